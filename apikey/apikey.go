@@ -0,0 +1,20 @@
+// Package apikey matches API keys sent by clients against the configured ones, for the REST and
+// gRPC APIs alike.
+package apikey
+
+import "crypto/subtle"
+
+// Contains reports whether key is one of keys. Keys are compared in constant time so that
+// response timing doesn't reveal how much of a configured key was guessed.
+func Contains(keys []string, key string) bool {
+	if key == "" {
+		return false
+	}
+	found := false
+	for _, candidate := range keys {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			found = true
+		}
+	}
+	return found
+}
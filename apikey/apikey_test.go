@@ -0,0 +1,18 @@
+package apikey
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContains(t *testing.T) {
+	keys := []string{"first", "second"}
+
+	assert.True(t, Contains(keys, "first"))
+	assert.True(t, Contains(keys, "second"))
+	assert.False(t, Contains(keys, "third"))
+	assert.False(t, Contains(keys, "firs"), "Prefixes of a key should not match")
+	assert.False(t, Contains(keys, ""), "An empty key should never match")
+	assert.False(t, Contains([]string{""}, ""), "An empty configured key should never match")
+}
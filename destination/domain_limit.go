@@ -0,0 +1,99 @@
+package destination
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+	"golang.org/x/time/rate"
+)
+
+// pruneDomainsPerInsert caps how many tracked domains domainLimiter inspects when it starts
+// tracking a new one, so inserts stay cheap however many domains are tracked.
+const pruneDomainsPerInsert = 8
+
+// domainLimiter limits how many short URLs may be created per destination registered domain.
+// Each domain may create a burst of limit URLs, refilled evenly over period.
+type domainLimiter struct {
+	limit  int
+	period time.Duration
+
+	mu      sync.Mutex
+	domains map[string]*domain
+}
+
+// domain is the create quota of one registered domain.
+type domain struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newDomainLimiter creates a domainLimiter allowing limit creates per domain every period.
+func newDomainLimiter(limit int, period time.Duration) *domainLimiter {
+	return &domainLimiter{
+		limit:   limit,
+		period:  period,
+		domains: make(map[string]*domain),
+	}
+}
+
+// Allow reports whether another short URL may be created for rawURL, consuming one token of its
+// registered domain if so. URLs without a host are always allowed, as validation rejects them.
+func (l *domainLimiter) Allow(rawURL string, now time.Time) bool {
+	registered := registeredDomain(rawURL)
+	if registered == "" {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	d, found := l.domains[registered]
+	if !found {
+		l.prune(now)
+		d = &domain{limiter: rate.NewLimiter(rate.Every(l.period/time.Duration(l.limit)), l.limit)}
+		l.domains[registered] = d
+	}
+	d.lastSeen = now
+	return d.limiter.AllowN(now, 1)
+}
+
+// prune drops a few domains not seen for a whole period. Their buckets are full again by then,
+// so forgetting them doesn't change what Allow answers. The caller must hold l.mu.
+func (l *domainLimiter) prune(now time.Time) {
+	inspected := 0
+	for registered, d := range l.domains {
+		if inspected == pruneDomainsPerInsert {
+			break
+		}
+		inspected++
+		if now.Sub(d.lastSeen) > l.period {
+			delete(l.domains, registered)
+		}
+	}
+}
+
+// registeredDomain returns the registered domain (eTLD+1) of the host of rawURL, e.g. "example.co.uk"
+// for "https://www.example.co.uk/path". Hosts without one, such as IP addresses, localhost or a bare
+// public suffix, are returned as is. It returns an empty string when rawURL has no host.
+func registeredDomain(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	if host == "" {
+		return ""
+	}
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	registered, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return registered
+}
@@ -0,0 +1,47 @@
+package destination
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisteredDomain(t *testing.T) {
+	tests := []struct {
+		rawURL   string
+		expected string
+	}{
+		{rawURL: "https://example.com/path", expected: "example.com"},
+		{rawURL: "https://www.Example.com:8443/path", expected: "example.com"},
+		{rawURL: "https://a.b.example.co.uk", expected: "example.co.uk"},
+		{rawURL: "https://example.com./path", expected: "example.com"},
+		{rawURL: "http://192.0.2.1/path", expected: "192.0.2.1"},
+		{rawURL: "http://[2001:db8::1]/path", expected: "2001:db8::1"},
+		{rawURL: "http://localhost:8080", expected: "localhost"},
+		{rawURL: "https://co.uk", expected: "co.uk"},
+		{rawURL: "mailto:someone", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rawURL, func(t *testing.T) {
+			assert.Equal(t, tt.expected, registeredDomain(tt.rawURL))
+		})
+	}
+}
+
+func TestDomainLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := newDomainLimiter(2, time.Minute)
+
+	assert.True(t, limiter.Allow("https://example.com/a", now))
+	assert.True(t, limiter.Allow("https://www.example.com/b", now))
+	assert.False(t, limiter.Allow("https://blog.example.com/c", now), "Subdomains share the registered domain quota")
+	assert.True(t, limiter.Allow("https://example.org", now), "Other domains have their own quota")
+
+	assert.True(t, limiter.Allow("https://example.com/d", now.Add(30*time.Second)), "The quota refills over the period")
+
+	later := now.Add(2 * time.Minute)
+	limiter.Allow("https://new.example.net", later)
+	assert.NotContains(t, limiter.domains, "example.org", "Domains idle for a whole period are pruned")
+}
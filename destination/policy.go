@@ -0,0 +1,179 @@
+// Package destination decides which destinations may be shortened. The same Policy is applied by
+// the REST and gRPC APIs, so that both enforce the destination options of the configuration alike.
+package destination
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"go-url-shortening/config"
+	"go-url-shortening/services"
+	"go-url-shortening/urlutil"
+)
+
+// defaultAllowedSchemes are the destination schemes accepted when config.AllowedSchemes is empty.
+var defaultAllowedSchemes = []string{"http", "https"}
+
+// Errors returned by Policy, one per rule a destination can break.
+var (
+	ErrUnsupportedScheme    = errors.New("unsupported URL scheme")
+	ErrInternalDestination  = errors.New("URL points to an internal address")
+	ErrDuplicateQueryParams = errors.New("URL has duplicate query parameters")
+	ErrDomainBlocked        = errors.New("domain not allowed")
+	ErrPrivateDestination   = errors.New("URL resolves to a private address")
+	ErrSelfShortLink        = errors.New("URL is a short link of this service")
+	ErrDomainRateLimited    = errors.New("rate limit exceeded for destination domain")
+)
+
+// Policy applies the destination policies enabled by the configuration. It is safe for concurrent
+// use, and one Policy should be shared by every API so that they count creates against the same
+// per-domain limit.
+type Policy struct {
+	config  *config.Config
+	service services.URLService
+
+	// limiter limits creates per destination domain, nil unless config.DomainCreateLimit is set
+	limiter *domainLimiter
+	// lookupIP resolves destination hosts for config.BlockPrivateRedirects
+	lookupIP func(ctx context.Context, host string) ([]netip.Addr, error)
+}
+
+// Option configures optional behaviour of a Policy.
+type Option func(*Policy)
+
+// WithLookupIP resolves destination hosts with lookup instead of the default resolver.
+func WithLookupIP(lookup func(ctx context.Context, host string) ([]netip.Addr, error)) Option {
+	return func(p *Policy) {
+		p.lookupIP = lookup
+	}
+}
+
+// NewPolicy returns the destination policy configured by cfg. service is used to tell whether a
+// destination on our own host is an existing short URL.
+func NewPolicy(cfg *config.Config, service services.URLService, opts ...Option) *Policy {
+	p := &Policy{
+		config:  cfg,
+		service: service,
+		lookupIP: func(ctx context.Context, host string) ([]netip.Addr, error) {
+			return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		},
+	}
+	if cfg.DomainCreateLimit > 0 {
+		p.limiter = newDomainLimiter(cfg.DomainCreateLimit, cfg.DomainCreatePeriod)
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Check returns the error of the first policy rawURL breaks, and nil if it breaks none:
+//   - config.AllowedSchemes, http and https by default, rejects every other scheme, so that links
+//     can't run script through javascript: or data: URLs, or send clients to ftp: and the like.
+//   - config.RejectInternalDestinations rejects localhost and internal IP literals in any notation
+//     urlutil.HostIP accepts, e.g. http://[0:0:0:0:0:0:0:1]/ as well as http://[::1]/.
+//   - config.RejectDuplicateQueryParams rejects query strings repeating a key, e.g. ?a=1&a=2,
+//     which servers resolve differently and can be used to smuggle parameters.
+//   - config.BlockedDomains rejects hosts under one of the listed domains.
+//   - config.BlockPrivateRedirects rejects hosts resolving to a private address.
+//
+// rawURL must already be validated as a URL.
+func (p *Policy) Check(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	if !p.allowedScheme(parsed.Scheme) {
+		return ErrUnsupportedScheme
+	}
+	if p.config.RejectInternalDestinations && urlutil.IsInternalHost(parsed) {
+		return ErrInternalDestination
+	}
+	if p.config.RejectDuplicateQueryParams && urlutil.HasDuplicateQueryKeys(parsed) {
+		return ErrDuplicateQueryParams
+	}
+	if p.blockedDomain(parsed) {
+		return ErrDomainBlocked
+	}
+	if p.ResolvesToPrivate(ctx, rawURL) {
+		return ErrPrivateDestination
+	}
+	return nil
+}
+
+// CheckSelfLink returns ErrSelfShortLink when config.RejectSelfShortLinks is set and rawURL is one
+// of our own short links, host being the host the request was sent to.
+func (p *Policy) CheckSelfLink(ctx context.Context, host, rawURL string) error {
+	if p.config.RejectSelfShortLinks && p.isSelfShortLink(ctx, host, rawURL) {
+		return ErrSelfShortLink
+	}
+	return nil
+}
+
+// AllowCreate returns ErrDomainRateLimited when config.DomainCreateLimit is set and the registered
+// domain of rawURL has used up its creates, and consumes one of them otherwise.
+func (p *Policy) AllowCreate(rawURL string) error {
+	if p.limiter != nil && !p.limiter.Allow(rawURL, time.Now()) {
+		return ErrDomainRateLimited
+	}
+	return nil
+}
+
+// allowedScheme reports whether scheme is one of config.AllowedSchemes, ignoring case.
+func (p *Policy) allowedScheme(scheme string) bool {
+	allowed := p.config.AllowedSchemes
+	if len(allowed) == 0 {
+		allowed = defaultAllowedSchemes
+	}
+	return slices.ContainsFunc(allowed, func(s string) bool { return strings.EqualFold(s, scheme) })
+}
+
+// blockedDomain reports whether the host of destination is under one of config.BlockedDomains.
+func (p *Policy) blockedDomain(destination *url.URL) bool {
+	if len(p.config.BlockedDomains) == 0 {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(destination.Hostname()), ".")
+	return slices.ContainsFunc(p.config.BlockedDomains, func(domain string) bool { return domainMatches(host, domain) })
+}
+
+// domainMatches reports whether host is domain or one of its subdomains, or only one of its
+// subdomains for a wildcard domain such as *.evil.com. host must be lower case.
+func domainMatches(host, domain string) bool {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if parent, wildcard := strings.CutPrefix(domain, "*."); wildcard {
+		return strings.HasSuffix(host, "."+parent)
+	}
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// ResolvesToPrivate reports whether config.BlockPrivateRedirects is set and the host of rawURL is
+// localhost, an internal IP literal, or a name that resolves to at least one internal address, as
+// classified by urlutil.IsInternalAddr. A host that fails to resolve is let through: it can't be
+// reached by anyone following the redirect either.
+func (p *Policy) ResolvesToPrivate(ctx context.Context, rawURL string) bool {
+	if !p.config.BlockPrivateRedirects {
+		return false
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	if urlutil.IsInternalHost(parsed) {
+		return true
+	}
+	if _, ok := urlutil.HostIP(parsed); ok || parsed.Hostname() == "" {
+		return false
+	}
+	addrs, err := p.lookupIP(ctx, parsed.Hostname())
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(addrs, urlutil.IsInternalAddr)
+}
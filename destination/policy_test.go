@@ -0,0 +1,89 @@
+package destination
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go-url-shortening/config"
+	"go-url-shortening/services"
+	"go-url-shortening/services/mocks"
+	"go-url-shortening/types"
+)
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{
+		RejectInternalDestinations: true,
+		RejectDuplicateQueryParams: true,
+		BlockedDomains:             []string{"evil.com", "*.wild.org"},
+		BlockPrivateRedirects:      true,
+	}
+	policy := NewPolicy(cfg, nil, WithLookupIP(func(_ context.Context, host string) ([]netip.Addr, error) {
+		if host == "redis.internal" {
+			return []netip.Addr{netip.MustParseAddr("10.0.0.5")}, nil
+		}
+		return nil, errors.New("no such host")
+	}))
+
+	tests := []struct {
+		url      string
+		expected error
+	}{
+		{url: "https://example.com/", expected: nil},
+		{url: "HTTPS://example.com/", expected: nil},
+		{url: "javascript:alert(1)", expected: ErrUnsupportedScheme},
+		{url: "http://[::1]/", expected: ErrInternalDestination},
+		{url: "https://example.com/?a=1&a=2", expected: ErrDuplicateQueryParams},
+		{url: "https://evil.com/", expected: ErrDomainBlocked},
+		{url: "https://login.EVIL.com./", expected: ErrDomainBlocked},
+		{url: "https://notevil.com/", expected: nil},
+		{url: "https://wild.org/", expected: nil},
+		{url: "https://a.wild.org/", expected: ErrDomainBlocked},
+		{url: "http://redis.internal:6379/", expected: ErrPrivateDestination},
+		{url: "https://unknown.example/", expected: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			assert.Equal(t, tt.expected, policy.Check(ctx, tt.url))
+		})
+	}
+
+	t.Run("Allowed schemes", func(t *testing.T) {
+		policy := NewPolicy(&config.Config{AllowedSchemes: []string{"https", "mailto"}}, nil)
+		assert.NoError(t, policy.Check(ctx, "mailto:someone@example.com"))
+		assert.Equal(t, ErrUnsupportedScheme, policy.Check(ctx, "http://example.com/"))
+	})
+}
+
+func TestCheckSelfLink(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{RejectSelfShortLinks: true, BaseURL: "https://sho.rt/s"}
+	mockService := new(mocks.MockURLService)
+	mockService.On("GetURLData", mock.Anything, "custom-alias!").Return(types.URLData{}, nil)
+	mockService.On("GetURLData", mock.Anything, mock.Anything).Return(types.URLData{}, services.ErrShortURLNotFound)
+	policy := NewPolicy(cfg, mockService)
+
+	assert.Equal(t, ErrSelfShortLink, policy.CheckSelfLink(ctx, "api.example.com", "https://sho.rt/s/abc123"))
+	assert.Equal(t, ErrSelfShortLink, policy.CheckSelfLink(ctx, "api.example.com", "https://sho.rt/s/custom-alias!"), "Existing short URLs should be recognized")
+	assert.NoError(t, policy.CheckSelfLink(ctx, "api.example.com", "https://sho.rt/s/not*a*code"))
+	assert.NoError(t, policy.CheckSelfLink(ctx, "api.example.com", "https://sho.rt/s/abc/def"))
+	assert.Equal(t, ErrSelfShortLink, policy.CheckSelfLink(ctx, "api.example.com", "https://api.example.com/abc123"), "The request host should count as ours")
+	assert.NoError(t, policy.CheckSelfLink(ctx, "api.example.com", "https://example.org/abc123"))
+
+	cfg = &config.Config{BaseURL: "https://sho.rt/s"}
+	assert.NoError(t, NewPolicy(cfg, mockService).CheckSelfLink(ctx, "", "https://sho.rt/s/abc123"), "Self links should be allowed unless rejected")
+}
+
+func TestAllowCreate(t *testing.T) {
+	assert.NoError(t, NewPolicy(&config.Config{}, nil).AllowCreate("https://example.com/"), "Creates should be unlimited by default")
+
+	policy := NewPolicy(&config.Config{DomainCreateLimit: 1, DomainCreatePeriod: time.Hour}, nil)
+	assert.NoError(t, policy.AllowCreate("https://example.com/a"))
+	assert.Equal(t, ErrDomainRateLimited, policy.AllowCreate("https://www.example.com/b"))
+	assert.NoError(t, policy.AllowCreate("https://example.org/"))
+}
@@ -0,0 +1,82 @@
+package destination
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"go-url-shortening/services"
+	"go-url-shortening/urlgen"
+)
+
+// isSelfShortLink reports whether rawURL is one of our own short links: a single path segment,
+// under config.BaseURL or on host, the host the request was sent to, that is a syntactically valid
+// short code or an existing short URL. Shortening it again would only create a link to a link, or
+// a loop.
+func (p *Policy) isSelfShortLink(ctx context.Context, host, rawURL string) bool {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	code, found := p.ownShortCode(host, parsed)
+	if !found {
+		return false
+	}
+	if p.validShortCode(code) {
+		return true
+	}
+	_, err = p.service.GetURLData(ctx, code)
+	return err == nil || errors.Is(err, services.ErrShortURLExpired)
+}
+
+// ownShortCode returns the path segment a short code would occupy in destination, and false if
+// destination isn't on our own host or has more or less than one path segment.
+func (p *Policy) ownShortCode(host string, destination *url.URL) (string, bool) {
+	path, found := p.pathUnderBaseURL(destination)
+	if !found {
+		if !strings.EqualFold(destination.Host, host) {
+			return "", false
+		}
+		path = strings.TrimPrefix(destination.Path, "/")
+	}
+	if path == "" || strings.Contains(path, "/") {
+		return "", false
+	}
+	return path, true
+}
+
+// pathUnderBaseURL returns the path of destination relative to config.BaseURL, and false if
+// no BaseURL is configured or destination isn't below it.
+func (p *Policy) pathUnderBaseURL(destination *url.URL) (string, bool) {
+	if p.config.BaseURL == "" {
+		return "", false
+	}
+	base, err := url.Parse(p.config.BaseURL)
+	if err != nil || !strings.EqualFold(destination.Host, base.Host) {
+		return "", false
+	}
+	prefix := strings.TrimSuffix(base.Path, "/") + "/"
+	if !strings.HasPrefix(destination.Path, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(destination.Path, prefix), true
+}
+
+// validShortCode reports whether code could be a generated short URL or an alias: at most
+// services.MaxAliasLength characters, all from the configured short URL charset.
+func (p *Policy) validShortCode(code string) bool {
+	charset := p.config.ShortURLCharset
+	if charset == "" {
+		charset = urlgen.DefaultCharset
+	}
+	if len(code) > services.MaxAliasLength {
+		return false
+	}
+	for _, char := range code {
+		if !strings.ContainsRune(charset, char) {
+			return false
+		}
+	}
+	return true
+}
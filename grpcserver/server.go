@@ -0,0 +1,271 @@
+// Package grpcserver serves the short URL operations of the REST API over gRPC, backed by the same
+// services.URLService.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"go-url-shortening/apikey"
+	"go-url-shortening/config"
+	"go-url-shortening/destination"
+	"go-url-shortening/services"
+	"go-url-shortening/shortenerpb"
+	"go-url-shortening/types"
+	"go-url-shortening/urlutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// writeMethods are the methods that require an API key when config.APIKeys is set, like the
+// write routes of the REST API.
+var writeMethods = []string{
+	shortenerpb.URLShortener_CreateShortURL_FullMethodName,
+	shortenerpb.URLShortener_UpdateURL_FullMethodName,
+	shortenerpb.URLShortener_DeleteURL_FullMethodName,
+}
+
+// Server implements shortenerpb.URLShortenerServer on top of a services.URLService.
+type Server struct {
+	shortenerpb.UnimplementedURLShortenerServer
+
+	service  services.URLService
+	policy   *destination.Policy
+	config   *config.Config
+	validate *validator.Validate
+}
+
+// NewServer returns a gRPC server with the URLShortener service backed by svc registered, applying
+// policy to the destinations submitted. Every call is bounded by cfg.RequestTimeout, and writes
+// require one of cfg.APIKeys, if any. When cfg.OTLPEndpoint is set, a span is recorded per call.
+func NewServer(cfg *config.Config, svc services.URLService, policy *destination.Policy) *grpc.Server {
+	var interceptors []grpc.UnaryServerInterceptor
+	if cfg.OTLPEndpoint != "" {
+		interceptors = append(interceptors, tracingInterceptor())
+	}
+	interceptors = append(interceptors, timeoutInterceptor(cfg.RequestTimeout), apiKeyInterceptor(cfg.APIKeys))
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors...))
+	shortenerpb.RegisterURLShortenerServer(srv, &Server{service: svc, policy: policy, config: cfg, validate: validator.New()})
+	return srv
+}
+
+// Serve listens on cfg.GRPCPort and serves the URLShortener service backed by svc and policy until
+// ctx is done, then stops gracefully, letting calls in progress complete.
+func Serve(ctx context.Context, cfg *config.Config, svc services.URLService, policy *destination.Policy) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.GRPCPort))
+	if err != nil {
+		return err
+	}
+	return serve(ctx, NewServer(cfg, svc, policy), lis)
+}
+
+// serve runs srv on lis until ctx is done or srv fails.
+func serve(ctx context.Context, srv *grpc.Server, lis net.Listener) error {
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- srv.Serve(lis)
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+		srv.GracefulStop()
+		return <-errChan
+	}
+}
+
+// CreateShortURL shortens req.Url, returning the existing short URL with Created false when the
+// URL is already shortened.
+func (s *Server) CreateShortURL(ctx context.Context, req *shortenerpb.CreateShortURLRequest) (*shortenerpb.CreateShortURLResponse, error) {
+	rawURL, err := s.checkDestination(ctx, req.GetUrl())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validate.Struct(types.URLRequest{URL: rawURL, Tags: req.GetTags()}); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid tags provided")
+	}
+	if len(req.GetTags()) > 0 && !s.config.EnableTags {
+		return nil, status.Error(codes.InvalidArgument, "tags are not enabled")
+	}
+	if req.GetAlias() != "" && len(s.config.AliasAPIKeys) > 0 && !apikey.Contains(s.config.AliasAPIKeys, callAPIKey(ctx)) {
+		return nil, status.Error(codes.PermissionDenied, "API key is not allowed to use aliases")
+	}
+
+	opts := services.CreateOptions{Tags: req.GetTags(), Alias: req.GetAlias()}
+	if req.GetTtl() != nil {
+		opts.TTL = req.GetTtl().AsDuration()
+		if err := req.GetTtl().CheckValid(); err != nil || opts.TTL <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "invalid TTL provided")
+		}
+	}
+	if err := s.policy.AllowCreate(rawURL); err != nil {
+		return nil, destinationStatus(err)
+	}
+
+	urlData, err := s.service.CreateShortURL(ctx, rawURL, opts)
+	if errors.Is(err, services.ErrShortURLExists) && !errors.Is(err, services.ErrAliasTaken) && urlData.ShortURL != "" {
+		// The URL is already shortened, so its short URL is returned as by the REST API
+		return &shortenerpb.CreateShortURLResponse{Url: newShortURL(urlData), Created: false}, nil
+	}
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &shortenerpb.CreateShortURLResponse{Url: newShortURL(urlData), Created: true}, nil
+}
+
+// GetURLData returns the data of req.ShortUrl.
+func (s *Server) GetURLData(ctx context.Context, req *shortenerpb.GetURLDataRequest) (*shortenerpb.ShortURL, error) {
+	urlData, err := s.service.GetURLData(ctx, req.GetShortUrl())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return newShortURL(urlData), nil
+}
+
+// UpdateURL points req.ShortUrl to req.Url.
+func (s *Server) UpdateURL(ctx context.Context, req *shortenerpb.UpdateURLRequest) (*shortenerpb.ShortURL, error) {
+	rawURL, err := s.checkDestination(ctx, req.GetUrl())
+	if err != nil {
+		return nil, err
+	}
+	urlData, err := s.service.UpdateURL(ctx, req.GetShortUrl(), rawURL)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return newShortURL(urlData), nil
+}
+
+// DeleteURL deletes req.ShortUrl.
+func (s *Server) DeleteURL(ctx context.Context, req *shortenerpb.DeleteURLRequest) (*shortenerpb.DeleteURLResponse, error) {
+	if err := s.service.DeleteURL(ctx, req.GetShortUrl()); err != nil {
+		return nil, statusError(err)
+	}
+	return &shortenerpb.DeleteURLResponse{}, nil
+}
+
+// checkDestination normalizes rawURL as the REST API does and returns it, or an InvalidArgument
+// error when it is too long or not a valid URL, or the status of the destination policy it breaks.
+func (s *Server) checkDestination(ctx context.Context, rawURL string) (string, error) {
+	if s.config.DefaultScheme != "" && rawURL != "" {
+		rawURL = urlutil.NormalizeURL(rawURL, s.config.DefaultScheme)
+	}
+	if s.config.MaxURLLength > 0 && len(rawURL) > s.config.MaxURLLength {
+		return "", status.Error(codes.InvalidArgument, "URL too long")
+	}
+	if err := s.validate.Var(rawURL, "required,url"); err != nil {
+		return "", status.Error(codes.InvalidArgument, "invalid URL provided")
+	}
+	err := s.policy.Check(ctx, rawURL)
+	if err == nil {
+		err = s.policy.CheckSelfLink(ctx, callAuthority(ctx), rawURL)
+	}
+	if err != nil {
+		return "", destinationStatus(err)
+	}
+	return rawURL, nil
+}
+
+// destinationStatus maps an error of destination.Policy to the gRPC status of the same meaning as
+// the HTTP status the REST API answers with.
+func destinationStatus(err error) error {
+	code := codes.InvalidArgument
+	switch {
+	case errors.Is(err, destination.ErrDomainBlocked), errors.Is(err, destination.ErrPrivateDestination):
+		code = codes.PermissionDenied
+	case errors.Is(err, destination.ErrDomainRateLimited):
+		code = codes.ResourceExhausted
+	}
+	return status.Error(code, err.Error())
+}
+
+// newShortURL converts stored URLData into its gRPC representation.
+func newShortURL(urlData types.URLData) *shortenerpb.ShortURL {
+	shortURL := &shortenerpb.ShortURL{
+		ShortUrl:    urlData.ShortURL,
+		OriginalUrl: urlData.OriginalURL,
+		CreatedAt:   timestamppb.New(urlData.CreatedAt),
+		UpdatedAt:   timestamppb.New(urlData.UpdatedAt),
+		Tags:        urlData.Tags,
+	}
+	if !urlData.ExpiresAt.IsZero() {
+		shortURL.ExpiresAt = timestamppb.New(urlData.ExpiresAt)
+	}
+	return shortURL
+}
+
+// statusError maps an error of the URL service to the gRPC status of the same meaning. Unexpected
+// errors are reported as Internal without their details.
+func statusError(err error) error {
+	var code codes.Code
+	switch {
+	case errors.Is(err, services.ErrShortURLNotFound), errors.Is(err, services.ErrShortURLExpired):
+		code = codes.NotFound
+	case errors.Is(err, services.ErrShortURLExists), errors.Is(err, services.ErrExternalIDExists):
+		code = codes.AlreadyExists
+	case errors.Is(err, services.ErrStorageCapacityReached):
+		code = codes.ResourceExhausted
+	case errors.Is(err, services.ErrInvalidAlias):
+		code = codes.InvalidArgument
+	case errors.Is(err, context.DeadlineExceeded):
+		code = codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		code = codes.Canceled
+	default:
+		return status.Error(codes.Internal, "internal server error")
+	}
+	return status.Error(code, err.Error())
+}
+
+// timeoutInterceptor bounds every call by timeout, like the request timeout of the REST API.
+func timeoutInterceptor(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
+
+// apiKeyInterceptor rejects write calls without one of keys with Unauthenticated. Every call is
+// let through when keys is empty.
+func apiKeyInterceptor(keys []string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if len(keys) > 0 && slices.Contains(writeMethods, info.FullMethod) && !apikey.Contains(keys, callAPIKey(ctx)) {
+			return nil, status.Error(codes.Unauthenticated, "missing or invalid API key")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// callAuthority returns the host the call of ctx was sent to, from its :authority pseudo-header.
+func callAuthority(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if authority := md.Get(":authority"); len(authority) > 0 {
+		return authority[0]
+	}
+	return ""
+}
+
+// callAPIKey returns the API key sent with the call of ctx, read from the x-api-key metadata or
+// from "authorization: Bearer <key>", or an empty string when the call carries none.
+func callAPIKey(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if keys := md.Get("x-api-key"); len(keys) > 0 && keys[0] != "" {
+		return keys[0]
+	}
+	for _, value := range md.Get("authorization") {
+		if token, ok := strings.CutPrefix(value, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	return ""
+}
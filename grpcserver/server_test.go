@@ -0,0 +1,189 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-url-shortening/config"
+	"go-url-shortening/destination"
+	"go-url-shortening/services"
+	"go-url-shortening/shortenerpb"
+	"go-url-shortening/storage"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// newTestClient serves the URLShortener service backed by svc and the destination policy of cfg
+// over an in-memory listener until the test ends, and returns a client connected to it.
+func newTestClient(t *testing.T, cfg *config.Config, svc services.URLService, opts ...destination.Option) shortenerpb.URLShortenerClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, NewServer(cfg, svc, destination.NewPolicy(cfg, svc, opts...)), lis)
+	}()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+		cancel()
+		assert.NoError(t, <-done, "The server should stop gracefully")
+	})
+	return shortenerpb.NewURLShortenerClient(conn)
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.DefaultConfig()
+	client := newTestClient(t, cfg, services.NewURLService(storage.NewInMemoryStorage(3, zap.NewNop())))
+
+	created, err := client.CreateShortURL(ctx, &shortenerpb.CreateShortURLRequest{Url: "https://example.com", Ttl: durationpb.New(time.Hour)})
+	require.NoError(t, err)
+	assert.True(t, created.GetCreated())
+	shortURL := created.GetUrl().GetShortUrl()
+	assert.NotEmpty(t, shortURL)
+	assert.Equal(t, "https://example.com", created.GetUrl().GetOriginalUrl())
+	assert.NotNil(t, created.GetUrl().GetExpiresAt(), "The TTL should make the short URL expire")
+
+	t.Run("Creating a shortened URL returns it", func(t *testing.T) {
+		existing, err := client.CreateShortURL(ctx, &shortenerpb.CreateShortURLRequest{Url: "https://example.com"})
+		require.NoError(t, err)
+		assert.False(t, existing.GetCreated())
+		assert.Equal(t, shortURL, existing.GetUrl().GetShortUrl())
+	})
+
+	t.Run("GetURLData", func(t *testing.T) {
+		urlData, err := client.GetURLData(ctx, &shortenerpb.GetURLDataRequest{ShortUrl: shortURL})
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com", urlData.GetOriginalUrl())
+		assert.False(t, urlData.GetCreatedAt().AsTime().IsZero())
+	})
+
+	t.Run("UpdateURL", func(t *testing.T) {
+		updated, err := client.UpdateURL(ctx, &shortenerpb.UpdateURLRequest{ShortUrl: shortURL, Url: "https://example.org"})
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.org", updated.GetOriginalUrl())
+	})
+
+	t.Run("Taken alias", func(t *testing.T) {
+		_, err := client.CreateShortURL(ctx, &shortenerpb.CreateShortURLRequest{Url: "https://example.net", Alias: "docs"})
+		require.NoError(t, err)
+
+		_, err = client.CreateShortURL(ctx, &shortenerpb.CreateShortURLRequest{Url: "https://example.io", Alias: "docs"})
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	})
+
+	t.Run("Full storage", func(t *testing.T) {
+		_, err := client.CreateShortURL(ctx, &shortenerpb.CreateShortURLRequest{Url: "https://example.dev"})
+		require.NoError(t, err)
+
+		_, err = client.CreateShortURL(ctx, &shortenerpb.CreateShortURLRequest{Url: "https://example.io"})
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	})
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		_, err := client.CreateShortURL(ctx, &shortenerpb.CreateShortURLRequest{Url: "not a url"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = client.CreateShortURL(ctx, &shortenerpb.CreateShortURLRequest{Url: "javascript:alert(1)"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = client.CreateShortURL(ctx, &shortenerpb.CreateShortURLRequest{Url: "https://example.io", Ttl: durationpb.New(-time.Hour)})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		_, err = client.CreateShortURL(ctx, &shortenerpb.CreateShortURLRequest{Url: "https://example.io", Tags: []string{"docs"}})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), "Tags should be rejected unless enabled")
+		_, err = client.UpdateURL(ctx, &shortenerpb.UpdateURLRequest{ShortUrl: shortURL, Url: "ftp://example.org"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	})
+
+	t.Run("DeleteURL", func(t *testing.T) {
+		_, err := client.DeleteURL(ctx, &shortenerpb.DeleteURLRequest{ShortUrl: shortURL})
+		require.NoError(t, err)
+
+		_, err = client.GetURLData(ctx, &shortenerpb.GetURLDataRequest{ShortUrl: shortURL})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+		_, err = client.DeleteURL(ctx, &shortenerpb.DeleteURLRequest{ShortUrl: shortURL})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
+
+func TestServerAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.DefaultConfig()
+	cfg.APIKeys = []string{"secret"}
+	client := newTestClient(t, cfg, services.NewURLService(storage.NewInMemoryStorage(10, zap.NewNop())))
+
+	_, err := client.CreateShortURL(ctx, &shortenerpb.CreateShortURLRequest{Url: "https://example.com"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "Writes should require an API key")
+	_, err = client.CreateShortURL(metadata.AppendToOutgoingContext(ctx, "x-api-key", "wrong"),
+		&shortenerpb.CreateShortURLRequest{Url: "https://example.com"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	created, err := client.CreateShortURL(metadata.AppendToOutgoingContext(ctx, "x-api-key", "secret"),
+		&shortenerpb.CreateShortURLRequest{Url: "https://example.com"})
+	require.NoError(t, err)
+	_, err = client.DeleteURL(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret"),
+		&shortenerpb.DeleteURLRequest{ShortUrl: "missing"})
+	assert.Equal(t, codes.NotFound, status.Code(err), "Bearer tokens should be accepted too")
+
+	_, err = client.GetURLData(ctx, &shortenerpb.GetURLDataRequest{ShortUrl: created.GetUrl().GetShortUrl()})
+	assert.NoError(t, err, "Reads should stay public")
+}
+
+func TestServerDestinationPolicy(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.DefaultConfig()
+	cfg.BlockedDomains = []string{"evil.com"}
+	cfg.BlockPrivateRedirects = true
+	cfg.RejectSelfShortLinks = true
+	cfg.BaseURL = "https://sho.rt"
+	cfg.DomainCreateLimit = 1
+	cfg.DomainCreatePeriod = time.Hour
+	lookupIP := destination.WithLookupIP(func(_ context.Context, host string) ([]netip.Addr, error) {
+		if host == "redis.internal" {
+			return []netip.Addr{netip.MustParseAddr("10.0.0.5")}, nil
+		}
+		return nil, errors.New("no such host")
+	})
+	client := newTestClient(t, cfg, services.NewURLService(storage.NewInMemoryStorage(10, zap.NewNop())), lookupIP)
+
+	tests := []struct {
+		name string
+		url  string
+		code codes.Code
+	}{
+		{name: "Blocked domain", url: "https://www.evil.com/login", code: codes.PermissionDenied},
+		{name: "Private address literal", url: "http://127.0.0.1:6379/", code: codes.PermissionDenied},
+		{name: "Name resolving to a private address", url: "http://redis.internal/", code: codes.PermissionDenied},
+		{name: "Own short link", url: "https://sho.rt/abc123", code: codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.CreateShortURL(ctx, &shortenerpb.CreateShortURLRequest{Url: tt.url})
+			assert.Equal(t, tt.code, status.Code(err))
+			_, err = client.UpdateURL(ctx, &shortenerpb.UpdateURLRequest{ShortUrl: "abc123", Url: tt.url})
+			assert.Equal(t, tt.code, status.Code(err), "Updates should apply the same policy")
+		})
+	}
+
+	t.Run("Domain create limit", func(t *testing.T) {
+		_, err := client.CreateShortURL(ctx, &shortenerpb.CreateShortURLRequest{Url: "https://example.com/a"})
+		require.NoError(t, err)
+		_, err = client.CreateShortURL(ctx, &shortenerpb.CreateShortURLRequest{Url: "https://www.example.com/b"})
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	})
+}
@@ -0,0 +1,70 @@
+package grpcserver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-url-shortening/config"
+	"go-url-shortening/services"
+	"go-url-shortening/shortenerpb"
+	"go-url-shortening/storage"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	cfg := config.DefaultConfig()
+	cfg.OTLPEndpoint = "http://localhost:4318" // Only enables the instrumentation, the exporter above is used
+	svc := services.NewTracedURLService(services.NewURLService(storage.NewTracedStorage(storage.NewInMemoryStorage(10, zap.NewNop()))))
+	client := newTestClient(t, cfg, svc)
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "traceparent", traceparent)
+	created, err := client.CreateShortURL(ctx, &shortenerpb.CreateShortURLRequest{Url: "https://example.com"})
+	require.NoError(t, err)
+
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+	serverSpan, ok := spans["shortener.v1.URLShortener/CreateShortURL"]
+	require.True(t, ok, "A span should be recorded for the call")
+	assert.Equal(t, trace.SpanKindServer, serverSpan.SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", serverSpan.SpanContext.TraceID().String(), "The propagated trace should be continued")
+	assert.Equal(t, "00f067aa0ba902b7", serverSpan.Parent.SpanID().String())
+
+	serviceSpan := spans["URLService.CreateShortURL"]
+	assert.Equal(t, serverSpan.SpanContext.SpanID(), serviceSpan.Parent.SpanID())
+	assert.Contains(t, serviceSpan.Attributes, attribute.String("short_url", created.GetUrl().GetShortUrl()))
+	assert.Equal(t, serviceSpan.SpanContext.SpanID(), spans["Storage.GetOrCreate"].Parent.SpanID())
+}
+
+func TestTracingDisabled(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	client := newTestClient(t, config.DefaultConfig(), services.NewURLService(storage.NewInMemoryStorage(10, zap.NewNop())))
+	_, err := client.CreateShortURL(context.Background(), &shortenerpb.CreateShortURLRequest{Url: "https://example.com"})
+	require.NoError(t, err)
+
+	assert.Empty(t, exporter.GetSpans(), "No span should be recorded without an OTLP endpoint")
+}
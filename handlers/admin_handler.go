@@ -0,0 +1,141 @@
+// Package handlers provides HTTP request handlers for the URL shortener service.
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go-url-shortening/types"
+	"go.uber.org/zap"
+)
+
+// RuntimeStats handles the admin runtime diagnostics endpoint.
+// It reports the number of goroutines, the allocated heap and the number of clients
+// tracked by the rate limiters, which helps diagnose goroutine and memory leaks, along with
+// the usage of the storage when the backend reports it.
+func (h *URLHandler) RuntimeStats(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.config.RequestTimeout)
+	defer cancel()
+
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	response := types.RuntimeStatsResponse{
+		Goroutines:       runtime.NumGoroutine(),
+		HeapAllocBytes:   memStats.HeapAlloc,
+		RateLimitClients: h.rateLimitClients.Load(),
+	}
+	if stats, err := h.service.StorageStats(ctx); err == nil {
+		response.Storage = &stats
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// EffectiveConfig handles the admin configuration endpoint. It reports the configuration the
+// instance is running with, with secrets redacted, so operators can confirm what was loaded.
+func (h *URLHandler) EffectiveConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, h.config.Redacted())
+}
+
+// exportFlushInterval is the number of rows ExportCSV writes between flushes to the client.
+const exportFlushInterval = 500
+
+// exportCSVHeader is the header row of the CSV export, in column order.
+var exportCSVHeader = []string{"short_url", "original_url", "created_at", "updated_at", "clicks"}
+
+// ExportCSV handles the CSV export endpoints, served for backups and, when config.EnableAdmin is set,
+// among the admin routes. It streams every stored URL, in no particular order, as a CSV file that
+// can be opened in a spreadsheet, in a single pass over the storage, which reads a page at a time.
+// Expired and soft-deleted URLs are left out: the export has no column to mark them, so importing
+// it would bring them back to life. Rows are written as they are read, so an error before the first
+// row still gets an error response, while a later one truncates the export. The export runs under config.ExportTimeout rather than the request and write timeouts,
+// which a large dataset would outlast.
+func (h *URLHandler) ExportCSV(c *gin.Context) {
+	timeout := h.config.ExportTimeout
+	if timeout <= 0 {
+		timeout = h.config.RequestTimeout
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+		h.requestLogger(c).Debug("Failed to extend the write deadline of the CSV export", zap.Error(err))
+	}
+
+	w := csv.NewWriter(c.Writer)
+	written := 0
+	start := func() error {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="export.csv"`)
+		c.Status(http.StatusOK)
+		return w.Write(exportCSVHeader)
+	}
+	flush := func() error {
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	now := time.Now()
+	var writeErr error
+	err := h.service.ForEach(ctx, func(urlData types.URLData) error {
+		if urlData.Expired(now) || urlData.Deleted() {
+			return nil
+		}
+		if written == 0 {
+			if writeErr = start(); writeErr != nil {
+				return writeErr
+			}
+		}
+		if writeErr = w.Write(exportCSVRecord(urlData)); writeErr != nil {
+			return writeErr
+		}
+		if written++; written%exportFlushInterval == 0 {
+			writeErr = flush()
+		}
+		return writeErr
+	})
+	switch {
+	case writeErr != nil:
+		h.requestLogger(c).Error("Failed to write CSV export", zap.Error(writeErr))
+		return
+	case err != nil && written == 0:
+		h.handleError(c, err, map[error]string{
+			context.DeadlineExceeded: errorTimeout,
+			nil:                      errorListingURLs,
+		})
+		return
+	case err != nil:
+		// The status is already sent, so the truncated export is all the client gets
+		h.requestLogger(c).Error("Failed to list URLs for CSV export", zap.Int("written", written), zap.Error(err))
+		return
+	}
+
+	if written == 0 {
+		if err := start(); err != nil {
+			h.requestLogger(c).Error("Failed to write CSV export", zap.Error(err))
+			return
+		}
+	}
+	if err := flush(); err != nil {
+		h.requestLogger(c).Error("Failed to write CSV export", zap.Error(err))
+	}
+}
+
+// exportCSVRecord returns the CSV row of urlData, in the column order of exportCSVHeader.
+func exportCSVRecord(urlData types.URLData) []string {
+	return []string{
+		urlData.ShortURL,
+		urlData.OriginalURL,
+		urlData.CreatedAt.UTC().Format(time.RFC3339),
+		urlData.UpdatedAt.UTC().Format(time.RFC3339),
+		strconv.FormatInt(urlData.AccessCount, 10),
+	}
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go-url-shortening/services"
+	"go-url-shortening/services/mocks"
+	"go-url-shortening/types"
+	"go.uber.org/zap"
+)
+
+func TestRuntimeStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	handler.(*URLHandler).config.EnableAdmin = true
+	mockService := handler.(*URLHandler).service.(*mocks.MockURLService)
+	mockService.On("StorageStats", mock.Anything).Return(types.StorageStats{Count: 3, Capacity: 1000}, nil).Once()
+	mockService.On("StorageStats", mock.Anything).Return(types.StorageStats{}, services.ErrStatsUnsupported).Once()
+
+	router := gin.New()
+	RegisterRoutes(router, handler, handler.(*URLHandler).config, zap.NewNop())
+
+	// The admin route itself goes through the rate limiter, so at least one client is tracked
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/runtime", nil)
+	req.RemoteAddr = testIP
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stats types.RuntimeStatsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Positive(t, stats.Goroutines)
+	assert.Positive(t, stats.HeapAllocBytes)
+	assert.Equal(t, int64(1), stats.RateLimitClients)
+	assert.Equal(t, &types.StorageStats{Count: 3, Capacity: 1000}, stats.Storage)
+
+	// Backends that don't report their usage leave the field out
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), `"storage"`)
+}
+
+func TestRuntimeStatsDisabledByDefault(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+
+	router := gin.New()
+	RegisterRoutes(router, handler, handler.(*URLHandler).config, zap.NewNop())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/runtime", nil))
+
+	// Without the admin flag the path falls through to the redirect route
+	assert.NotEqual(t, http.StatusOK, w.Code)
+}
+
+func TestEffectiveConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	cfg := handler.(*URLHandler).config
+	cfg.EnableAdmin = true
+	cfg.DisableRateLimit = true
+	cfg.BaseURL = "https://sho.rt"
+	cfg.AliasAPIKeys = []string{"premium-secret", "enterprise-secret"}
+	cfg.PostgresDSN = "postgres://shortener:hunter2@db:5432/urls"
+
+	router := gin.New()
+	RegisterRoutes(router, handler, cfg, zap.NewNop())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/config", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var effective map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &effective))
+	assert.Equal(t, "https://sho.rt", effective["BaseURL"])
+	assert.Equal(t, float64(10), effective["RateLimit"])
+	assert.Equal(t, true, effective["EnableAdmin"])
+	assert.Equal(t, []interface{}{"REDACTED", "REDACTED"}, effective["AliasAPIKeys"])
+	assert.Equal(t, "postgres://shortener:REDACTED@db:5432/urls", effective["PostgresDSN"])
+	assert.NotContains(t, w.Body.String(), "secret")
+	assert.NotContains(t, w.Body.String(), "hunter2")
+	assert.Equal(t, []string{"premium-secret", "enterprise-secret"}, cfg.AliasAPIKeys, "The running configuration should be left untouched")
+}
+
+func TestExportCSV(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	cfg := handler.(*URLHandler).config
+	cfg.EnableAdmin = true
+	cfg.DisableRateLimit = true
+	cfg.ExportTimeout = time.Minute
+
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	updated := created.Add(time.Hour)
+	items := []types.URLData{
+		{ShortURL: "abc123", OriginalURL: "https://example.com/a,b", CreatedAt: created, UpdatedAt: created, AccessCount: 7},
+		{ShortURL: "def456", OriginalURL: `https://example.com/?q="quoted"`, CreatedAt: created, UpdatedAt: updated},
+	}
+
+	t.Run("Streams every URL as escaped CSV", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		mockService.On("ForEach", mock.Anything, mock.Anything).Return(items, nil).Once()
+		handler.(*URLHandler).service = mockService
+
+		router := gin.New()
+		RegisterRoutes(router, handler, cfg, zap.NewNop())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/export.csv", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, "short_url,original_url,created_at,updated_at,clicks\n"+
+			`abc123,"https://example.com/a,b",2024-03-01T12:00:00Z,2024-03-01T12:00:00Z,7`+"\n"+
+			`def456,"https://example.com/?q=""quoted""",2024-03-01T12:00:00Z,2024-03-01T13:00:00Z,0`+"\n",
+			w.Body.String())
+
+		records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+		require.NoError(t, err, "The export should be well-formed CSV")
+		require.Len(t, records, 3)
+		assert.Equal(t, []string{"short_url", "original_url", "created_at", "updated_at", "clicks"}, records[0])
+		assert.Equal(t, "https://example.com/a,b", records[1][1])
+		assert.Equal(t, `https://example.com/?q="quoted"`, records[2][1])
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Served for backups under the short URL routes", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		mockService.On("ForEach", mock.Anything, mock.Anything).Return(items, nil).Once()
+		handler.(*URLHandler).service = mockService
+
+		backupCfg := *cfg
+		backupCfg.EnableAdmin = false
+		backupCfg.APIKeys = []string{"secret"}
+		router := gin.New()
+		RegisterRoutes(router, handler, &backupCfg, zap.NewNop())
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/short/export", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "The export should require an API key like writes")
+
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/short/export", nil)
+		req.Header.Set("X-API-Key", "secret")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="export.csv"`, w.Header().Get("Content-Disposition"))
+		records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		assert.Equal(t, []string{"short_url", "original_url", "created_at", "updated_at"}, records[0][:4])
+		assert.Equal(t, []string{"abc123", "https://example.com/a,b", "2024-03-01T12:00:00Z", "2024-03-01T12:00:00Z"}, records[1][:4])
+		assert.Equal(t, []string{"def456", `https://example.com/?q="quoted"`, "2024-03-01T12:00:00Z", "2024-03-01T13:00:00Z"}, records[2][:4])
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("The admin export requires an API key", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		mockService.On("ForEach", mock.Anything, mock.Anything).Return(items, nil).Once()
+		handler.(*URLHandler).service = mockService
+
+		adminCfg := *cfg
+		adminCfg.EnableAdmin = true
+		adminCfg.APIKeys = []string{"secret"}
+		router := gin.New()
+		RegisterRoutes(router, handler, &adminCfg, zap.NewNop())
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/export.csv", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		mockService.AssertNotCalled(t, "ForEach", mock.Anything, mock.Anything)
+
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/export.csv", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Expired and soft-deleted URLs are left out", func(t *testing.T) {
+		past := time.Now().Add(-time.Minute)
+		mockService := new(mocks.MockURLService)
+		mockService.On("ForEach", mock.Anything, mock.Anything).Return([]types.URLData{
+			{ShortURL: "expired", OriginalURL: "https://example.com/expired", CreatedAt: created, ExpiresAt: past},
+			{ShortURL: "deleted", OriginalURL: "https://example.com/deleted", CreatedAt: created, DeletedAt: past},
+			items[0],
+		}, nil).Once()
+		handler.(*URLHandler).service = mockService
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/admin/export.csv", nil)
+		handler.ExportCSV(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 2, "Only the live URL should be exported")
+		assert.Equal(t, "abc123", records[1][0])
+	})
+
+	t.Run("Runs under the export timeout", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		mockService.On("ForEach", mock.MatchedBy(func(ctx context.Context) bool {
+			deadline, ok := ctx.Deadline()
+			return ok && time.Until(deadline) > cfg.RequestTimeout
+		}), mock.Anything).Return([]types.URLData(nil), nil).Once()
+		handler.(*URLHandler).service = mockService
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/admin/export.csv", nil)
+		handler.ExportCSV(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "short_url,original_url,created_at,updated_at,clicks\n", w.Body.String(),
+			"An empty storage should still get the header row")
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Service errors are reported before streaming", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		mockService.On("ForEach", mock.Anything, mock.Anything).Return(nil, errors.New("storage down")).Once()
+		handler.(*URLHandler).service = mockService
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/admin/export.csv", nil)
+		handler.ExportCSV(c)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.JSONEq(t, `{"error":"Internal server error"}`, w.Body.String())
+	})
+}
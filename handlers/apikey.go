@@ -0,0 +1,36 @@
+// Package handlers provides HTTP request handlers for the URL shortener service.
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go-url-shortening/apikey"
+)
+
+// APIKeyMiddleware answers 401 Unauthorized to requests that don't carry one of keys in an
+// X-API-Key or "Authorization: Bearer" header, and lets the others through.
+func APIKeyMiddleware(keys []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !apikey.Contains(keys, requestAPIKey(c.Request)) {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": invalidAPIKey})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// requestAPIKey returns the API key sent with r, read from the X-API-Key header or from an
+// "Authorization: Bearer <key>" header, or an empty string when the request carries none.
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+)
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	router, _, mockHandler, cfg := setupTest()
+	cfg.DisableRateLimit = true
+	cfg.APIKeys = []string{"first-key", "second-key"}
+	for _, method := range []string{"CreateShortURL", "BatchCreateShortURLs", "UpdateURL", "DeleteURL", "GetURLData", "RedirectURL"} {
+		mockHandler.On(method, mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(0).(*gin.Context).Status(http.StatusOK)
+		})
+	}
+	RegisterRoutes(router, mockHandler, cfg, zap.NewNop())
+
+	writes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/api/v1/short"},
+		{http.MethodPost, "/api/v1/short/batch"},
+		{http.MethodPut, "/api/v1/short/abc123"},
+		{http.MethodDelete, "/api/v1/short/abc123"},
+	}
+	credentials := []struct {
+		name           string
+		header         string
+		value          string
+		expectedStatus int
+	}{
+		{name: "Missing key", expectedStatus: http.StatusUnauthorized},
+		{name: "Wrong key", header: "X-API-Key", value: "third-key", expectedStatus: http.StatusUnauthorized},
+		{name: "Wrong bearer token", header: "Authorization", value: "Bearer first", expectedStatus: http.StatusUnauthorized},
+		{name: "Valid key", header: "X-API-Key", value: "second-key", expectedStatus: http.StatusOK},
+		{name: "Valid bearer token", header: "Authorization", value: "Bearer first-key", expectedStatus: http.StatusOK},
+	}
+
+	for _, write := range writes {
+		for _, tt := range credentials {
+			t.Run(write.method+" "+write.path+" "+tt.name, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest(write.method, write.path, nil)
+				if tt.header != "" {
+					req.Header.Set(tt.header, tt.value)
+				}
+				router.ServeHTTP(w, req)
+
+				assert.Equal(t, tt.expectedStatus, w.Code)
+				if tt.expectedStatus == http.StatusUnauthorized {
+					assert.JSONEq(t, `{"error":"Missing or invalid API key"}`, w.Body.String())
+					assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+				}
+			})
+		}
+	}
+
+	t.Run("Reads and redirects stay public", func(t *testing.T) {
+		for _, path := range []string{"/api/v1/short/abc123", "/abc123"} {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+			assert.Equal(t, http.StatusOK, w.Code, path)
+		}
+	})
+
+	t.Run("Writes are open without configured keys", func(t *testing.T) {
+		router, _, mockHandler, cfg := setupTest()
+		cfg.DisableRateLimit = true
+		mockHandler.On("CreateShortURL", mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(0).(*gin.Context).Status(http.StatusCreated)
+		})
+		RegisterRoutes(router, mockHandler, cfg, zap.NewNop())
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/short", nil))
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+}
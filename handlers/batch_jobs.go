@@ -0,0 +1,222 @@
+// Package handlers provides HTTP request handlers for the URL shortener service.
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go-url-shortening/types"
+	"go.uber.org/zap"
+)
+
+// Statuses reported for asynchronous batch jobs.
+const (
+	jobStatusRunning   = "running"
+	jobStatusCompleted = "completed"
+)
+
+// batchJobChunkSize is how many URLs an asynchronous batch job creates at a time. Progress is
+// reported after every chunk, and each chunk gets its own config.RequestTimeout.
+const batchJobChunkSize = 50
+
+// errTooManyJobs is returned by batchJobStore.start when every slot holds a running or unexpired job.
+var errTooManyJobs = errors.New("too many batch jobs")
+
+// batchJob tracks the progress and results of one asynchronous batch create.
+type batchJob struct {
+	id          string
+	total       int
+	processed   int
+	results     []types.BatchURLResult
+	createdAt   time.Time
+	completedAt time.Time // Zero while the job is running
+}
+
+// batchJobStore keeps a bounded number of asynchronous batch jobs in memory. Completed jobs are
+// dropped ttl after they complete, while running jobs are kept until they complete.
+type batchJobStore struct {
+	capacity int
+	ttl      time.Duration
+
+	mu   sync.Mutex
+	jobs map[string]*batchJob
+}
+
+// newBatchJobStore creates a batchJobStore holding at most capacity jobs.
+func newBatchJobStore(capacity int, ttl time.Duration) *batchJobStore {
+	return &batchJobStore{
+		capacity: capacity,
+		ttl:      ttl,
+		jobs:     make(map[string]*batchJob),
+	}
+}
+
+// start registers a new running job for total URLs. When the store is full, it first drops
+// expired jobs and then the oldest completed one, failing with errTooManyJobs if none is completed.
+func (s *batchJobStore) start(total int, now time.Time) (*batchJob, error) {
+	id, err := newJobID()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired(now)
+	if len(s.jobs) >= s.capacity && !s.dropOldestCompleted() {
+		return nil, errTooManyJobs
+	}
+	job := &batchJob{id: id, total: total, createdAt: now}
+	s.jobs[id] = job
+	return job, nil
+}
+
+// remove drops job, which never started.
+func (s *batchJobStore) remove(job *batchJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.jobs, job.id)
+}
+
+// record appends the results of a processed chunk to job, completing it once every URL is processed.
+func (s *batchJobStore) record(job *batchJob, results []types.BatchURLResult, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job.results = append(job.results, results...)
+	job.processed += len(results)
+	if job.processed == job.total {
+		job.completedAt = now
+	}
+}
+
+// get returns a snapshot of the job with the given ID, and false if it is unknown or expired.
+// Results are only included once the job has completed.
+func (s *batchJobStore) get(id string, now time.Time) (types.BatchJobResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired(now)
+	job, found := s.jobs[id]
+	if !found {
+		return types.BatchJobResponse{}, false
+	}
+
+	response := types.BatchJobResponse{
+		ID:        job.id,
+		Status:    jobStatusRunning,
+		Total:     job.total,
+		Processed: job.processed,
+		CreatedAt: job.createdAt,
+	}
+	if !job.completedAt.IsZero() {
+		completedAt := job.completedAt
+		response.Status = jobStatusCompleted
+		response.CompletedAt = &completedAt
+		response.Results = job.results
+	}
+	return response, true
+}
+
+// purgeExpired drops the jobs completed more than ttl ago. The caller must hold s.mu.
+func (s *batchJobStore) purgeExpired(now time.Time) {
+	for id, job := range s.jobs {
+		if !job.completedAt.IsZero() && now.Sub(job.completedAt) > s.ttl {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// dropOldestCompleted drops the job that completed first, reporting whether there was one.
+// The caller must hold s.mu.
+func (s *batchJobStore) dropOldestCompleted() bool {
+	var oldest *batchJob
+	for _, job := range s.jobs {
+		if !job.completedAt.IsZero() && (oldest == nil || job.completedAt.Before(oldest.completedAt)) {
+			oldest = job
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	delete(s.jobs, oldest.id)
+	return true
+}
+
+// newJobID returns a random, unguessable job ID.
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// startBatchJob registers a job for urls, queues it on the worker pool and answers 202 Accepted
+// with the job and a Location header pointing at GetBatchJob, or 503 when the pool queue is full.
+func (h *URLHandler) startBatchJob(c *gin.Context, urls []string) {
+	job, err := h.batchJobs.start(len(urls), time.Now())
+	if err != nil {
+		if errors.Is(err, errTooManyJobs) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": tooManyBatchJobs})
+			return
+		}
+		h.logger.Error("Failed to start batch job", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errorCreatingURL})
+		return
+	}
+	queued := h.pool.Go(func(ctx context.Context) {
+		h.runBatchJob(ctx, job, urls)
+	})
+	if !queued {
+		h.batchJobs.remove(job)
+		h.logger.Warn("Rejected batch job, the background queue is full", zap.Int("urls", len(urls)))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": tooManyBatchJobs})
+		return
+	}
+	h.logger.Info("Batch job started", zap.String("jobID", job.id), zap.Int("urls", len(urls)))
+
+	c.Header("Location", "/api/v1/jobs/"+job.id)
+	c.JSON(http.StatusAccepted, types.BatchJobResponse{
+		ID:        job.id,
+		Status:    jobStatusRunning,
+		Total:     job.total,
+		CreatedAt: job.createdAt,
+	})
+}
+
+// runBatchJob creates the short URLs of job chunk by chunk, recording the results of each chunk.
+// Jobs outlive the request that started them, so each chunk runs under a fresh timeout, derived
+// from ctx, the context of the pool, so that shutting down cancels them.
+func (h *URLHandler) runBatchJob(ctx context.Context, job *batchJob, urls []string) {
+	for start := 0; start < len(urls); start += batchJobChunkSize {
+		chunk := urls[start:min(start+batchJobChunkSize, len(urls))]
+		ctx, cancel := context.WithTimeout(ctx, h.config.RequestTimeout)
+		results := h.createBatch(ctx, chunk)
+		cancel()
+		h.batchJobs.record(job, results, time.Now())
+	}
+	h.logger.Info("Batch job completed", zap.String("jobID", job.id), zap.Int("urls", len(urls)))
+}
+
+// GetBatchJob reports the progress of an asynchronous batch create, including the per-URL
+// results once it has completed.
+func (h *URLHandler) GetBatchJob(c *gin.Context) {
+	if h.batchJobs == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": jobNotFound})
+		return
+	}
+	job, found := h.batchJobs.get(c.Param("id"), time.Now())
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": jobNotFound})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-url-shortening/config"
+	"go-url-shortening/services"
+	"go-url-shortening/services/mocks"
+	"go-url-shortening/types"
+	"go-url-shortening/workerpool"
+	"go.uber.org/zap"
+)
+
+func TestBatchJobStore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Progress and completion", func(t *testing.T) {
+		store := newBatchJobStore(10, time.Hour)
+		job, err := store.start(2, now)
+		require.NoError(t, err)
+
+		store.record(job, []types.BatchURLResult{{URL: "https://a.com", Status: http.StatusCreated}}, now)
+		response, found := store.get(job.id, now)
+		require.True(t, found)
+		assert.Equal(t, jobStatusRunning, response.Status)
+		assert.Equal(t, 1, response.Processed)
+		assert.Nil(t, response.Results, "Results are only reported once completed")
+
+		store.record(job, []types.BatchURLResult{{URL: "https://b.com", Status: http.StatusCreated}}, now.Add(time.Second))
+		response, found = store.get(job.id, now)
+		require.True(t, found)
+		assert.Equal(t, jobStatusCompleted, response.Status)
+		assert.Equal(t, now.Add(time.Second), *response.CompletedAt)
+		assert.Len(t, response.Results, 2)
+	})
+
+	t.Run("Completed jobs expire", func(t *testing.T) {
+		store := newBatchJobStore(10, time.Hour)
+		job, err := store.start(1, now)
+		require.NoError(t, err)
+		store.record(job, []types.BatchURLResult{{URL: "https://a.com"}}, now)
+
+		_, found := store.get(job.id, now.Add(time.Hour))
+		assert.True(t, found)
+		_, found = store.get(job.id, now.Add(time.Hour+time.Second))
+		assert.False(t, found)
+	})
+
+	t.Run("Full store drops the oldest completed job", func(t *testing.T) {
+		store := newBatchJobStore(2, time.Hour)
+		first, err := store.start(1, now)
+		require.NoError(t, err)
+		running, err := store.start(1, now)
+		require.NoError(t, err)
+
+		_, err = store.start(1, now)
+		assert.ErrorIs(t, err, errTooManyJobs, "Running jobs are never dropped")
+
+		store.record(first, []types.BatchURLResult{{URL: "https://a.com"}}, now)
+		_, err = store.start(1, now)
+		require.NoError(t, err)
+		_, found := store.get(first.id, now)
+		assert.False(t, found)
+		_, found = store.get(running.id, now)
+		assert.True(t, found)
+	})
+}
+
+// chunkedBatchService creates every URL it is given, except that failAt fails as the storage being full.
+type chunkedBatchService struct {
+	*mocks.MockURLService
+	failAt string
+	calls  int
+}
+
+func (s *chunkedBatchService) BatchCreate(_ context.Context, urls []string) ([]types.URLData, []error) {
+	s.calls++
+	urlData := make([]types.URLData, len(urls))
+	errs := make([]error, len(urls))
+	for i, u := range urls {
+		if u == s.failAt {
+			errs[i] = services.ErrStorageCapacityReached
+			continue
+		}
+		urlData[i] = types.URLData{ShortURL: fmt.Sprintf("code%d", i), OriginalURL: u}
+	}
+	return urlData, errs
+}
+
+func TestAsyncBatchCreate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		RateLimit:         10,
+		RatePeriod:        time.Second,
+		RequestTimeout:    5 * time.Second,
+		MaxBatchSize:      2,
+		EnableAsyncBatch:  true,
+		MaxAsyncBatchSize: 200,
+		MaxBatchJobs:      10,
+		BatchJobTTL:       time.Hour,
+	}
+	mockService := &chunkedBatchService{MockURLService: new(mocks.MockURLService), failAt: "https://example.com/100"}
+	handler, err := NewURLHandler(context.Background(), mockService, cfg, zap.NewNop())
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.POST("/api/v1/short/batch", handler.BatchCreateShortURLs)
+	router.GET("/api/v1/jobs/:id", handler.GetBatchJob)
+
+	urls := make([]string, 120)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("https://example.com/%d", i)
+	}
+	urls[5] = "not-a-url"
+	body, _ := json.Marshal(types.BatchURLRequest{URLs: urls})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/short/batch?async=true", strings.NewReader(string(body))))
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var accepted types.BatchJobResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &accepted))
+	assert.Equal(t, jobStatusRunning, accepted.Status)
+	assert.Equal(t, len(urls), accepted.Total)
+	assert.Equal(t, "/api/v1/jobs/"+accepted.ID, w.Header().Get("Location"))
+
+	var job types.BatchJobResponse
+	require.Eventually(t, func() bool {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/jobs/"+accepted.ID, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+		return job.Status == jobStatusCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, len(urls), job.Processed)
+	require.Len(t, job.Results, len(urls))
+	assert.Equal(t, http.StatusCreated, job.Results[0].Status)
+	assert.Equal(t, "https://example.com/0", job.Results[0].OriginalURL)
+	assert.Equal(t, http.StatusBadRequest, job.Results[5].Status)
+	assert.Equal(t, http.StatusInsufficientStorage, job.Results[100].Status)
+	assert.Equal(t, "https://example.com/119", job.Results[119].URL)
+	assert.Equal(t, 3, mockService.calls, "URLs should be created in chunks")
+
+	t.Run("Unknown job", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/jobs/unknown", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.JSONEq(t, `{"error":"Job not found"}`, w.Body.String())
+	})
+
+	t.Run("Async batches have their own size limit", func(t *testing.T) {
+		body, _ := json.Marshal(types.BatchURLRequest{URLs: make([]string, cfg.MaxAsyncBatchSize+1)})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/short/batch?async=true", strings.NewReader(string(body))))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"error":"Invalid batch size"}`, w.Body.String())
+	})
+
+	t.Run("Rejected while the background queue is full", func(t *testing.T) {
+		pool := workerpool.New(1, 1)
+		defer pool.Stop()
+		started := make(chan struct{})
+		require.True(t, pool.Go(func(ctx context.Context) {
+			close(started)
+			<-ctx.Done()
+		}))
+		<-started
+		require.True(t, pool.Go(func(context.Context) {}))
+		handler, err := NewURLHandler(context.Background(), mockService, cfg, zap.NewNop(), WithWorkerPool(pool))
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/short/batch?async=true", strings.NewReader(`{"urls":["https://a.com"]}`))
+		handler.BatchCreateShortURLs(c)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.JSONEq(t, `{"error":"Too many batch jobs in progress"}`, w.Body.String())
+		assert.Empty(t, handler.(*URLHandler).batchJobs.jobs, "The rejected job should not be kept")
+	})
+
+	t.Run("Rejected unless enabled", func(t *testing.T) {
+		handler, err := setupTestHandler()
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/short/batch?async=true", strings.NewReader(`{"urls":["https://a.com"]}`))
+		handler.BatchCreateShortURLs(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"error":"Asynchronous batches are not enabled"}`, w.Body.String())
+	})
+}
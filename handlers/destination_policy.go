@@ -0,0 +1,52 @@
+// Package handlers provides HTTP request handlers for the URL shortener service.
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go-url-shortening/destination"
+	"go.uber.org/zap"
+)
+
+// destinationError maps an error of destination.Policy to the status and message a request
+// submitting the destination is answered with.
+func destinationError(err error) (int, string) {
+	switch {
+	case errors.Is(err, destination.ErrUnsupportedScheme):
+		return http.StatusBadRequest, unsupportedURLScheme
+	case errors.Is(err, destination.ErrInternalDestination):
+		return http.StatusBadRequest, internalDestinationProvided
+	case errors.Is(err, destination.ErrDuplicateQueryParams):
+		return http.StatusBadRequest, duplicateQueryParamsProvided
+	case errors.Is(err, destination.ErrSelfShortLink):
+		return http.StatusBadRequest, selfShortLinkProvided
+	case errors.Is(err, destination.ErrDomainBlocked):
+		return http.StatusForbidden, domainNotAllowed
+	case errors.Is(err, destination.ErrPrivateDestination):
+		return http.StatusForbidden, privateDestinationBlocked
+	case errors.Is(err, destination.ErrDomainRateLimited):
+		return http.StatusTooManyRequests, domainRateLimitExceeded
+	default:
+		return http.StatusInternalServerError, errorCreatingURL
+	}
+}
+
+// rejectDestination answers and returns true when rawURL, the destination submitted with c, breaks
+// one of the destination policies, with 400 for an invalid destination, 403 when its domain is
+// blocked or it resolves to a private address, or 400 when it is one of our own short links.
+func (h *URLHandler) rejectDestination(ctx context.Context, c *gin.Context, rawURL string) bool {
+	err := h.policy.Check(ctx, rawURL)
+	if err == nil {
+		err = h.policy.CheckSelfLink(ctx, c.Request.Host, rawURL)
+	}
+	if err == nil {
+		return false
+	}
+	status, message := destinationError(err)
+	h.requestLogger(c).Warn("Rejected a destination", zap.String("url", rawURL), zap.String("reason", message))
+	c.JSON(status, gin.H{"error": message})
+	return true
+}
@@ -0,0 +1,474 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go-url-shortening/config"
+	"go-url-shortening/destination"
+	"go-url-shortening/services/mocks"
+	"go-url-shortening/types"
+	"go.uber.org/zap"
+)
+
+func TestRejectInternalDestinations(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		RateLimit:                  10,
+		RatePeriod:                 time.Second,
+		RequestTimeout:             5 * time.Second,
+		MaxBatchSize:               10,
+		RejectInternalDestinations: true,
+	}
+	mockService := new(mocks.MockURLService)
+	mockService.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything).Return(types.URLData{ShortURL: "abc123"}, nil)
+	mockService.On("UpdateURL", mock.Anything, "abc123", mock.Anything).Return(types.URLData{ShortURL: "abc123"}, nil)
+	handler, err := NewURLHandler(context.Background(), mockService, cfg, zap.NewNop())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+	}{
+		{name: "IPv4 loopback", url: "http://127.0.0.1/admin", expectedStatus: http.StatusBadRequest},
+		{name: "IPv6 loopback", url: "http://[::1]/", expectedStatus: http.StatusBadRequest},
+		{name: "Expanded IPv6 loopback", url: "http://[0:0:0:0:0:0:0:1]/", expectedStatus: http.StatusBadRequest},
+		{name: "IPv4-mapped private address", url: "http://[::ffff:192.168.0.1]:8080/", expectedStatus: http.StatusBadRequest},
+		{name: "Localhost", url: "http://localhost:3000/", expectedStatus: http.StatusBadRequest},
+		{name: "Public IP literal", url: "https://[2606:4700::1111]/", expectedStatus: http.StatusCreated},
+		{name: "Public host", url: "https://example.com/", expectedStatus: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/short", strings.NewReader(`{"url":"`+tt.url+`"}`))
+
+			handler.CreateShortURL(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusBadRequest {
+				assert.JSONEq(t, `{"error":"URL points to an internal address"}`, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("Update to an internal destination", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "short_url", Value: "abc123"}}
+		c.Request = httptest.NewRequest(http.MethodPut, "/api/v1/short/abc123", strings.NewReader(`{"url":"http://[::1]:8080/"}`))
+
+		handler.UpdateURL(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		mockService.AssertNotCalled(t, "UpdateURL", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Batch items to internal destinations", func(t *testing.T) {
+		mockService.On("BatchCreate", mock.Anything, []string{"https://example.com/"}).
+			Return([]types.URLData{{ShortURL: "abc123", OriginalURL: "https://example.com/"}}, []error{nil}).Once()
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/short/batch", strings.NewReader(`{"urls":["http://[::1]/","https://example.com/"]}`))
+
+		handler.BatchCreateShortURLs(c)
+
+		require.Equal(t, http.StatusMultiStatus, w.Code)
+		var response types.BatchURLResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Results, 2)
+		assert.Equal(t, http.StatusBadRequest, response.Results[0].Status)
+		assert.Equal(t, "URL points to an internal address", response.Results[0].Error)
+		assert.Equal(t, http.StatusCreated, response.Results[1].Status)
+	})
+}
+
+func TestBlockedDomains(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		RateLimit:      10,
+		RatePeriod:     time.Second,
+		RequestTimeout: 5 * time.Second,
+		MaxBatchSize:   10,
+		BlockedDomains: []string{"evil.com", "*.phish.example"},
+	}
+	mockService := new(mocks.MockURLService)
+	mockService.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything).Return(types.URLData{ShortURL: "abc123"}, nil)
+	mockService.On("UpdateURL", mock.Anything, "abc123", mock.Anything).Return(types.URLData{ShortURL: "abc123"}, nil)
+	handler, err := NewURLHandler(context.Background(), mockService, cfg, zap.NewNop())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		url     string
+		blocked bool
+	}{
+		{name: "Exact domain", url: "https://evil.com/login", blocked: true},
+		{name: "Exact domain in another case", url: "https://EVIL.com./", blocked: true},
+		{name: "Subdomain", url: "http://www.evil.com:8080/", blocked: true},
+		{name: "Subdomain of a wildcard", url: "https://login.phish.example/", blocked: true},
+		{name: "Domain of a wildcard itself", url: "https://phish.example/", blocked: false},
+		{name: "Domain merely ending like a blocked one", url: "https://notevil.com/", blocked: false},
+		{name: "Allowed host", url: "https://example.com/evil.com", blocked: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/short", strings.NewReader(`{"url":"`+tt.url+`"}`))
+
+			handler.CreateShortURL(c)
+
+			if tt.blocked {
+				assert.Equal(t, http.StatusForbidden, w.Code)
+				assert.JSONEq(t, `{"error":"Domain not allowed"}`, w.Body.String())
+			} else {
+				assert.Equal(t, http.StatusCreated, w.Code)
+			}
+		})
+	}
+
+	t.Run("Update to a blocked domain", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "short_url", Value: "abc123"}}
+		c.Request = httptest.NewRequest(http.MethodPut, "/api/v1/short/abc123", strings.NewReader(`{"url":"https://sub.evil.com/"}`))
+
+		handler.UpdateURL(c)
+
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		mockService.AssertNotCalled(t, "UpdateURL", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Batch items to blocked domains", func(t *testing.T) {
+		mockService.On("BatchCreate", mock.Anything, []string{"https://example.com/"}).
+			Return([]types.URLData{{ShortURL: "abc123", OriginalURL: "https://example.com/"}}, []error{nil}).Once()
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/short/batch", strings.NewReader(`{"urls":["https://evil.com/","https://example.com/"]}`))
+
+		handler.BatchCreateShortURLs(c)
+
+		require.Equal(t, http.StatusMultiStatus, w.Code)
+		var response types.BatchURLResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Results, 2)
+		assert.Equal(t, http.StatusForbidden, response.Results[0].Status)
+		assert.Equal(t, "Domain not allowed", response.Results[0].Error)
+		assert.Equal(t, http.StatusCreated, response.Results[1].Status)
+	})
+}
+
+func TestAllowedSchemes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		RateLimit:      10,
+		RatePeriod:     time.Second,
+		RequestTimeout: 5 * time.Second,
+	}
+	mockService := new(mocks.MockURLService)
+	mockService.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything).Return(types.URLData{ShortURL: "abc123"}, nil)
+	handler, err := NewURLHandler(context.Background(), mockService, cfg, zap.NewNop())
+	require.NoError(t, err)
+
+	create := func(destination string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(types.URLRequest{URL: destination})
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/short", strings.NewReader(string(body)))
+		handler.CreateShortURL(c)
+		return w
+	}
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+	}{
+		{name: "JavaScript", url: "javascript:alert(1)", expectedStatus: http.StatusBadRequest},
+		{name: "Upper case JavaScript", url: "JAVASCRIPT:alert(1)", expectedStatus: http.StatusBadRequest},
+		{name: "Data", url: "data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==", expectedStatus: http.StatusBadRequest},
+		{name: "FTP", url: "ftp://files.example.com/report.pdf", expectedStatus: http.StatusBadRequest},
+		{name: "HTTP", url: "http://example.com/", expectedStatus: http.StatusCreated},
+		{name: "HTTPS", url: "HTTPS://example.com/", expectedStatus: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := create(tt.url)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusBadRequest {
+				assert.JSONEq(t, `{"error":"Unsupported URL scheme"}`, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("Update to an unsupported scheme", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "short_url", Value: "abc123"}}
+		c.Request = httptest.NewRequest(http.MethodPut, "/api/v1/short/abc123", strings.NewReader(`{"url":"ftp://files.example.com/"}`))
+
+		handler.UpdateURL(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"error":"Unsupported URL scheme"}`, w.Body.String())
+		mockService.AssertNotCalled(t, "UpdateURL", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Configured schemes replace the defaults", func(t *testing.T) {
+		cfg.AllowedSchemes = []string{"https", "ftp"}
+		defer func() { cfg.AllowedSchemes = nil }()
+
+		assert.Equal(t, http.StatusCreated, create("ftp://files.example.com/report.pdf").Code)
+		assert.Equal(t, http.StatusBadRequest, create("http://example.com/").Code)
+	})
+}
+
+func TestRejectDuplicateQueryParams(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		RateLimit:                  10,
+		RatePeriod:                 time.Second,
+		RequestTimeout:             5 * time.Second,
+		RejectDuplicateQueryParams: true,
+	}
+	mockService := new(mocks.MockURLService)
+	mockService.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything).Return(types.URLData{ShortURL: "abc123"}, nil)
+	mockService.On("UpdateURL", mock.Anything, "abc123", mock.Anything).Return(types.URLData{ShortURL: "abc123"}, nil)
+	handler, err := NewURLHandler(context.Background(), mockService, cfg, zap.NewNop())
+	require.NoError(t, err)
+
+	create := func(destination string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/short", strings.NewReader(`{"url":"`+destination+`"}`))
+		handler.CreateShortURL(c)
+		return w
+	}
+
+	t.Run("Duplicate keys are rejected", func(t *testing.T) {
+		w := create("https://example.com/?a=1&a=2")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"error":"URL has duplicate query parameters"}`, w.Body.String())
+	})
+
+	t.Run("Distinct keys are accepted", func(t *testing.T) {
+		w := create("https://example.com/?a=1&b=2")
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("Update with duplicate keys", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "short_url", Value: "abc123"}}
+		c.Request = httptest.NewRequest(http.MethodPut, "/api/v1/short/abc123", strings.NewReader(`{"url":"https://example.com/?a=1&%61=2"}`))
+
+		handler.UpdateURL(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		mockService.AssertNotCalled(t, "UpdateURL", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Accepted unless enabled", func(t *testing.T) {
+		cfg.RejectDuplicateQueryParams = false
+		defer func() { cfg.RejectDuplicateQueryParams = true }()
+
+		w := create("https://example.com/?a=1&a=2")
+		assert.Equal(t, http.StatusCreated, w.Code)
+		mockService.AssertCalled(t, "CreateShortURL", mock.Anything, "https://example.com/?a=1&a=2", mock.Anything)
+	})
+}
+
+func TestBlockPrivateRedirects(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		RateLimit:             10,
+		RatePeriod:            time.Second,
+		RequestTimeout:        5 * time.Second,
+		MaxBatchSize:          10,
+		BlockPrivateRedirects: true,
+	}
+	mockService := new(mocks.MockURLService)
+	mockService.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything).Return(types.URLData{ShortURL: "abc123"}, nil)
+	resolved := map[string][]netip.Addr{
+		"metadata.internal": {netip.MustParseAddr("169.254.169.254")},
+		"redis.internal":    {netip.MustParseAddr("10.0.0.5")},
+		"ula.internal":      {netip.MustParseAddr("2606:4700::1111"), netip.MustParseAddr("fc00::5")},
+		"example.com":       {netip.MustParseAddr("93.184.215.14"), netip.MustParseAddr("2606:2800:21f:cb07:6820:80da:af6b:8b2c")},
+	}
+	policy := destination.NewPolicy(cfg, mockService, destination.WithLookupIP(func(_ context.Context, host string) ([]netip.Addr, error) {
+		addrs, ok := resolved[host]
+		if !ok {
+			return nil, errors.New("no such host")
+		}
+		return addrs, nil
+	}))
+	handler, err := NewURLHandler(context.Background(), mockService, cfg, zap.NewNop(), WithDestinationPolicy(policy))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		url     string
+		blocked bool
+	}{
+		{name: "IPv4 loopback literal", url: "http://127.0.0.1:6379/", blocked: true},
+		{name: "IPv6 loopback literal", url: "http://[::1]/", blocked: true},
+		{name: "Unique local IPv6 literal", url: "http://[fc00::1]/", blocked: true},
+		{name: "Localhost", url: "http://localhost:6379/", blocked: true},
+		{name: "Link-local literal", url: "http://169.254.169.254/", blocked: true},
+		{name: "Name resolving to link-local", url: "http://metadata.internal/latest/", blocked: true},
+		{name: "Name resolving to RFC 1918", url: "http://redis.internal:6379/", blocked: true},
+		{name: "Name with one unique local IPv6 address", url: "http://ula.internal/", blocked: true},
+		{name: "Name resolving to public addresses", url: "https://example.com/", blocked: false},
+		{name: "Unresolvable name", url: "https://unknown.example/", blocked: false},
+	}
+
+	for _, tt := range tests {
+		t.Run("Create "+tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/short", strings.NewReader(`{"url":"`+tt.url+`"}`))
+
+			handler.CreateShortURL(c)
+
+			if tt.blocked {
+				assert.Equal(t, http.StatusForbidden, w.Code)
+				assert.JSONEq(t, `{"error":"URL resolves to a private address"}`, w.Body.String())
+			} else {
+				assert.Equal(t, http.StatusCreated, w.Code)
+			}
+		})
+
+		t.Run("Redirect "+tt.name, func(t *testing.T) {
+			redirectService := new(mocks.MockURLService)
+			redirectService.On("GetURLData", mock.Anything, "abc123").Return(types.URLData{ShortURL: "abc123", OriginalURL: tt.url}, nil)
+			redirectService.On("RecordAccess", mock.Anything, "abc123").Return(nil)
+			handler.(*URLHandler).service = redirectService
+			defer func() { handler.(*URLHandler).service = mockService }()
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Params = gin.Params{{Key: "short_url", Value: "abc123"}}
+			c.Request = httptest.NewRequest(http.MethodGet, "/abc123", nil)
+
+			handler.RedirectURL(c)
+
+			if tt.blocked {
+				assert.Equal(t, http.StatusForbidden, w.Code)
+				assert.JSONEq(t, `{"error":"Redirect to a private address blocked"}`, w.Body.String())
+				redirectService.AssertNotCalled(t, "RecordAccess", mock.Anything, mock.Anything)
+			} else {
+				assert.Equal(t, http.StatusFound, w.Code)
+				assert.Equal(t, tt.url, w.Header().Get("Location"))
+			}
+		})
+	}
+
+	t.Run("Batch items resolving to private addresses", func(t *testing.T) {
+		mockService.On("BatchCreate", mock.Anything, []string{"https://example.com/"}).
+			Return([]types.URLData{{ShortURL: "abc123", OriginalURL: "https://example.com/"}}, []error{nil}).Once()
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/short/batch", strings.NewReader(`{"urls":["http://redis.internal/","https://example.com/"]}`))
+
+		handler.BatchCreateShortURLs(c)
+
+		require.Equal(t, http.StatusMultiStatus, w.Code)
+		var response types.BatchURLResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Results, 2)
+		assert.Equal(t, http.StatusForbidden, response.Results[0].Status)
+		assert.Equal(t, "URL resolves to a private address", response.Results[0].Error)
+		assert.Equal(t, http.StatusCreated, response.Results[1].Status)
+	})
+
+	t.Run("Names are not resolved unless enabled", func(t *testing.T) {
+		cfg.BlockPrivateRedirects = false
+		defer func() { cfg.BlockPrivateRedirects = true }()
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/short", strings.NewReader(`{"url":"http://redis.internal/"}`))
+
+		handler.CreateShortURL(c)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+}
+
+func TestCreateShortURLDomainLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		RateLimit:          10,
+		RatePeriod:         time.Second,
+		RequestTimeout:     5 * time.Second,
+		MaxBatchSize:       10,
+		DomainCreateLimit:  3,
+		DomainCreatePeriod: time.Hour,
+	}
+	mockService := new(mocks.MockURLService)
+	mockService.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything).
+		Return(types.URLData{ShortURL: "abc123"}, nil)
+	handler, err := NewURLHandler(context.Background(), mockService, cfg, zap.NewNop())
+	require.NoError(t, err)
+
+	create := func(rawURL string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(types.URLRequest{URL: rawURL})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short", bytes.NewBuffer(body))
+		handler.CreateShortURL(c)
+		return w
+	}
+
+	for i := 0; i < cfg.DomainCreateLimit; i++ {
+		assert.Equal(t, http.StatusCreated, create("https://flood.example.com/"+string(rune('a'+i))).Code)
+	}
+	w := create("https://other.example.com/page")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.JSONEq(t, `{"error":"Rate limit exceeded for destination domain"}`, w.Body.String())
+
+	assert.Equal(t, http.StatusCreated, create("https://unaffected.org/page").Code)
+	mockService.AssertNumberOfCalls(t, "CreateShortURL", cfg.DomainCreateLimit+1)
+
+	t.Run("Batch items over the limit", func(t *testing.T) {
+		mockService.On("BatchCreate", mock.Anything, []string{"https://unaffected.org/next"}).
+			Return([]types.URLData{{ShortURL: "def456", OriginalURL: "https://unaffected.org/next"}}, []error{nil})
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short/batch",
+			bytes.NewBufferString(`{"urls":["https://example.com/more","https://unaffected.org/next"]}`))
+		handler.BatchCreateShortURLs(c)
+
+		assert.Equal(t, http.StatusMultiStatus, w.Code)
+		var response types.BatchURLResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Results, 2)
+		assert.Equal(t, http.StatusTooManyRequests, response.Results[0].Status)
+		assert.Equal(t, domainRateLimitExceeded, response.Results[0].Error)
+		assert.Equal(t, http.StatusCreated, response.Results[1].Status)
+	})
+}
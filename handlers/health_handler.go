@@ -2,6 +2,7 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -9,11 +10,41 @@ import (
 )
 
 // HealthCheck handles the health check endpoint.
-// It returns a 200 OK status to indicate that the service is up and running.
+// It returns a 200 OK status when the storage is usable, and 503 Service Unavailable with
+// {"status":"unhealthy"} otherwise.
+// Probes are only logged with config.LogHealthChecks.
 func (h *URLHandler) HealthCheck(c *gin.Context) {
-	h.logger.Info("Health check request",
-		zap.String("ip", c.ClientIP()),
-		zap.String("user_agent", c.Request.UserAgent()),
-	)
+	if h.config.LogHealthChecks {
+		h.logger.Info("Health check request",
+			zap.String("ip", c.ClientIP()),
+			zap.String("user_agent", c.Request.UserAgent()),
+		)
+	}
+	h.checkStorage(c)
+}
+
+// Liveness handles the liveness probe, answering 200 OK as long as the server handles requests.
+// It doesn't depend on the storage, so that an outage of the backend doesn't get the server restarted.
+func (h *URLHandler) Liveness(c *gin.Context) {
+	c.String(http.StatusOK, "OK")
+}
+
+// Readiness handles the readiness probe, answering like HealthCheck, so that traffic is only routed
+// to the server while its storage is usable.
+func (h *URLHandler) Readiness(c *gin.Context) {
+	h.checkStorage(c)
+}
+
+// checkStorage answers 200 OK when the storage responds to a ping within the request timeout,
+// and 503 Service Unavailable with {"status":"unhealthy"} otherwise.
+func (h *URLHandler) checkStorage(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.config.RequestTimeout)
+	defer cancel()
+
+	if err := h.service.Ping(ctx); err != nil {
+		h.requestLogger(c).Warn("Storage is unreachable", zap.Error(err))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unhealthy"})
+		return
+	}
 	c.String(http.StatusOK, "OK")
 }
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go-url-shortening/services/mocks"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestHealthChecks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		pingErr        error
+		expectedStatus map[string]int
+	}{
+		{
+			name: "Storage reachable",
+			expectedStatus: map[string]int{
+				"/health": http.StatusOK,
+				"/livez":  http.StatusOK,
+				"/readyz": http.StatusOK,
+			},
+		},
+		{
+			name:    "Storage unreachable",
+			pingErr: errors.New("connection refused"),
+			expectedStatus: map[string]int{
+				"/health": http.StatusServiceUnavailable,
+				"/livez":  http.StatusOK,
+				"/readyz": http.StatusServiceUnavailable,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, err := setupTestHandler()
+			require.NoError(t, err)
+			urlHandler := handler.(*URLHandler)
+			urlHandler.config.DisableRateLimit = true
+			urlHandler.service.(*mocks.MockURLService).On("Ping", mock.Anything).Return(tt.pingErr)
+
+			router := gin.New()
+			RegisterRoutes(router, handler, urlHandler.config, zap.NewNop())
+
+			for path, status := range tt.expectedStatus {
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+				assert.Equal(t, status, w.Code, path)
+				if status == http.StatusOK {
+					assert.Equal(t, "OK", w.Body.String(), path)
+				} else {
+					assert.JSONEq(t, `{"status":"unhealthy"}`, w.Body.String(), path)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthCheckLogging(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name            string
+		logHealthChecks bool
+		expectedEntries int
+	}{
+		{name: "Not logged by default", logHealthChecks: false, expectedEntries: 0},
+		{name: "Logged when enabled", logHealthChecks: true, expectedEntries: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, err := setupTestHandler()
+			require.NoError(t, err)
+			core, logs := observer.New(zap.InfoLevel)
+			logger := zap.New(core)
+			urlHandler := handler.(*URLHandler)
+			urlHandler.service.(*mocks.MockURLService).On("Ping", mock.Anything).Return(nil)
+			urlHandler.logger = logger
+			urlHandler.config.DisableRateLimit = true
+			urlHandler.config.LogHealthChecks = tt.logHealthChecks
+
+			router := gin.New()
+			RegisterRoutes(router, handler, urlHandler.config, logger)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expectedEntries, logs.Len(), "Both the handler and the access log should follow LogHealthChecks")
+			if tt.expectedEntries > 0 {
+				assert.Equal(t, 1, logs.FilterMessage("Health check request").Len())
+				assert.Equal(t, 1, logs.FilterMessage("Request handled").Len())
+			}
+		})
+	}
+
+	t.Run("Failed health checks are always in the access log", func(t *testing.T) {
+		core, logs := observer.New(zap.InfoLevel)
+
+		router := gin.New()
+		router.Use(AccessLogMiddleware(zap.New(core), false))
+		router.GET("/health", func(c *gin.Context) { c.Status(http.StatusServiceUnavailable) })
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+		assert.Equal(t, 1, logs.FilterMessage("Request handled").Len())
+	})
+}
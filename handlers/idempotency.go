@@ -0,0 +1,172 @@
+// Package handlers provides HTTP request handlers for the URL shortener service.
+package handlers
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go-url-shortening/types"
+	"go.uber.org/zap"
+)
+
+// Headers of idempotent creates: the key sent by the client, and the header marking replayed responses.
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// maxIdempotencyKeyLength bounds the length of idempotency keys, which are kept in memory.
+const maxIdempotencyKeyLength = 255
+
+// maxIdempotencyKeys caps how many keys an idempotencyStore remembers. Once full, the oldest key is
+// forgotten early, which only costs a retry with it its replay.
+const maxIdempotencyKeys = 10000
+
+// Outcomes of idempotencyStore.claim.
+const (
+	// idempotencyClaimed means the key is new: the caller creates and then completes or releases it
+	idempotencyClaimed = iota
+	// idempotencyReplay means the key was used with the same request, whose response is returned
+	idempotencyReplay
+	// idempotencyMismatch means the key was used with a different request
+	idempotencyMismatch
+	// idempotencyInProgress means the key is claimed by a request that hasn't completed yet
+	idempotencyInProgress
+)
+
+// idempotencyEntry is the request an idempotency key was first used with and, once it completed,
+// the response it got.
+type idempotencyEntry struct {
+	key         string
+	fingerprint [sha256.Size]byte
+	expiresAt   time.Time
+	completed   bool
+	status      int
+	response    types.URLResponse
+}
+
+// idempotencyStore remembers the response to the first successful create sent with each
+// idempotency key for ttl, so that retries get the same response instead of creating again.
+// Keys are kept in the order they were claimed, which is also the order they expire in.
+type idempotencyStore struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // Of *idempotencyEntry
+	order   *list.List               // Oldest claim first
+}
+
+// newIdempotencyStore creates an idempotencyStore remembering keys for ttl.
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// claim looks key up for the request with the given fingerprint. A new key is claimed for it,
+// while a known one is reported as a replay, along with its response, as a mismatch if it was
+// used with another request, or as in progress if its first request hasn't completed yet.
+func (s *idempotencyStore) claim(key string, fingerprint [sha256.Size]byte, now time.Time) (int, *idempotencyEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purgeExpired(now)
+	if element, found := s.entries[key]; found {
+		entry := element.Value.(*idempotencyEntry)
+		switch {
+		case entry.fingerprint != fingerprint:
+			return idempotencyMismatch, nil
+		case !entry.completed:
+			return idempotencyInProgress, nil
+		default:
+			replay := *entry
+			return idempotencyReplay, &replay
+		}
+	}
+
+	if s.order.Len() >= maxIdempotencyKeys {
+		s.remove(s.order.Front())
+	}
+	s.entries[key] = s.order.PushBack(&idempotencyEntry{key: key, fingerprint: fingerprint, expiresAt: now.Add(s.ttl)})
+	return idempotencyClaimed, nil
+}
+
+// complete records the response to the request that claimed key, to be replayed to its retries.
+func (s *idempotencyStore) complete(key string, status int, response types.URLResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, found := s.entries[key]; found {
+		entry := element.Value.(*idempotencyEntry)
+		entry.completed, entry.status, entry.response = true, status, response
+	}
+}
+
+// release forgets key unless its request completed, so that a request that failed can be retried
+// with it.
+func (s *idempotencyStore) release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, found := s.entries[key]; found && !element.Value.(*idempotencyEntry).completed {
+		s.remove(element)
+	}
+}
+
+// purgeExpired forgets the keys claimed more than ttl ago. The caller must hold s.mu.
+func (s *idempotencyStore) purgeExpired(now time.Time) {
+	for front := s.order.Front(); front != nil && !now.Before(front.Value.(*idempotencyEntry).expiresAt); front = s.order.Front() {
+		s.remove(front)
+	}
+}
+
+// remove forgets the key of element. The caller must hold s.mu.
+func (s *idempotencyStore) remove(element *list.Element) {
+	delete(s.entries, element.Value.(*idempotencyEntry).key)
+	s.order.Remove(element)
+}
+
+// claimIdempotencyKey handles the Idempotency-Key header of a create of input. It returns the key
+// claimed for the request, empty if it carries none or idempotency keys are disabled, and reports
+// whether it already responded: with the first response to a retry, or with an error for a key
+// that is invalid, was used with another request or is in use by a request still in progress.
+// Keys are scoped to the API key of the request, so that clients can't collide with each other.
+func (h *URLHandler) claimIdempotencyKey(c *gin.Context, input types.URLRequest) (string, bool) {
+	key := c.GetHeader(idempotencyKeyHeader)
+	if key == "" || h.idempotency == nil {
+		return "", false
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidIdempotencyKey})
+		return "", true
+	}
+
+	body, err := json.Marshal(input)
+	if err != nil {
+		h.requestLogger(c).Error("Failed to fingerprint the request", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": internalServerError})
+		return "", true
+	}
+	scoped := requestAPIKey(c.Request) + "\x00" + key
+	outcome, entry := h.idempotency.claim(scoped, sha256.Sum256(body), time.Now())
+	switch outcome {
+	case idempotencyReplay:
+		c.Header(idempotentReplayedHeader, "true")
+		c.JSON(entry.status, entry.response)
+		return "", true
+	case idempotencyMismatch:
+		c.JSON(http.StatusConflict, gin.H{"error": idempotencyKeyReused})
+		return "", true
+	case idempotencyInProgress:
+		c.JSON(http.StatusConflict, gin.H{"error": idempotencyKeyInProgress})
+		return "", true
+	}
+	return scoped, false
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go-url-shortening/services"
+	"go-url-shortening/services/mocks"
+	"go-url-shortening/types"
+)
+
+func TestCreateShortURLIdempotencyKey(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	urlHandler := handler.(*URLHandler)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	create := func(body, key string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/short", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			c.Request.Header.Set(idempotencyKeyHeader, key)
+		}
+		handler.CreateShortURL(c)
+		return w
+	}
+	setup := func() *mocks.MockURLService {
+		mockService := new(mocks.MockURLService)
+		urlHandler.service = mockService
+		urlHandler.idempotency = newIdempotencyStore(time.Hour)
+		return mockService
+	}
+
+	t.Run("Retries replay the first response", func(t *testing.T) {
+		mockService := setup()
+		mockService.On("CreateShortURL", mock.Anything, "https://example.com", mock.Anything).
+			Return(types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com", CreatedAt: now, UpdatedAt: now}, nil).Once()
+
+		first := create(`{"url":"https://example.com"}`, "key-1")
+		require.Equal(t, http.StatusCreated, first.Code)
+		assert.Empty(t, first.Header().Get(idempotentReplayedHeader))
+
+		retry := create(`{"url": "https://example.com"}`, "key-1")
+		assert.Equal(t, http.StatusCreated, retry.Code)
+		assert.Equal(t, "true", retry.Header().Get(idempotentReplayedHeader))
+		assert.JSONEq(t, first.Body.String(), retry.Body.String())
+		mockService.AssertNumberOfCalls(t, "CreateShortURL", 1)
+	})
+
+	t.Run("Reusing a key with another body is a conflict", func(t *testing.T) {
+		mockService := setup()
+		mockService.On("CreateShortURL", mock.Anything, "https://example.com", mock.Anything).
+			Return(types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}, nil).Once()
+
+		require.Equal(t, http.StatusCreated, create(`{"url":"https://example.com"}`, "key-1").Code)
+		w := create(`{"url":"https://example.org"}`, "key-1")
+
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.JSONEq(t, `{"error":"Idempotency-Key was used with a different request"}`, w.Body.String())
+		mockService.AssertNumberOfCalls(t, "CreateShortURL", 1)
+	})
+
+	t.Run("Failed creates can be retried with the same key", func(t *testing.T) {
+		mockService := setup()
+		mockService.On("CreateShortURL", mock.Anything, "https://example.com", mock.Anything).
+			Return(types.URLData{}, errors.New("storage unavailable")).Once()
+		mockService.On("CreateShortURL", mock.Anything, "https://example.com", mock.Anything).
+			Return(types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}, nil).Once()
+
+		assert.Equal(t, http.StatusInternalServerError, create(`{"url":"https://example.com"}`, "key-1").Code)
+		assert.Equal(t, http.StatusCreated, create(`{"url":"https://example.com"}`, "key-1").Code)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Keys are scoped to the API key", func(t *testing.T) {
+		mockService := setup()
+		mockService.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything).
+			Return(types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}, nil)
+
+		require.Equal(t, http.StatusCreated, create(`{"url":"https://example.com"}`, "key-1").Code)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/short", strings.NewReader(`{"url":"https://example.org"}`))
+		c.Request.Header.Set(idempotencyKeyHeader, "key-1")
+		c.Request.Header.Set("X-API-Key", "other-client")
+		handler.CreateShortURL(c)
+
+		assert.Equal(t, http.StatusCreated, w.Code, "Another client's key should not conflict")
+		mockService.AssertNumberOfCalls(t, "CreateShortURL", 2)
+	})
+
+	t.Run("Existing URLs are replayed with their status", func(t *testing.T) {
+		mockService := setup()
+		mockService.On("CreateShortURL", mock.Anything, "https://example.com", mock.Anything).
+			Return(types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}, services.ErrShortURLExists).Once()
+
+		require.Equal(t, http.StatusOK, create(`{"url":"https://example.com"}`, "key-1").Code)
+		assert.Equal(t, http.StatusOK, create(`{"url":"https://example.com"}`, "key-1").Code)
+		mockService.AssertNumberOfCalls(t, "CreateShortURL", 1)
+	})
+
+	t.Run("Overlong keys are rejected", func(t *testing.T) {
+		mockService := setup()
+
+		w := create(`{"url":"https://example.com"}`, strings.Repeat("k", maxIdempotencyKeyLength+1))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		mockService.AssertNotCalled(t, "CreateShortURL", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Ignored when disabled", func(t *testing.T) {
+		mockService := setup()
+		urlHandler.idempotency = nil
+		mockService.On("CreateShortURL", mock.Anything, "https://example.com", mock.Anything).
+			Return(types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}, nil).Twice()
+
+		assert.Equal(t, http.StatusCreated, create(`{"url":"https://example.com"}`, "key-1").Code)
+		assert.Equal(t, http.StatusCreated, create(`{"url":"https://example.com"}`, "key-1").Code)
+		mockService.AssertExpectations(t)
+	})
+}
+
+func TestIdempotencyStore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fingerprint := sha256.Sum256([]byte("request"))
+
+	t.Run("A key in progress is not claimed twice", func(t *testing.T) {
+		store := newIdempotencyStore(time.Hour)
+		outcome, _ := store.claim("key", fingerprint, now)
+		require.Equal(t, idempotencyClaimed, outcome)
+
+		outcome, _ = store.claim("key", fingerprint, now)
+		assert.Equal(t, idempotencyInProgress, outcome)
+
+		store.complete("key", http.StatusCreated, types.URLResponse{ShortURL: "abc123"})
+		outcome, entry := store.claim("key", fingerprint, now)
+		require.Equal(t, idempotencyReplay, outcome)
+		assert.Equal(t, http.StatusCreated, entry.status)
+		assert.Equal(t, "abc123", entry.response.ShortURL)
+	})
+
+	t.Run("Keys expire after the TTL", func(t *testing.T) {
+		store := newIdempotencyStore(time.Hour)
+		store.claim("key", fingerprint, now)
+		store.complete("key", http.StatusCreated, types.URLResponse{ShortURL: "abc123"})
+
+		outcome, _ := store.claim("key", sha256.Sum256([]byte("other")), now.Add(time.Hour))
+		assert.Equal(t, idempotencyClaimed, outcome, "An expired key should be free to use again")
+	})
+
+	t.Run("The oldest key is forgotten once full", func(t *testing.T) {
+		store := newIdempotencyStore(time.Hour)
+		for i := 0; i < maxIdempotencyKeys; i++ {
+			store.claim(strconv.Itoa(i), fingerprint, now)
+		}
+		store.claim("newest", fingerprint, now)
+
+		assert.Len(t, store.entries, maxIdempotencyKeys)
+		assert.NotContains(t, store.entries, "0")
+		assert.Contains(t, store.entries, "newest")
+	})
+}
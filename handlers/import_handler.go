@@ -0,0 +1,221 @@
+// Package handlers provides HTTP request handlers for the URL shortener service.
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go-url-shortening/apikey"
+	"go-url-shortening/services"
+	"go-url-shortening/types"
+	"go.uber.org/zap"
+)
+
+// importFormField is the multipart form field ImportCSV reads the CSV file from.
+const importFormField = "file"
+
+// Values of the mode query parameter of ImportCSV.
+const (
+	importModeMerge   = "merge"
+	importModeReplace = "replace"
+)
+
+// ImportCSV handles the CSV import endpoint, the counterpart of ExportCSV. It reads a CSV file
+// uploaded in the "file" field of a multipart form, with the short URL and the original URL as
+// its first two columns, and stores each row under its own short URL, which only has to be one the
+// redirect route can serve rather than a valid alias, as it may have been generated under another
+// configuration. A header row such as the export's is skipped, as are further columns: importing an
+// export brings back its short URLs and destinations only, while their creation and update times,
+// clicks, tags and expiry are lost. The upload is capped at MaxRequestBodyBytes, larger ones
+// getting 413.
+//
+// Rows are imported one at a time and don't fail the import as a whole: rows whose short URL is
+// already taken are counted as skipped, and rows that are malformed or fail validation are
+// reported in the errors of the summary, by line. Once the storage is full, or the request times
+// out, the remaining rows are not attempted and the summary so far is returned.
+//
+// With ?mode=replace the file replaces the stored URLs instead, through a single ReplaceAll: every
+// URL not in the file is dropped, and the access counts of all of them are reset. The file is
+// validated as a whole first, a short URL appearing twice being an error too, and any error fails
+// the import with the summary, leaving the stored URLs untouched. The default mode is merge.
+func (h *URLHandler) ImportCSV(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.config.RequestTimeout)
+	defer cancel()
+	logger := h.requestLogger(c)
+
+	mode := c.DefaultQuery("mode", importModeMerge)
+	if mode != importModeMerge && mode != importModeReplace {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidImportMode})
+		return
+	}
+
+	if len(h.config.AliasAPIKeys) > 0 && !apikey.Contains(h.config.AliasAPIKeys, requestAPIKey(c.Request)) {
+		// Imported rows keep their short URLs, which amounts to choosing aliases
+		c.JSON(http.StatusForbidden, gin.H{"error": aliasNotAllowed})
+		return
+	}
+
+	if h.config.MaxRequestBodyBytes > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.config.MaxRequestBodyBytes)
+	}
+	header, err := c.FormFile(importFormField)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": requestBodyTooLarge})
+		return
+	}
+	if err != nil {
+		logger.Error("Error reading the uploaded CSV file", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": csvFileRequired})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		logger.Error("Error opening the uploaded CSV file", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": csvFileRequired})
+		return
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	summary := types.ImportSummary{Errors: []types.ImportError{}}
+	replacement := make(map[string]string)
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			summary.Errors = append(summary.Errors, types.ImportError{Line: parseErr.StartLine, Error: malformedCSVRow})
+			continue
+		}
+		if err != nil {
+			logger.Error("Error reading the uploaded CSV file", zap.Error(err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": invalidRequestBody})
+			return
+		}
+		line, _ := reader.FieldPos(0)
+		if first && len(record) > 0 && record[0] == exportCSVHeader[0] {
+			continue
+		}
+		if len(record) < 2 || record[0] == "" {
+			summary.Errors = append(summary.Errors, types.ImportError{Line: line, Error: malformedCSVRow})
+			continue
+		}
+
+		shortURL := record[0]
+		if mode == importModeReplace {
+			if rowErr := h.replacementRow(ctx, replacement, shortURL, record[1]); rowErr != "" {
+				summary.Errors = append(summary.Errors, types.ImportError{Line: line, ShortURL: shortURL, Error: rowErr})
+			}
+			continue
+		}
+		rowErr, stop := h.importRow(ctx, shortURL, record[1])
+		switch {
+		case rowErr == "":
+			summary.Imported++
+		case rowErr == aliasTaken:
+			summary.Skipped++
+		default:
+			summary.Errors = append(summary.Errors, types.ImportError{Line: line, ShortURL: shortURL, Error: rowErr})
+		}
+		if stop {
+			logger.Warn("Stopped the CSV import early", zap.Int("line", line), zap.String("reason", rowErr))
+			break
+		}
+	}
+
+	if mode == importModeReplace {
+		h.replaceAll(ctx, c, replacement, summary)
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+// replacementRow validates a row of a replace mode import and adds it to replacement. It returns
+// the error message of the row, empty once it is added.
+func (h *URLHandler) replacementRow(ctx context.Context, replacement map[string]string, shortURL, originalURL string) string {
+	originalURL, rowErr := h.checkImportedURL(ctx, originalURL)
+	if rowErr != "" {
+		return rowErr
+	}
+	if services.ValidateImportedShortURL(shortURL) != nil {
+		return invalidAliasProvided
+	}
+	if _, ok := replacement[shortURL]; ok {
+		return duplicateShortURL
+	}
+	replacement[shortURL] = originalURL
+	return ""
+}
+
+// replaceAll answers a replace mode import, replacing the stored URLs with replacement unless
+// summary already holds errors.
+func (h *URLHandler) replaceAll(ctx context.Context, c *gin.Context, replacement map[string]string, summary types.ImportSummary) {
+	if len(summary.Errors) > 0 {
+		c.JSON(http.StatusBadRequest, summary)
+		return
+	}
+	if err := h.service.ReplaceAll(ctx, replacement); err != nil {
+		h.handleError(c, err, map[error]string{
+			services.ErrStorageCapacityReached: storageCapacityFull,
+			context.DeadlineExceeded:           errorTimeout,
+			nil:                                errorCreatingURL,
+		})
+		return
+	}
+	h.requestLogger(c).Info("Replaced the stored URLs with a CSV import", zap.Int("count", len(replacement)))
+	summary.Imported = len(replacement)
+	c.JSON(http.StatusOK, summary)
+}
+
+// importRow validates originalURL and stores it under shortURL. It returns the error message of the
+// row, empty once it is imported and aliasTaken if the short URL is already in use, and whether the
+// rows after it can't be imported either.
+func (h *URLHandler) importRow(ctx context.Context, shortURL, originalURL string) (string, bool) {
+	originalURL, rowErr := h.checkImportedURL(ctx, originalURL)
+	if rowErr != "" {
+		return rowErr, false
+	}
+
+	_, err := h.service.CreateShortURL(ctx, originalURL, services.CreateOptions{Alias: shortURL, Imported: true})
+	switch {
+	case err == nil:
+		return "", false
+	case errors.Is(err, services.ErrAliasTaken):
+		return aliasTaken, false
+	case errors.Is(err, services.ErrInvalidAlias):
+		return invalidAliasProvided, false
+	case errors.Is(err, services.ErrStorageCapacityReached):
+		return storageCapacityFull, true
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return errorTimeout, true
+	default:
+		h.logger.Error("Unexpected error", zap.String("short_url", shortURL), zap.Error(err))
+		return errorCreatingURL, false
+	}
+}
+
+// checkImportedURL normalizes and validates the original URL of an imported row. It returns the
+// normalized URL and the error message of the row, empty if the URL is valid.
+func (h *URLHandler) checkImportedURL(ctx context.Context, originalURL string) (string, string) {
+	originalURL = h.normalizeURL(originalURL)
+	if h.exceedsMaxURLLength(originalURL) {
+		return "", urlTooLong
+	}
+	if err := h.validate.Var(originalURL, "required,url"); err != nil {
+		return "", invalidURLProvided
+	}
+	if err := h.policy.Check(ctx, originalURL); err != nil {
+		_, message := destinationError(err)
+		return "", message
+	}
+	return originalURL, ""
+}
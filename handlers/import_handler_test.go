@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go-url-shortening/config"
+	"go-url-shortening/services"
+	"go-url-shortening/services/mocks"
+	"go-url-shortening/storage"
+	"go-url-shortening/types"
+	"go.uber.org/zap"
+)
+
+func TestImportCSV(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	urlHandler := handler.(*URLHandler)
+
+	uploadTo := func(t *testing.T, target, content string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, err := form.CreateFormFile("file", "export.csv")
+		require.NoError(t, err)
+		_, err = part.Write([]byte(content))
+		require.NoError(t, err)
+		require.NoError(t, form.Close())
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, target, &body)
+		c.Request.Header.Set("Content-Type", form.FormDataContentType())
+		handler.ImportCSV(c)
+		return w
+	}
+	upload := func(t *testing.T, content string) *httptest.ResponseRecorder {
+		return uploadTo(t, "/api/v1/short/import", content)
+	}
+	expectCreate := func(mockService *mocks.MockURLService, shortURL, originalURL string, err error) {
+		mockService.On("CreateShortURL", mock.Anything, originalURL, services.CreateOptions{Alias: shortURL, Imported: true}).
+			Return(types.URLData{ShortURL: shortURL, OriginalURL: originalURL}, err).Once()
+	}
+
+	t.Run("Well-formed file", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		urlHandler.service = mockService
+		expectCreate(mockService, "abc123", "https://example.com/a,b", nil)
+		expectCreate(mockService, "def456", "https://example.org", nil)
+
+		w := upload(t, "short_url,original_url,created_at,updated_at,clicks\n"+
+			`abc123,"https://example.com/a,b",2024-03-01T12:00:00Z,2024-03-01T12:00:00Z,7`+"\n"+
+			"def456,https://example.org\n")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"imported":2,"skipped":0,"errors":[]}`, w.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Duplicates are skipped", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		urlHandler.service = mockService
+		expectCreate(mockService, "abc123", "https://example.com", services.ErrAliasTaken)
+		expectCreate(mockService, "def456", "https://example.org", nil)
+
+		w := upload(t, "abc123,https://example.com\ndef456,https://example.org\n")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"imported":1,"skipped":1,"errors":[]}`, w.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Malformed rows are reported by line", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		urlHandler.service = mockService
+		expectCreate(mockService, "abc123", "https://example.com", nil)
+		expectCreate(mockService, "ab", "https://example.org", services.ErrInvalidAlias)
+
+		w := upload(t, "abc123,https://example.com\n"+
+			"missing-url\n"+
+			`bad"quote,https://example.net`+"\n"+
+			"ghi789,not-a-url\n"+
+			"ab,https://example.org\n")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"imported":1,"skipped":0,"errors":[
+			{"line":2,"error":"Malformed CSV row"},
+			{"line":3,"error":"Malformed CSV row"},
+			{"line":4,"short_url":"ghi789","error":"Invalid URL provided"},
+			{"line":5,"short_url":"ab","error":"Invalid alias provided"}
+		]}`, w.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Stops once the storage is full", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		urlHandler.service = mockService
+		expectCreate(mockService, "abc123", "https://example.com", nil)
+		expectCreate(mockService, "def456", "https://example.org", services.ErrStorageCapacityReached)
+
+		w := upload(t, "abc123,https://example.com\ndef456,https://example.org\nghi789,https://example.net\n")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"imported":1,"skipped":0,"errors":[
+			{"line":2,"short_url":"def456","error":"Storage capacity reached"}
+		]}`, w.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Replace mode replaces the stored URLs", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		urlHandler.service = mockService
+		mockService.On("ReplaceAll", mock.Anything, map[string]string{
+			"abc123": "https://example.com/a,b",
+			"def456": "https://example.org",
+		}).Return(nil).Once()
+
+		w := uploadTo(t, "/api/v1/short/import?mode=replace", "short_url,original_url\n"+
+			`abc123,"https://example.com/a,b"`+"\n"+
+			"def456,https://example.org\n")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"imported":2,"skipped":0,"errors":[]}`, w.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Replace mode leaves the stored URLs untouched on any error", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		urlHandler.service = mockService
+
+		w := uploadTo(t, "/api/v1/short/import?mode=replace", "abc123,https://example.com\n"+
+			"def456,not a url\n"+
+			"abc123,https://example.org\n"+
+			"api,https://example.net\n")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"imported":0,"skipped":0,"errors":[
+			{"line":2,"short_url":"def456","error":"Invalid URL provided"},
+			{"line":3,"short_url":"abc123","error":"Duplicate short URL"},
+			{"line":4,"short_url":"api","error":"Invalid alias provided"}
+		]}`, w.Body.String())
+		mockService.AssertNotCalled(t, "ReplaceAll", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Replace mode once the storage is full", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		urlHandler.service = mockService
+		mockService.On("ReplaceAll", mock.Anything, map[string]string{"abc123": "https://example.com"}).
+			Return(services.ErrStorageCapacityReached).Once()
+
+		w := uploadTo(t, "/api/v1/short/import?mode=replace", "abc123,https://example.com\n")
+
+		assert.Equal(t, http.StatusInsufficientStorage, w.Code)
+		assert.JSONEq(t, `{"error":"Storage capacity reached"}`, w.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Unknown mode", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		urlHandler.service = mockService
+
+		w := uploadTo(t, "/api/v1/short/import?mode=overwrite", "abc123,https://example.com\n")
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"error":"Invalid import mode"}`, w.Body.String())
+		mockService.AssertNotCalled(t, "CreateShortURL", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Upload beyond the body cap", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		urlHandler.service = mockService
+		urlHandler.config.MaxRequestBodyBytes = 256
+		defer func() { urlHandler.config.MaxRequestBodyBytes = 0 }()
+
+		w := upload(t, strings.Repeat("abc123,https://example.com\n", 20))
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.JSONEq(t, `{"error":"Request body too large"}`, w.Body.String())
+		mockService.AssertNotCalled(t, "CreateShortURL", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		urlHandler.service = mockService
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/short/import", strings.NewReader("abc123,https://example.com"))
+		c.Request.Header.Set("Content-Type", "text/csv")
+		handler.ImportCSV(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		mockService.AssertNotCalled(t, "CreateShortURL", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{RateLimit: 10, RatePeriod: time.Second, RequestTimeout: 5 * time.Second, ExportTimeout: time.Minute}
+	newHandler := func(service services.URLService) URLHandlerInterface {
+		handler, err := NewURLHandler(ctx, service, cfg, zap.NewNop())
+		require.NoError(t, err)
+		return handler
+	}
+
+	// Exported from a service generating short URLs unlike the importing one, where "docs" has
+	// since become a reserved word
+	store := storage.NewInMemoryStorage(10, zap.NewNop())
+	require.NoError(t, store.Create(ctx, types.URLData{ShortURL: "docs", OriginalURL: "https://example.com/docs", CreatedAt: time.Now()}))
+	source := services.NewURLService(store, services.WithShortURLFormat(12, "xyz_"))
+	for _, originalURL := range []string{"https://example.com/a", "https://example.com/b"} {
+		_, err := source.CreateShortURL(ctx, originalURL, services.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/short/export", nil)
+	newHandler(source).ExportCSV(c)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "export.csv")
+	require.NoError(t, err)
+	_, err = part.Write(w.Body.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, form.Close())
+
+	target := services.NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()), services.WithReservedWords([]string{"docs"}))
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/short/import", &body)
+	c.Request.Header.Set("Content-Type", form.FormDataContentType())
+	newHandler(target).ImportCSV(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"imported":3,"skipped":0,"errors":[]}`, w.Body.String())
+	destinations := func(service services.URLService) map[string]string {
+		urls := map[string]string{}
+		require.NoError(t, service.ForEach(ctx, func(urlData types.URLData) error {
+			urls[urlData.ShortURL] = urlData.OriginalURL
+			return nil
+		}))
+		return urls
+	}
+	assert.Equal(t, destinations(source), destinations(target), "Every short URL should be restored as exported")
+}
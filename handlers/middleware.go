@@ -2,11 +2,24 @@
 package handlers
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"math"
 	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go-url-shortening/config"
+	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 )
 
@@ -16,16 +29,52 @@ type client struct {
 	lastSeen time.Time
 }
 
-// CORSMiddleware adds CORS headers to the response.
-func CORSMiddleware() gin.HandlerFunc {
+// Defaults of CORSMiddleware, used when the corresponding option is empty.
+var (
+	defaultCORSMethods = []string{"POST", "GET", "OPTIONS", "PUT", "PATCH", "DELETE"}
+	defaultCORSHeaders = []string{"Accept", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization"}
+)
+
+// CORSMiddleware adds CORS headers to the response, as configured by the config.CORS* options, and
+// answers preflight OPTIONS requests with 200. Without config.CORSAllowedOrigins, or when it
+// contains "*", every origin is allowed with a wildcard. Otherwise the request Origin is reflected
+// when it is in the list, and no Access-Control-Allow-Origin header is sent when it isn't.
+func CORSMiddleware(cfg *config.Config) gin.HandlerFunc {
+	methods := cfg.CORSAllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	allowedHeaders := cfg.CORSAllowedHeaders
+	if len(allowedHeaders) == 0 {
+		allowedHeaders = defaultCORSHeaders
+	}
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(allowedHeaders, ", ")
+	anyOrigin := len(cfg.CORSAllowedOrigins) == 0 || slices.Contains(cfg.CORSAllowedOrigins, "*")
+	maxAge := strconv.Itoa(int(cfg.CORSMaxAge.Seconds()))
+
 	return func(c *gin.Context) {
-		// Caveat make these configurable via Config ?
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-		c.Writer.Header().Set("X-Content-Type-Options", "nosniff")
+		header := c.Writer.Header()
+		if anyOrigin {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			// The response depends on the Origin, so caches must not share it across origins
+			header.Add("Vary", "Origin")
+			if origin := c.GetHeader("Origin"); origin != "" && slices.Contains(cfg.CORSAllowedOrigins, origin) {
+				header.Set("Access-Control-Allow-Origin", origin)
+			}
+		}
+		header.Set("Access-Control-Allow-Methods", allowMethods)
+		header.Set("Access-Control-Allow-Headers", allowHeaders)
+		if cfg.CORSAllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		header.Set("X-Content-Type-Options", "nosniff")
 
 		if c.Request.Method == "OPTIONS" {
+			if cfg.CORSMaxAge > 0 {
+				header.Set("Access-Control-Max-Age", maxAge)
+			}
 			c.AbortWithStatus(http.StatusOK)
 			return
 		}
@@ -34,39 +83,291 @@ func CORSMiddleware() gin.HandlerFunc {
 	}
 }
 
-// RateLimitMiddleware applies per-IP rate limiting to the given handler function.
-// It checks if the request is within the rate limit before calling the next handler.
-// If the rate limit is exceeded, it returns a 429 Too Many Requests error.
-func (h *URLHandler) RateLimitMiddleware() gin.HandlerFunc {
-	const (
-		cleanupInterval   = time.Minute
-		clientInactiveFor = 3 * time.Minute
-	)
+// userAgentExemptPaths lists the operational endpoints that are probed by tooling
+// which commonly omits the User-Agent header.
+var userAgentExemptPaths = map[string]bool{
+	healthCheckPath: true,
+	livenessPath:    true,
+	readinessPath:   true,
+	"/metrics":      true,
+}
+
+// RequireUserAgentMiddleware rejects requests without a User-Agent header with a 400 Bad Request.
+// The health check, probe and metrics endpoints are exempt.
+func RequireUserAgentMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.UserAgent() == "" && !userAgentExemptPaths[c.Request.URL.Path] {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "User-Agent header is required"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ReadinessGateMiddleware answers every request with 503 Service Unavailable and a Retry-After
+// header until isReady reports true, so clients arriving during warm-up know to come back.
+// The liveness probe is let through, so that orchestrators don't restart a server still warming up.
+func ReadinessGateMiddleware(isReady func() bool, retryAfter time.Duration) gin.HandlerFunc {
+	seconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+	return func(c *gin.Context) {
+		if !isReady() && c.Request.URL.Path != livenessPath {
+			c.Header("Retry-After", seconds)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Service is starting up"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// MaxRequestBodyMiddleware caps every request body at maxBytes, as sent over the wire. Bodies
+// declaring a larger Content-Length are answered with 413 before being read, and the others are
+// read through http.MaxBytesReader, which fails reads past the cap and closes the connection, so
+// a body of unknown length can't exhaust memory either.
+func MaxRequestBodyMiddleware(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxBytes {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": requestBodyTooLarge})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		c.Next()
+	}
+}
+
+// GzipRequestMiddleware decompresses request bodies sent with Content-Encoding: gzip, so that
+// handlers read them as if they had been sent uncompressed. At most maxBytes are decompressed:
+// larger bodies, and compressed bodies exceeding MaxRequestBodyMiddleware's cap, are answered with
+// 413 rather than expanded further, which defuses zip bombs, and bodies that aren't valid gzip with 400.
+func GzipRequestMiddleware(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.EqualFold(c.GetHeader("Content-Encoding"), "gzip") {
+			c.Next()
+			return
+		}
+
+		zr, err := gzip.NewReader(c.Request.Body)
+		if err != nil {
+			abortBodyError(c, err)
+			return
+		}
+		defer zr.Close()
+		// Reading one byte past the cap tells a body of exactly maxBytes apart from a larger one
+		body, err := io.ReadAll(io.LimitReader(zr, maxBytes+1))
+		if err != nil {
+			abortBodyError(c, err)
+			return
+		}
+		if int64(len(body)) > maxBytes {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": requestBodyTooLarge})
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Request.ContentLength = int64(len(body))
+		c.Request.Header.Del("Content-Encoding")
+		c.Request.Header.Set("Content-Length", strconv.Itoa(len(body)))
+
+		c.Next()
+	}
+}
+
+// abortBodyError answers a request whose body couldn't be read with 413 when it exceeded the cap of
+// MaxRequestBodyMiddleware, and with 400 otherwise.
+func abortBodyError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": requestBodyTooLarge})
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": invalidRequestBody})
+}
+
+// Paths of the health check and of the liveness and readiness probes, polled by orchestrators and
+// load balancers.
+const (
+	healthCheckPath = "/health"
+	livenessPath    = "/livez"
+	readinessPath   = "/readyz"
+)
+
+// isProbe reports whether path is the health check or one of the probes.
+func isProbe(path string) bool {
+	return path == healthCheckPath || path == livenessPath || path == readinessPath
+}
+
+// AccessLogMiddleware logs one structured line per request once the rest of the chain has run,
+// with the method, path, final status, latency, client IP and user agent. Successful health checks
+// are only logged with logHealthChecks, while failing ones always are.
+func AccessLogMiddleware(logger *zap.Logger, logHealthChecks bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		if !logHealthChecks && isProbe(c.Request.URL.Path) && c.Writer.Status() < http.StatusBadRequest {
+			return
+		}
+		logger.Info("Request handled",
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("status", c.Writer.Status()),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("client_ip", c.ClientIP()),
+			zap.String("user_agent", c.Request.UserAgent()),
+			requestIDField(c))
+	}
+}
 
-	var (
-		mu      sync.Mutex
-		clients = make(map[string]*client)
-	)
+// RecoveryMiddleware recovers from panics in the rest of the chain, logging them with their stack,
+// and answers 500 with the API's JSON error body unless a response has already been started.
+func RecoveryMiddleware(logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				// Deliberately aborts the response, and is not logged by net/http either
+				panic(recovered)
+			}
+			logger.Error("Recovered from panic",
+				zap.Any("panic", recovered),
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.Request.URL.Path),
+				requestIDField(c),
+				zap.Stack("stack"))
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": internalServerError})
+		}()
+
+		c.Next()
+	}
+}
+
+// RequestIDHeader carries the ID correlating a request with the log lines it produced.
+const RequestIDHeader = "X-Request-ID"
 
-	// Start a goroutine to periodically clean up inactive clients
-	go h.cleanupInactiveClients(&mu, clients, cleanupInterval, clientInactiveFor)
+// requestIDKey is the gin context key RequestIDMiddleware stores the request ID under.
+const requestIDKey = "request_id"
 
+// maxRequestIDLength bounds the incoming request IDs that are kept, as they end up in every log line.
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware assigns every request an ID, stored on the gin context and echoed back in the
+// X-Request-ID response header. A valid X-Request-ID sent by the client is kept, so that an ID set
+// upstream follows the request through our logs; otherwise a random UUID is generated.
+func RequestIDMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ip := c.ClientIP()
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+
+		c.Next()
+	}
+}
+
+// validRequestID reports whether id is a non-empty request ID of at most maxRequestIDLength
+// printable ASCII characters, which can be logged and echoed back as is.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
 
-		mu.Lock()
-		defer mu.Unlock()
+// requestIDField returns the request ID RequestIDMiddleware assigned to c as a log field,
+// or a no-op field if there is none.
+func requestIDField(c *gin.Context) zap.Field {
+	id := c.GetString(requestIDKey)
+	if id == "" {
+		return zap.Skip()
+	}
+	return zap.String("request_id", id)
+}
+
+// prefixRedirect is a single rule of PrefixRedirectMiddleware.
+type prefixRedirect struct {
+	prefix      string // Leading path, e.g. "/docs"
+	destination string // URL the remaining path is appended to, without a trailing slash
+}
+
+// PrefixRedirectMiddleware redirects GET and HEAD requests whose path is one of the rule prefixes,
+// or lies below one, to the rule's destination with the remaining path and query string appended.
+// With the rule "docs" -> "https://example.com/docs", "/docs/guide" redirects to
+// "https://example.com/docs/guide". The longest matching prefix wins; other requests continue.
+func PrefixRedirectMiddleware(rules map[string]string) gin.HandlerFunc {
+	redirects := make([]prefixRedirect, 0, len(rules))
+	for prefix, destination := range rules {
+		redirects = append(redirects, prefixRedirect{
+			prefix:      "/" + strings.Trim(prefix, "/"),
+			destination: strings.TrimSuffix(destination, "/"),
+		})
+	}
+	sort.Slice(redirects, func(i, j int) bool {
+		return len(redirects[i].prefix) > len(redirects[j].prefix)
+	})
 
-		// Create a new rate limiter for this IP if it doesn't exist
-		if _, found := clients[ip]; !found {
-			clients[ip] = &client{
-				limiter: rate.NewLimiter(rate.Limit(h.config.RateLimit), h.config.RateLimit),
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+
+		path := c.Request.URL.Path
+		for _, redirect := range redirects {
+			rest, found := strings.CutPrefix(path, redirect.prefix)
+			if !found || (rest != "" && !strings.HasPrefix(rest, "/")) {
+				continue
 			}
+			location := redirect.destination + rest
+			if query := c.Request.URL.RawQuery; query != "" {
+				separator := "?"
+				if strings.Contains(location, "?") {
+					separator = "&"
+				}
+				location += separator + query
+			}
+			c.Redirect(http.StatusMovedPermanently, location)
+			c.Abort()
+			return
 		}
-		clients[ip].lastSeen = time.Now()
 
-		// Check if this request is allowed by the rate limiter
-		if !clients[ip].limiter.Allow() {
+		c.Next()
+	}
+}
+
+// RateLimitMiddleware applies per-IP rate limiting to the given handler function.
+// It checks if the request is within the rate limit before calling the next handler.
+// Each client may send a burst of config.RateLimit requests, refilled evenly over config.RatePeriod.
+// If the rate limit is exceeded, it returns a 429 Too Many Requests error with a Retry-After header
+// giving the seconds until the next request is allowed. Every response passing through it carries
+// X-RateLimit-Limit and X-RateLimit-Remaining, the requests left to the client once this one is counted.
+// Every middleware returned shares the handler's limiter, in memory or in Redis, and so one quota
+// per client.
+func (h *URLHandler) RateLimitMiddleware() gin.HandlerFunc {
+	limiter := h.sharedRateLimiter()
+
+	return func(c *gin.Context) {
+		allowed, remaining, retryAfter := limiter.AllowWithQuota(c.ClientIP())
+		c.Header("X-RateLimit-Limit", strconv.Itoa(h.config.RateLimit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !allowed {
+			// Retry-After is in whole seconds, rounded up so that retrying on time succeeds
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(max(retryAfter, time.Second).Seconds()))))
 			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
 			c.Abort()
 			return
@@ -76,16 +377,106 @@ func (h *URLHandler) RateLimitMiddleware() gin.HandlerFunc {
 	}
 }
 
-// cleanupInactiveClients periodically removes clients that haven't been seen recently
-func (h *URLHandler) cleanupInactiveClients(mu *sync.Mutex, clients map[string]*client, interval, inactiveFor time.Duration) {
-	for {
-		time.Sleep(interval)
-		mu.Lock()
-		for ip, client := range clients {
-			if time.Since(client.lastSeen) > inactiveFor {
-				delete(clients, ip)
-			}
+// sharedRateLimiter returns the limiter of every RateLimitMiddleware, creating the in-memory one on
+// first use unless one was given with WithRateLimiter.
+func (h *URLHandler) sharedRateLimiter() RateLimiter {
+	h.rateLimiterOnce.Do(func() {
+		if h.rateLimiter == nil {
+			h.rateLimiter = h.newMemoryRateLimiter()
+		}
+	})
+	return h.rateLimiter
+}
+
+// memoryRateLimiter is the process-local RateLimiter, keeping a token bucket per client IP.
+type memoryRateLimiter struct {
+	h       *URLHandler
+	mu      sync.Mutex
+	clients map[string]*client
+}
+
+// newMemoryRateLimiter creates a memoryRateLimiter for the rate limit of h.config, with a task on
+// the worker pool periodically dropping the clients it hasn't seen recently.
+func (h *URLHandler) newMemoryRateLimiter() *memoryRateLimiter {
+	l := &memoryRateLimiter{h: h, clients: make(map[string]*client)}
+	h.pool.Schedule(rateLimitCleanupInterval, func(context.Context) {
+		h.cleanupInactiveClients(&l.mu, l.clients, rateLimitClientInactiveFor)
+	})
+	return l
+}
+
+// Inactive clients of memoryRateLimiter are looked for every rateLimitCleanupInterval, and dropped
+// once not seen for rateLimitClientInactiveFor.
+const (
+	rateLimitCleanupInterval   = time.Minute
+	rateLimitClientInactiveFor = 3 * time.Minute
+)
+
+// Allow reports whether the client at ip may send another request, consuming a token if so.
+func (l *memoryRateLimiter) Allow(ip string) bool {
+	allowed, _, _ := l.AllowWithQuota(ip)
+	return allowed
+}
+
+// AllowWithQuota is Allow, also reporting the quota left to the client from the tokens of its limiter.
+func (l *memoryRateLimiter) AllowWithQuota(ip string) (bool, int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Create a new rate limiter for this IP if it doesn't exist
+	if _, found := l.clients[ip]; !found {
+		if l.h.config.PruneRateLimitClients {
+			l.h.pruneInactiveClients(l.clients, time.Now(), rateLimitClientInactiveFor, pruneClientsPerInsert)
+		}
+		l.clients[ip] = &client{
+			limiter: rate.NewLimiter(rate.Every(l.h.config.RatePeriod/time.Duration(l.h.config.RateLimit)), l.h.config.RateLimit),
+		}
+		l.h.rateLimitClients.Add(1)
+	}
+	l.clients[ip].lastSeen = time.Now()
+
+	// Check if this request is allowed by the rate limiter
+	limiter := l.clients[ip].limiter
+	now := time.Now()
+	allowed := limiter.AllowN(now, 1)
+	tokens := limiter.TokensAt(now)
+	if allowed {
+		return true, int(max(tokens, 0)), 0
+	}
+	return false, 0, time.Duration((1 - tokens) / float64(limiter.Limit()) * float64(time.Second))
+}
+
+// pruneClientsPerInsert caps how many clients pruneInactiveClients inspects when a new client is
+// tracked, so inserts stay cheap however large the map grows.
+const pruneClientsPerInsert = 8
+
+// pruneInactiveClients inspects at most limit clients and removes those not seen for inactiveFor,
+// returning how many were removed. Map iteration starts at a random entry, so successive calls
+// spread over the whole map. The caller must hold the lock guarding clients.
+func (h *URLHandler) pruneInactiveClients(clients map[string]*client, now time.Time, inactiveFor time.Duration, limit int) int {
+	inspected, removed := 0, 0
+	for ip, client := range clients {
+		if inspected == limit {
+			break
+		}
+		inspected++
+		if now.Sub(client.lastSeen) > inactiveFor {
+			delete(clients, ip)
+			removed++
+		}
+	}
+	h.rateLimitClients.Add(int64(-removed))
+	return removed
+}
+
+// cleanupInactiveClients removes the clients not seen for inactiveFor.
+func (h *URLHandler) cleanupInactiveClients(mu *sync.Mutex, clients map[string]*client, inactiveFor time.Duration) {
+	mu.Lock()
+	defer mu.Unlock()
+	for ip, client := range clients {
+		if time.Since(client.lastSeen) > inactiveFor {
+			delete(clients, ip)
+			h.rateLimitClients.Add(-1)
 		}
-		mu.Unlock()
 	}
 }
@@ -1,14 +1,28 @@
 package handlers
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go-url-shortening/config"
+	"go-url-shortening/services/mocks"
+	"go-url-shortening/types"
+	"go-url-shortening/workerpool"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 const (
@@ -22,22 +36,358 @@ func TestCORSMiddleware(t *testing.T) {
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
 		c.Request = httptest.NewRequest("GET", "/", nil)
-		CORSMiddleware()(c)
+		CORSMiddleware(&config.Config{})(c)
 
 		assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
-		assert.Equal(t, "POST, GET, OPTIONS, PUT, DELETE", w.Header().Get("Access-Control-Allow-Methods"))
+		assert.Equal(t, "POST, GET, OPTIONS, PUT, PATCH, DELETE", w.Header().Get("Access-Control-Allow-Methods"))
 		assert.Equal(t, "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization", w.Header().Get("Access-Control-Allow-Headers"))
 		assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Empty(t, w.Header().Get("Vary"))
 	})
 
 	t.Run("OPTIONS request returns OK status", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		c, _ := gin.CreateTestContext(w)
 		c.Request = httptest.NewRequest("OPTIONS", "/", nil)
-		CORSMiddleware()(c)
+		CORSMiddleware(&config.Config{})(c)
 
 		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Max-Age"))
 	})
+
+	t.Run("Configured origins, methods, headers, credentials and max age", func(t *testing.T) {
+		cfg := &config.Config{
+			CORSAllowedOrigins:   []string{"https://app.example.com", "https://admin.example.com"},
+			CORSAllowedMethods:   []string{"GET", "POST"},
+			CORSAllowedHeaders:   []string{"Content-Type", "X-API-Key"},
+			CORSAllowCredentials: true,
+			CORSMaxAge:           10 * time.Minute,
+		}
+
+		tests := []struct {
+			name           string
+			method         string
+			origin         string
+			expectedOrigin string
+			expectedMaxAge string
+		}{
+			{name: "Listed origin is reflected", method: http.MethodGet, origin: "https://admin.example.com", expectedOrigin: "https://admin.example.com"},
+			{name: "Unlisted origin is not allowed", method: http.MethodGet, origin: "https://evil.example.com"},
+			{name: "Request without origin", method: http.MethodGet},
+			{name: "Preflight is cached", method: http.MethodOptions, origin: "https://app.example.com", expectedOrigin: "https://app.example.com", expectedMaxAge: "600"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(w)
+				c.Request = httptest.NewRequest(tt.method, "/", nil)
+				if tt.origin != "" {
+					c.Request.Header.Set("Origin", tt.origin)
+				}
+				CORSMiddleware(cfg)(c)
+
+				assert.Equal(t, tt.expectedOrigin, w.Header().Get("Access-Control-Allow-Origin"))
+				assert.Equal(t, "Origin", w.Header().Get("Vary"))
+				assert.Equal(t, "GET, POST", w.Header().Get("Access-Control-Allow-Methods"))
+				assert.Equal(t, "Content-Type, X-API-Key", w.Header().Get("Access-Control-Allow-Headers"))
+				assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+				assert.Equal(t, tt.expectedMaxAge, w.Header().Get("Access-Control-Max-Age"))
+			})
+		}
+	})
+
+	t.Run("Wildcard in the list allows every origin", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		c.Request.Header.Set("Origin", "https://app.example.com")
+		CORSMiddleware(&config.Config{CORSAllowedOrigins: []string{"https://a.example.com", "*"}})(c)
+
+		assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	})
+}
+
+func TestRequireUserAgentMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		path           string
+		userAgent      string
+		expectedStatus int
+	}{
+		{name: "Request with User-Agent is allowed", path: "/abc123", userAgent: "curl/8.0", expectedStatus: http.StatusOK},
+		{name: "Request without User-Agent is rejected", path: "/abc123", userAgent: "", expectedStatus: http.StatusBadRequest},
+		{name: "Health check without User-Agent is allowed", path: "/health", userAgent: "", expectedStatus: http.StatusOK},
+		{name: "Liveness probe without User-Agent is allowed", path: "/livez", userAgent: "", expectedStatus: http.StatusOK},
+		{name: "Readiness probe without User-Agent is allowed", path: "/readyz", userAgent: "", expectedStatus: http.StatusOK},
+		{name: "Metrics without User-Agent is allowed", path: "/metrics", userAgent: "", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(RequireUserAgentMiddleware())
+			router.GET("/*path", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusBadRequest {
+				assert.JSONEq(t, `{"error":"User-Agent header is required"}`, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGzipRequestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	cfg := handler.(*URLHandler).config
+	cfg.DisableRateLimit = true
+	cfg.AcceptGzipRequests = true
+	cfg.MaxRequestBodyBytes = 128
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mockService := new(mocks.MockURLService)
+	mockService.On("BatchCreate", mock.Anything, []string{"https://a.com", "https://b.com"}).Return(
+		[]types.URLData{
+			{ShortURL: "aaa111", OriginalURL: "https://a.com", CreatedAt: now, UpdatedAt: now},
+			{ShortURL: "bbb222", OriginalURL: "https://b.com", CreatedAt: now, UpdatedAt: now},
+		},
+		[]error{nil, nil},
+	).Once()
+	handler.(*URLHandler).service = mockService
+
+	router := gin.New()
+	RegisterRoutes(router, handler, cfg, zap.NewNop())
+
+	gzipped := func(body string) *bytes.Buffer {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write([]byte(body))
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		return &buf
+	}
+	post := func(body io.Reader) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/short/batch", body)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", "gzip")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Gzipped batch is decompressed", func(t *testing.T) {
+		w := post(gzipped(`{"urls":["https://a.com","https://b.com"]}`))
+
+		assert.Equal(t, http.StatusMultiStatus, w.Code)
+		assert.Contains(t, w.Body.String(), `"short_url":"bbb222"`)
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Body decompressing beyond the cap is rejected", func(t *testing.T) {
+		// Compresses to far less than the cap, which only applies once decompressed
+		body := gzipped(`{"urls":["https://example.com/` + strings.Repeat("a", 1000) + `"]}`)
+		require.Less(t, body.Len(), 128)
+
+		w := post(body)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.JSONEq(t, `{"error":"Request body too large"}`, w.Body.String())
+	})
+
+	t.Run("Body that isn't gzip is rejected", func(t *testing.T) {
+		w := post(strings.NewReader(`{"urls":["https://a.com"]}`))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, `{"error":"Invalid request body"}`, w.Body.String())
+	})
+
+	t.Run("Compressed body beyond the cap is rejected", func(t *testing.T) {
+		random := make([]byte, 256)
+		for i := range random {
+			random[i] = byte(i * 7919 % 251)
+		}
+		body := gzipped(string(random))
+		require.Greater(t, body.Len(), 128)
+
+		// Hide the length, so that the body is only found too large while being read
+		w := post(io.MultiReader(body))
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.JSONEq(t, `{"error":"Request body too large"}`, w.Body.String())
+	})
+}
+
+func TestMaxRequestBodyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var read []byte
+	var readErr error
+	router := gin.New()
+	router.Use(MaxRequestBodyMiddleware(16))
+	router.POST("/", func(c *gin.Context) {
+		read, readErr = io.ReadAll(c.Request.Body)
+		c.Status(http.StatusNoContent)
+	})
+	post := func(body io.Reader) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", body))
+		return w.Code
+	}
+
+	t.Run("Bodies within the cap are read", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, post(strings.NewReader(strings.Repeat("a", 16))))
+		require.NoError(t, readErr)
+		assert.Len(t, read, 16)
+	})
+
+	t.Run("Declared lengths beyond the cap are rejected unread", func(t *testing.T) {
+		read, readErr = nil, nil
+		assert.Equal(t, http.StatusRequestEntityTooLarge, post(strings.NewReader(strings.Repeat("a", 17))))
+		assert.Nil(t, read, "The handler should not run")
+	})
+
+	t.Run("Bodies of unknown length are cut at the cap", func(t *testing.T) {
+		post(io.MultiReader(strings.NewReader(strings.Repeat("a", 17))))
+		var tooLarge *http.MaxBytesError
+		assert.ErrorAs(t, readErr, &tooLarge)
+		assert.Len(t, read, 16)
+	})
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, logs := observer.New(zap.InfoLevel)
+
+	router := gin.New()
+	router.Use(AccessLogMiddleware(zap.New(core), false))
+	router.GET("/:short_url", func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Short URL not found"})
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+	req.RemoteAddr = testIP
+	req.Header.Set("User-Agent", "curl/8.0")
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, 1, logs.Len())
+	entry := logs.All()[0]
+	assert.Equal(t, "Request handled", entry.Message)
+	fields := entry.ContextMap()
+	assert.Equal(t, http.MethodGet, fields["method"])
+	assert.Equal(t, "/abc123", fields["path"])
+	assert.EqualValues(t, http.StatusNotFound, fields["status"])
+	assert.Contains(t, fields, "latency")
+	assert.Equal(t, "192.0.2.1", fields["client_ip"])
+	assert.Equal(t, "curl/8.0", fields["user_agent"])
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, logs := observer.New(zap.ErrorLevel)
+
+	router := gin.New()
+	router.Use(RecoveryMiddleware(zap.New(core)))
+	router.GET("/panic", func(c *gin.Context) { panic("boom") })
+	router.GET("/partial", func(c *gin.Context) {
+		c.String(http.StatusOK, "partial")
+		panic("boom")
+	})
+
+	t.Run("Panic answers a JSON 500", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.JSONEq(t, `{"error":"Internal server error"}`, w.Body.String())
+
+		entries := logs.TakeAll()
+		require.Len(t, entries, 1)
+		fields := entries[0].ContextMap()
+		assert.Equal(t, "boom", fields["panic"])
+		assert.Equal(t, "/panic", fields["path"])
+		assert.Contains(t, fields["stack"], "TestRecoveryMiddleware")
+	})
+
+	t.Run("Started response is left as is", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/partial", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "partial", w.Body.String())
+		assert.Equal(t, 1, logs.Len())
+	})
+
+	t.Run("Registered by RegisterRoutes", func(t *testing.T) {
+		handler, err := setupTestHandler()
+		require.NoError(t, err)
+		router := gin.New()
+		RegisterRoutes(router, handler, handler.(*URLHandler).config, zap.NewNop())
+		router.GET("/api/v1/panic", func(c *gin.Context) { panic("boom") })
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/panic", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.JSONEq(t, `{"error":"Internal server error"}`, w.Body.String())
+	})
+}
+
+func TestPrefixRedirectMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rules := map[string]string{
+		"docs":       "https://external/docs/",
+		"/docs/api/": "https://api.external/reference",
+		"search":     "https://external/find?source=short",
+	}
+
+	tests := []struct {
+		name             string
+		method           string
+		path             string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{name: "Sub-path is preserved", method: http.MethodGet, path: "/docs/guide", expectedStatus: http.StatusMovedPermanently, expectedLocation: "https://external/docs/guide"},
+		{name: "Prefix itself", method: http.MethodGet, path: "/docs", expectedStatus: http.StatusMovedPermanently, expectedLocation: "https://external/docs"},
+		{name: "Query string is preserved", method: http.MethodGet, path: "/docs/guide?lang=en", expectedStatus: http.StatusMovedPermanently, expectedLocation: "https://external/docs/guide?lang=en"},
+		{name: "Longest prefix wins", method: http.MethodGet, path: "/docs/api/v1", expectedStatus: http.StatusMovedPermanently, expectedLocation: "https://api.external/reference/v1"},
+		{name: "Query is merged with the destination's", method: http.MethodGet, path: "/search?q=go", expectedStatus: http.StatusMovedPermanently, expectedLocation: "https://external/find?source=short&q=go"},
+		{name: "HEAD is redirected", method: http.MethodHead, path: "/docs/guide", expectedStatus: http.StatusMovedPermanently, expectedLocation: "https://external/docs/guide"},
+		{name: "Partial segment does not match", method: http.MethodGet, path: "/docsify", expectedStatus: http.StatusOK},
+		{name: "Other paths fall through", method: http.MethodGet, path: "/abc123", expectedStatus: http.StatusOK},
+		{name: "Other methods fall through", method: http.MethodPost, path: "/docs/guide", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(PrefixRedirectMiddleware(rules))
+			router.Any("/*path", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+		})
+	}
+}
+
+// newTestPool returns a worker pool stopped once the test ends.
+func newTestPool(t *testing.T) *workerpool.Pool {
+	pool := workerpool.New(1, 10)
+	t.Cleanup(pool.Stop)
+	return pool
 }
 
 func TestRateLimitMiddleware(t *testing.T) {
@@ -47,6 +397,7 @@ func TestRateLimitMiddleware(t *testing.T) {
 	}
 	handler := &URLHandler{
 		config: cfg,
+		pool:   newTestPool(t),
 	}
 
 	middleware := handler.RateLimitMiddleware()
@@ -113,3 +464,188 @@ func TestRateLimitMiddleware(t *testing.T) {
 		})
 	})
 }
+
+func TestRateLimitMiddlewareSharesQuota(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := &URLHandler{config: &config.Config{RateLimit: 1, RatePeriod: time.Minute}, pool: newTestPool(t)}
+
+	request := func(middleware gin.HandlerFunc) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		c.Request.RemoteAddr = testIP
+		middleware(c)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request(handler.RateLimitMiddleware()))
+	assert.Equal(t, http.StatusTooManyRequests, request(handler.RateLimitMiddleware()),
+		"Every middleware should draw from the one in-memory quota, like with Redis")
+	assert.EqualValues(t, 1, handler.rateLimitClients.Load())
+}
+
+func TestRateLimitMiddlewareHonorsRatePeriod(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Two requests per two seconds refill one request per second
+	cfg := &config.Config{
+		RateLimit:  2,
+		RatePeriod: 2 * time.Second,
+	}
+	middleware := (&URLHandler{config: cfg, pool: newTestPool(t)}).RateLimitMiddleware()
+
+	request := func() int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		c.Request.RemoteAddr = testIP
+		middleware(c)
+		return w.Code
+	}
+
+	start := time.Now()
+	assert.Equal(t, http.StatusOK, request())
+	assert.Equal(t, http.StatusOK, request())
+	assert.Equal(t, http.StatusTooManyRequests, request(), "The burst is RateLimit requests")
+
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, http.StatusTooManyRequests, request(), "Half of the refill interval is not enough for a request")
+
+	time.Sleep(time.Second - time.Since(start) + 50*time.Millisecond)
+	assert.Equal(t, http.StatusOK, request(), "One request is refilled every RatePeriod/RateLimit")
+	assert.Equal(t, http.StatusTooManyRequests, request())
+}
+
+func TestRateLimitMiddlewareHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Two requests per minute refill one request every thirty seconds
+	cfg := &config.Config{
+		RateLimit:  2,
+		RatePeriod: time.Minute,
+	}
+	middleware := (&URLHandler{config: cfg, pool: newTestPool(t)}).RateLimitMiddleware()
+
+	request := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		c.Request.RemoteAddr = testIP
+		middleware(c)
+		return w
+	}
+
+	for _, remaining := range []string{"1", "0"} {
+		w := request()
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, remaining, w.Header().Get("X-RateLimit-Remaining"))
+		assert.Empty(t, w.Header().Get("Retry-After"), "Only rejected requests are told to retry")
+	}
+
+	w := request()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "30", w.Header().Get("Retry-After"), "The next request is allowed once one is refilled")
+}
+
+func TestPruneInactiveClients(t *testing.T) {
+	now := time.Now()
+	handler := &URLHandler{config: &config.Config{RateLimit: 10, RatePeriod: time.Second}}
+
+	clients := make(map[string]*client)
+	for i := 0; i < 100; i++ {
+		clients[fmt.Sprintf("192.0.2.%d", i)] = &client{lastSeen: now.Add(-time.Hour)}
+	}
+	clients["198.51.100.1"] = &client{lastSeen: now}
+	handler.rateLimitClients.Store(int64(len(clients)))
+
+	removed := handler.pruneInactiveClients(clients, now, time.Minute, pruneClientsPerInsert)
+	assert.LessOrEqual(t, removed, pruneClientsPerInsert, "A single prune should only inspect a bounded number of clients")
+	assert.GreaterOrEqual(t, removed, pruneClientsPerInsert-1, "Every inspected inactive client should be removed")
+	assert.Len(t, clients, 101-removed)
+	assert.Equal(t, int64(len(clients)), handler.rateLimitClients.Load())
+	assert.Contains(t, clients, "198.51.100.1", "Active clients are kept")
+
+	// Repeated inserts eventually clear every inactive client
+	for len(clients) > 1 {
+		handler.pruneInactiveClients(clients, now, time.Minute, pruneClientsPerInsert)
+	}
+	assert.Contains(t, clients, "198.51.100.1")
+	assert.Equal(t, int64(1), handler.rateLimitClients.Load())
+}
+
+func TestRateLimitMiddlewareGuardsHealth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	cfg := handler.(*URLHandler).config
+	handler.(*URLHandler).service.(*mocks.MockURLService).On("Ping", mock.Anything).Return(nil)
+
+	router := gin.New()
+	RegisterRoutes(router, handler, cfg, zap.NewNop())
+
+	health := func(remoteAddr string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.RemoteAddr = remoteAddr
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i := 0; i < cfg.RateLimit; i++ {
+		assert.Equal(t, http.StatusOK, health(testIP))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, health(testIP), "The handler's own limiter should reject the burst overflow")
+	assert.Equal(t, http.StatusOK, health("192.0.2.3:1234"), "Other clients have their own limiter")
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, logs := observer.New(zap.InfoLevel)
+	cfg := &config.Config{RateLimit: 10, RatePeriod: time.Second, RequestTimeout: 5 * time.Second}
+	mockService := new(mocks.MockURLService)
+	mockService.On("GetURLData", mock.Anything, "abc123").Return(types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}, nil)
+	mockService.On("RecordAccess", mock.Anything, "abc123").Return(nil)
+	handler, err := NewURLHandler(context.Background(), mockService, cfg, zap.New(core))
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(RequestIDMiddleware())
+	router.GET("/:short_url", handler.RedirectURL)
+
+	redirect := func(requestID string) (string, []observer.LoggedEntry) {
+		logs.TakeAll()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+		if requestID != "" {
+			req.Header.Set(RequestIDHeader, requestID)
+		}
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusFound, w.Code)
+		return w.Header().Get(RequestIDHeader), logs.FilterMessage("Redirecting").All()
+	}
+
+	t.Run("Incoming ID is echoed and logged", func(t *testing.T) {
+		id, entries := redirect("req-42")
+		assert.Equal(t, "req-42", id)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "req-42", entries[0].ContextMap()["request_id"])
+	})
+
+	t.Run("Missing ID is generated", func(t *testing.T) {
+		id, entries := redirect("")
+		_, err := uuid.Parse(id)
+		assert.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, id, entries[0].ContextMap()["request_id"])
+	})
+
+	t.Run("Unsafe ID is replaced", func(t *testing.T) {
+		for _, requestID := range []string{"has space", strings.Repeat("a", maxRequestIDLength+1)} {
+			id, _ := redirect(requestID)
+			assert.NotEqual(t, requestID, id)
+			_, err := uuid.Parse(id)
+			assert.NoError(t, err)
+		}
+	})
+}
@@ -17,22 +17,90 @@ func (m *MockURLHandler) GetURLData(c *gin.Context) {
 	m.Called(c)
 }
 
+func (m *MockURLHandler) GetURLByExternalID(c *gin.Context) {
+	m.Called(c)
+}
+
 func (m *MockURLHandler) UpdateURL(c *gin.Context) {
 	m.Called(c)
 }
 
+func (m *MockURLHandler) BatchDeleteShortURLs(c *gin.Context) {
+	m.Called(c)
+}
+
+func (m *MockURLHandler) BatchGetURLData(c *gin.Context) {
+	m.Called(c)
+}
+
+func (m *MockURLHandler) ImportCSV(c *gin.Context) {
+	m.Called(c)
+}
+
+func (m *MockURLHandler) PatchURL(c *gin.Context) {
+	m.Called(c)
+}
+
 func (m *MockURLHandler) DeleteURL(c *gin.Context) {
 	m.Called(c)
 }
 
+func (m *MockURLHandler) RestoreURL(c *gin.Context) {
+	m.Called(c)
+}
+
 func (m *MockURLHandler) HealthCheck(c *gin.Context) {
 	m.Called(c)
 }
 
+func (m *MockURLHandler) Liveness(c *gin.Context) {
+	m.Called(c)
+}
+
+func (m *MockURLHandler) Readiness(c *gin.Context) {
+	m.Called(c)
+}
+
 func (m *MockURLHandler) RedirectURL(c *gin.Context) {
 	m.Called(c)
 }
 
+func (m *MockURLHandler) ListURLs(c *gin.Context) {
+	m.Called(c)
+}
+
+func (m *MockURLHandler) RuntimeStats(c *gin.Context) {
+	m.Called(c)
+}
+
+func (m *MockURLHandler) EffectiveConfig(c *gin.Context) {
+	m.Called(c)
+}
+
+func (m *MockURLHandler) ExportCSV(c *gin.Context) {
+	m.Called(c)
+}
+
+func (m *MockURLHandler) TopURLs(c *gin.Context) {
+	m.Called(c)
+}
+
+func (m *MockURLHandler) GetURLStats(c *gin.Context) {
+	m.Called(c)
+}
+
+func (m *MockURLHandler) BatchCreateShortURLs(c *gin.Context) {
+	m.Called(c)
+}
+
+func (m *MockURLHandler) GetBatchJob(c *gin.Context) {
+	m.Called(c)
+}
+
+func (m *MockURLHandler) GetQRCode(c *gin.Context) {
+	m.Called(c)
+}
+
 func (m *MockURLHandler) RateLimitMiddleware() gin.HandlerFunc {
 	args := m.Called()
 	return args.Get(0).(gin.HandlerFunc)
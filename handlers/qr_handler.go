@@ -0,0 +1,65 @@
+// Package handlers provides HTTP request handlers for the URL shortener service.
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+	"go-url-shortening/services"
+	"go.uber.org/zap"
+)
+
+// Bounds of the "size" query parameter of GetQRCode, in pixels.
+const (
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 1024
+)
+
+// GetQRCode renders a PNG QR code encoding the full short link of a given short URL, under
+// config.BaseURL when set and otherwise built from the host the request was sent to.
+// The image is square, with a side of the "size" query parameter in pixels (default 256).
+func (h *URLHandler) GetQRCode(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.config.RequestTimeout)
+	defer cancel()
+
+	size, err := positiveQueryInt(c, "size", defaultQRSize)
+	if err != nil || size < minQRSize || size > maxQRSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidSizeProvided})
+		return
+	}
+
+	urlData, err := h.service.GetURLData(ctx, c.Param("short_url"))
+	if err != nil {
+		h.handleError(c, err, map[error]string{
+			services.ErrShortURLNotFound: shortURLNotFound,
+			services.ErrShortURLExpired:  shortURLExpired,
+			context.DeadlineExceeded:     errorTimeout,
+			nil:                          errorRetrievingURL,
+		})
+		return
+	}
+
+	link := h.configuredShortLink(urlData.ShortURL)
+	if link == "" {
+		link = shortLink(c.Request, urlData.ShortURL)
+	}
+	png, err := qrcode.Encode(link, qrcode.Medium, size)
+	if err != nil {
+		h.logger.Error("Failed to render QR code", zap.String("short_url", urlData.ShortURL), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errorRenderingQRCode})
+		return
+	}
+	c.Data(http.StatusOK, "image/png", png)
+}
+
+// shortLink returns the absolute URL redirecting to shortURL, built from the host the request was sent to.
+func shortLink(r *http.Request, shortURL string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/" + shortURL
+}
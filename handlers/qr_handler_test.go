@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go-url-shortening/services"
+	"go-url-shortening/services/mocks"
+	"go-url-shortening/types"
+)
+
+func TestGetQRCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		shortURL       string
+		query          string
+		serviceErr     error
+		expectedStatus int
+		expectedSize   int
+	}{
+		{name: "Default size", shortURL: "abc123", expectedStatus: http.StatusOK, expectedSize: defaultQRSize},
+		{name: "Custom size", shortURL: "abc123", query: "?size=128", expectedStatus: http.StatusOK, expectedSize: 128},
+		{name: "Size too small", shortURL: "abc123", query: "?size=8", expectedStatus: http.StatusBadRequest},
+		{name: "Size too large", shortURL: "abc123", query: "?size=4096", expectedStatus: http.StatusBadRequest},
+		{name: "Size not a number", shortURL: "abc123", query: "?size=big", expectedStatus: http.StatusBadRequest},
+		{name: "Short URL not found", shortURL: "notfound", serviceErr: services.ErrShortURLNotFound, expectedStatus: http.StatusNotFound},
+		{name: "Short URL expired", shortURL: "expired", serviceErr: services.ErrShortURLExpired, expectedStatus: http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(mocks.MockURLService)
+			mockService.On("GetURLData", mock.Anything, tt.shortURL).Return(types.URLData{ShortURL: tt.shortURL, OriginalURL: "https://example.com"}, tt.serviceErr)
+			handler.(*URLHandler).service = mockService
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/short/"+tt.shortURL+"/qr"+tt.query, nil)
+			c.Params = gin.Params{{Key: "short_url", Value: tt.shortURL}}
+
+			handler.GetQRCode(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+				return
+			}
+			assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+			img, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedSize, img.Bounds().Dx())
+			assert.Equal(t, tt.expectedSize, img.Bounds().Dy())
+		})
+	}
+}
+
+func TestShortLink(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/short/abc123/qr", nil)
+	req.Host = "sho.rt"
+	assert.Equal(t, "http://sho.rt/abc123", shortLink(req, "abc123"))
+
+	req = httptest.NewRequest(http.MethodGet, "https://sho.rt/api/v1/short/abc123/qr", nil)
+	assert.Equal(t, "https://sho.rt/abc123", shortLink(req, "abc123"))
+}
@@ -0,0 +1,100 @@
+// Package handlers provides HTTP request handlers for the URL shortener service.
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// RateLimiter decides whether a client, identified by its IP, may send another request.
+type RateLimiter interface {
+	Allow(ip string) bool
+	// AllowWithQuota is Allow, also reporting the requests the client has left once this one is
+	// counted and, when it is rejected, how long until the client may send another one.
+	AllowWithQuota(ip string) (allowed bool, remaining int, retryAfter time.Duration)
+}
+
+// redisRateLimitKeyPrefix prefixes the key of the token bucket of every client in Redis.
+const redisRateLimitKeyPrefix = "ratelimit:"
+
+// redisRateLimitTimeout bounds how long a request waits for Redis before being let through.
+const redisRateLimitTimeout = 100 * time.Millisecond
+
+// redisTokenBucketScript refills and takes a token from the bucket of a client in one atomic step.
+// The clock is the Redis server's, so instances with skewed clocks still agree on the refill.
+// KEYS: bucket key. ARGV: burst, microseconds to refill one token. Returns 1 if allowed and 0 otherwise,
+// the whole tokens left, and the microseconds until the next token when rejected.
+var redisTokenBucketScript = redis.NewScript(`
+local burst = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated_at")
+local tokens = tonumber(bucket[1])
+local updatedAt = tonumber(bucket[2])
+if tokens == nil or updatedAt == nil then
+  tokens = burst
+else
+  tokens = math.min(burst, tokens + math.max(0, now - updatedAt) / interval)
+end
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) * interval)
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated_at", tostring(now))
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst * interval / 1000))
+return {allowed, math.floor(tokens), wait}`)
+
+// RedisRateLimiter is a RateLimiter keeping a token bucket per client IP in Redis, so that every
+// instance of the service sharing the Redis server enforces one quota per client between them.
+// Like the in-memory limiter, each client may send a burst of limit requests, refilled evenly over
+// period. Buckets expire once full again, so idle clients cost nothing.
+type RedisRateLimiter struct {
+	client   *redis.Client
+	limit    int
+	interval time.Duration // Time to refill one token
+	logger   *zap.Logger
+}
+
+// NewRedisRateLimiter creates a RedisRateLimiter allowing limit requests per client every period.
+func NewRedisRateLimiter(client *redis.Client, limit int, period time.Duration, logger *zap.Logger) *RedisRateLimiter {
+	return &RedisRateLimiter{
+		client:   client,
+		limit:    limit,
+		interval: period / time.Duration(limit),
+		logger:   logger,
+	}
+}
+
+// Allow reports whether the client at ip may send another request, consuming a token if so.
+func (l *RedisRateLimiter) Allow(ip string) bool {
+	allowed, _, _ := l.AllowWithQuota(ip)
+	return allowed
+}
+
+// AllowWithQuota is Allow, also reporting the quota left to the client. Requests are let through
+// when Redis can't be reached, so that an outage of the limiter doesn't take the service down with
+// it, and are then reported with the full quota left.
+func (l *RedisRateLimiter) AllowWithQuota(ip string) (bool, int, time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisRateLimitTimeout)
+	defer cancel()
+
+	reply, err := redisTokenBucketScript.Run(ctx, l.client, []string{redisRateLimitKeyPrefix + ip},
+		l.limit, max(l.interval.Microseconds(), 1)).Int64Slice()
+	if err == nil && len(reply) != 3 {
+		err = fmt.Errorf("unexpected rate limit reply %v", reply)
+	}
+	if err != nil {
+		l.logger.Warn("Redis rate limiting failed, allowing request", zap.String("ip", ip), zap.Error(err))
+		return true, l.limit, 0
+	}
+	return reply[0] == 1, int(reply[1]), time.Duration(reply[2]) * time.Microsecond
+}
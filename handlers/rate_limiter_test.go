@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-url-shortening/config"
+	"go-url-shortening/services/mocks"
+	"go.uber.org/zap"
+)
+
+func TestRedisRateLimiter(t *testing.T) {
+	server := miniredis.RunT(t)
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	server.SetTime(now)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	// Two requests per two seconds refill one request per second
+	limiter := NewRedisRateLimiter(client, 2, 2*time.Second, zap.NewNop())
+
+	t.Run("Burst, then refill", func(t *testing.T) {
+		assert.True(t, limiter.Allow(testIP))
+		assert.True(t, limiter.Allow(testIP))
+		assert.False(t, limiter.Allow(testIP), "The burst is the limit")
+		assert.True(t, limiter.Allow("192.0.2.2"), "Clients have buckets of their own")
+
+		server.SetTime(now.Add(500 * time.Millisecond))
+		assert.False(t, limiter.Allow(testIP), "Half of the refill interval is not enough for a request")
+
+		server.SetTime(now.Add(time.Second))
+		assert.True(t, limiter.Allow(testIP), "One request is refilled every period/limit")
+		assert.False(t, limiter.Allow(testIP))
+	})
+
+	t.Run("Quota", func(t *testing.T) {
+		allowed, remaining, retryAfter := limiter.AllowWithQuota("192.0.2.3")
+		assert.True(t, allowed)
+		assert.Equal(t, 1, remaining)
+		assert.Zero(t, retryAfter)
+		limiter.Allow("192.0.2.3")
+
+		allowed, remaining, retryAfter = limiter.AllowWithQuota("192.0.2.3")
+		assert.False(t, allowed)
+		assert.Zero(t, remaining)
+		assert.Equal(t, time.Second, retryAfter, "The next token is refilled after period/limit")
+	})
+
+	t.Run("Instances share the quota", func(t *testing.T) {
+		otherClient := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		defer otherClient.Close()
+		other := NewRedisRateLimiter(otherClient, 2, 2*time.Second, zap.NewNop())
+		assert.True(t, limiter.Allow("198.51.100.1"))
+		assert.True(t, other.Allow("198.51.100.1"))
+		assert.False(t, limiter.Allow("198.51.100.1"))
+		assert.False(t, other.Allow("198.51.100.1"))
+	})
+
+	t.Run("Idle buckets expire", func(t *testing.T) {
+		limiter.Allow("203.0.113.1")
+		assert.True(t, server.Exists(redisRateLimitKeyPrefix+"203.0.113.1"))
+		server.FastForward(2 * time.Second)
+		assert.False(t, server.Exists(redisRateLimitKeyPrefix+"203.0.113.1"))
+	})
+
+	t.Run("Requests are allowed while Redis is unavailable", func(t *testing.T) {
+		unavailable := NewRedisRateLimiter(redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"}), 1, time.Minute, zap.NewNop())
+		assert.True(t, unavailable.Allow(testIP))
+		allowed, remaining, _ := unavailable.AllowWithQuota(testIP)
+		assert.True(t, allowed)
+		assert.Equal(t, 1, remaining, "The full quota is reported while Redis is unavailable")
+	})
+}
+
+func TestRateLimitMiddlewareUsesSharedLimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	cfg := &config.Config{RateLimit: 1, RatePeriod: time.Minute}
+	created, err := NewURLHandler(context.Background(), new(mocks.MockURLService), cfg, zap.NewNop(),
+		WithRateLimiter(NewRedisRateLimiter(client, cfg.RateLimit, cfg.RatePeriod, zap.NewNop())))
+	require.NoError(t, err)
+	handler := created.(*URLHandler)
+
+	request := func(middleware gin.HandlerFunc) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		c.Request.RemoteAddr = testIP
+		middleware(c)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request(handler.RateLimitMiddleware()))
+	assert.Equal(t, http.StatusTooManyRequests, request(handler.RateLimitMiddleware()),
+		"Every middleware should draw from the one quota kept in Redis")
+	assert.Zero(t, handler.rateLimitClients.Load(), "No client should be tracked in memory")
+}
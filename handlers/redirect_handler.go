@@ -2,26 +2,54 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"html/template"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"go.uber.org/zap"
 
 	"go-url-shortening/services"
+	"go-url-shortening/types"
 )
 
 const (
 	errShortURLNotFound   = "Short URL not found"
+	errShortURLExpired    = "Short URL expired"
 	errRequestTimeout     = "Request timed out"
 	errRetrievingURL      = "Error retrieving URL"
 	errInvalidRedirectURL = "Invalid redirect URL"
+	errPrivateRedirect    = "Redirect to a private address blocked"
 )
 
+// RedirectModeMeta is the config.RedirectMode that answers redirects with an HTML page instead of a 3xx.
+const RedirectModeMeta = "meta"
+
+// metaRedirectPage redirects clients that don't follow 3xx responses, using a meta refresh with a
+// JavaScript fallback and a plain link as the last resort. html/template escapes the destination
+// for each context it appears in.
+var metaRedirectPage = template.Must(template.New("redirect").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="0; url={{.}}">
+<title>Redirecting</title>
+</head>
+<body>
+<script>window.location.replace({{.}});</script>
+<p>Redirecting to <a href="{{.}}">{{.}}</a></p>
+</body>
+</html>
+`))
+
 // RedirectURL handles the redirection from a short URL to its original URL.
 // It retrieves the original URL associated with the given short URL from the storage
-// and performs an HTTP redirect to that URL.
+// and performs an HTTP redirect to that URL. HEAD requests, as sent by monitoring tools,
+// get the same status and headers without a body, and are not counted as accesses.
+// Clients preferring JSON in their Accept header get the destination as JSON instead.
 func (h *URLHandler) RedirectURL(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), h.config.RequestTimeout)
 	defer cancel()
@@ -39,21 +67,107 @@ func (h *URLHandler) RedirectURL(c *gin.Context) {
 		h.handleInvalidRedirectURL(c, shortURL, urlData.OriginalURL)
 		return
 	}
+	// Catches URLs stored before the option was set, and names re-pointed at internal addresses since
+	if h.policy.ResolvesToPrivate(ctx, urlData.OriginalURL) {
+		h.requestLogger(c).Warn("Blocked redirect to a private address",
+			zap.String("short_url", shortURL),
+			zap.String("original_url", urlData.OriginalURL))
+		c.JSON(http.StatusForbidden, gin.H{"error": errPrivateRedirect})
+		return
+	}
+
+	// The response depends on Accept, which caches of permanent redirects must take into account
+	c.Writer.Header().Add("Vary", "Accept")
+	if prefersJSON(c) {
+		h.redirectTarget(c, urlData)
+		return
+	}
+	if c.Request.Method == http.MethodHead {
+		h.headRedirect(c, urlData.OriginalURL)
+		return
+	}
+
+	// A failed count must not fail the redirect itself
+	if err := h.service.RecordAccess(ctx, shortURL); err != nil {
+		h.requestLogger(c).Warn("Failed to record access", zap.String("short_url", shortURL), zap.Error(err))
+	}
 
 	h.logRedirect(c, shortURL, urlData.OriginalURL)
-	c.Redirect(http.StatusMovedPermanently, urlData.OriginalURL)
+	if h.config.RedirectMode == RedirectModeMeta {
+		h.metaRedirect(c, urlData.OriginalURL)
+		return
+	}
+	c.Redirect(h.redirectStatus(), urlData.OriginalURL)
+}
+
+// prefersJSON reports whether the Accept header of c lists JSON before HTML or any wildcard, so that
+// the client wants the destination of a short URL rather than to be redirected to it. Clients that
+// send no Accept header, like browsers following links, keep being redirected.
+func prefersJSON(c *gin.Context) bool {
+	return c.NegotiateFormat(binding.MIMEHTML, binding.MIMEJSON) == binding.MIMEJSON
+}
+
+// redirectTarget answers 200 with the destination of urlData as JSON, for API clients resolving a
+// short URL without following it. It isn't counted as an access, as the destination isn't visited.
+func (h *URLHandler) redirectTarget(c *gin.Context, urlData types.URLData) {
+	if c.Request.Method == http.MethodHead {
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		c.Status(http.StatusOK)
+		c.Writer.WriteHeaderNow()
+		return
+	}
+	c.JSON(http.StatusOK, types.RedirectTargetResponse{
+		ShortURL:    urlData.ShortURL,
+		OriginalURL: urlData.OriginalURL,
+		CreatedAt:   urlData.CreatedAt,
+	})
+}
+
+// redirectStatus returns the configured status of short URL redirects, 302 Found by default.
+func (h *URLHandler) redirectStatus() int {
+	if h.config.RedirectStatus == 0 {
+		return http.StatusFound
+	}
+	return h.config.RedirectStatus
+}
+
+// metaRedirect answers 200 with an HTML page that sends the client on to destination.
+func (h *URLHandler) metaRedirect(c *gin.Context, destination string) {
+	var page bytes.Buffer
+	if err := metaRedirectPage.Execute(&page, destination); err != nil {
+		h.logger.Error("Failed to render redirect page", zap.String("original_url", destination), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errRetrievingURL})
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
+
+// headRedirect answers a HEAD request with the status and headers a GET would get, without a body.
+func (h *URLHandler) headRedirect(c *gin.Context, destination string) {
+	if h.config.RedirectMode == RedirectModeMeta {
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Status(http.StatusOK)
+	} else {
+		c.Header("Location", destination)
+		c.Status(h.redirectStatus())
+	}
+	c.Writer.WriteHeaderNow()
 }
 
 func (h *URLHandler) handleRedirectError(c *gin.Context, err error, shortURL string) {
+	logger := h.requestLogger(c)
 	switch {
 	case errors.Is(err, services.ErrShortURLNotFound):
-		h.logger.Info("Short URL not found", zap.String("short_url", shortURL))
+		logger.Info("Short URL not found", zap.String("short_url", shortURL))
 		c.JSON(http.StatusNotFound, gin.H{"error": errShortURLNotFound})
+	case errors.Is(err, services.ErrShortURLExpired):
+		logger.Info("Short URL expired", zap.String("short_url", shortURL))
+		c.JSON(http.StatusGone, gin.H{"error": errShortURLExpired})
 	case errors.Is(err, context.DeadlineExceeded):
-		h.logger.Warn("Request timed out", zap.String("short_url", shortURL))
+		logger.Warn("Request timed out", zap.String("short_url", shortURL))
 		c.JSON(http.StatusRequestTimeout, gin.H{"error": errRequestTimeout})
 	default:
-		h.logger.Error("Error retrieving URL",
+		logger.Error("Error retrieving URL",
 			zap.String("short_url", shortURL),
 			zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": errRetrievingURL})
@@ -61,14 +175,14 @@ func (h *URLHandler) handleRedirectError(c *gin.Context, err error, shortURL str
 }
 
 func (h *URLHandler) handleInvalidRedirectURL(c *gin.Context, shortURL, originalURL string) {
-	h.logger.Warn("Invalid original URL",
+	h.requestLogger(c).Warn("Invalid original URL",
 		zap.String("short_url", shortURL),
 		zap.String("original_url", originalURL))
 	c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidRedirectURL})
 }
 
 func (h *URLHandler) logRedirect(c *gin.Context, shortURL, originalURL string) {
-	h.logger.Info("Redirecting",
+	h.requestLogger(c).Info("Redirecting",
 		zap.String("short_url", shortURL),
 		zap.String("original_url", originalURL),
 		zap.String("ip", c.ClientIP()),
@@ -45,7 +45,7 @@ func TestRedirectURL(t *testing.T) {
 			mockGetURLData: func(ctx context.Context, shortURL string) (types.URLData, error) {
 				return types.URLData{OriginalURL: "https://example.com"}, nil
 			},
-			expectedStatus: http.StatusMovedPermanently,
+			expectedStatus: http.StatusFound,
 			expectedURL:    "https://example.com",
 		},
 		{
@@ -57,6 +57,15 @@ func TestRedirectURL(t *testing.T) {
 			expectedStatus: http.StatusNotFound,
 			expectedBody:   `{"error":"Short URL not found"}`,
 		},
+		{
+			name:     "Short URL expired",
+			shortURL: "expired",
+			mockGetURLData: func(ctx context.Context, shortURL string) (types.URLData, error) {
+				return types.URLData{}, services.ErrShortURLExpired
+			},
+			expectedStatus: http.StatusGone,
+			expectedBody:   `{"error":"Short URL expired"}`,
+		},
 		{
 			name:     "Service error",
 			shortURL: "error",
@@ -90,6 +99,7 @@ func TestRedirectURL(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			mockService := new(mocks.MockURLService)
 			mockService.On("GetURLData", mock.Anything, tt.shortURL).Return(tt.mockGetURLData(ctx, tt.shortURL))
+			mockService.On("RecordAccess", mock.Anything, tt.shortURL).Return(nil).Maybe()
 
 			handler, err := NewURLHandler(ctx, mockService, cfg, mockLogger)
 			require.NoError(t, err)
@@ -103,10 +113,215 @@ func TestRedirectURL(t *testing.T) {
 
 			assert.Equal(t, tt.expectedStatus, w.Code)
 
-			if tt.expectedStatus == http.StatusMovedPermanently {
+			if tt.expectedStatus == http.StatusFound {
 				assert.Equal(t, tt.expectedURL, w.Header().Get("Location"))
+				mockService.AssertCalled(t, "RecordAccess", mock.Anything, tt.shortURL)
 			} else {
 				assert.JSONEq(t, tt.expectedBody, w.Body.String())
+				mockService.AssertNotCalled(t, "RecordAccess", mock.Anything, tt.shortURL)
+			}
+		})
+	}
+}
+
+func TestRedirectURLStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		redirectStatus int
+		expectedStatus int
+	}{
+		{name: "Default", redirectStatus: 0, expectedStatus: http.StatusFound},
+		{name: "301", redirectStatus: http.StatusMovedPermanently, expectedStatus: http.StatusMovedPermanently},
+		{name: "302", redirectStatus: http.StatusFound, expectedStatus: http.StatusFound},
+		{name: "307", redirectStatus: http.StatusTemporaryRedirect, expectedStatus: http.StatusTemporaryRedirect},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				RateLimit:      10,
+				RatePeriod:     time.Second,
+				RequestTimeout: 5 * time.Second,
+				RedirectStatus: tt.redirectStatus,
+			}
+			mockService := new(mocks.MockURLService)
+			mockService.On("GetURLData", mock.Anything, "abc123").Return(types.URLData{OriginalURL: "https://example.com/page?a=1"}, nil)
+			mockService.On("RecordAccess", mock.Anything, "abc123").Return(nil)
+			handler, err := NewURLHandler(context.Background(), mockService, cfg, zap.NewNop())
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Params = gin.Params{{Key: "short_url", Value: "abc123"}}
+			c.Request = httptest.NewRequest(http.MethodGet, "/abc123", nil)
+
+			handler.RedirectURL(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, "https://example.com/page?a=1", w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestRedirectURLHead(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, redirectMode := range []string{"", RedirectModeMeta} {
+		t.Run("RedirectMode="+redirectMode, func(t *testing.T) {
+			cfg := &config.Config{
+				RateLimit:      10,
+				RatePeriod:     time.Second,
+				RequestTimeout: 5 * time.Second,
+				RedirectMode:   redirectMode,
+			}
+			mockService := new(mocks.MockURLService)
+			mockService.On("GetURLData", mock.Anything, "abc123").Return(types.URLData{OriginalURL: "https://example.com"}, nil)
+			mockService.On("GetURLData", mock.Anything, "missing").Return(types.URLData{}, services.ErrShortURLNotFound)
+			mockService.On("RecordAccess", mock.Anything, "abc123").Return(nil)
+			handler, err := NewURLHandler(context.Background(), mockService, cfg, zap.NewNop())
+			require.NoError(t, err)
+
+			router := gin.New()
+			router.GET("/:short_url", handler.RedirectURL)
+			router.HEAD("/:short_url", handler.RedirectURL)
+
+			get := httptest.NewRecorder()
+			router.ServeHTTP(get, httptest.NewRequest(http.MethodGet, "/abc123", nil))
+			head := httptest.NewRecorder()
+			router.ServeHTTP(head, httptest.NewRequest(http.MethodHead, "/abc123", nil))
+
+			assert.Equal(t, get.Code, head.Code)
+			assert.Equal(t, get.Header().Get("Location"), head.Header().Get("Location"))
+			if redirectMode == RedirectModeMeta {
+				assert.Equal(t, get.Header().Get("Content-Type"), head.Header().Get("Content-Type"))
+			}
+			assert.NotEmpty(t, get.Body.String())
+			assert.Empty(t, head.Body.String())
+			mockService.AssertNumberOfCalls(t, "RecordAccess", 1)
+
+			missing := httptest.NewRecorder()
+			router.ServeHTTP(missing, httptest.NewRequest(http.MethodHead, "/missing", nil))
+			assert.Equal(t, http.StatusNotFound, missing.Code)
+		})
+	}
+
+	t.Run("Default redirect", func(t *testing.T) {
+		cfg := &config.Config{RateLimit: 10, RatePeriod: time.Second, RequestTimeout: 5 * time.Second}
+		mockService := new(mocks.MockURLService)
+		mockService.On("GetURLData", mock.Anything, "abc123").Return(types.URLData{OriginalURL: "https://example.com"}, nil)
+		handler, err := NewURLHandler(context.Background(), mockService, cfg, zap.NewNop())
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "short_url", Value: "abc123"}}
+		c.Request = httptest.NewRequest(http.MethodHead, "/abc123", nil)
+
+		handler.RedirectURL(c)
+
+		assert.Equal(t, http.StatusFound, w.Code)
+		assert.Equal(t, "https://example.com", w.Header().Get("Location"))
+		assert.Empty(t, w.Body.String())
+		mockService.AssertNotCalled(t, "RecordAccess", mock.Anything, mock.Anything)
+	})
+}
+
+func TestRedirectURLMetaMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		RateLimit:      10,
+		RatePeriod:     time.Second,
+		RequestTimeout: 5 * time.Second,
+		RedirectMode:   RedirectModeMeta,
+	}
+	ctx := context.Background()
+	destination := "https://example.com/search?q=a&lang=en"
+
+	mockService := new(mocks.MockURLService)
+	mockService.On("GetURLData", mock.Anything, "abc123").Return(types.URLData{ShortURL: "abc123", OriginalURL: destination}, nil)
+	mockService.On("RecordAccess", mock.Anything, "abc123").Return(nil)
+	mockService.On("GetURLData", mock.Anything, "notfound").Return(types.URLData{}, services.ErrShortURLNotFound)
+
+	handler, err := NewURLHandler(ctx, mockService, cfg, zap.NewNop())
+	require.NoError(t, err)
+
+	t.Run("Serves an HTML page with a meta refresh", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "short_url", Value: "abc123"}}
+		c.Request = httptest.NewRequest(http.MethodGet, "/abc123", nil)
+
+		handler.RedirectURL(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Empty(t, w.Header().Get("Location"))
+		body := w.Body.String()
+		assert.Contains(t, body, `<meta http-equiv="refresh" content="0; url=https://example.com/search?q=a&amp;lang=en">`)
+		assert.Contains(t, body, `window.location.replace("https://example.com/search?q=a\u0026lang=en")`)
+		mockService.AssertCalled(t, "RecordAccess", mock.Anything, "abc123")
+	})
+
+	t.Run("Errors are still JSON", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "short_url", Value: "notfound"}}
+		c.Request = httptest.NewRequest(http.MethodGet, "/notfound", nil)
+
+		handler.RedirectURL(c)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.JSONEq(t, `{"error":"Short URL not found"}`, w.Body.String())
+	})
+}
+
+func TestRedirectURLContentNegotiation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{RateLimit: 10, RatePeriod: time.Second, RequestTimeout: 5 * time.Second}
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		accept       string
+		expectedJSON bool
+	}{
+		{name: "No Accept header", accept: ""},
+		{name: "HTML", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+		{name: "Any", accept: "*/*"},
+		{name: "JSON", accept: "application/json", expectedJSON: true},
+		{name: "JSON before HTML", accept: "application/json, text/html;q=0.5", expectedJSON: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(mocks.MockURLService)
+			mockService.On("GetURLData", mock.Anything, "abc123").
+				Return(types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com", CreatedAt: created}, nil)
+			mockService.On("RecordAccess", mock.Anything, "abc123").Return(nil)
+			handler, err := NewURLHandler(context.Background(), mockService, cfg, zap.NewNop())
+			require.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Params = gin.Params{{Key: "short_url", Value: "abc123"}}
+			c.Request = httptest.NewRequest(http.MethodGet, "/abc123", nil)
+			if tt.accept != "" {
+				c.Request.Header.Set("Accept", tt.accept)
+			}
+
+			handler.RedirectURL(c)
+
+			assert.Equal(t, "Accept", w.Header().Get("Vary"))
+			if tt.expectedJSON {
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.Empty(t, w.Header().Get("Location"))
+				assert.JSONEq(t, `{"short_url":"abc123","original_url":"https://example.com","created_at":"2024-01-01T00:00:00Z"}`, w.Body.String())
+				mockService.AssertNotCalled(t, "RecordAccess", mock.Anything, mock.Anything)
+			} else {
+				assert.Equal(t, http.StatusFound, w.Code)
+				assert.Equal(t, "https://example.com", w.Header().Get("Location"))
+				mockService.AssertCalled(t, "RecordAccess", mock.Anything, "abc123")
 			}
 		})
 	}
@@ -2,16 +2,45 @@
 package handlers
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 	"go-url-shortening/config"
+	"go.uber.org/zap"
 )
 
 // RegisterRoutes sets up all the routes for the URL shortener service.
 // It registers all the API endpoints with their respective handlers,
-// and applies middleware such as rate limiting and CORS.
-func RegisterRoutes(r *gin.Engine, handler URLHandlerInterface, config *config.Config) {
+// and applies middleware such as access logging, rate limiting and CORS.
+func RegisterRoutes(r *gin.Engine, handler URLHandlerInterface, config *config.Config, logger *zap.Logger) {
+	// Registered first so that every request is logged with the status it finally got
+	r.Use(AccessLogMiddleware(logger, config.LogHealthChecks))
+	r.Use(RequestIDMiddleware())
+
+	// Registered before the other middleware so that responses written by them are counted too
+	var statusCounters *StatusCounters
+	if config.EnableStatusCounters {
+		statusCounters = NewStatusCounters()
+		r.Use(statusCounters.Middleware())
+	}
+	// Panics are recovered below the middleware above, which then log and count them as a 500
+	r.Use(RecoveryMiddleware(logger))
+
 	// Apply CORS middleware to all routes
-	r.Use(CORSMiddleware())
+	r.Use(CORSMiddleware(config))
+	if config.MaxRequestBodyBytes > 0 {
+		r.Use(MaxRequestBodyMiddleware(config.MaxRequestBodyBytes))
+	}
+	if config.AcceptGzipRequests {
+		r.Use(GzipRequestMiddleware(config.MaxRequestBodyBytes))
+	}
+	if config.RequireUserAgent {
+		r.Use(RequireUserAgentMiddleware())
+	}
+	// Prefix rules take precedence over short URL resolution, including multi-segment paths
+	if len(config.PrefixRedirects) > 0 {
+		r.Use(PrefixRedirectMiddleware(config.PrefixRedirects))
+	}
 
 	// API routes
 	v1 := r.Group("/api/v1")
@@ -19,27 +48,84 @@ func RegisterRoutes(r *gin.Engine, handler URLHandlerInterface, config *config.C
 		v1.Use(handler.RateLimitMiddleware())
 	}
 	{
-		// Short URL routes
+		// Short URL routes, where writes require one of the configured API keys, if any
+		var writeMiddleware []gin.HandlerFunc
+		if len(config.APIKeys) > 0 {
+			writeMiddleware = append(writeMiddleware, APIKeyMiddleware(config.APIKeys))
+		}
 		short := v1.Group("/short")
 		{
-			short.POST("", handler.CreateShortURL)
+			short.POST("", append(writeMiddleware, handler.CreateShortURL)...)
+			short.POST("/batch", append(writeMiddleware, handler.BatchCreateShortURLs)...)
+			short.POST("/batch-delete", append(writeMiddleware, handler.BatchDeleteShortURLs)...)
+			short.POST("/import", append(writeMiddleware, handler.ImportCSV)...)
+			// A read sent as a POST for its body, so like GET /:short_url it needs no API key
+			short.POST("/batch-get", handler.BatchGetURLData)
+			short.GET("", handler.ListURLs)
+			// A full dump of the data, so it is guarded like writes. The static segment takes
+			// precedence over the route below, so "export" is a reserved word.
+			short.GET("/export", append(writeMiddleware, handler.ExportCSV)...)
+			// Like /export, a static segment taking precedence over the short URL "top"
+			short.GET("/top", handler.TopURLs)
 			short.GET("/:short_url", handler.GetURLData)
-			short.PUT("/:short_url", handler.UpdateURL)
-			short.DELETE("/:short_url", handler.DeleteURL)
+			short.GET("/:short_url/stats", handler.GetURLStats)
+			short.GET("/:short_url/qr", handler.GetQRCode)
+			short.PUT("/:short_url", append(writeMiddleware, handler.UpdateURL)...)
+			short.PATCH("/:short_url", append(writeMiddleware, handler.PatchURL)...)
+			short.DELETE("/:short_url", append(writeMiddleware, handler.DeleteURL)...)
+			if config.SoftDelete {
+				short.POST("/:short_url/restore", append(writeMiddleware, handler.RestoreURL)...)
+			}
 		}
 
-		// Health check route
+		if config.EnableExternalIDs {
+			v1.GET("/by-external/:ext_id", handler.GetURLByExternalID)
+		}
+
+		if config.EnableAsyncBatch {
+			v1.GET("/jobs/:id", handler.GetBatchJob)
+		}
+
+		if statusCounters != nil {
+			v1.GET("/stats/status", statusCounters.Handler)
+		}
+
+		// Admin routes for operational diagnostics
+		if config.EnableAdmin {
+			admin := v1.Group("/admin")
+			{
+				admin.GET("/runtime", handler.RuntimeStats)
+				admin.GET("/config", handler.EffectiveConfig)
+				// Guarded like /short/export, as it is the same full dump of the data
+				admin.GET("/export.csv", append(writeMiddleware, handler.ExportCSV)...)
+			}
+		}
+
+		// Health check and probe routes
 		if !config.DisableRateLimit {
-			r.GET("/health", handler.RateLimitMiddleware(), handler.HealthCheck)
+			r.GET(healthCheckPath, handler.RateLimitMiddleware(), handler.HealthCheck)
+			r.GET(livenessPath, handler.RateLimitMiddleware(), handler.Liveness)
+			r.GET(readinessPath, handler.RateLimitMiddleware(), handler.Readiness)
 		} else {
-			r.GET("/health", handler.HealthCheck)
+			r.GET(healthCheckPath, handler.HealthCheck)
+			r.GET(livenessPath, handler.Liveness)
+			r.GET(readinessPath, handler.Readiness)
 		}
 	}
 
 	// Redirection route (not under /api/v1 as it's user-facing)
+	redirectHandlers := []gin.HandlerFunc{handler.RedirectURL}
 	if !config.DisableRateLimit {
-		r.GET("/:short_url", handler.RateLimitMiddleware(), handler.RedirectURL)
-	} else {
-		r.GET("/:short_url", handler.RedirectURL)
+		redirectHandlers = append([]gin.HandlerFunc{handler.RateLimitMiddleware()}, redirectHandlers...)
+	}
+	r.GET("/:short_url", redirectHandlers...)
+	r.HEAD("/:short_url", redirectHandlers...)
+
+	if config.StrictRedirectMethods {
+		// Gin sets the Allow header itself before invoking the NoMethod handlers
+		r.HandleMethodNotAllowed = true
+		r.NoMethod(func(c *gin.Context) {
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"error": methodNotAllowed})
+		})
 	}
 }
@@ -3,8 +3,10 @@ package handlers
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"go-url-shortening/config"
 	"go-url-shortening/handlers/mocks"
+	"go.uber.org/zap"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -26,16 +28,18 @@ func TestRegisterRoutes(t *testing.T) {
 	mockHandler.On("RateLimitMiddleware").Return(gin.HandlerFunc(func(c *gin.Context) {
 		c.Next()
 	}))
-	RegisterRoutes(router, mockHandler, cfg)
+	RegisterRoutes(router, mockHandler, cfg, zap.NewNop())
 
 	t.Run("Routes are registered correctly", func(t *testing.T) {
 		routes := router.Routes()
-		assert.Len(t, routes, 6)
+		assert.Len(t, routes, 19)
 
 		expectedRoutes := map[string][]string{
-			"POST":    {"/api/v1/short"},
-			"GET":     {"/api/v1/short/:short_url", "/health", "/:short_url"},
+			"POST":    {"/api/v1/short", "/api/v1/short/batch", "/api/v1/short/batch-delete", "/api/v1/short/batch-get", "/api/v1/short/import"},
+			"GET":     {"/api/v1/short", "/api/v1/short/export", "/api/v1/short/top", "/api/v1/short/:short_url", "/api/v1/short/:short_url/stats", "/api/v1/short/:short_url/qr", "/health", "/livez", "/readyz", "/:short_url"},
+			"HEAD":    {"/:short_url"},
 			"PUT":     {"/api/v1/short/:short_url"},
+			"PATCH":   {"/api/v1/short/:short_url"},
 			"DELETE":  {"/api/v1/short/:short_url"},
 			"OPTIONS": {"/api/v1/short"},
 		}
@@ -53,7 +57,7 @@ func TestRegisterRoutes(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, w.Code)
 		assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
-		assert.Equal(t, "POST, GET, OPTIONS, PUT, DELETE", w.Header().Get("Access-Control-Allow-Methods"))
+		assert.Equal(t, "POST, GET, OPTIONS, PUT, PATCH, DELETE", w.Header().Get("Access-Control-Allow-Methods"))
 	})
 
 	t.Run("Rate limiting is applied and is enabled by default", func(t *testing.T) {
@@ -63,8 +67,231 @@ func TestRegisterRoutes(t *testing.T) {
 	t.Run("Rate limiting is not applied when disabled", func(t *testing.T) {
 		newRouter, _, newMockHandler, newCfg := setupTest()
 		newCfg.DisableRateLimit = true
-		RegisterRoutes(newRouter, newMockHandler, newCfg)
+		RegisterRoutes(newRouter, newMockHandler, newCfg, zap.NewNop())
 
 		newMockHandler.AssertNotCalled(t, "RateLimitMiddleware")
 	})
 }
+
+func TestRegisterRoutesRequireUserAgent(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		router, _, mockHandler, cfg := setupTest()
+		cfg.DisableRateLimit = true
+		cfg.RequireUserAgent = enabled
+		mockHandler.On("RedirectURL", mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(0).(*gin.Context).Redirect(http.StatusMovedPermanently, "https://example.com")
+		})
+		RegisterRoutes(router, mockHandler, cfg, zap.NewNop())
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/abc123", nil)
+		router.ServeHTTP(w, req)
+
+		if enabled {
+			assert.Equal(t, http.StatusBadRequest, w.Code, "Missing User-Agent should be rejected when enabled")
+		} else {
+			assert.Equal(t, http.StatusMovedPermanently, w.Code, "Missing User-Agent should be allowed by default")
+		}
+	}
+}
+
+func TestRegisterRoutesRequireUserAgentExemptsProbes(t *testing.T) {
+	router, _, mockHandler, cfg := setupTest()
+	cfg.DisableRateLimit = true
+	cfg.RequireUserAgent = true
+	for _, method := range []string{"HealthCheck", "Liveness", "Readiness"} {
+		mockHandler.On(method, mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(0).(*gin.Context).Status(http.StatusOK)
+		})
+	}
+	RegisterRoutes(router, mockHandler, cfg, zap.NewNop())
+
+	for _, path := range []string{"/health", "/livez", "/readyz"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		assert.Equal(t, http.StatusOK, w.Code, "Probes of %s without a User-Agent should be answered", path)
+	}
+}
+
+func TestRegisterRoutesPrefixRedirects(t *testing.T) {
+	router, _, mockHandler, cfg := setupTest()
+	cfg.DisableRateLimit = true
+	cfg.PrefixRedirects = map[string]string{"docs": "https://external/docs"}
+	mockHandler.On("RedirectURL", mock.Anything).Run(func(args mock.Arguments) {
+		args.Get(0).(*gin.Context).Redirect(http.StatusMovedPermanently, "https://example.com")
+	})
+	RegisterRoutes(router, mockHandler, cfg, zap.NewNop())
+
+	t.Run("Multi-segment path below a prefix", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs/guide", nil))
+
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "https://external/docs/guide", w.Header().Get("Location"))
+	})
+
+	t.Run("Prefix shadows the short URL of the same name", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+
+		assert.Equal(t, "https://external/docs", w.Header().Get("Location"))
+		mockHandler.AssertNotCalled(t, "RedirectURL", mock.Anything)
+	})
+
+	t.Run("Non-matching paths resolve as short URLs", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/abc123", nil))
+
+		assert.Equal(t, "https://example.com", w.Header().Get("Location"))
+		mockHandler.AssertCalled(t, "RedirectURL", mock.Anything)
+	})
+}
+
+func TestRegisterRoutesStatusCounters(t *testing.T) {
+	router, _, mockHandler, cfg := setupTest()
+	cfg.DisableRateLimit = true
+	cfg.EnableStatusCounters = true
+	mockHandler.On("RedirectURL", mock.Anything).Run(func(args mock.Arguments) {
+		args.Get(0).(*gin.Context).Redirect(http.StatusMovedPermanently, "https://example.com")
+	})
+	mockHandler.On("HealthCheck", mock.Anything).Run(func(args mock.Arguments) {
+		args.Get(0).(*gin.Context).Status(http.StatusOK)
+	})
+	mockHandler.On("GetURLData", mock.Anything).Run(func(args mock.Arguments) {
+		c := args.Get(0).(*gin.Context)
+		if c.Param("short_url") == "broken" {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusNotFound)
+	})
+	RegisterRoutes(router, mockHandler, cfg, zap.NewNop())
+
+	requests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/health"},
+		{http.MethodGet, "/health"},
+		{http.MethodOptions, "/api/v1/short"},
+		{http.MethodGet, "/abc123"},
+		{http.MethodGet, "/api/v1/short/missing"},
+		{http.MethodGet, "/api/v1/short/missing"},
+		{http.MethodGet, "/no/such/route"},
+		{http.MethodGet, "/api/v1/short/broken"},
+	}
+	for _, req := range requests {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/stats/status", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"2xx":3,"3xx":1,"4xx":3,"5xx":1}`, w.Body.String())
+
+	t.Run("Not registered unless enabled", func(t *testing.T) {
+		router, _, mockHandler, cfg := setupTest()
+		cfg.DisableRateLimit = true
+		RegisterRoutes(router, mockHandler, cfg, zap.NewNop())
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/stats/status", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestRegisterRoutesAsyncBatch(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		router, _, mockHandler, cfg := setupTest()
+		cfg.DisableRateLimit = true
+		cfg.EnableAsyncBatch = enabled
+		mockHandler.On("GetBatchJob", mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(0).(*gin.Context).Status(http.StatusOK)
+		})
+		RegisterRoutes(router, mockHandler, cfg, zap.NewNop())
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/jobs/abc", nil))
+
+		if enabled {
+			assert.Equal(t, http.StatusOK, w.Code, "Jobs should be served when enabled")
+		} else {
+			assert.Equal(t, http.StatusNotFound, w.Code, "Jobs should not be served by default")
+		}
+	}
+}
+
+func TestRegisterRoutesExternalIDs(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		router, _, mockHandler, cfg := setupTest()
+		cfg.DisableRateLimit = true
+		cfg.EnableExternalIDs = enabled
+		mockHandler.On("GetURLByExternalID", mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(0).(*gin.Context).Status(http.StatusOK)
+		})
+		RegisterRoutes(router, mockHandler, cfg, zap.NewNop())
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/by-external/order-1", nil))
+
+		if enabled {
+			assert.Equal(t, http.StatusOK, w.Code, "External ID lookups should be served when enabled")
+		} else {
+			assert.Equal(t, http.StatusNotFound, w.Code, "External ID lookups should not be served by default")
+		}
+	}
+}
+
+func TestRegisterRoutesSoftDelete(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		router, _, mockHandler, cfg := setupTest()
+		cfg.DisableRateLimit = true
+		cfg.SoftDelete = enabled
+		mockHandler.On("RestoreURL", mock.Anything).Run(func(args mock.Arguments) {
+			args.Get(0).(*gin.Context).Status(http.StatusOK)
+		})
+		RegisterRoutes(router, mockHandler, cfg, zap.NewNop())
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/short/abc123/restore", nil))
+
+		if enabled {
+			assert.Equal(t, http.StatusOK, w.Code, "Restores should be served when enabled")
+		} else {
+			assert.Equal(t, http.StatusNotFound, w.Code, "Restores should not be served by default")
+		}
+	}
+}
+
+func TestRegisterRoutesStrictRedirectMethods(t *testing.T) {
+	router, _, mockHandler, cfg := setupTest()
+	cfg.DisableRateLimit = true
+	cfg.StrictRedirectMethods = true
+	mockHandler.On("RedirectURL", mock.Anything).Run(func(args mock.Arguments) {
+		args.Get(0).(*gin.Context).Redirect(http.StatusMovedPermanently, "https://example.com")
+	})
+	RegisterRoutes(router, mockHandler, cfg, zap.NewNop())
+
+	t.Run("POST to a short URL returns 405", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/abc123", nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Contains(t, w.Header().Get("Allow"), http.MethodGet)
+		assert.Contains(t, w.Header().Get("Allow"), http.MethodHead)
+		assert.JSONEq(t, `{"error":"Method not allowed"}`, w.Body.String())
+		mockHandler.AssertNotCalled(t, "RedirectURL", mock.Anything)
+	})
+
+	t.Run("GET and HEAD still redirect", func(t *testing.T) {
+		for _, method := range []string{http.MethodGet, http.MethodHead} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(method, "/abc123", nil)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusMovedPermanently, w.Code, "Unexpected status for %s", method)
+		}
+	})
+}
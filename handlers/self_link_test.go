@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go-url-shortening/config"
+	"go-url-shortening/services"
+	"go-url-shortening/services/mocks"
+	"go-url-shortening/types"
+	"go.uber.org/zap"
+)
+
+func TestRejectSelfShortLinks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		RateLimit:            10,
+		RatePeriod:           time.Second,
+		RequestTimeout:       5 * time.Second,
+		BaseURL:              "https://sho.rt/s",
+		RejectSelfShortLinks: true,
+	}
+	mockService := new(mocks.MockURLService)
+	mockService.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything).Return(types.URLData{ShortURL: "abc123"}, nil)
+	mockService.On("UpdateURL", mock.Anything, "abc123", mock.Anything).Return(types.URLData{ShortURL: "abc123"}, nil)
+	mockService.On("GetURLData", mock.Anything, "legacy-code!").Return(types.URLData{ShortURL: "legacy-code!"}, nil)
+	mockService.On("GetURLData", mock.Anything, mock.Anything).Return(types.URLData{}, services.ErrShortURLNotFound)
+	handler, err := NewURLHandler(context.Background(), mockService, cfg, zap.NewNop())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+	}{
+		{name: "Short link on the request host", url: "http://api.sho.rt:8080/xyz789", expectedStatus: http.StatusBadRequest},
+		{name: "Short link under BaseURL", url: "https://SHO.RT/s/xyz789", expectedStatus: http.StatusBadRequest},
+		{name: "Existing short URL outside the charset", url: "http://api.sho.rt:8080/legacy-code!", expectedStatus: http.StatusBadRequest},
+		{name: "External URL", url: "https://example.com/xyz789", expectedStatus: http.StatusCreated},
+		{name: "Nested path on our own host", url: "http://api.sho.rt:8080/docs/guide", expectedStatus: http.StatusCreated},
+		{name: "BaseURL host outside its path", url: "https://sho.rt/xyz789", expectedStatus: http.StatusCreated},
+		{name: "Unknown path that can't be a short code", url: "http://api.sho.rt:8080/not-a-code", expectedStatus: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "http://api.sho.rt:8080/api/v1/short", strings.NewReader(`{"url":"`+tt.url+`"}`))
+
+			handler.CreateShortURL(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusBadRequest {
+				assert.JSONEq(t, `{"error":"URL is a short link of this service"}`, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("Update to a short link", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "short_url", Value: "abc123"}}
+		c.Request = httptest.NewRequest(http.MethodPut, "http://api.sho.rt:8080/api/v1/short/abc123", strings.NewReader(`{"url":"https://sho.rt/s/abc123"}`))
+
+		handler.UpdateURL(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		mockService.AssertNotCalled(t, "UpdateURL", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Allowed unless enabled", func(t *testing.T) {
+		cfg.RejectSelfShortLinks = false
+		defer func() { cfg.RejectSelfShortLinks = true }()
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "http://api.sho.rt:8080/api/v1/short", strings.NewReader(`{"url":"https://sho.rt/s/xyz789"}`))
+
+		handler.CreateShortURL(c)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+}
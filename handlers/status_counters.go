@@ -0,0 +1,49 @@
+// Package handlers provides HTTP request handlers for the URL shortener service.
+package handlers
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"go-url-shortening/types"
+)
+
+// StatusCounters counts the responses served by status class, as a lightweight health
+// signal when no metrics backend is deployed. The counters live in memory and reset on restart.
+type StatusCounters struct {
+	classes [4]atomic.Int64 // 2xx, 3xx, 4xx and 5xx, in that order
+}
+
+// NewStatusCounters returns a StatusCounters with every counter at zero.
+func NewStatusCounters() *StatusCounters {
+	return &StatusCounters{}
+}
+
+// Middleware counts the status of every response once the rest of the chain has run.
+// Statuses outside 200-599 are not counted.
+func (s *StatusCounters) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		class := c.Writer.Status()/100 - 2
+		if class >= 0 && class < len(s.classes) {
+			s.classes[class].Add(1)
+		}
+	}
+}
+
+// Snapshot returns the current counters.
+func (s *StatusCounters) Snapshot() types.StatusCountsResponse {
+	return types.StatusCountsResponse{
+		Status2xx: s.classes[0].Load(),
+		Status3xx: s.classes[1].Load(),
+		Status4xx: s.classes[2].Load(),
+		Status5xx: s.classes[3].Load(),
+	}
+}
+
+// Handler serves the current counters as JSON.
+func (s *StatusCounters) Handler(c *gin.Context) {
+	c.JSON(http.StatusOK, s.Snapshot())
+}
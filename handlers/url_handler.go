@@ -4,37 +4,120 @@ package handlers
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+	"go-url-shortening/apikey"
 	"go-url-shortening/config"
+	"go-url-shortening/destination"
 	"go-url-shortening/services"
 	"go-url-shortening/types"
+	"go-url-shortening/urlutil"
+	"go-url-shortening/workerpool"
 	"go.uber.org/zap"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
-	invalidRequestBody  = "Invalid request body"
-	errorCreatingURL    = "Error creating short URL"
-	errorRetrievingURL  = "Error retrieving URL"
-	errorUpdatingURL    = "Error updating URL"
-	errorDeletingURL    = "Error deleting URL"
-	errorTimeout        = "Request timed out"
-	storageCapacityFull = "Storage capacity reached"
-	shortURLExists      = "Short URL already exists"
-	shortURLNotFound    = "Short URL not found"
-	invalidURLProvided  = "Invalid URL provided"
+	invalidRequestBody           = "Invalid request body"
+	errorCreatingURL             = "Error creating short URL"
+	errorRetrievingURL           = "Error retrieving URL"
+	errorUpdatingURL             = "Error updating URL"
+	errorDeletingURL             = "Error deleting URL"
+	errorRestoringURL            = "Error restoring URL"
+	deletedURLNotFound           = "No deleted short URL found"
+	errorTimeout                 = "Request timed out"
+	storageCapacityFull          = "Storage capacity reached"
+	shortURLExists               = "Short URL already exists"
+	shortURLNotFound             = "Short URL not found"
+	shortURLExpired              = "Short URL expired"
+	invalidTTLProvided           = "Invalid TTL provided"
+	invalidTagsProvided          = "Invalid tags provided"
+	tagsNotEnabled               = "Tags are not enabled"
+	tagRequired                  = "Tag query parameter is required"
+	errorListingURLs             = "Error listing URLs"
+	invalidPageProvided          = "Invalid page provided"
+	invalidPageSizeProvided      = "Invalid page_size provided"
+	invalidLimitProvided         = "Invalid limit provided"
+	invalidURLProvided           = "Invalid URL provided"
+	aliasTaken                   = "Alias already taken"
+	invalidAliasProvided         = "Invalid alias provided"
+	methodNotAllowed             = "Method not allowed"
+	invalidBatchSize             = "Invalid batch size"
+	invalidSizeProvided          = "Invalid size provided"
+	errorRenderingQRCode         = "Error rendering QR code"
+	aliasNotAllowed              = "API key is not allowed to use aliases"
+	domainRateLimitExceeded      = "Rate limit exceeded for destination domain"
+	asyncBatchNotEnabled         = "Asynchronous batches are not enabled"
+	tooManyBatchJobs             = "Too many batch jobs in progress"
+	jobNotFound                  = "Job not found"
+	selfShortLinkProvided        = "URL is a short link of this service"
+	internalServerError          = "Internal server error"
+	internalDestinationProvided  = "URL points to an internal address"
+	duplicateQueryParamsProvided = "URL has duplicate query parameters"
+	requestBodyTooLarge          = "Request body too large"
+	privateDestinationBlocked    = "URL resolves to a private address"
+	unsupportedURLScheme         = "Unsupported URL scheme"
+	invalidAPIKey                = "Missing or invalid API key"
+	externalIDsNotEnabled        = "External IDs are not enabled"
+	invalidExternalIDProvided    = "Invalid external ID provided"
+	externalIDTaken              = "External ID already exists"
+	emptyPatch                   = "No fields to update"
+	csvFileRequired              = "A CSV file is required in the file field"
+	malformedCSVRow              = "Malformed CSV row"
+	invalidImportMode            = "Invalid import mode"
+	duplicateShortURL            = "Duplicate short URL"
+	invalidIdempotencyKey        = "Invalid Idempotency-Key"
+	idempotencyKeyReused         = "Idempotency-Key was used with a different request"
+	idempotencyKeyInProgress     = "A request with this Idempotency-Key is in progress"
+	urlModified                  = "URL was modified since the If-Match ETag"
+	urlModifiedConcurrently      = "URL kept being modified concurrently"
+	domainNotAllowed             = "Domain not allowed"
+	urlTooLong                   = "URL too long"
+)
+
+// Machine-readable codes returned alongside create conflicts when config.DistinctConflictStatus is set.
+const (
+	codeAliasTaken    = "ALIAS_TAKEN"
+	codeAlreadyExists = "ALREADY_EXISTS"
 )
 
 // URLHandlerInterface defines the methods that a URL handler should implement.
 type URLHandlerInterface interface {
 	CreateShortURL(c *gin.Context)
 	GetURLData(c *gin.Context)
+	GetURLByExternalID(c *gin.Context)
 	UpdateURL(c *gin.Context)
+	PatchURL(c *gin.Context)
 	DeleteURL(c *gin.Context)
+	RestoreURL(c *gin.Context)
 	HealthCheck(c *gin.Context)
+	Liveness(c *gin.Context)
+	Readiness(c *gin.Context)
 	RedirectURL(c *gin.Context)
 	RateLimitMiddleware() gin.HandlerFunc
+	RuntimeStats(c *gin.Context)
+	EffectiveConfig(c *gin.Context)
+	ExportCSV(c *gin.Context)
+	ImportCSV(c *gin.Context)
+	ListURLs(c *gin.Context)
+	TopURLs(c *gin.Context)
+	GetURLStats(c *gin.Context)
+	BatchCreateShortURLs(c *gin.Context)
+	BatchDeleteShortURLs(c *gin.Context)
+	BatchGetURLData(c *gin.Context)
+	GetBatchJob(c *gin.Context)
+	GetQRCode(c *gin.Context)
+}
+
+// requestLogger returns the handler's logger with the request ID of c, if any, attached to every line.
+func (h *URLHandler) requestLogger(c *gin.Context) *zap.Logger {
+	return h.logger.With(requestIDField(c))
 }
 
 // handleError is a helper function to handle errors and send appropriate responses
@@ -52,15 +135,21 @@ func (h *URLHandler) handleError(c *gin.Context, err error, customMessages map[e
 	case errors.Is(err, services.ErrShortURLNotFound):
 		statusCode = http.StatusNotFound
 		errorMessage = customMessages[services.ErrShortURLNotFound]
+	case errors.Is(err, services.ErrShortURLExpired):
+		statusCode = http.StatusGone
+		errorMessage = customMessages[services.ErrShortURLExpired]
+	case errors.Is(err, services.ErrVersionMismatch):
+		statusCode = http.StatusPreconditionFailed
+		errorMessage = customMessages[services.ErrVersionMismatch]
 	case errors.Is(err, context.DeadlineExceeded):
 		statusCode = http.StatusRequestTimeout
 		errorMessage = customMessages[context.DeadlineExceeded]
 	default:
-		h.logger.Error("Unexpected error", zap.Error(err))
+		h.requestLogger(c).Error("Unexpected error", zap.Error(err))
 		statusCode = http.StatusInternalServerError
 		errorMessage = customMessages[err]
 		if errorMessage == "" {
-			errorMessage = "Internal server error"
+			errorMessage = internalServerError
 		}
 	}
 
@@ -73,6 +162,51 @@ type URLHandler struct {
 	validate *validator.Validate
 	config   *config.Config
 	logger   *zap.Logger
+
+	// rateLimitClients counts the clients tracked by the in-memory rate limiter of this handler
+	rateLimitClients atomic.Int64
+	// rateLimiter is shared by every RateLimitMiddleware, so that a client has one quota across the
+	// routes. It is given with WithRateLimiter, or else an in-memory limiter created on first use.
+	rateLimiter     RateLimiter
+	rateLimiterOnce sync.Once
+	// pool runs the asynchronous batch jobs and the rate limiter cleanup, shared with the other
+	// background tasks when given with WithWorkerPool
+	pool *workerpool.Pool
+	// policy decides which destinations may be shortened, shared with the other APIs when given
+	// with WithDestinationPolicy
+	policy *destination.Policy
+	// batchJobs holds the asynchronous batch jobs, nil unless config.EnableAsyncBatch is set
+	batchJobs *batchJobStore
+	// idempotency remembers the responses to creates sent with an Idempotency-Key, nil unless
+	// config.IdempotencyKeyTTL is positive
+	idempotency *idempotencyStore
+}
+
+// HandlerOption configures optional dependencies of a URLHandler.
+type HandlerOption func(*URLHandler)
+
+// WithWorkerPool runs the background tasks of the handler on pool instead of a pool of its own,
+// so that they stop with it.
+func WithWorkerPool(pool *workerpool.Pool) HandlerOption {
+	return func(h *URLHandler) {
+		h.pool = pool
+	}
+}
+
+// WithRateLimiter rate limits clients with limiter, such as a RedisRateLimiter, instead of an
+// in-memory limiter of the handler's own.
+func WithRateLimiter(limiter RateLimiter) HandlerOption {
+	return func(h *URLHandler) {
+		h.rateLimiter = limiter
+	}
+}
+
+// WithDestinationPolicy applies policy to submitted destinations instead of a policy of the
+// handler's own, so that it can be shared with the gRPC API.
+func WithDestinationPolicy(policy *destination.Policy) HandlerOption {
+	return func(h *URLHandler) {
+		h.policy = policy
+	}
 }
 
 // NewURLHandler creates and returns a new URLHandler instance.
@@ -81,11 +215,15 @@ type URLHandler struct {
 //   - service: An implementation of the services.URLService interface for URL operations.
 //   - cfg: A pointer to the Config struct containing application settings.
 //   - logger: A pointer to a zap.Logger for logging.
-//   - cfg: A pointer to the Config struct containing application settings.
+//   - opts: Optional dependencies, such as WithWorkerPool, WithRateLimiter and WithDestinationPolicy.
 //
 // Returns:
 //   - A pointer to a new URLHandler instance and an error if initialization fails.
-func NewURLHandler(ctx context.Context, service services.URLService, cfg *config.Config, logger *zap.Logger) (URLHandlerInterface, error) {
+//
+// Unless a limiter is given with WithRateLimiter, RateLimitMiddleware keeps a per-client limiter
+// from cfg.RateLimit in memory, built for each caller on first use. cfg.RateLimitRedisAddr is left to
+// the caller, which owns the Redis client and so closes it.
+func NewURLHandler(ctx context.Context, service services.URLService, cfg *config.Config, logger *zap.Logger, opts ...HandlerOption) (URLHandlerInterface, error) {
 	if service == nil {
 		return nil, errors.New("service cannot be nil")
 	}
@@ -105,6 +243,21 @@ func NewURLHandler(ctx context.Context, service services.URLService, cfg *config
 		config:   cfg,
 		logger:   logger,
 	}
+	for _, opt := range opts {
+		opt(handler)
+	}
+	if handler.policy == nil {
+		handler.policy = destination.NewPolicy(cfg, service)
+	}
+	if handler.pool == nil {
+		handler.pool = workerpool.New(1, cfg.BackgroundQueueSize)
+	}
+	if cfg.EnableAsyncBatch {
+		handler.batchJobs = newBatchJobStore(cfg.MaxBatchJobs, cfg.BatchJobTTL)
+	}
+	if cfg.IdempotencyKeyTTL > 0 {
+		handler.idempotency = newIdempotencyStore(cfg.IdempotencyKeyTTL)
+	}
 
 	// Perform any initialization that might be cancelled
 	select {
@@ -117,38 +270,282 @@ func NewURLHandler(ctx context.Context, service services.URLService, cfg *config
 	return handler, nil
 }
 
+// newURLResponse converts stored URLData into its API representation.
+func (h *URLHandler) newURLResponse(urlData types.URLData) types.URLResponse {
+	response := types.URLResponse{
+		ShortURL:    urlData.ShortURL,
+		ShortLink:   h.configuredShortLink(urlData.ShortURL),
+		OriginalURL: urlData.OriginalURL,
+		CreatedAt:   urlData.CreatedAt,
+		UpdatedAt:   urlData.UpdatedAt,
+	}
+	if !urlData.ExpiresAt.IsZero() {
+		expiresAt := urlData.ExpiresAt
+		response.ExpiresAt = &expiresAt
+	}
+	response.Tags = urlData.Tags
+	response.ExternalID = urlData.ExternalID
+	if !urlData.LastCheckedAt.IsZero() {
+		lastCheckedAt := urlData.LastCheckedAt
+		response.LastCheckedAt = &lastCheckedAt
+		response.LastStatus = urlData.LastStatus
+	}
+	if urlData.Deleted() {
+		deletedAt := urlData.DeletedAt
+		response.DeletedAt = &deletedAt
+	}
+	return response
+}
+
+// urlDataETag returns the weak ETag of the URL data response for urlData. It is derived from the
+// times the data was last updated and last checked for reachability, the only changes to it that
+// don't go through an update, so it stays stable across reads and rotates on every update.
+func urlDataETag(urlData types.URLData) string {
+	etag := strconv.FormatInt(urlData.UpdatedAt.UnixNano(), 36)
+	if !urlData.LastCheckedAt.IsZero() {
+		etag += "-" + strconv.FormatInt(urlData.LastCheckedAt.UnixNano(), 36)
+	}
+	return `W/"` + etag + `"`
+}
+
+// etagUpdatedAt returns the UpdatedAt of the URL data an ETag of urlDataETag was derived from, and
+// false if etag is not one of them. The reachability check part of the ETag is ignored, since a
+// check doesn't change the URL as far as updates are concerned.
+func etagUpdatedAt(etag string) (time.Time, bool) {
+	etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	if len(etag) < 2 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		return time.Time{}, false
+	}
+	updated, _, _ := strings.Cut(etag[1:len(etag)-1], "-")
+	nanos, err := strconv.ParseInt(updated, 36, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
+
+// urlDataLastModified returns when the URL data response for urlData last changed: the later of the
+// times it was last updated and last checked for reachability, like urlDataETag.
+func urlDataLastModified(urlData types.URLData) time.Time {
+	if urlData.LastCheckedAt.After(urlData.UpdatedAt) {
+		return urlData.LastCheckedAt
+	}
+	return urlData.UpdatedAt
+}
+
+// setURLDataValidators sets the ETag and Last-Modified headers of the URL data response for urlData.
+func setURLDataValidators(c *gin.Context, urlData types.URLData) {
+	c.Header("ETag", urlDataETag(urlData))
+	if lastModified := urlDataLastModified(urlData); !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// urlDataNotModified reports whether the conditional headers of r show that the client already has
+// the URL data response for urlData. As RFC 9110 requires, If-Modified-Since is only consulted
+// without If-None-Match, and with the one second resolution of HTTP dates.
+func urlDataNotModified(r *http.Request, urlData types.URLData) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, urlDataETag(urlData))
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	lastModified := urlDataLastModified(urlData)
+	return err == nil && !lastModified.IsZero() && !lastModified.Truncate(time.Second).After(since)
+}
+
+// etagMatches reports whether an If-None-Match header matches etag, using the weak comparison
+// required for If-None-Match: the W/ prefix is ignored on both sides.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// configuredShortLink returns the absolute URL redirecting to shortURL under config.BaseURL,
+// or an empty string when no BaseURL is configured or shortURL is empty.
+func (h *URLHandler) configuredShortLink(shortURL string) string {
+	if h.config.BaseURL == "" || shortURL == "" {
+		return ""
+	}
+	return strings.TrimSuffix(h.config.BaseURL, "/") + "/" + shortURL
+}
+
+// normalizeURL prefixes rawURL, a submitted destination, with config.DefaultScheme when it has
+// no scheme of its own, and returns it unchanged when no default scheme is configured.
+func (h *URLHandler) normalizeURL(rawURL string) string {
+	if h.config.DefaultScheme == "" || rawURL == "" {
+		return rawURL
+	}
+	return urlutil.NormalizeURL(rawURL, h.config.DefaultScheme)
+}
+
+// exceedsMaxURLLength reports whether rawURL, a normalized destination, is longer than
+// config.MaxURLLength. It is checked before validation, so that overlong URLs are not parsed.
+func (h *URLHandler) exceedsMaxURLLength(rawURL string) bool {
+	return h.config.MaxURLLength > 0 && len(rawURL) > h.config.MaxURLLength
+}
+
+// validationStatus is the status of a well-formed request body whose fields fail validation:
+// 422 Unprocessable Entity with config.UnprocessableEntityStatus, 400 Bad Request otherwise.
+// Bodies that cannot be parsed at all always get 400.
+func (h *URLHandler) validationStatus() int {
+	if h.config.UnprocessableEntityStatus {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusBadRequest
+}
+
+// isFieldError reports whether validation failed on the given struct field or one of its elements.
+func isFieldError(err error, field string) bool {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return false
+	}
+	for _, fieldErr := range validationErrors {
+		name := fieldErr.StructField()
+		if name == field || strings.HasPrefix(name, field+"[") {
+			return true
+		}
+	}
+	return false
+}
+
 // CreateShortURL handles the creation of a new shortened URL.
 // It validates the input, checks for existing short URL, and stores it in the database if it doesn't exist.
 func (h *URLHandler) CreateShortURL(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), h.config.RequestTimeout)
 	defer cancel()
+	logger := h.requestLogger(c)
 
 	var input types.URLRequest
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		h.logger.Error("Error decoding request body", zap.Error(err))
+		logger.Error("Error decoding request body", zap.Error(err))
 		c.JSON(http.StatusBadRequest, gin.H{"error": invalidRequestBody})
 		return
 	}
+	idempotencyKey, responded := h.claimIdempotencyKey(c, input)
+	if responded {
+		return
+	}
+	if idempotencyKey != "" {
+		// Only successful creates are replayed, so that a failed one can be retried with the same key
+		defer h.idempotency.release(idempotencyKey)
+	}
+	input.URL = h.normalizeURL(input.URL)
+	if h.exceedsMaxURLLength(input.URL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": urlTooLong})
+		return
+	}
 
 	// Validate the input
 	if err := h.validate.Struct(input); err != nil {
-		h.logger.Error("Invalid input", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": invalidURLProvided})
+		logger.Error("Invalid input", zap.Error(err))
+		message := invalidURLProvided
+		if isFieldError(err, "Tags") {
+			message = invalidTagsProvided
+		} else if isFieldError(err, "ExternalID") {
+			message = invalidExternalIDProvided
+		}
+		c.JSON(h.validationStatus(), gin.H{"error": message})
+		return
+	}
+	if len(input.Tags) > 0 && !h.config.EnableTags {
+		c.JSON(http.StatusBadRequest, gin.H{"error": tagsNotEnabled})
+		return
+	}
+	if input.ExternalID != "" && !h.config.EnableExternalIDs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": externalIDsNotEnabled})
+		return
+	}
+	if input.Alias != "" && len(h.config.AliasAPIKeys) > 0 && !apikey.Contains(h.config.AliasAPIKeys, requestAPIKey(c.Request)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": aliasNotAllowed})
+		return
+	}
+	if h.rejectDestination(ctx, c, input.URL) {
 		return
 	}
 
-	urlData, err := h.service.CreateShortURL(ctx, input.URL)
-	response := types.URLResponse{
-		ShortURL:    urlData.ShortURL,
-		OriginalURL: urlData.OriginalURL,
-		CreatedAt:   urlData.CreatedAt,
-		UpdatedAt:   urlData.UpdatedAt,
+	opts := services.CreateOptions{Tags: input.Tags, Alias: input.Alias, ExternalID: input.ExternalID}
+	if input.TTL != "" {
+		ttl, err := time.ParseDuration(input.TTL)
+		if err != nil || ttl <= 0 {
+			logger.Error("Invalid TTL", zap.String("ttl", input.TTL), zap.Error(err))
+			c.JSON(h.validationStatus(), gin.H{"error": invalidTTLProvided})
+			return
+		}
+		opts.TTL = ttl
+	}
+	if err := h.policy.AllowCreate(input.URL); err != nil {
+		status, message := destinationError(err)
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+
+	var timings *services.CreateTimings
+	if h.config.DebugTimings {
+		ctx, timings = services.WithCreateTimings(ctx)
+	}
+	urlData, err := h.service.CreateShortURL(ctx, input.URL, opts)
+	response := h.newURLResponse(urlData)
+	if timings != nil {
+		logger.Debug("Create timings",
+			zap.Duration("generation", timings.Generation),
+			zap.Duration("dedup_key", timings.DedupKey),
+			zap.Duration("storage_write", timings.StorageWrite))
+		response.Timings = &types.CreateTimings{
+			GenerationMS:   milliseconds(timings.Generation),
+			DedupKeyMS:     milliseconds(timings.DedupKey),
+			StorageWriteMS: milliseconds(timings.StorageWrite),
+		}
 	}
+	// The service only returns an existing short URL along with ErrShortURLExists
+	created := err == nil
+	response.Created = &created
 
 	if err != nil {
-		if errors.Is(err, services.ErrShortURLExists) {
-			c.JSON(http.StatusConflict, response)
+		// Without a record, ErrShortURLExists means generated short URLs kept colliding and gets 409
+		if errors.Is(err, services.ErrShortURLExists) && urlData.ShortURL != "" {
+			// Creating is idempotent: the URL is already shortened, so its short URL is returned
+			if h.config.DistinctConflictStatus {
+				response.Code = codeAlreadyExists
+			}
+			if idempotencyKey != "" {
+				h.idempotency.complete(idempotencyKey, http.StatusOK, response)
+			}
+			c.JSON(http.StatusOK, response)
+			return
+		}
+		if h.config.DistinctConflictStatus && errors.Is(err, services.ErrAliasTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": aliasTaken, "code": codeAliasTaken})
+			return
+		}
+		if errors.Is(err, services.ErrInvalidAlias) {
+			c.JSON(h.validationStatus(), gin.H{"error": invalidAliasProvided})
+			return
+		}
+		if errors.Is(err, services.ErrAliasTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": aliasTaken})
+			return
+		}
+		if errors.Is(err, services.ErrExternalIDExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": externalIDTaken})
+			return
+		}
+		var fullErr *services.StorageFullError
+		if h.config.ExposeStorageUsage && errors.As(err, &fullErr) {
+			c.JSON(http.StatusInsufficientStorage, gin.H{
+				"error":    storageCapacityFull,
+				"count":    fullErr.Count,
+				"capacity": fullErr.Capacity,
+			})
 			return
 		}
 		h.handleError(c, err, map[error]string{
@@ -159,9 +556,114 @@ func (h *URLHandler) CreateShortURL(c *gin.Context) {
 		return
 	}
 
+	if idempotencyKey != "" {
+		h.idempotency.complete(idempotencyKey, http.StatusCreated, response)
+	}
 	c.JSON(http.StatusCreated, response)
 }
 
+// BatchCreateShortURLs creates a short URL for every URL of the request body.
+// Once the body is accepted it answers 207 Multi-Status, reporting per URL the status a single
+// create would have returned, so one invalid or failing URL doesn't fail the whole batch.
+// With ?async=true and config.EnableAsyncBatch, up to config.MaxAsyncBatchSize URLs are instead
+// processed in the background, answering 202 Accepted with a job to poll through GetBatchJob.
+func (h *URLHandler) BatchCreateShortURLs(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.config.RequestTimeout)
+	defer cancel()
+
+	var input types.BatchURLRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		h.logger.Error("Error decoding request body", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidRequestBody})
+		return
+	}
+
+	async := c.Query("async") == "true"
+	if async && h.batchJobs == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": asyncBatchNotEnabled})
+		return
+	}
+	maxSize := h.config.MaxBatchSize
+	if async {
+		maxSize = h.config.MaxAsyncBatchSize
+	}
+	if len(input.URLs) == 0 || len(input.URLs) > maxSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidBatchSize})
+		return
+	}
+
+	if async {
+		h.startBatchJob(c, input.URLs)
+		return
+	}
+	c.JSON(http.StatusMultiStatus, types.BatchURLResponse{Results: h.createBatch(ctx, input.URLs)})
+}
+
+// createBatch validates and creates the short URLs of urls, returning one result per URL in order.
+func (h *URLHandler) createBatch(ctx context.Context, urls []string) []types.BatchURLResult {
+	results := make([]types.BatchURLResult, len(urls))
+	valid := make([]string, 0, len(urls))
+	validIndexes := make([]int, 0, len(urls))
+	for i, rawURL := range urls {
+		results[i].URL = rawURL
+		rawURL = h.normalizeURL(rawURL)
+		if h.exceedsMaxURLLength(rawURL) {
+			results[i].Status = http.StatusBadRequest
+			results[i].Error = urlTooLong
+			continue
+		}
+		if err := h.validate.Var(rawURL, "required,url"); err != nil {
+			results[i].Status = h.validationStatus()
+			results[i].Error = invalidURLProvided
+			continue
+		}
+		err := h.policy.Check(ctx, rawURL)
+		if err == nil {
+			err = h.policy.AllowCreate(rawURL)
+		}
+		if err != nil {
+			results[i].Status, results[i].Error = destinationError(err)
+			continue
+		}
+		valid = append(valid, rawURL)
+		validIndexes = append(validIndexes, i)
+	}
+
+	urlData, errs := h.service.BatchCreate(ctx, valid)
+	for j, i := range validIndexes {
+		results[i].Status, results[i].Error = h.batchItemStatus(urlData[j], errs[j])
+		if results[i].Error == "" {
+			response := h.newURLResponse(urlData[j])
+			created := errs[j] == nil
+			response.Created = &created
+			results[i].URLResponse = &response
+		}
+	}
+	return results
+}
+
+// batchItemStatus maps the outcome of one batch item to the status and message a single create
+// would answer: 201 for a new short URL, and 200 for a URL already shortened, returned with
+// ErrShortURLExists along with its existing record.
+func (h *URLHandler) batchItemStatus(urlData types.URLData, err error) (int, string) {
+	switch {
+	case err == nil:
+		return http.StatusCreated, ""
+	case errors.Is(err, services.ErrShortURLExists) && urlData.ShortURL != "":
+		return http.StatusOK, ""
+	case errors.Is(err, services.ErrShortURLExists):
+		// Without a record, generated short URLs kept colliding
+		return http.StatusConflict, shortURLExists
+	case errors.Is(err, services.ErrStorageCapacityReached):
+		return http.StatusInsufficientStorage, storageCapacityFull
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusRequestTimeout, errorTimeout
+	default:
+		h.logger.Error("Unexpected error", zap.Error(err))
+		return http.StatusInternalServerError, errorCreatingURL
+	}
+}
+
 // GetURLData retrieves the original URL for a given short URL.
 // It returns the original URL in a JSON response if found, or an appropriate error if not found or if an error occurs.
 func (h *URLHandler) GetURLData(c *gin.Context) {
@@ -174,71 +676,210 @@ func (h *URLHandler) GetURLData(c *gin.Context) {
 	if err != nil {
 		h.handleError(c, err, map[error]string{
 			services.ErrShortURLNotFound: shortURLNotFound,
+			services.ErrShortURLExpired:  shortURLExpired,
 			context.DeadlineExceeded:     errorTimeout,
 			nil:                          errorRetrievingURL,
 		})
 		return
 	}
 
-	response := types.URLResponse{
+	if h.config.EnableETags {
+		setURLDataValidators(c, urlData)
+		if urlDataNotModified(c.Request, urlData) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, h.newURLResponse(urlData))
+}
+
+// GetURLByExternalID retrieves the URL data stored with the external ID given as ext_id.
+// It answers like GetURLData, including 404 Not Found when no URL carries the external ID.
+func (h *URLHandler) GetURLByExternalID(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.config.RequestTimeout)
+	defer cancel()
+
+	urlData, err := h.service.GetByExternalID(ctx, c.Param("ext_id"))
+	if err != nil {
+		h.handleError(c, err, map[error]string{
+			services.ErrShortURLNotFound: shortURLNotFound,
+			services.ErrShortURLExpired:  shortURLExpired,
+			context.DeadlineExceeded:     errorTimeout,
+			nil:                          errorRetrievingURL,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.newURLResponse(urlData))
+}
+
+// GetURLStats returns the access statistics of a given short URL.
+func (h *URLHandler) GetURLStats(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.config.RequestTimeout)
+	defer cancel()
+
+	urlData, err := h.service.GetURLData(ctx, c.Param("short_url"))
+	if err != nil {
+		h.handleError(c, err, map[error]string{
+			services.ErrShortURLNotFound: shortURLNotFound,
+			services.ErrShortURLExpired:  shortURLExpired,
+			context.DeadlineExceeded:     errorTimeout,
+			nil:                          errorRetrievingURL,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, types.URLStatsResponse{
 		ShortURL:    urlData.ShortURL,
-		OriginalURL: urlData.OriginalURL,
+		AccessCount: urlData.AccessCount,
 		CreatedAt:   urlData.CreatedAt,
 		UpdatedAt:   urlData.UpdatedAt,
-	}
-	c.JSON(http.StatusOK, response)
+	})
 }
 
 // UpdateURL updates the original URL for a given short URL.
 // It validates the input, updates the URL in storage, and returns the updated URL pair in a JSON response.
 // If the short URL is not found or an error occurs, it returns an appropriate error response.
+// With an If-Match header holding an ETag of the URL, the update is only applied if the URL wasn't
+// updated since, and 412 Precondition Failed is returned otherwise.
 func (h *URLHandler) UpdateURL(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), h.config.RequestTimeout)
 	defer cancel()
+	logger := h.requestLogger(c)
 
 	shortURL := c.Param("short_url")
 
 	var input types.URLRequest
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		h.logger.Error("Error decoding request body", zap.Error(err))
+		logger.Error("Error decoding request body", zap.Error(err))
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
+	input.URL = h.normalizeURL(input.URL)
+	if h.exceedsMaxURLLength(input.URL) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": urlTooLong})
+		return
+	}
 
 	if err := h.validate.Struct(input); err != nil {
-		h.logger.Error("Invalid input", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL provided"})
+		logger.Error("Invalid input", zap.Error(err))
+		c.JSON(h.validationStatus(), gin.H{"error": "Invalid URL provided"})
+		return
+	}
+	if h.rejectDestination(ctx, c, input.URL) {
 		return
 	}
 
-	err := h.service.UpdateURL(ctx, shortURL, input.URL)
+	var urlData types.URLData
+	var err error
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" && strings.TrimSpace(ifMatch) != "*" {
+		updatedAt, ok := etagUpdatedAt(ifMatch)
+		if !ok {
+			// Not an ETag this service hands out, so it can't match the current version
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": urlModified})
+			return
+		}
+		urlData, err = h.service.UpdateURLIfUnmodified(ctx, shortURL, input.URL, updatedAt)
+	} else {
+		urlData, err = h.service.UpdateURL(ctx, shortURL, input.URL)
+	}
 	if err != nil {
 		h.handleError(c, err, map[error]string{
 			services.ErrShortURLNotFound: shortURLNotFound,
+			services.ErrVersionMismatch:  urlModified,
 			context.DeadlineExceeded:     errorTimeout,
 			nil:                          errorUpdatingURL,
 		})
 		return
 	}
 
-	urlData, err := h.service.GetURLData(ctx, shortURL)
+	if h.config.EnableETags {
+		setURLDataValidators(c, urlData)
+	}
+	c.JSON(http.StatusOK, h.newURLResponse(urlData))
+}
+
+// PatchURL applies any subset of a new URL, TTL and alias to an existing short URL, leaving the
+// omitted fields unchanged, and responds with the URL as stored. A new TTL counts from now.
+// It returns 404 Not Found if the short URL doesn't exist and 409 Conflict if the alias is taken.
+func (h *URLHandler) PatchURL(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.config.RequestTimeout)
+	defer cancel()
+	logger := h.requestLogger(c)
+
+	shortURL := c.Param("short_url")
+
+	var input types.URLPatchRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		logger.Error("Error decoding request body", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidRequestBody})
+		return
+	}
+	if input.URL == nil && input.TTL == nil && input.Alias == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": emptyPatch})
+		return
+	}
+
+	var patch services.URLPatch
+	if input.URL != nil {
+		normalized := h.normalizeURL(*input.URL)
+		input.URL = &normalized
+		if h.exceedsMaxURLLength(normalized) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": urlTooLong})
+			return
+		}
+		if err := h.validate.Struct(input); err != nil || normalized == "" {
+			logger.Error("Invalid input", zap.Error(err))
+			c.JSON(h.validationStatus(), gin.H{"error": invalidURLProvided})
+			return
+		}
+		if h.rejectDestination(ctx, c, normalized) {
+			return
+		}
+		patch.URL = input.URL
+	}
+	if input.TTL != nil {
+		ttl, err := time.ParseDuration(*input.TTL)
+		if err != nil || ttl <= 0 {
+			logger.Error("Invalid TTL", zap.String("ttl", *input.TTL), zap.Error(err))
+			c.JSON(h.validationStatus(), gin.H{"error": invalidTTLProvided})
+			return
+		}
+		patch.TTL = &ttl
+	}
+	if input.Alias != nil {
+		if len(h.config.AliasAPIKeys) > 0 && !apikey.Contains(h.config.AliasAPIKeys, requestAPIKey(c.Request)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": aliasNotAllowed})
+			return
+		}
+		patch.Alias = input.Alias
+	}
+
+	urlData, err := h.service.PatchURL(ctx, shortURL, patch)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidAlias) {
+			c.JSON(h.validationStatus(), gin.H{"error": invalidAliasProvided})
+			return
+		}
+		if errors.Is(err, services.ErrAliasTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": aliasTaken})
+			return
+		}
 		h.handleError(c, err, map[error]string{
 			services.ErrShortURLNotFound: shortURLNotFound,
+			services.ErrVersionMismatch:  urlModifiedConcurrently,
 			context.DeadlineExceeded:     errorTimeout,
-			nil:                          errorRetrievingURL,
+			nil:                          errorUpdatingURL,
 		})
 		return
 	}
 
-	response := types.URLResponse{
-		ShortURL:    urlData.ShortURL,
-		OriginalURL: urlData.OriginalURL,
-		CreatedAt:   urlData.CreatedAt,
-		UpdatedAt:   urlData.UpdatedAt,
+	if h.config.EnableETags {
+		setURLDataValidators(c, urlData)
 	}
-	c.JSON(http.StatusOK, response)
+	c.JSON(http.StatusOK, h.newURLResponse(urlData))
 }
 
 // DeleteURL removes a short URL and its corresponding original URL from storage.
@@ -261,3 +902,236 @@ func (h *URLHandler) DeleteURL(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// RestoreURL brings back a short URL deleted while soft deletes are enabled, answering 200 OK
+// with its data, or 404 Not Found if there is no deleted short URL by that name.
+func (h *URLHandler) RestoreURL(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.config.RequestTimeout)
+	defer cancel()
+
+	shortURL := c.Param("short_url")
+
+	urlData, err := h.service.RestoreURL(ctx, shortURL)
+	if errors.Is(err, services.ErrSoftDeleteDisabled) {
+		// The storage backend doesn't support soft deletes, so nothing was ever kept to restore
+		err = services.ErrShortURLNotFound
+	}
+	if err != nil {
+		h.handleError(c, err, map[error]string{
+			services.ErrShortURLNotFound: deletedURLNotFound,
+			context.DeadlineExceeded:     errorTimeout,
+			nil:                          errorRestoringURL,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.newURLResponse(urlData))
+}
+
+// BatchDeleteShortURLs deletes up to config.MaxBatchSize short URLs at once. It always answers
+// 200 OK with the result of each short URL, so that partial failures such as short URLs that
+// don't exist are visible, and 400 Bad Request only for an invalid request body or batch size.
+func (h *URLHandler) BatchDeleteShortURLs(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.config.RequestTimeout)
+	defer cancel()
+
+	var input types.BatchDeleteRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		h.requestLogger(c).Error("Error decoding request body", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidRequestBody})
+		return
+	}
+	if len(input.ShortURLs) == 0 || len(input.ShortURLs) > h.config.MaxBatchSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidBatchSize})
+		return
+	}
+
+	errs := h.service.BatchDelete(ctx, input.ShortURLs)
+	results := make(map[string]types.BatchDeleteResult, len(errs))
+	for shortURL, err := range errs {
+		var result types.BatchDeleteResult
+		switch {
+		case err == nil:
+			result.Status = http.StatusNoContent
+		case errors.Is(err, services.ErrShortURLNotFound):
+			result.Status, result.Error = http.StatusNotFound, shortURLNotFound
+		case errors.Is(err, context.DeadlineExceeded):
+			result.Status, result.Error = http.StatusRequestTimeout, errorTimeout
+		default:
+			h.requestLogger(c).Error("Unexpected error", zap.String("short_url", shortURL), zap.Error(err))
+			result.Status, result.Error = http.StatusInternalServerError, errorDeletingURL
+		}
+		results[shortURL] = result
+	}
+	c.JSON(http.StatusOK, types.BatchDeleteResponse{Results: results})
+}
+
+// BatchGetURLData looks up to config.MaxBatchSize short URLs at once. It answers 200 OK with the
+// data of the short URLs found and the error message of the others, such as those that don't exist
+// or have expired, and 400 Bad Request only for an invalid request body or batch size.
+func (h *URLHandler) BatchGetURLData(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.config.RequestTimeout)
+	defer cancel()
+
+	var input types.BatchGetRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		h.requestLogger(c).Error("Error decoding request body", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidRequestBody})
+		return
+	}
+	if len(input.ShortURLs) == 0 || len(input.ShortURLs) > h.config.MaxBatchSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidBatchSize})
+		return
+	}
+
+	found, errs := h.service.BatchGet(ctx, input.ShortURLs)
+	response := types.BatchGetResponse{
+		URLs:   make(map[string]types.URLResponse, len(found)),
+		Errors: make(map[string]string, len(errs)),
+	}
+	for shortURL, urlData := range found {
+		response.URLs[shortURL] = h.newURLResponse(urlData)
+	}
+	for shortURL, err := range errs {
+		switch {
+		case errors.Is(err, services.ErrShortURLNotFound):
+			response.Errors[shortURL] = shortURLNotFound
+		case errors.Is(err, services.ErrShortURLExpired):
+			response.Errors[shortURL] = shortURLExpired
+		case errors.Is(err, context.DeadlineExceeded):
+			response.Errors[shortURL] = errorTimeout
+		default:
+			h.requestLogger(c).Error("Unexpected error", zap.String("short_url", shortURL), zap.Error(err))
+			response.Errors[shortURL] = errorRetrievingURL
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// defaultPageSize is the page size used by ListURLs when page_size is not given.
+const defaultPageSize = 20
+
+// ListURLs lists the stored short URLs one page at a time, oldest first, using the
+// "page" (1-based) and "page_size" query parameters. A page_size above config.MaxPageSize
+// is clamped to it. With a "tag" query parameter it instead lists every URL carrying that tag.
+// It returns 400 Bad Request for invalid parameters.
+func (h *URLHandler) ListURLs(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.config.RequestTimeout)
+	defer cancel()
+
+	if tag, ok := c.GetQuery("tag"); ok {
+		h.listURLsByTag(ctx, c, tag)
+		return
+	}
+
+	page, err := positiveQueryInt(c, "page", 1)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidPageProvided})
+		return
+	}
+	pageSize, err := positiveQueryInt(c, "page_size", min(defaultPageSize, h.config.MaxPageSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidPageSizeProvided})
+		return
+	}
+	pageSize = min(pageSize, h.config.MaxPageSize)
+
+	items, total, err := h.service.List(ctx, page, pageSize)
+	if err != nil {
+		h.handleError(c, err, map[error]string{
+			context.DeadlineExceeded: errorTimeout,
+			nil:                      errorListingURLs,
+		})
+		return
+	}
+
+	response := types.URLPageResponse{Items: make([]types.URLResponse, 0, len(items)), Total: total, Page: page}
+	for _, urlData := range items {
+		response.Items = append(response.Items, h.newURLResponse(urlData))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// listURLsByTag responds with every URL carrying tag.
+func (h *URLHandler) listURLsByTag(ctx context.Context, c *gin.Context, tag string) {
+	if !h.config.EnableTags {
+		c.JSON(http.StatusBadRequest, gin.H{"error": tagsNotEnabled})
+		return
+	}
+	if tag == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": tagRequired})
+		return
+	}
+
+	items, err := h.service.ListByTag(ctx, tag)
+	if err != nil {
+		h.handleError(c, err, map[error]string{
+			context.DeadlineExceeded: errorTimeout,
+			nil:                      errorListingURLs,
+		})
+		return
+	}
+
+	response := types.URLListResponse{URLs: make([]types.URLResponse, 0, len(items))}
+	for _, urlData := range items {
+		response.URLs = append(response.URLs, h.newURLResponse(urlData))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// defaultTopLimit is the number of URLs listed by TopURLs when limit is not given.
+const defaultTopLimit = 10
+
+// TopURLs lists the most visited short URLs, most accessed first, along with their access counts.
+// The "limit" query parameter sets how many are listed, clamped to config.MaxPageSize. It returns
+// 400 Bad Request for an invalid limit.
+func (h *URLHandler) TopURLs(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.config.RequestTimeout)
+	defer cancel()
+
+	limit, err := positiveQueryInt(c, "limit", min(defaultTopLimit, h.config.MaxPageSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalidLimitProvided})
+		return
+	}
+	limit = min(limit, h.config.MaxPageSize)
+
+	items, err := h.service.TopN(ctx, limit)
+	if err != nil {
+		h.handleError(c, err, map[error]string{
+			context.DeadlineExceeded: errorTimeout,
+			nil:                      errorListingURLs,
+		})
+		return
+	}
+
+	response := types.URLListResponse{URLs: make([]types.URLResponse, 0, len(items))}
+	for _, urlData := range items {
+		urlResponse := h.newURLResponse(urlData)
+		urlResponse.AccessCount = &urlData.AccessCount
+		response.URLs = append(response.URLs, urlResponse)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// milliseconds returns d in fractional milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// positiveQueryInt parses the query parameter key as a positive integer, returning
+// fallback when the parameter is absent.
+func positiveQueryInt(c *gin.Context, key string, fallback int) (int, error) {
+	raw, ok := c.GetQuery(key)
+	if !ok {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, err
+	}
+	if value < 1 {
+		return 0, fmt.Errorf("%s must be positive", key)
+	}
+	return value, nil
+}
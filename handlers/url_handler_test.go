@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -12,11 +13,15 @@ import (
 	"go-url-shortening/config"
 	"go-url-shortening/services"
 	"go-url-shortening/services/mocks"
+	"go-url-shortening/storage"
 	"go-url-shortening/types"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -133,6 +138,8 @@ func setupTestHandler() (URLHandlerInterface, error) {
 		RatePeriod:     time.Second,
 		RequestTimeout: 5 * time.Second,
 		ServerPort:     3000,
+		MaxPageSize:    100,
+		MaxBatchSize:   3,
 	}
 	mockService := new(mocks.MockURLService)
 	logger := zap.NewNop()
@@ -200,7 +207,7 @@ func TestCreateShortURL(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 		},
 		{
-			name:           "Service CreateShortURL fails with ErrShortURLExists",
+			name:           "Service CreateShortURL fails with ErrShortURLExists after collisions",
 			inputURL:       "https://example.com",
 			expectedStatus: http.StatusConflict,
 			mockCreateShortURL: func(ctx context.Context, originalURL string) (types.URLData, error) {
@@ -235,7 +242,7 @@ func TestCreateShortURL(t *testing.T) {
 			mockService := new(mocks.MockURLService)
 
 			if tt.mockCreateShortURL != nil {
-				mockService.On("CreateShortURL", mock.Anything, tt.inputURL).Return(tt.mockCreateShortURL(context.Background(), tt.inputURL))
+				mockService.On("CreateShortURL", mock.Anything, tt.inputURL, services.CreateOptions{}).Return(tt.mockCreateShortURL(context.Background(), tt.inputURL))
 			}
 
 			urlHandler, ok := handler.(*URLHandler)
@@ -276,6 +283,440 @@ func TestCreateShortURL(t *testing.T) {
 	}
 }
 
+func TestBatchCreateShortURLs(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Per-item results", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		mockService.On("BatchCreate", mock.Anything, []string{"https://a.com", "https://b.com"}).Return(
+			[]types.URLData{{ShortURL: "aaa111", OriginalURL: "https://a.com", CreatedAt: now, UpdatedAt: now}, {}},
+			[]error{nil, services.ErrStorageCapacityReached},
+		)
+		handler.(*URLHandler).service = mockService
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short/batch", strings.NewReader(`{"urls":["https://a.com","not-a-url","https://b.com"]}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+
+		handler.BatchCreateShortURLs(c)
+
+		assert.Equal(t, http.StatusMultiStatus, w.Code)
+		assert.JSONEq(t, `{"results":[
+			{"url":"https://a.com","status":201,"short_url":"aaa111","original_url":"https://a.com","created_at":"2024-01-01T00:00:00Z","updated_at":"2024-01-01T00:00:00Z","created":true},
+			{"url":"not-a-url","status":400,"error":"Invalid URL provided"},
+			{"url":"https://b.com","status":507,"error":"Storage capacity reached"}
+		]}`, w.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Existing URLs are returned like a single create", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		mockService.On("BatchCreate", mock.Anything, []string{"https://a.com", "https://b.com"}).Return(
+			[]types.URLData{{ShortURL: "aaa111", OriginalURL: "https://a.com", CreatedAt: now, UpdatedAt: now}, {}},
+			[]error{services.ErrShortURLExists, services.ErrShortURLExists},
+		)
+		handler.(*URLHandler).service = mockService
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short/batch", strings.NewReader(`{"urls":["https://a.com","https://b.com"]}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+
+		handler.BatchCreateShortURLs(c)
+
+		assert.Equal(t, http.StatusMultiStatus, w.Code)
+		assert.JSONEq(t, `{"results":[
+			{"url":"https://a.com","status":200,"short_url":"aaa111","original_url":"https://a.com","created_at":"2024-01-01T00:00:00Z","updated_at":"2024-01-01T00:00:00Z","created":false},
+			{"url":"https://b.com","status":409,"error":"Short URL already exists"}
+		]}`, w.Body.String(), "Only generated short URLs colliding every time should conflict")
+	})
+
+	for _, body := range []string{`{"urls":[]}`, `{"urls":["https://a.com","https://b.com","https://c.com","https://d.com"]}`, `{"urls":"https://a.com"}`} {
+		t.Run("Rejected body "+body, func(t *testing.T) {
+			mockService := new(mocks.MockURLService)
+			handler.(*URLHandler).service = mockService
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short/batch", strings.NewReader(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			handler.BatchCreateShortURLs(c)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			mockService.AssertNotCalled(t, "BatchCreate", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestBatchDeleteShortURLs(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+
+	t.Run("Existing and missing short URLs", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		mockService.On("BatchDelete", mock.Anything, []string{"aaa111", "missing", "bbb222"}).Return(map[string]error{
+			"aaa111":  nil,
+			"missing": services.ErrShortURLNotFound,
+			"bbb222":  errors.New("storage unavailable"),
+		})
+		handler.(*URLHandler).service = mockService
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short/batch-delete", strings.NewReader(`{"short_urls":["aaa111","missing","bbb222"]}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+
+		handler.BatchDeleteShortURLs(c)
+
+		assert.Equal(t, http.StatusOK, w.Code, "Partial failures should still be answered with 200")
+		assert.JSONEq(t, `{"results":{
+			"aaa111":{"status":204},
+			"missing":{"status":404,"error":"Short URL not found"},
+			"bbb222":{"status":500,"error":"Error deleting URL"}
+		}}`, w.Body.String())
+		mockService.AssertExpectations(t)
+	})
+
+	for _, body := range []string{`invalid json`, `{"short_urls":[]}`, `{"short_urls":["a","b","c","d"]}`} {
+		t.Run("Rejected body "+body, func(t *testing.T) {
+			mockService := new(mocks.MockURLService)
+			handler.(*URLHandler).service = mockService
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short/batch-delete", strings.NewReader(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			handler.BatchDeleteShortURLs(c)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			mockService.AssertNotCalled(t, "BatchDelete", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestBatchGetURLData(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Found and missing short URLs", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		mockService.On("BatchGet", mock.Anything, []string{"aaa111", "missing", "expired"}).Return(
+			map[string]types.URLData{
+				"aaa111": {ShortURL: "aaa111", OriginalURL: "https://example.com", CreatedAt: created, UpdatedAt: created},
+			},
+			map[string]error{
+				"missing": services.ErrShortURLNotFound,
+				"expired": services.ErrShortURLExpired,
+			})
+		handler.(*URLHandler).service = mockService
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short/batch-get", strings.NewReader(`{"short_urls":["aaa111","missing","expired"]}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+
+		handler.BatchGetURLData(c)
+
+		assert.Equal(t, http.StatusOK, w.Code, "Missing short URLs should still be answered with 200")
+		var response types.BatchGetResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.URLs, 1)
+		assert.Equal(t, "https://example.com", response.URLs["aaa111"].OriginalURL)
+		assert.Equal(t, map[string]string{"missing": "Short URL not found", "expired": "Short URL expired"}, response.Errors)
+		mockService.AssertExpectations(t)
+	})
+
+	for _, body := range []string{`invalid json`, `{"short_urls":[]}`, `{"short_urls":["a","b","c","d"]}`} {
+		t.Run("Rejected body "+body, func(t *testing.T) {
+			mockService := new(mocks.MockURLService)
+			handler.(*URLHandler).service = mockService
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short/batch-get", strings.NewReader(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			handler.BatchGetURLData(c)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			mockService.AssertNotCalled(t, "BatchGet", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestCreateShortURLWithTTL(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	expiresAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		ttl            string
+		expectedStatus int
+		expectedOpts   *services.CreateOptions
+	}{
+		{name: "Valid TTL", ttl: "1h30m", expectedStatus: http.StatusCreated, expectedOpts: &services.CreateOptions{TTL: 90 * time.Minute}},
+		{name: "Malformed TTL", ttl: "tomorrow", expectedStatus: http.StatusBadRequest},
+		{name: "Zero TTL", ttl: "0s", expectedStatus: http.StatusBadRequest},
+		{name: "Negative TTL", ttl: "-1h", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(mocks.MockURLService)
+			if tt.expectedOpts != nil {
+				mockService.On("CreateShortURL", mock.Anything, "https://example.com", *tt.expectedOpts).
+					Return(types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com", ExpiresAt: expiresAt}, nil)
+			}
+			handler.(*URLHandler).service = mockService
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			body := fmt.Sprintf(`{"url":"https://example.com","ttl":%q}`, tt.ttl)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short", strings.NewReader(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			handler.CreateShortURL(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedOpts != nil {
+				var response types.URLResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+				require.NotNil(t, response.ExpiresAt)
+				assert.Equal(t, expiresAt, *response.ExpiresAt)
+			} else {
+				assert.JSONEq(t, `{"error":"Invalid TTL provided"}`, w.Body.String())
+				mockService.AssertNotCalled(t, "CreateShortURL", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestCreateShortURLWithTags(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		enableTags     bool
+		tags           []string
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "Tags stored when enabled", enableTags: true, tags: []string{"campaignX", "team"}, expectedStatus: http.StatusCreated},
+		{name: "Tags rejected when disabled", enableTags: false, tags: []string{"campaignX"}, expectedStatus: http.StatusBadRequest, expectedError: "Tags are not enabled"},
+		{name: "Too many tags", enableTags: true, tags: strings.Split("a,b,c,d,e,f,g,h,i,j,k", ","), expectedStatus: http.StatusBadRequest, expectedError: "Invalid tags provided"},
+		{name: "Tag too long", enableTags: true, tags: []string{strings.Repeat("x", 33)}, expectedStatus: http.StatusBadRequest, expectedError: "Invalid tags provided"},
+		{name: "Empty tag", enableTags: true, tags: []string{""}, expectedStatus: http.StatusBadRequest, expectedError: "Invalid tags provided"},
+		{name: "Tag with a comma", enableTags: true, tags: []string{"a,b"}, expectedStatus: http.StatusBadRequest, expectedError: "Invalid tags provided"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(mocks.MockURLService)
+			mockService.On("CreateShortURL", mock.Anything, "https://example.com", services.CreateOptions{Tags: tt.tags}).
+				Return(types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com", Tags: tt.tags}, nil)
+			handler.(*URLHandler).service = mockService
+			handler.(*URLHandler).config.EnableTags = tt.enableTags
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			body, _ := json.Marshal(types.URLRequest{URL: "https://example.com", Tags: tt.tags})
+			c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short", bytes.NewReader(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			handler.CreateShortURL(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedError != "" {
+				assert.JSONEq(t, fmt.Sprintf(`{"error":%q}`, tt.expectedError), w.Body.String())
+				mockService.AssertNotCalled(t, "CreateShortURL", mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+			var response types.URLResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.tags, response.Tags)
+		})
+	}
+}
+
+func TestListURLs(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		query          string
+		serviceItems   []types.URLData
+		serviceErr     error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:  "Filter by tag",
+			query: "?tag=campaignX",
+			serviceItems: []types.URLData{
+				{ShortURL: "a", OriginalURL: "https://a.com", Tags: []string{"campaignX"}},
+				{ShortURL: "b", OriginalURL: "https://b.com", Tags: []string{"campaignX", "team"}},
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{name: "No matches returns an empty list", query: "?tag=unknown", serviceItems: nil, expectedStatus: http.StatusOK, expectedBody: `{"urls":[]}`},
+		{name: "Empty tag", query: "?tag=", expectedStatus: http.StatusBadRequest, expectedBody: `{"error":"Tag query parameter is required"}`},
+		{name: "Service error", query: "?tag=broken", serviceErr: errors.New("boom"), expectedStatus: http.StatusInternalServerError, expectedBody: `{"error":"Internal server error"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(mocks.MockURLService)
+			mockService.On("ListByTag", mock.Anything, mock.Anything).Return(tt.serviceItems, tt.serviceErr)
+			handler.(*URLHandler).service = mockService
+			handler.(*URLHandler).config.EnableTags = true
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodGet, "/api/v1/short"+tt.query, nil)
+
+			handler.ListURLs(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, w.Body.String())
+				return
+			}
+			var response types.URLListResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			require.Len(t, response.URLs, len(tt.serviceItems))
+			for i, item := range tt.serviceItems {
+				assert.Equal(t, item.ShortURL, response.URLs[i].ShortURL)
+				assert.Equal(t, item.Tags, response.URLs[i].Tags)
+			}
+		})
+	}
+}
+
+func TestListURLsPaginated(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	items := []types.URLData{
+		{ShortURL: "a", OriginalURL: "https://a.com"},
+		{ShortURL: "b", OriginalURL: "https://b.com"},
+	}
+
+	tests := []struct {
+		name             string
+		query            string
+		enableTags       bool
+		expectedPage     int
+		expectedPageSize int
+		serviceErr       error
+		expectedStatus   int
+		expectedBody     string
+	}{
+		{name: "Defaults", query: "", expectedPage: 1, expectedPageSize: 20, expectedStatus: http.StatusOK},
+		{name: "Explicit page", query: "?page=3&page_size=2", expectedPage: 3, expectedPageSize: 2, expectedStatus: http.StatusOK},
+		{name: "Page size is capped", query: "?page_size=1000", expectedPage: 1, expectedPageSize: 100, expectedStatus: http.StatusOK},
+		{name: "Non-numeric page", query: "?page=first", expectedStatus: http.StatusBadRequest, expectedBody: `{"error":"Invalid page provided"}`},
+		{name: "Zero page", query: "?page=0", expectedStatus: http.StatusBadRequest, expectedBody: `{"error":"Invalid page provided"}`},
+		{name: "Negative page size", query: "?page_size=-5", expectedStatus: http.StatusBadRequest, expectedBody: `{"error":"Invalid page_size provided"}`},
+		{name: "Tag filter requires tags", query: "?tag=campaignX", expectedStatus: http.StatusBadRequest, expectedBody: `{"error":"Tags are not enabled"}`},
+		{name: "Timeout", query: "", expectedPage: 1, expectedPageSize: 20, serviceErr: context.DeadlineExceeded, expectedStatus: http.StatusRequestTimeout, expectedBody: `{"error":"Request timed out"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(mocks.MockURLService)
+			if tt.expectedPage > 0 {
+				mockService.On("List", mock.Anything, tt.expectedPage, tt.expectedPageSize).Return(items, 42, tt.serviceErr).Once()
+			}
+			handler.(*URLHandler).service = mockService
+			handler.(*URLHandler).config.EnableTags = tt.enableTags
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodGet, "/api/v1/short"+tt.query, nil)
+
+			handler.ListURLs(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, w.Body.String())
+				return
+			}
+			var response types.URLPageResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, 42, response.Total)
+			assert.Equal(t, tt.expectedPage, response.Page)
+			require.Len(t, response.Items, len(items))
+			assert.Equal(t, "a", response.Items[0].ShortURL)
+			assert.Equal(t, "https://b.com", response.Items[1].OriginalURL)
+		})
+	}
+}
+
+func TestTopURLs(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	items := []types.URLData{
+		{ShortURL: "a", OriginalURL: "https://a.com", AccessCount: 42},
+		{ShortURL: "b", OriginalURL: "https://b.com"},
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedLimit  int
+		serviceErr     error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Default limit", query: "", expectedLimit: 10, expectedStatus: http.StatusOK},
+		{name: "Explicit limit", query: "?limit=3", expectedLimit: 3, expectedStatus: http.StatusOK},
+		{name: "Limit is capped", query: "?limit=1000", expectedLimit: 100, expectedStatus: http.StatusOK},
+		{name: "Non-numeric limit", query: "?limit=all", expectedStatus: http.StatusBadRequest, expectedBody: `{"error":"Invalid limit provided"}`},
+		{name: "Zero limit", query: "?limit=0", expectedStatus: http.StatusBadRequest, expectedBody: `{"error":"Invalid limit provided"}`},
+		{name: "Timeout", query: "", expectedLimit: 10, serviceErr: context.DeadlineExceeded, expectedStatus: http.StatusRequestTimeout, expectedBody: `{"error":"Request timed out"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(mocks.MockURLService)
+			if tt.expectedLimit > 0 {
+				mockService.On("TopN", mock.Anything, tt.expectedLimit).Return(items, tt.serviceErr).Once()
+			}
+			handler.(*URLHandler).service = mockService
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodGet, "/api/v1/short/top"+tt.query, nil)
+
+			handler.TopURLs(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, w.Body.String())
+				return
+			}
+			var response types.URLListResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			require.Len(t, response.URLs, len(items))
+			assert.Equal(t, "a", response.URLs[0].ShortURL)
+			require.NotNil(t, response.URLs[0].AccessCount)
+			assert.Equal(t, int64(42), *response.URLs[0].AccessCount)
+			require.NotNil(t, response.URLs[1].AccessCount, "Unvisited URLs should report a zero count")
+			assert.Zero(t, *response.URLs[1].AccessCount)
+		})
+	}
+}
+
 func TestGetURLData(t *testing.T) {
 	handler, err := setupTestHandler()
 	require.NoError(t, err)
@@ -319,6 +760,15 @@ func TestGetURLData(t *testing.T) {
 				return types.URLData{OriginalURL: ""}, services.ErrShortURLNotFound
 			},
 		},
+		{
+			name:           "Short URL expired",
+			shortURL:       "expired",
+			expectedStatus: http.StatusGone,
+			expectedURL:    "",
+			mockGetURLData: func(ctx context.Context, shortURL string) (types.URLData, error) {
+				return types.URLData{}, services.ErrShortURLExpired
+			},
+		},
 		{
 			name:           "Service error",
 			shortURL:       "error",
@@ -346,28 +796,380 @@ func TestGetURLData(t *testing.T) {
 			w := httptest.NewRecorder()
 			c, _ := gin.CreateTestContext(w)
 
-			// Set up the request
-			req, _ := http.NewRequest(http.MethodGet, "/api/v1/short/"+tt.shortURL, nil)
-			c.Request = req
-			c.Params = []gin.Param{{Key: "short_url", Value: tt.shortURL}}
+			// Set up the request
+			req, _ := http.NewRequest(http.MethodGet, "/api/v1/short/"+tt.shortURL, nil)
+			c.Request = req
+			c.Params = []gin.Param{{Key: "short_url", Value: tt.shortURL}}
+
+			// Call the handler function
+			handler.GetURLData(c)
+
+			// Check the status code
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedStatus == http.StatusOK {
+				var response types.URLResponse
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				require.NoError(t, err)
+				assert.Equal(t, tt.shortURL, response.ShortURL, "Short URL in response should match")
+				assert.Equal(t, tt.expectedURL, response.OriginalURL, "Original URL in response should match")
+				assert.NotZero(t, response.CreatedAt, "CreatedAt should not be zero")
+				assert.NotZero(t, response.UpdatedAt, "UpdatedAt should not be zero")
+			}
+		})
+	}
+}
+
+func TestGetURLStats(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		shortURL       string
+		urlData        types.URLData
+		serviceErr     error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Valid short URL",
+			shortURL:       "abc123",
+			urlData:        types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com", AccessCount: 42, CreatedAt: createdAt, UpdatedAt: createdAt},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"short_url":"abc123","access_count":42,"created_at":"2024-01-01T00:00:00Z","updated_at":"2024-01-01T00:00:00Z"}`,
+		},
+		{
+			name:           "Short URL not found",
+			shortURL:       "notfound",
+			serviceErr:     services.ErrShortURLNotFound,
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   `{"error":"Short URL not found"}`,
+		},
+		{
+			name:           "Short URL expired",
+			shortURL:       "expired",
+			serviceErr:     services.ErrShortURLExpired,
+			expectedStatus: http.StatusGone,
+			expectedBody:   `{"error":"Short URL expired"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(mocks.MockURLService)
+			mockService.On("GetURLData", mock.Anything, tt.shortURL).Return(tt.urlData, tt.serviceErr)
+
+			urlHandler, ok := handler.(*URLHandler)
+			require.True(t, ok)
+			urlHandler.service = mockService
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodGet, "/api/v1/short/"+tt.shortURL+"/stats", nil)
+			c.Params = []gin.Param{{Key: "short_url", Value: tt.shortURL}}
+
+			handler.GetURLStats(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestNewURLResponseReachability(t *testing.T) {
+	handler := &URLHandler{config: &config.Config{}}
+	response := handler.newURLResponse(types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"})
+	assert.Nil(t, response.LastCheckedAt)
+	assert.Zero(t, response.LastStatus)
+
+	checkedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	response = handler.newURLResponse(types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com", LastCheckedAt: checkedAt, LastStatus: http.StatusOK})
+	require.NotNil(t, response.LastCheckedAt)
+	assert.Equal(t, checkedAt, *response.LastCheckedAt)
+	assert.Equal(t, http.StatusOK, response.LastStatus)
+}
+
+func TestShortLinkWithBaseURL(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	handler.(*URLHandler).config.BaseURL = "https://sho.rt/"
+	urlData := types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}
+
+	mockService := new(mocks.MockURLService)
+	mockService.On("CreateShortURL", mock.Anything, "https://example.com", services.CreateOptions{}).Return(urlData, nil)
+	mockService.On("GetURLData", mock.Anything, "abc123").Return(urlData, nil)
+	mockService.On("UpdateURL", mock.Anything, "abc123", "https://example.com").Return(urlData, nil)
+	handler.(*URLHandler).service = mockService
+
+	requests := []struct {
+		name    string
+		method  string
+		handle  func(c *gin.Context)
+		status  int
+		hasBody bool
+	}{
+		{name: "Create", method: http.MethodPost, handle: handler.CreateShortURL, status: http.StatusCreated, hasBody: true},
+		{name: "Get", method: http.MethodGet, handle: handler.GetURLData, status: http.StatusOK},
+		{name: "Update", method: http.MethodPut, handle: handler.UpdateURL, status: http.StatusOK, hasBody: true},
+	}
+	for _, req := range requests {
+		t.Run(req.name, func(t *testing.T) {
+			var body *bytes.Buffer
+			if req.hasBody {
+				body = bytes.NewBufferString(`{"url":"https://example.com"}`)
+			} else {
+				body = &bytes.Buffer{}
+			}
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(req.method, "/api/v1/short/abc123", body)
+			c.Params = gin.Params{{Key: "short_url", Value: "abc123"}}
+
+			req.handle(c)
+
+			require.Equal(t, req.status, w.Code)
+			var response types.URLResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "abc123", response.ShortURL)
+			assert.Equal(t, "https://sho.rt/abc123", response.ShortLink)
+		})
+	}
+
+	t.Run("Omitted without a base URL", func(t *testing.T) {
+		handler := &URLHandler{config: &config.Config{}}
+		assert.Empty(t, handler.newURLResponse(urlData).ShortLink)
+	})
+}
+
+func TestURLDataETags(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	handler.(*URLHandler).config.EnableETags = true
+
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	original := types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com", CreatedAt: created, UpdatedAt: created}
+	updated := original
+	updated.OriginalURL = "https://example.org"
+	updated.UpdatedAt = created.Add(time.Minute)
+
+	mockService := new(mocks.MockURLService)
+	mockService.On("GetURLData", mock.Anything, "abc123").Return(original, nil).Twice()
+	mockService.On("UpdateURL", mock.Anything, "abc123", "https://example.org").Return(updated, nil).Once()
+	mockService.On("GetURLData", mock.Anything, "abc123").Return(updated, nil)
+	handler.(*URLHandler).service = mockService
+
+	// A router is needed for a 304 without a body to be written to the recorder.
+	router := gin.New()
+	router.GET("/api/v1/short/:short_url", handler.GetURLData)
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/api/v1/short/abc123", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := get("")
+	require.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+	assert.True(t, strings.HasPrefix(etag, `W/"`), "ETag should be weak, got %q", etag)
+
+	unchanged := get(etag)
+	assert.Equal(t, http.StatusNotModified, unchanged.Code)
+	assert.Equal(t, etag, unchanged.Header().Get("ETag"), "Repeated reads should keep the ETag")
+	assert.Empty(t, unchanged.Body.String())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "short_url", Value: "abc123"}}
+	c.Request, _ = http.NewRequest(http.MethodPut, "/api/v1/short/abc123", strings.NewReader(`{"url":"https://example.org"}`))
+	handler.UpdateURL(c)
+	require.Equal(t, http.StatusOK, w.Code)
+	rotated := w.Header().Get("ETag")
+	assert.NotEqual(t, etag, rotated, "An update should rotate the ETag")
+
+	stale := get(etag)
+	assert.Equal(t, http.StatusOK, stale.Code, "The ETag from before the update should no longer match")
+	assert.Equal(t, rotated, stale.Header().Get("ETag"))
+	assert.Equal(t, http.StatusNotModified, get(`"other", `+strings.TrimPrefix(rotated, "W/")).Code)
+
+	t.Run("Not sent unless enabled", func(t *testing.T) {
+		handler.(*URLHandler).config.EnableETags = false
+		defer func() { handler.(*URLHandler).config.EnableETags = true }()
+
+		w := get(rotated)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("ETag"))
+		assert.Empty(t, w.Header().Get("Last-Modified"))
+	})
+
+	t.Run("Last-Modified and If-Modified-Since", func(t *testing.T) {
+		getSince := func(ifModifiedSince, ifNoneMatch string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/api/v1/short/abc123", nil)
+			req.Header.Set("If-Modified-Since", ifModifiedSince)
+			if ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", ifNoneMatch)
+			}
+			router.ServeHTTP(w, req)
+			return w
+		}
+
+		w := get("")
+		lastModified := w.Header().Get("Last-Modified")
+		assert.Equal(t, "Mon, 01 Jan 2024 00:01:00 GMT", lastModified, "Last-Modified should be the time of the update")
+
+		assert.Equal(t, http.StatusNotModified, getSince(lastModified, "").Code)
+		assert.Equal(t, http.StatusNotModified, getSince(updated.UpdatedAt.Add(time.Hour).Format(http.TimeFormat), "").Code)
+		assert.Equal(t, http.StatusOK, getSince(created.Format(http.TimeFormat), "").Code, "A date before the update should get the URL data")
+		assert.Equal(t, http.StatusOK, getSince("not a date", "").Code)
+		assert.Equal(t, http.StatusOK, getSince(lastModified, etag).Code, "If-None-Match should take precedence over If-Modified-Since")
+	})
+}
+
+func TestMaxURLLength(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	urlHandler := handler.(*URLHandler)
+	urlHandler.config.MaxURLLength = 2048
+	// A URL of exactly n characters
+	urlOfLength := func(n int) string {
+		prefix := "https://example.com/"
+		return prefix + strings.Repeat("a", n-len(prefix))
+	}
+
+	t.Run("Create", func(t *testing.T) {
+		for _, tt := range []struct {
+			length         int
+			expectedStatus int
+		}{
+			{length: 2048, expectedStatus: http.StatusCreated},
+			{length: 2049, expectedStatus: http.StatusBadRequest},
+		} {
+			mockService := new(mocks.MockURLService)
+			mockService.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything).Return(types.URLData{ShortURL: "abc123"}, nil)
+			urlHandler.service = mockService
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short", strings.NewReader(`{"url":"`+urlOfLength(tt.length)+`"}`))
+			handler.CreateShortURL(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code, "Length %d", tt.length)
+			if tt.expectedStatus == http.StatusBadRequest {
+				assert.JSONEq(t, `{"error":"URL too long"}`, w.Body.String())
+				mockService.AssertNotCalled(t, "CreateShortURL", mock.Anything, mock.Anything, mock.Anything)
+			}
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		for _, tt := range []struct {
+			length         int
+			expectedStatus int
+		}{
+			{length: 2048, expectedStatus: http.StatusOK},
+			{length: 2049, expectedStatus: http.StatusBadRequest},
+		} {
+			mockService := new(mocks.MockURLService)
+			mockService.On("UpdateURL", mock.Anything, "abc123", mock.Anything).Return(types.URLData{ShortURL: "abc123"}, nil)
+			urlHandler.service = mockService
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Params = gin.Params{{Key: "short_url", Value: "abc123"}}
+			c.Request, _ = http.NewRequest(http.MethodPut, "/api/v1/short/abc123", strings.NewReader(`{"url":"`+urlOfLength(tt.length)+`"}`))
+			handler.UpdateURL(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code, "Length %d", tt.length)
+			if tt.expectedStatus == http.StatusBadRequest {
+				assert.JSONEq(t, `{"error":"URL too long"}`, w.Body.String())
+				mockService.AssertNotCalled(t, "UpdateURL", mock.Anything, mock.Anything, mock.Anything)
+			}
+		}
+	})
+
+	t.Run("Not enforced when zero", func(t *testing.T) {
+		urlHandler.config.MaxURLLength = 0
+		defer func() { urlHandler.config.MaxURLLength = 2048 }()
+		mockService := new(mocks.MockURLService)
+		mockService.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything).Return(types.URLData{ShortURL: "abc123"}, nil)
+		urlHandler.service = mockService
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short", strings.NewReader(`{"url":"`+urlOfLength(4096)+`"}`))
+		handler.CreateShortURL(c)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+}
+
+func TestUpdateURLIfMatch(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	urlHandler := handler.(*URLHandler)
+	urlHandler.config.EnableETags = true
+	urlHandler.service = services.NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()))
+	created, err := urlHandler.service.CreateShortURL(context.Background(), "https://example.com", services.CreateOptions{})
+	require.NoError(t, err)
+
+	get := func() string {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "short_url", Value: created.ShortURL}}
+		c.Request, _ = http.NewRequest(http.MethodGet, "/api/v1/short/"+created.ShortURL, nil)
+		handler.GetURLData(c)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Header().Get("ETag")
+	}
+	put := func(shortURL, ifMatch, destination string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "short_url", Value: shortURL}}
+		c.Request, _ = http.NewRequest(http.MethodPut, "/api/v1/short/"+shortURL, strings.NewReader(`{"url":"`+destination+`"}`))
+		c.Request.Header.Set("If-Match", ifMatch)
+		handler.UpdateURL(c)
+		return w
+	}
+
+	t.Run("Of two racing updates the stale one fails", func(t *testing.T) {
+		etag := get()
+
+		var wg sync.WaitGroup
+		codes := make([]int, 2)
+		for i := range codes {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				codes[i] = put(created.ShortURL, etag, fmt.Sprintf("https://example.com/%d", i)).Code
+			}(i)
+		}
+		wg.Wait()
+		assert.ElementsMatch(t, []int{http.StatusOK, http.StatusPreconditionFailed}, codes)
+
+		w := put(created.ShortURL, etag, "https://example.com/retry")
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code, "The ETag from before the update should no longer match")
+		assert.JSONEq(t, `{"error":"URL was modified since the If-Match ETag"}`, w.Body.String())
+		assert.Equal(t, http.StatusOK, put(created.ShortURL, get(), "https://example.com/retry").Code)
+	})
 
-			// Call the handler function
-			handler.GetURLData(c)
+	t.Run("Any version matches a wildcard", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, put(created.ShortURL, "*", "https://example.org").Code)
+	})
 
-			// Check the status code
-			assert.Equal(t, tt.expectedStatus, w.Code)
+	t.Run("Foreign ETags never match", func(t *testing.T) {
+		assert.Equal(t, http.StatusPreconditionFailed, put(created.ShortURL, `"not-ours!"`, "https://example.org").Code)
+		assert.Equal(t, http.StatusPreconditionFailed, put(created.ShortURL, "unquoted", "https://example.org").Code)
+	})
 
-			if tt.expectedStatus == http.StatusOK {
-				var response types.URLResponse
-				err := json.Unmarshal(w.Body.Bytes(), &response)
-				require.NoError(t, err)
-				assert.Equal(t, tt.shortURL, response.ShortURL, "Short URL in response should match")
-				assert.Equal(t, tt.expectedURL, response.OriginalURL, "Original URL in response should match")
-				assert.NotZero(t, response.CreatedAt, "CreatedAt should not be zero")
-				assert.NotZero(t, response.UpdatedAt, "UpdatedAt should not be zero")
-			}
-		})
-	}
+	t.Run("Missing short URL", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, put("missing", get(), "https://example.org").Code)
+	})
 }
 
 func TestUpdateURL(t *testing.T) {
@@ -480,13 +1282,17 @@ func TestUpdateURL(t *testing.T) {
 
 			// Set up mock service
 			if tt.mockUpdateURL != nil {
-				mockService.On("UpdateURL", mock.Anything, tt.shortURL.ShortURL, tt.inputURL.OriginalURL).Return(tt.mockUpdateURL(context.Background(), tt.shortURL.ShortURL, tt.inputURL.OriginalURL))
-				mockService.On("GetURLData", mock.Anything, tt.shortURL.ShortURL).Return(types.URLData{
-					ShortURL:    tt.shortURL.ShortURL,
-					OriginalURL: tt.inputURL.OriginalURL,
-					CreatedAt:   time.Now(),
-					UpdatedAt:   time.Now(),
-				}, nil)
+				var updated types.URLData
+				err := tt.mockUpdateURL(context.Background(), tt.shortURL.ShortURL, tt.inputURL.OriginalURL)
+				if err == nil {
+					updated = types.URLData{
+						ShortURL:    tt.shortURL.ShortURL,
+						OriginalURL: tt.inputURL.OriginalURL,
+						CreatedAt:   time.Now(),
+						UpdatedAt:   time.Now(),
+					}
+				}
+				mockService.On("UpdateURL", mock.Anything, tt.shortURL.ShortURL, tt.inputURL.OriginalURL).Return(updated, err)
 			}
 
 			urlHandler, ok := handler.(*URLHandler)
@@ -521,6 +1327,92 @@ func TestUpdateURL(t *testing.T) {
 				assert.NotZero(t, response.CreatedAt, "CreatedAt should not be zero")
 				assert.NotZero(t, response.UpdatedAt, "UpdatedAt should not be zero")
 			}
+			mockService.AssertNotCalled(t, "GetURLData", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestPatchURL(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	urlHandler := handler.(*URLHandler)
+
+	patch := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rr)
+		c.Request, _ = http.NewRequest(http.MethodPatch, "/api/v1/short/abc123", bytes.NewBufferString(body))
+		c.Params = []gin.Param{{Key: "short_url", Value: "abc123"}}
+		handler.PatchURL(c)
+		return rr
+	}
+	ptr := func(s string) *string { return &s }
+
+	t.Run("Only the TTL", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		urlHandler.service = mockService
+		ttl := time.Hour
+		expiresAt := time.Now().Add(time.Hour).UTC()
+		mockService.On("PatchURL", mock.Anything, "abc123", services.URLPatch{TTL: &ttl}).
+			Return(types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com", ExpiresAt: expiresAt}, nil).Once()
+
+		rr := patch(`{"ttl":"1h"}`)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var response types.URLResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Equal(t, "abc123", response.ShortURL)
+		assert.Equal(t, "https://example.com", response.OriginalURL)
+		require.NotNil(t, response.ExpiresAt)
+		assert.True(t, expiresAt.Equal(*response.ExpiresAt))
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("Only the URL", func(t *testing.T) {
+		mockService := new(mocks.MockURLService)
+		urlHandler.service = mockService
+		mockService.On("PatchURL", mock.Anything, "abc123", services.URLPatch{URL: ptr("https://example.org")}).
+			Return(types.URLData{ShortURL: "abc123", OriginalURL: "https://example.org"}, nil).Once()
+
+		rr := patch(`{"url":"https://example.org"}`)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var response types.URLResponse
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Equal(t, "https://example.org", response.OriginalURL)
+		assert.Nil(t, response.ExpiresAt)
+		mockService.AssertExpectations(t)
+	})
+
+	tests := []struct {
+		name           string
+		body           string
+		serviceErr     error
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "Empty patch", body: `{}`, expectedStatus: http.StatusBadRequest, expectedError: emptyPatch},
+		{name: "Invalid JSON input", body: `invalid json`, expectedStatus: http.StatusBadRequest, expectedError: invalidRequestBody},
+		{name: "Invalid URL", body: `{"url":"not-a-url"}`, expectedStatus: http.StatusBadRequest, expectedError: invalidURLProvided},
+		{name: "Empty URL", body: `{"url":""}`, expectedStatus: http.StatusBadRequest, expectedError: invalidURLProvided},
+		{name: "Invalid TTL", body: `{"ttl":"soon"}`, expectedStatus: http.StatusBadRequest, expectedError: invalidTTLProvided},
+		{name: "Negative TTL", body: `{"ttl":"-1h"}`, expectedStatus: http.StatusBadRequest, expectedError: invalidTTLProvided},
+		{name: "Invalid alias", body: `{"alias":"ab"}`, serviceErr: services.ErrInvalidAlias, expectedStatus: http.StatusBadRequest, expectedError: invalidAliasProvided},
+		{name: "Alias taken", body: `{"alias":"taken"}`, serviceErr: services.ErrAliasTaken, expectedStatus: http.StatusConflict, expectedError: aliasTaken},
+		{name: "Short URL Not Found", body: `{"ttl":"1h"}`, serviceErr: services.ErrShortURLNotFound, expectedStatus: http.StatusNotFound, expectedError: shortURLNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(mocks.MockURLService)
+			urlHandler.service = mockService
+			if tt.serviceErr != nil {
+				mockService.On("PatchURL", mock.Anything, "abc123", mock.Anything).Return(types.URLData{}, tt.serviceErr).Once()
+			}
+
+			rr := patch(tt.body)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.expectedError)
+			mockService.AssertExpectations(t)
 		})
 	}
 }
@@ -600,3 +1492,521 @@ func TestDeleteURL(t *testing.T) {
 		})
 	}
 }
+
+func TestRestoreURL(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	urlHandler := handler.(*URLHandler)
+	urlHandler.service = services.NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()), services.WithSoftDelete())
+
+	router := gin.New()
+	router.GET("/:short_url", handler.RedirectURL)
+	router.GET("/api/v1/short/:short_url", handler.GetURLData)
+	router.DELETE("/api/v1/short/:short_url", handler.DeleteURL)
+	router.POST("/api/v1/short/:short_url/restore", handler.RestoreURL)
+	send := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	created, err := urlHandler.service.CreateShortURL(context.Background(), "https://example.com/restore", services.CreateOptions{})
+	require.NoError(t, err)
+	shortURL := created.ShortURL
+
+	assert.Equal(t, http.StatusNotFound, send(http.MethodPost, "/api/v1/short/"+shortURL+"/restore").Code,
+		"A short URL that isn't deleted can't be restored")
+
+	require.Equal(t, http.StatusNoContent, send(http.MethodDelete, "/api/v1/short/"+shortURL).Code)
+	assert.Equal(t, http.StatusNotFound, send(http.MethodGet, "/api/v1/short/"+shortURL).Code)
+	assert.Equal(t, http.StatusNotFound, send(http.MethodGet, "/"+shortURL).Code)
+
+	w := send(http.MethodPost, "/api/v1/short/"+shortURL+"/restore")
+	require.Equal(t, http.StatusOK, w.Code)
+	var response types.URLResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, shortURL, response.ShortURL)
+	assert.Equal(t, "https://example.com/restore", response.OriginalURL)
+	assert.Nil(t, response.DeletedAt)
+
+	w = send(http.MethodGet, "/"+shortURL)
+	assert.Equal(t, http.StatusFound, w.Code, "The restored short URL should redirect again")
+	assert.Equal(t, "https://example.com/restore", w.Header().Get("Location"))
+
+	assert.Equal(t, http.StatusNotFound, send(http.MethodPost, "/api/v1/short/missing/restore").Code)
+}
+
+func TestCreateShortURLWithAlias(t *testing.T) {
+	tests := []struct {
+		name           string
+		serviceData    types.URLData
+		serviceErr     error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Alias is used as the short URL",
+			serviceData:    types.URLData{ShortURL: "docs", OriginalURL: "https://example.com"},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Alias taken",
+			serviceErr:     services.ErrAliasTaken,
+			expectedStatus: http.StatusConflict,
+			expectedBody:   `{"error":"Alias already taken"}`,
+		},
+		{
+			name:           "Invalid alias",
+			serviceErr:     services.ErrInvalidAlias,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"error":"Invalid alias provided"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, err := setupTestHandler()
+			require.NoError(t, err)
+
+			mockService := new(mocks.MockURLService)
+			mockService.On("CreateShortURL", mock.Anything, "https://example.com", services.CreateOptions{Alias: "docs"}).Return(tt.serviceData, tt.serviceErr)
+			handler.(*URLHandler).service = mockService
+
+			body, _ := json.Marshal(types.URLRequest{URL: "https://example.com", Alias: "docs"})
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short", bytes.NewBuffer(body))
+
+			handler.CreateShortURL(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			mockService.AssertExpectations(t)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, w.Body.String())
+				return
+			}
+			var response types.URLResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "docs", response.ShortURL)
+		})
+	}
+}
+
+func TestUnprocessableEntityStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		enabled        bool
+		body           string
+		serviceErr     error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "Invalid JSON when enabled", enabled: true, body: `{"url":`, expectedStatus: http.StatusBadRequest, expectedBody: `{"error":"Invalid request body"}`},
+		{name: "Malformed URL when enabled", enabled: true, body: `{"url":"not-a-url"}`, expectedStatus: http.StatusUnprocessableEntity, expectedBody: `{"error":"Invalid URL provided"}`},
+		{name: "Invalid TTL when enabled", enabled: true, body: `{"url":"https://example.com","ttl":"-1h"}`, expectedStatus: http.StatusUnprocessableEntity, expectedBody: `{"error":"Invalid TTL provided"}`},
+		{name: "Invalid alias when enabled", enabled: true, body: `{"url":"https://example.com","alias":"a!"}`, serviceErr: services.ErrInvalidAlias, expectedStatus: http.StatusUnprocessableEntity, expectedBody: `{"error":"Invalid alias provided"}`},
+		{name: "Malformed URL when disabled", body: `{"url":"not-a-url"}`, expectedStatus: http.StatusBadRequest, expectedBody: `{"error":"Invalid URL provided"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, err := setupTestHandler()
+			require.NoError(t, err)
+			handler.(*URLHandler).config.UnprocessableEntityStatus = tt.enabled
+
+			mockService := new(mocks.MockURLService)
+			mockService.On("CreateShortURL", mock.Anything, mock.Anything, mock.Anything).Return(types.URLData{}, tt.serviceErr)
+			handler.(*URLHandler).service = mockService
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short", strings.NewReader(tt.body))
+
+			handler.CreateShortURL(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+		})
+	}
+
+	t.Run("Update with a malformed URL when enabled", func(t *testing.T) {
+		handler, err := setupTestHandler()
+		require.NoError(t, err)
+		handler.(*URLHandler).config.UnprocessableEntityStatus = true
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "short_url", Value: "abc123"}}
+		c.Request, _ = http.NewRequest(http.MethodPut, "/api/v1/short/abc123", strings.NewReader(`{"url":"not-a-url"}`))
+
+		handler.UpdateURL(c)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+}
+
+func TestCreateShortURLAliasAPIKeys(t *testing.T) {
+	tests := []struct {
+		name           string
+		alias          string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{name: "Privileged key with an alias", alias: "docs", headers: map[string]string{"X-API-Key": "premium"}, expectedStatus: http.StatusCreated},
+		{name: "Privileged bearer token with an alias", alias: "docs", headers: map[string]string{"Authorization": "Bearer premium"}, expectedStatus: http.StatusCreated},
+		{name: "Non-privileged key with an alias", alias: "docs", headers: map[string]string{"X-API-Key": "basic"}, expectedStatus: http.StatusForbidden},
+		{name: "No key with an alias", alias: "docs", expectedStatus: http.StatusForbidden},
+		{name: "Non-privileged key without an alias", headers: map[string]string{"X-API-Key": "basic"}, expectedStatus: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, err := setupTestHandler()
+			require.NoError(t, err)
+			handler.(*URLHandler).config.AliasAPIKeys = []string{"premium", "enterprise"}
+
+			mockService := new(mocks.MockURLService)
+			mockService.On("CreateShortURL", mock.Anything, "https://example.com", services.CreateOptions{Alias: tt.alias}).
+				Return(types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}, nil)
+			handler.(*URLHandler).service = mockService
+
+			body, _ := json.Marshal(types.URLRequest{URL: "https://example.com", Alias: tt.alias})
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short", bytes.NewBuffer(body))
+			for key, value := range tt.headers {
+				c.Request.Header.Set(key, value)
+			}
+
+			handler.CreateShortURL(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusForbidden {
+				assert.JSONEq(t, `{"error":"API key is not allowed to use aliases"}`, w.Body.String())
+				mockService.AssertNotCalled(t, "CreateShortURL", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestCreateShortURLDistinctConflictStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		distinct       bool
+		serviceData    types.URLData
+		serviceErr     error
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name:           "Alias conflict",
+			distinct:       true,
+			serviceErr:     services.ErrAliasTaken,
+			expectedStatus: http.StatusConflict,
+			expectedCode:   codeAliasTaken,
+		},
+		{
+			name:           "Duplicate URL without alias",
+			distinct:       true,
+			serviceData:    types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"},
+			serviceErr:     services.ErrShortURLExists,
+			expectedStatus: http.StatusOK,
+			expectedCode:   codeAlreadyExists,
+		},
+		{
+			name:           "Duplicate URL with option disabled",
+			distinct:       false,
+			serviceData:    types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"},
+			serviceErr:     services.ErrShortURLExists,
+			expectedStatus: http.StatusOK,
+			expectedCode:   "",
+		},
+		{
+			name:           "Alias conflict with option disabled",
+			distinct:       false,
+			serviceErr:     services.ErrAliasTaken,
+			expectedStatus: http.StatusConflict,
+			expectedCode:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, err := setupTestHandler()
+			require.NoError(t, err)
+
+			mockService := new(mocks.MockURLService)
+			mockService.On("CreateShortURL", mock.Anything, "https://example.com", services.CreateOptions{}).Return(tt.serviceData, tt.serviceErr)
+
+			urlHandler := handler.(*URLHandler)
+			urlHandler.service = mockService
+			urlHandler.config.DistinctConflictStatus = tt.distinct
+
+			body, _ := json.Marshal(types.URLRequest{URL: "https://example.com"})
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short", bytes.NewBuffer(body))
+
+			handler.CreateShortURL(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			if tt.expectedCode == "" {
+				assert.NotContains(t, response, "code")
+			} else {
+				assert.Equal(t, tt.expectedCode, response["code"])
+			}
+		})
+	}
+}
+
+func TestCreateShortURLReportsCreated(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+
+	urlData := types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}
+	mockService := new(mocks.MockURLService)
+	mockService.On("CreateShortURL", mock.Anything, "https://example.com", services.CreateOptions{}).Return(urlData, nil).Once()
+	mockService.On("CreateShortURL", mock.Anything, "https://example.com", services.CreateOptions{}).Return(urlData, services.ErrShortURLExists).Once()
+	handler.(*URLHandler).service = mockService
+
+	post := func() (int, map[string]interface{}) {
+		body, _ := json.Marshal(types.URLRequest{URL: "https://example.com"})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short", bytes.NewBuffer(body))
+		handler.CreateShortURL(c)
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	status, response := post()
+	assert.Equal(t, http.StatusCreated, status, "A new URL is created")
+	assert.Equal(t, "abc123", response["short_url"])
+	assert.Equal(t, true, response["created"])
+
+	status, response = post()
+	assert.Equal(t, http.StatusOK, status, "An already shortened URL returns the existing record")
+	assert.Equal(t, "abc123", response["short_url"])
+	assert.Equal(t, false, response["created"])
+	mockService.AssertExpectations(t)
+}
+
+func TestCreateShortURLStorageUsage(t *testing.T) {
+	for _, exposed := range []bool{true, false} {
+		t.Run(fmt.Sprintf("ExposeStorageUsage=%v", exposed), func(t *testing.T) {
+			handler, err := setupTestHandler()
+			require.NoError(t, err)
+
+			mockService := new(mocks.MockURLService)
+			mockService.On("CreateShortURL", mock.Anything, "https://example.com", services.CreateOptions{}).
+				Return(types.URLData{}, &services.StorageFullError{Count: 5, Capacity: 5})
+
+			urlHandler := handler.(*URLHandler)
+			urlHandler.service = mockService
+			urlHandler.config.ExposeStorageUsage = exposed
+
+			body, _ := json.Marshal(types.URLRequest{URL: "https://example.com"})
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short", bytes.NewBuffer(body))
+
+			handler.CreateShortURL(c)
+
+			assert.Equal(t, http.StatusInsufficientStorage, w.Code)
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, storageCapacityFull, response["error"])
+			if exposed {
+				assert.Equal(t, float64(5), response["count"])
+				assert.Equal(t, float64(5), response["capacity"])
+			} else {
+				assert.NotContains(t, response, "count")
+				assert.NotContains(t, response, "capacity")
+			}
+		})
+	}
+}
+
+func TestCreateShortURLDebugTimings(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	urlHandler := handler.(*URLHandler)
+	urlHandler.service = services.NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()))
+	core, logs := observer.New(zapcore.DebugLevel)
+	urlHandler.logger = zap.New(core)
+
+	post := func(destination string) map[string]interface{} {
+		body, _ := json.Marshal(types.URLRequest{URL: destination})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short", bytes.NewBuffer(body))
+		handler.CreateShortURL(c)
+
+		require.Equal(t, http.StatusCreated, w.Code)
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	t.Run("Reported when enabled", func(t *testing.T) {
+		urlHandler.config.DebugTimings = true
+		defer func() { urlHandler.config.DebugTimings = false }()
+
+		response := post("https://example.com")
+
+		timings, ok := response["timings"].(map[string]interface{})
+		require.True(t, ok, "The response should carry a timings object")
+		for _, field := range []string{"generation_ms", "dedup_key_ms", "storage_write_ms"} {
+			assert.Positive(t, timings[field], field)
+		}
+		entries := logs.FilterMessage("Create timings").AllUntimed()
+		require.Len(t, entries, 1)
+		assert.Equal(t, zapcore.DebugLevel, entries[0].Level)
+		assert.Contains(t, entries[0].ContextMap(), "storage_write")
+	})
+
+	t.Run("Omitted unless enabled", func(t *testing.T) {
+		response := post("https://example.org")
+
+		assert.NotContains(t, response, "timings")
+		assert.Equal(t, 1, logs.FilterMessage("Create timings").Len())
+	})
+}
+
+func TestDefaultScheme(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	urlHandler := handler.(*URLHandler)
+	urlHandler.service = services.NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()))
+	urlHandler.config.DefaultScheme = "https"
+
+	send := func(method, path, destination string, params gin.Params) (int, types.URLResponse) {
+		body, _ := json.Marshal(types.URLRequest{URL: destination})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = params
+		c.Request, _ = http.NewRequest(method, path, bytes.NewBuffer(body))
+		if method == http.MethodPut {
+			handler.UpdateURL(c)
+		} else {
+			handler.CreateShortURL(c)
+		}
+
+		var response types.URLResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "Bare host", input: "example.com", expected: "https://example.com"},
+		{name: "Scheme-relative URL", input: "//example.org/path", expected: "https://example.org/path"},
+		{name: "HTTP URL", input: "http://example.net", expected: "http://example.net"},
+		{name: "HTTPS URL", input: "https://example.io/a", expected: "https://example.io/a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, created := send(http.MethodPost, "/api/v1/short", tt.input, nil)
+			require.Equal(t, http.StatusCreated, status)
+			assert.Equal(t, tt.expected, created.OriginalURL)
+
+			stored, err := urlHandler.service.GetURLData(context.Background(), created.ShortURL)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, stored.OriginalURL, "The normalized URL should be stored")
+		})
+	}
+
+	t.Run("Update", func(t *testing.T) {
+		_, created := send(http.MethodPost, "/api/v1/short", "example.edu", nil)
+
+		status, updated := send(http.MethodPut, "/api/v1/short/"+created.ShortURL, "example.edu/new",
+			gin.Params{{Key: "short_url", Value: created.ShortURL}})
+
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "https://example.edu/new", updated.OriginalURL)
+	})
+
+	t.Run("Rejected without a default scheme", func(t *testing.T) {
+		urlHandler.config.DefaultScheme = ""
+		defer func() { urlHandler.config.DefaultScheme = "https" }()
+
+		status, _ := send(http.MethodPost, "/api/v1/short", "example.com", nil)
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+}
+
+func TestExternalIDs(t *testing.T) {
+	handler, err := setupTestHandler()
+	require.NoError(t, err)
+	urlHandler := handler.(*URLHandler)
+	urlHandler.service = services.NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()))
+	urlHandler.config.EnableExternalIDs = true
+
+	create := func(input types.URLRequest) (int, []byte) {
+		body, _ := json.Marshal(input)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodPost, "/api/v1/short", bytes.NewBuffer(body))
+		handler.CreateShortURL(c)
+		return w.Code, w.Body.Bytes()
+	}
+	lookup := func(externalID string) (int, []byte) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "ext_id", Value: externalID}}
+		c.Request, _ = http.NewRequest(http.MethodGet, "/api/v1/by-external/"+externalID, nil)
+		handler.GetURLByExternalID(c)
+		return w.Code, w.Body.Bytes()
+	}
+
+	var created types.URLResponse
+	t.Run("Create with an external ID", func(t *testing.T) {
+		status, body := create(types.URLRequest{URL: "https://example.com", ExternalID: "order-1"})
+		require.Equal(t, http.StatusCreated, status)
+		require.NoError(t, json.Unmarshal(body, &created))
+		assert.Equal(t, "order-1", created.ExternalID)
+	})
+
+	t.Run("Lookup by external ID", func(t *testing.T) {
+		status, body := lookup("order-1")
+		require.Equal(t, http.StatusOK, status)
+		var found types.URLResponse
+		require.NoError(t, json.Unmarshal(body, &found))
+		assert.Equal(t, created.ShortURL, found.ShortURL)
+		assert.Equal(t, "https://example.com", found.OriginalURL)
+
+		status, body = lookup("missing")
+		assert.Equal(t, http.StatusNotFound, status)
+		assert.JSONEq(t, `{"error": "`+shortURLNotFound+`"}`, string(body))
+	})
+
+	t.Run("Duplicate external ID is rejected", func(t *testing.T) {
+		status, body := create(types.URLRequest{URL: "https://other.com", ExternalID: "order-1"})
+		assert.Equal(t, http.StatusConflict, status)
+		assert.JSONEq(t, `{"error": "`+externalIDTaken+`"}`, string(body))
+	})
+
+	t.Run("Overlong external ID is rejected", func(t *testing.T) {
+		status, body := create(types.URLRequest{URL: "https://example.com", ExternalID: strings.Repeat("x", 129)})
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.JSONEq(t, `{"error": "`+invalidExternalIDProvided+`"}`, string(body))
+	})
+
+	t.Run("Rejected unless enabled", func(t *testing.T) {
+		urlHandler.config.EnableExternalIDs = false
+		defer func() { urlHandler.config.EnableExternalIDs = true }()
+
+		status, body := create(types.URLRequest{URL: "https://example.com", ExternalID: "order-2"})
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.JSONEq(t, `{"error": "`+externalIDsNotEnabled+`"}`, string(body))
+	})
+}
@@ -4,34 +4,98 @@ package server
 import (
 	"context"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"go-url-shortening/config"
+	"go-url-shortening/destination"
+	"go-url-shortening/grpcserver"
 	"go-url-shortening/handlers"
 	"go-url-shortening/services"
 	"go-url-shortening/storage"
+	"go-url-shortening/urlgen"
+	"go-url-shortening/workerpool"
 	"go.uber.org/zap"
 )
 
 // Run initializes and starts the server, setting up all necessary components.
 // It returns an error if any part of the setup or running process fails.
 func Run(logger *zap.Logger, cfg *config.Config) error {
-	store := storage.NewInMemoryStorage(1000000, logger)
+	if err := cfg.Validate(); err != nil {
+		logger.Error("Invalid configuration", zap.Error(err))
+		return err
+	}
+
+	store, err := newStorage(cfg, logger)
+	if err != nil {
+		return err
+	}
+	if err := restoreSnapshot(cfg, store, logger); err != nil {
+		return err
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	urlHandler, err := setupURLHandler(ctx, cfg, store, logger)
+	shutdownTracing, err := setupTracing(ctx, cfg, logger)
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing()
+
+	// Background tasks share a bounded pool, stopped once the server has shut down
+	pool := workerpool.New(cfg.BackgroundWorkers, cfg.BackgroundQueueSize)
+	defer pool.Stop()
+
+	// Purge expired URLs in the background for backends that keep them in memory
+	if c, ok := store.(cleaner); ok {
+		c.StartCleanup(pool, cfg.CleanupInterval)
+	}
+	startReachabilityChecks(pool, cfg, store, logger)
+
+	var notifier services.EventNotifier
+	if cfg.WebhookURL != "" {
+		webhooks := services.NewWebhookNotifier(cfg.WebhookURL, logger)
+		defer webhooks.Close()
+		notifier = webhooks
+	}
+	urlService := newURLService(cfg, store, notifier, logger)
+	// Shared by both APIs, so that creates over either count against the same per-domain limit
+	policy := destination.NewPolicy(cfg, urlService)
+	handlerOpts := []handlers.HandlerOption{handlers.WithWorkerPool(pool), handlers.WithDestinationPolicy(policy)}
+	if cfg.RateLimitRedisAddr != "" {
+		client := redis.NewClient(&redis.Options{Addr: cfg.RateLimitRedisAddr})
+		defer client.Close()
+		limiter := handlers.NewRedisRateLimiter(client, cfg.RateLimit, cfg.RatePeriod, logger)
+		handlerOpts = append(handlerOpts, handlers.WithRateLimiter(limiter))
+	}
+	urlHandler, err := setupURLHandler(ctx, cfg, urlService, logger, handlerOpts...)
 	if err != nil {
 		return err
 	}
 
-	router := setupRouter(urlHandler, cfg)
+	var middleware []gin.HandlerFunc
+	if cfg.GateTrafficUntilReady {
+		var ready atomic.Bool
+		queued := pool.Go(func(ctx context.Context) {
+			awaitReadiness(ctx, store, &ready, readinessRetryInterval, logger)
+		})
+		if queued {
+			middleware = append(middleware, handlers.ReadinessGateMiddleware(ready.Load, readinessRetryInterval))
+		} else {
+			logger.Warn("Background queue full, serving traffic without waiting for the storage to be ready")
+		}
+	}
+
+	router := setupRouter(urlHandler, cfg, logger, middleware...)
 	server := setupServer(cfg, router)
 
 	var wg sync.WaitGroup
@@ -40,7 +104,7 @@ func Run(logger *zap.Logger, cfg *config.Config) error {
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		if err := startServer(ctx, server, logger); err != nil {
+		if err := startServer(ctx, server, cfg, logger); err != nil {
 			select {
 			case errChan <- err:
 			default:
@@ -48,7 +112,22 @@ func Run(logger *zap.Logger, cfg *config.Config) error {
 		}
 	}()
 
-	// Ensure the goroutine is cleaned up
+	if cfg.GRPCPort > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logger.Info("Serving gRPC", zap.Int("port", cfg.GRPCPort))
+			if err := grpcserver.Serve(ctx, cfg, urlService, policy); err != nil {
+				logger.Error("gRPC server error", zap.Error(err))
+				select {
+				case errChan <- err:
+				default:
+				}
+			}
+		}()
+	}
+
+	// Ensure the goroutines are cleaned up
 	defer func() {
 		cancel()
 		wg.Wait()
@@ -60,21 +139,174 @@ func Run(logger *zap.Logger, cfg *config.Config) error {
 		wg.Wait()
 		return err
 	case <-time.After(100 * time.Millisecond):
-		err := waitForShutdown(ctx, server, logger)
+		err := waitForShutdown(ctx, server, cfg.ShutdownTimeout, logger)
+		saveSnapshot(cfg, store, logger)
+		cancel()
 		wg.Wait()
 		return err
 	}
 }
 
+// newStorage returns the storage backend selected by the configuration,
+// falling back to in-memory storage when no external backend is configured.
+func newStorage(cfg *config.Config, logger *zap.Logger) (storage.Storage, error) {
+	switch {
+	case cfg.PostgresDSN != "":
+		logger.Info("Using PostgreSQL storage")
+		store, err := storage.NewPostgresStorage(cfg.PostgresDSN, logger)
+		if err != nil {
+			logger.Error("Failed to initialize PostgreSQL storage", zap.Error(err))
+			return nil, err
+		}
+		if len(cfg.PostgresReplicaDSNs) == 0 {
+			return store, nil
+		}
+		replicas := make([]storage.Storage, 0, len(cfg.PostgresReplicaDSNs))
+		for i, dsn := range cfg.PostgresReplicaDSNs {
+			replica, err := storage.NewPostgresReplicaStorage(dsn, logger)
+			if err != nil {
+				logger.Error("Failed to initialize PostgreSQL replica", zap.Int("replica", i), zap.Error(err))
+				store.Close()
+				return nil, err
+			}
+			replicas = append(replicas, replica)
+		}
+		logger.Info("Reading from PostgreSQL replicas", zap.Int("replicas", len(replicas)))
+		return storage.NewReplicatedStorage(store, replicas, logger), nil
+	case cfg.RedisAddr != "":
+		logger.Info("Using Redis storage", zap.String("address", cfg.RedisAddr))
+		return storage.NewRedisStorage(cfg.RedisAddr, cfg.StorageCapacity, logger), nil
+	default:
+		policy, err := storage.ParseEvictionPolicy(cfg.EvictionPolicy)
+		if err != nil {
+			logger.Error("Invalid eviction policy", zap.String("evictionPolicy", cfg.EvictionPolicy), zap.Error(err))
+			return nil, err
+		}
+		return storage.NewInMemoryStorage(cfg.StorageCapacity, logger,
+			storage.WithEvictionPolicy(policy),
+			storage.WithSnapshotCompression(cfg.CompressSnapshot),
+			storage.WithSoftDeleteRetention(cfg.SoftDeleteRetention),
+		), nil
+	}
+}
+
+// readinessRetryInterval is how often the storage backend is pinged during warm-up,
+// and how long clients are asked to wait before retrying.
+const readinessRetryInterval = time.Second
+
+// awaitReadiness pings the store until it responds, then marks the server as ready.
+// Backends without an external dependency are ready immediately.
+func awaitReadiness(ctx context.Context, store storage.Storage, ready *atomic.Bool, interval time.Duration, logger *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := store.Ping(ctx)
+		if err == nil {
+			logger.Info("Storage is reachable, accepting traffic")
+			ready.Store(true)
+			return
+		}
+		logger.Warn("Storage not ready yet", zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cleaner is implemented by storage backends that need to purge expired URLs themselves.
+type cleaner interface {
+	StartCleanup(pool *workerpool.Pool, interval time.Duration)
+}
+
+// startReachabilityChecks starts the background destination checker when enabled by the configuration.
+func startReachabilityChecks(pool *workerpool.Pool, cfg *config.Config, store storage.Storage, logger *zap.Logger) {
+	if cfg.ReachabilityCheckInterval <= 0 {
+		return
+	}
+	checker, err := services.NewReachabilityChecker(store, cfg.ReachabilityChecksPerSecond, logger)
+	if err != nil {
+		logger.Warn("Storage backend does not support reachability checks, ignoring ReachabilityCheckInterval")
+		return
+	}
+	logger.Info("Checking destination reachability",
+		zap.Duration("interval", cfg.ReachabilityCheckInterval),
+		zap.Float64("checksPerSecond", cfg.ReachabilityChecksPerSecond))
+	checker.Start(pool, cfg.ReachabilityCheckInterval)
+}
+
+// snapshotter is implemented by storage backends that can persist their dataset to a file.
+type snapshotter interface {
+	SaveToFile(path string) error
+	LoadFromFile(path string) error
+}
+
+// restoreSnapshot loads the configured snapshot into the store before serving.
+// It is a no-op when no snapshot path is configured or the backend doesn't support snapshots.
+func restoreSnapshot(cfg *config.Config, store storage.Storage, logger *zap.Logger) error {
+	if cfg.SnapshotPath == "" {
+		return nil
+	}
+	s, ok := store.(snapshotter)
+	if !ok {
+		logger.Warn("Storage backend does not support snapshots, ignoring SnapshotPath")
+		return nil
+	}
+	if err := s.LoadFromFile(cfg.SnapshotPath); err != nil {
+		logger.Error("Failed to restore snapshot", zap.String("path", cfg.SnapshotPath), zap.Error(err))
+		return err
+	}
+	logger.Info("Snapshot restored", zap.String("path", cfg.SnapshotPath))
+	return nil
+}
+
+// saveSnapshot persists the store to the configured snapshot path during shutdown.
+// Failures are logged rather than returned so they don't mask the shutdown result.
+func saveSnapshot(cfg *config.Config, store storage.Storage, logger *zap.Logger) {
+	if cfg.SnapshotPath == "" {
+		return
+	}
+	s, ok := store.(snapshotter)
+	if !ok {
+		return
+	}
+	if err := s.SaveToFile(cfg.SnapshotPath); err != nil {
+		logger.Error("Failed to save snapshot", zap.String("path", cfg.SnapshotPath), zap.Error(err))
+		return
+	}
+	logger.Info("Snapshot saved", zap.String("path", cfg.SnapshotPath))
+}
+
+// newURLService creates the URL service shared by the REST and gRPC APIs on top of store, telling
+// notifier, if not nil, about every change.
+func newURLService(cfg *config.Config, store storage.Storage, notifier services.EventNotifier, logger *zap.Logger) services.URLService {
+	opts := serviceOptions(cfg, logger)
+	if notifier != nil {
+		opts = append(opts, services.WithEventNotifier(notifier))
+	}
+	if cfg.SoftDelete {
+		if _, ok := store.(storage.SoftDeleter); ok {
+			opts = append(opts, services.WithSoftDelete())
+		} else {
+			logger.Warn("Storage backend does not support soft deletes, ignoring SoftDelete")
+		}
+	}
+	if cfg.OTLPEndpoint != "" {
+		// Record child spans for service and storage calls under each request span
+		return services.NewTracedURLService(services.NewURLService(storage.NewTracedStorage(store), opts...))
+	}
+	return services.NewURLService(store, opts...)
+}
+
 // setupURLHandler creates and configures the URL handler with necessary dependencies.
 // It returns the configured handler or an error if setup fails.
-func setupURLHandler(ctx context.Context, cfg *config.Config, store storage.Storage, logger *zap.Logger) (handlers.URLHandlerInterface, error) {
+func setupURLHandler(ctx context.Context, cfg *config.Config, urlService services.URLService, logger *zap.Logger, opts ...handlers.HandlerOption) (handlers.URLHandlerInterface, error) {
 	handlerCtx, cancel := context.WithTimeout(ctx, cfg.RequestTimeout)
 	defer cancel()
 
-	urlService := services.NewURLService(store)
-
-	handler, err := handlers.NewURLHandler(handlerCtx, urlService, cfg, logger)
+	handler, err := handlers.NewURLHandler(handlerCtx, urlService, cfg, logger, opts...)
 	if err != nil {
 		logger.Error("Failed to create URL handler", zap.Error(err))
 		return nil, err
@@ -84,29 +316,126 @@ func setupURLHandler(ctx context.Context, cfg *config.Config, store storage.Stor
 	return handler, nil
 }
 
+// serviceOptions translates the configuration into URL service options.
+func serviceOptions(cfg *config.Config, logger *zap.Logger) []services.Option {
+	charset := cfg.ShortURLCharset
+	if charset == "" {
+		charset = urlgen.DefaultCharset
+	}
+	length := urlgen.DefaultLength
+	if cfg.ShortURLLength > 0 {
+		length = cfg.ShortURLLength
+	} else if cfg.ExpectedURLCount > 0 {
+		if recommended := urlgen.RecommendLength(cfg.ExpectedURLCount, cfg.CollisionProbability, len(charset)); recommended > 0 {
+			length = recommended
+			logger.Info("Using recommended short URL length",
+				zap.Int("length", length),
+				zap.Int("expectedURLCount", cfg.ExpectedURLCount),
+				zap.Float64("collisionProbability", cfg.CollisionProbability))
+		}
+	}
+	opts := []services.Option{
+		services.WithShortURLFormat(length, charset),
+		services.WithGenerationAttempts(cfg.MaxGenerationAttempts),
+		services.WithReservedWords(cfg.ReservedWords),
+	}
+	if cfg.CanonicalDedup {
+		opts = append(opts, services.WithCanonicalDedup())
+	}
+	if cfg.LogGenerationAttempts {
+		opts = append(opts, services.WithAttemptLogging(logger))
+	}
+	return opts
+}
+
 // setupRouter creates a new Gin router and registers the application routes.
-func setupRouter(urlHandler handlers.URLHandlerInterface, cfg *config.Config) *gin.Engine {
-	router := gin.Default()
-	handlers.RegisterRoutes(router, urlHandler, cfg)
+// The given middleware runs before every route, ahead of the application's own middleware, and
+// after the tracing middleware when cfg.OTLPEndpoint is set, so that every request gets a span.
+// Requests and recovered panics are logged through logger rather than by Gin's own middleware.
+// Only cfg.TrustedProxies may report the client IP through forwarding headers.
+func setupRouter(urlHandler handlers.URLHandlerInterface, cfg *config.Config, logger *zap.Logger, middleware ...gin.HandlerFunc) *gin.Engine {
+	router := gin.New()
+	// Config.Validate rejects malformed entries; were one to get through, Gin would trust no proxy
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		logger.Error("Invalid trusted proxies, trusting none", zap.Error(err))
+	}
+	if cfg.OTLPEndpoint != "" {
+		router.Use(handlers.TracingMiddleware())
+	}
+	router.Use(middleware...)
+	handlers.RegisterRoutes(router, urlHandler, cfg, logger)
+	if cfg.EnableProfiling {
+		registerProfiling(router, cfg.WriteTimeout)
+	}
 	return router
 }
 
+// registerProfiling mounts the net/http/pprof handlers under /debug/pprof, where the standard library
+// would register them on http.DefaultServeMux. The CPU profile and the trace sample for as long as
+// asked, 30s and 1s by default, so their write deadline is pushed back past writeTimeout.
+func registerProfiling(router *gin.Engine, writeTimeout time.Duration) {
+	profiles := router.Group("/debug/pprof")
+	profiles.GET("/", gin.WrapF(pprof.Index))
+	profiles.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	profiles.GET("/profile", extendWriteDeadline(writeTimeout, 30, pprof.Profile))
+	profiles.GET("/symbol", gin.WrapF(pprof.Symbol))
+	profiles.POST("/symbol", gin.WrapF(pprof.Symbol))
+	profiles.GET("/trace", extendWriteDeadline(writeTimeout, 1, pprof.Trace))
+	// Index serves the named runtime profiles, such as heap and goroutine, from the end of the path
+	profiles.GET("/:profile", gin.WrapF(pprof.Index))
+}
+
+// extendWriteDeadline wraps a profile handler sampling for the seconds of its seconds query
+// parameter, or defaultSeconds, so that the response may be written for writeTimeout past the
+// sampling. Zero writeTimeout leaves writes without deadline, so there is nothing to extend.
+func extendWriteDeadline(writeTimeout time.Duration, defaultSeconds float64, handler http.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if writeTimeout > 0 {
+			seconds, err := strconv.ParseFloat(c.Query("seconds"), 64)
+			if err != nil || seconds <= 0 {
+				seconds = defaultSeconds
+			}
+			deadline := time.Now().Add(writeTimeout + time.Duration(seconds*float64(time.Second)))
+			// Recorders in tests can't set deadlines, and a real connection always can
+			_ = http.NewResponseController(c.Writer).SetWriteDeadline(deadline)
+			// Older net/http/pprof refuses to sample for longer than the WriteTimeout of the server
+			// in the request context, so the server is hidden from it now that the deadline is extended
+			c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), http.ServerContextKey, nil))
+		}
+		handler(c.Writer, c.Request)
+	}
+}
+
 // setupServer creates and returns a new HTTP server with the given configuration and router.
+// Connections are closed once reading a request takes longer than cfg.ReadTimeout (default 10s),
+// writing its response longer than cfg.WriteTimeout (default 30s), or once they idle between requests
+// longer than cfg.IdleTimeout (default 2m), so slow clients can't exhaust the server's connections.
 func setupServer(cfg *config.Config, router *gin.Engine) *http.Server {
 	return &http.Server{
-		Addr:    ":" + strconv.Itoa(cfg.ServerPort),
-		Handler: router,
+		Addr:         ":" + strconv.Itoa(cfg.ServerPort),
+		Handler:      router,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
 	}
 }
 
-// startServer begins listening and serving HTTP requests.
+// startServer begins listening and serving HTTP requests, over TLS when cfg.TLSCertFile and
+// cfg.TLSKeyFile are set.
 // It logs any errors that occur during server operation.
-func startServer(ctx context.Context, srv *http.Server, logger *zap.Logger) error {
-	logger.Debug("Starting server", zap.String("address", srv.Addr))
+func startServer(ctx context.Context, srv *http.Server, cfg *config.Config, logger *zap.Logger) error {
+	useTLS := cfg.TLSCertFile != "" && cfg.TLSKeyFile != ""
+	logger.Debug("Starting server", zap.String("address", srv.Addr), zap.Bool("tls", useTLS))
 
 	errChan := make(chan error, 1)
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if useTLS {
+			err = srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			errChan <- err
 		}
 	}()
@@ -124,19 +453,28 @@ func startServer(ctx context.Context, srv *http.Server, logger *zap.Logger) erro
 	}
 }
 
-// waitForShutdown blocks until the server receives an interrupt signal, then initiates a graceful shutdown.
+// waitForShutdown blocks until the server receives an interrupt or termination signal, then initiates a
+// graceful shutdown lasting at most timeout.
 // It returns an error if the shutdown process fails.
-func waitForShutdown(ctx context.Context, srv *http.Server, logger *zap.Logger) error {
+func waitForShutdown(ctx context.Context, srv *http.Server, timeout time.Duration, logger *zap.Logger) error {
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
-	logger.Info("Received interrupt signal. Initiating server shutdown...")
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(quit)
+	sig := <-quit
+	logger.Info("Received shutdown signal. Initiating server shutdown...", zap.String("signal", sig.String()))
+
+	return shutdownServer(ctx, srv, timeout, logger)
+}
 
-	shutdownCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+// shutdownServer stops the server accepting connections and waits up to timeout for in-flight requests
+// to complete, then closes the connections of those still running.
+func shutdownServer(ctx context.Context, srv *http.Server, timeout time.Duration, logger *zap.Logger) error {
+	shutdownCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		logger.Error("Server forced to shutdown", zap.Error(err))
+		srv.Close()
 		return err
 	}
 
@@ -2,24 +2,44 @@ package server
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"github.com/stretchr/testify/mock"
 	"go-url-shortening/handlers"
+	"io"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go-url-shortening/config"
 	"go-url-shortening/handlers/mocks"
+	"go-url-shortening/services"
 	"go-url-shortening/storage"
+	"go-url-shortening/types"
+	"go-url-shortening/urlgen"
 	"go.uber.org/zap"
 )
 
-var setupURLHandlerFunc func(ctx context.Context, cfg *config.Config, store storage.Storage, logger *zap.Logger) (handlers.URLHandlerInterface, error)
+var setupURLHandlerFunc func(ctx context.Context, cfg *config.Config, urlService services.URLService, logger *zap.Logger, opts ...handlers.HandlerOption) (handlers.URLHandlerInterface, error)
 
 func init() {
 	setupURLHandlerFunc = setupURLHandler
@@ -41,7 +61,7 @@ func TestRun(t *testing.T) {
 
 	// Replace setupURLHandlerFunc with a test function
 	originalSetupURLHandlerFunc := setupURLHandlerFunc
-	setupURLHandlerFunc = func(ctx context.Context, cfg *config.Config, store storage.Storage, logger *zap.Logger) (handlers.URLHandlerInterface, error) {
+	setupURLHandlerFunc = func(ctx context.Context, cfg *config.Config, urlService services.URLService, logger *zap.Logger, opts ...handlers.HandlerOption) (handlers.URLHandlerInterface, error) {
 		return mockHandler, nil
 	}
 	defer func() { setupURLHandlerFunc = originalSetupURLHandlerFunc }()
@@ -56,11 +76,15 @@ func TestRun(t *testing.T) {
 		assert.NoError(t, err)
 	}()
 
-	// Give the server a moment to start
-	time.Sleep(100 * time.Millisecond)
-
-	// Make a request to the health check endpoint
-	resp, err := http.Get("http://localhost:" + strconv.Itoa(cfg.ServerPort) + "/health")
+	// Make a request to the health check endpoint, retrying while the server starts
+	var resp *http.Response
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		resp, err = http.Get("http://localhost:" + strconv.Itoa(cfg.ServerPort) + "/health")
+		if err == nil {
+			break
+		}
+	}
 	if err != nil {
 		t.Fatalf("Failed to make request: %v", err)
 	}
@@ -77,7 +101,7 @@ func TestRun(t *testing.T) {
 func TestRunServerStartupFailure(t *testing.T) {
 	logger, _ := zap.NewDevelopment()
 	cfg := config.DefaultConfig()
-	cfg.ServerPort = -1 // Invalid port to force startup failure
+	cfg.ServerPort = -1 // Invalid port, rejected before anything is set up
 
 	// Create a context with a timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -93,19 +117,314 @@ func TestRunServerStartupFailure(t *testing.T) {
 	select {
 	case err := <-errChan:
 		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "listen tcp: address -1: invalid port")
+		assert.Contains(t, err.Error(), "ServerPort must be between 1 and 65535, got -1")
 	case <-ctx.Done():
 		t.Fatal("Test timed out")
 	}
 }
 
+func TestRunConflictingConfig(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.RedisAddr = "localhost:6379"
+	cfg.SnapshotPath = filepath.Join(t.TempDir(), "snapshot.json")
+
+	err := Run(zap.NewNop(), cfg)
+	assert.ErrorContains(t, err, "SnapshotPath only applies to the in-memory storage")
+}
+
+func TestNewStorage(t *testing.T) {
+	logger := zap.NewNop()
+
+	cfg := config.DefaultConfig()
+	store, err := newStorage(cfg, logger)
+	assert.NoError(t, err)
+	assert.IsType(t, &storage.InMemoryStorage{}, store)
+
+	cfg.EvictionPolicy = "lru"
+	store, err = newStorage(cfg, logger)
+	assert.NoError(t, err)
+	assert.IsType(t, &storage.InMemoryStorage{}, store)
+
+	cfg.EvictionPolicy = "random"
+	_, err = newStorage(cfg, logger)
+	assert.EqualError(t, err, `unknown eviction policy "random"`)
+	cfg.EvictionPolicy = ""
+
+	cfg.RedisAddr = "localhost:6379"
+	store, err = newStorage(cfg, logger)
+	assert.NoError(t, err)
+	assert.IsType(t, &storage.RedisStorage{}, store)
+	store.(*storage.RedisStorage).Close()
+
+	cfg.PostgresDSN = "postgres://invalid host/db"
+	_, err = newStorage(cfg, logger)
+	assert.Error(t, err, "An unreachable PostgreSQL DSN should fail storage setup")
+}
+
+func TestStorageCapacity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+	cfg := config.DefaultConfig()
+	cfg.DisableRateLimit = true
+	cfg.StorageCapacity = 5
+
+	store, err := newStorage(cfg, logger)
+	require.NoError(t, err)
+	urlHandler, err := setupURLHandler(context.Background(), cfg, newURLService(cfg, store, nil, logger), logger)
+	require.NoError(t, err)
+	router := setupRouter(urlHandler, cfg, logger)
+
+	create := func(i int) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		body := `{"url":"https://example.com/` + strconv.Itoa(i) + `"}`
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/short", strings.NewReader(body)))
+		return w
+	}
+
+	for i := 0; i < cfg.StorageCapacity; i++ {
+		assert.Equal(t, http.StatusCreated, create(i).Code)
+	}
+	w := create(cfg.StorageCapacity)
+	assert.Equal(t, http.StatusInsufficientStorage, w.Code)
+	assert.JSONEq(t, `{"error":"Storage capacity reached"}`, w.Body.String())
+}
+
+func TestWebhook(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	events := make(chan services.Event, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event services.Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		events <- event
+	}))
+	defer webhook.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.DisableRateLimit = true
+	notifier := services.NewWebhookNotifier(webhook.URL, logger)
+	defer notifier.Close()
+	urlHandler, err := setupURLHandler(context.Background(), cfg, newURLService(cfg, storage.NewInMemoryStorage(10, logger), notifier, logger), logger)
+	require.NoError(t, err)
+	router := setupRouter(urlHandler, cfg, logger)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/short", strings.NewReader(`{"url":"https://example.com"}`)))
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	select {
+	case event := <-events:
+		assert.Equal(t, services.EventCreated, event.Event)
+		assert.Equal(t, "https://example.com", event.OriginalURL)
+	case <-time.After(5 * time.Second):
+		t.Fatal("No webhook event received")
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	// request reports whether a request from proxyIP claiming to come from clientIP was allowed
+	request := func(router *gin.Engine, proxyIP, clientIP string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.RemoteAddr = proxyIP + ":12345"
+		req.Header.Set("X-Forwarded-For", clientIP)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	newRouter := func(trustedProxies ...string) *gin.Engine {
+		cfg := config.DefaultConfig()
+		cfg.RateLimit = 1
+		cfg.RatePeriod = time.Minute
+		cfg.TrustedProxies = trustedProxies
+		urlHandler, err := setupURLHandler(context.Background(), cfg, newURLService(cfg, storage.NewInMemoryStorage(10, logger), nil, logger), logger)
+		require.NoError(t, err)
+		return setupRouter(urlHandler, cfg, logger)
+	}
+
+	t.Run("Spoofed X-Forwarded-For is ignored by default", func(t *testing.T) {
+		router := newRouter()
+		assert.Equal(t, http.StatusOK, request(router, "192.0.2.1", "198.51.100.1"))
+		assert.Equal(t, http.StatusTooManyRequests, request(router, "192.0.2.1", "198.51.100.2"),
+			"A client should not escape its limit by claiming another IP")
+	})
+
+	t.Run("Trusted proxies report the client IP", func(t *testing.T) {
+		router := newRouter("192.0.2.0/24")
+		assert.Equal(t, http.StatusOK, request(router, "192.0.2.1", "198.51.100.1"))
+		assert.Equal(t, http.StatusOK, request(router, "192.0.2.1", "198.51.100.2"))
+		assert.Equal(t, http.StatusTooManyRequests, request(router, "192.0.2.2", "198.51.100.1"))
+		assert.Equal(t, http.StatusOK, request(router, "203.0.113.1", "198.51.100.1"),
+			"Untrusted peers are limited by their own IP")
+	})
+}
+
+func TestProfiling(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	newRouter := func(enableProfiling bool) *gin.Engine {
+		cfg := config.DefaultConfig()
+		cfg.DisableRateLimit = true
+		cfg.EnableProfiling = enableProfiling
+		urlHandler, err := setupURLHandler(context.Background(), cfg, newURLService(cfg, storage.NewInMemoryStorage(10, logger), nil, logger), logger)
+		require.NoError(t, err)
+		return setupRouter(urlHandler, cfg, logger)
+	}
+	request := func(router *gin.Engine, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+	paths := []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/heap", "/debug/pprof/goroutine"}
+
+	t.Run("Not reachable by default", func(t *testing.T) {
+		router := newRouter(false)
+		for _, path := range paths {
+			assert.Equal(t, http.StatusNotFound, request(router, path).Code, path)
+		}
+	})
+
+	t.Run("Served when enabled", func(t *testing.T) {
+		router := newRouter(true)
+		for _, path := range paths {
+			assert.Equal(t, http.StatusOK, request(router, path).Code, path)
+		}
+		assert.Contains(t, request(router, "/debug/pprof/").Body.String(), "goroutine")
+		assert.Equal(t, http.StatusNotFound, request(router, "/debug/pprof/unknown").Code)
+	})
+
+	t.Run("CPU profiles outlast the write timeout", func(t *testing.T) {
+		srv := httptest.NewUnstartedServer(newRouter(true))
+		srv.Config.WriteTimeout = 500 * time.Millisecond
+		srv.Start()
+		defer srv.Close()
+
+		resp, err := srv.Client().Get(srv.URL + "/debug/pprof/profile?seconds=1")
+		require.NoError(t, err, "The connection should not be closed at the write timeout")
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+		assert.NotEmpty(t, body)
+	})
+}
+
+func TestServiceOptions(t *testing.T) {
+	logger := zap.NewNop()
+	cfg := config.DefaultConfig()
+	cfg.ShortURLCharset = "0123456789"
+	cfg.ExpectedURLCount = 1000000
+
+	service := services.NewURLService(storage.NewInMemoryStorage(10, logger), serviceOptions(cfg, logger)...)
+	urlData, err := service.CreateShortURL(context.Background(), "https://example.com", services.CreateOptions{})
+	assert.NoError(t, err)
+
+	assert.Len(t, urlData.ShortURL, urlgen.RecommendLength(cfg.ExpectedURLCount, cfg.CollisionProbability, len(cfg.ShortURLCharset)))
+	for _, char := range urlData.ShortURL {
+		assert.Contains(t, cfg.ShortURLCharset, string(char))
+	}
+
+	cfg.ShortURLLength = 5
+	service = services.NewURLService(storage.NewInMemoryStorage(10, logger), serviceOptions(cfg, logger)...)
+	urlData, err = service.CreateShortURL(context.Background(), "https://example.com", services.CreateOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, urlData.ShortURL, 5, "An explicit length takes precedence over the recommended one")
+}
+
+// slowStorage is an in-memory store whose backend only becomes reachable once ready is closed.
+type slowStorage struct {
+	*storage.InMemoryStorage
+	ready chan struct{}
+}
+
+func (s *slowStorage) Ping(ctx context.Context) error {
+	select {
+	case <-s.ready:
+		return nil
+	default:
+		return errors.New("connection refused")
+	}
+}
+
+func TestGateTrafficUntilReady(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := config.DefaultConfig()
+	cfg.DisableRateLimit = true
+	cfg.GateTrafficUntilReady = true
+	store := &slowStorage{InMemoryStorage: storage.NewInMemoryStorage(10, logger), ready: make(chan struct{})}
+
+	urlHandler, err := setupURLHandler(ctx, cfg, newURLService(cfg, store, nil, logger), logger)
+	require.NoError(t, err)
+	var ready atomic.Bool
+	go awaitReadiness(ctx, store, &ready, 10*time.Millisecond, logger)
+	router := setupRouter(urlHandler, cfg, logger, handlers.ReadinessGateMiddleware(ready.Load, time.Second))
+
+	request := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+		return w
+	}
+
+	// Requests arriving before the storage responds are turned away with a retry hint
+	w := request()
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"error":"Service is starting up"}`, w.Body.String())
+
+	liveness := httptest.NewRecorder()
+	router.ServeHTTP(liveness, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	assert.Equal(t, http.StatusOK, liveness.Code, "The liveness probe should pass while warming up")
+
+	close(store.ready)
+	assert.Eventually(t, func() bool {
+		return request().Code == http.StatusOK
+	}, time.Second, 10*time.Millisecond, "Requests should succeed once the storage is ready")
+}
+
+func TestAwaitReadinessInMemory(t *testing.T) {
+	var ready atomic.Bool
+	awaitReadiness(context.Background(), storage.NewInMemoryStorage(10, zap.NewNop()), &ready, time.Second, zap.NewNop())
+	assert.True(t, ready.Load(), "In-memory storage should be ready immediately")
+}
+
+func TestSnapshotPersistence(t *testing.T) {
+	logger := zap.NewNop()
+	ctx := context.Background()
+	cfg := config.DefaultConfig()
+	cfg.SnapshotPath = filepath.Join(t.TempDir(), "snapshot.json")
+
+	// The first start finds no snapshot and begins empty
+	store := storage.NewInMemoryStorage(10, logger)
+	assert.NoError(t, restoreSnapshot(cfg, store, logger))
+	assert.NoError(t, store.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}))
+	saveSnapshot(cfg, store, logger)
+
+	restored := storage.NewInMemoryStorage(10, logger)
+	assert.NoError(t, restoreSnapshot(cfg, restored, logger))
+	urlData, err := restored.GetURLData(ctx, "abc123")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com", urlData.OriginalURL)
+
+	// A corrupt snapshot must stop startup instead of silently serving an empty store
+	assert.NoError(t, os.WriteFile(cfg.SnapshotPath, []byte("corrupt"), 0o600))
+	assert.Error(t, restoreSnapshot(cfg, storage.NewInMemoryStorage(10, logger), logger))
+}
+
 func TestSetupURLHandler(t *testing.T) {
 	cfg := config.DefaultConfig()
 	logger := zap.NewNop()
 	store := storage.NewInMemoryStorage(1000000, logger)
 
 	ctx := context.Background()
-	handler, err := setupURLHandler(ctx, cfg, store, logger)
+	handler, err := setupURLHandler(ctx, cfg, newURLService(cfg, store, nil, logger), logger)
 
 	assert.NoError(t, err)
 	assert.NotNil(t, handler)
@@ -117,13 +436,13 @@ func TestSetupRouter(t *testing.T) {
 	store := storage.NewInMemoryStorage(1000000, logger)
 
 	ctx := context.Background()
-	handler, err := setupURLHandler(ctx, cfg, store, logger)
+	handler, err := setupURLHandler(ctx, cfg, newURLService(cfg, store, nil, logger), logger)
 	assert.NoError(t, err)
 
 	w := httptest.NewRecorder()
 	_, router := gin.CreateTestContext(w)
 
-	router = setupRouter(handler, cfg)
+	router = setupRouter(handler, cfg, logger)
 
 	assert.NotNil(t, router)
 
@@ -171,7 +490,7 @@ func TestStartServer(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 
 	// Start the server in a goroutine
-	go startServer(ctx, server, logger)
+	go startServer(ctx, server, cfg, logger)
 
 	// Give the server a moment to start
 	time.Sleep(100 * time.Millisecond)
@@ -187,45 +506,199 @@ func TestStartServer(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-func TestWaitForShutdown(t *testing.T) {
-	cfg := config.DefaultConfig()
-	ctx := context.Background()
+func TestStartServerTLS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
 	logger := zap.NewNop()
+	certPEM, keyPEM := selfSignedCertificate(t)
+	dir := t.TempDir()
+
+	cfg := config.DefaultConfig()
+	cfg.ServerPort = 3004 // Use a different port to avoid conflicts
+	cfg.TLSCertFile = filepath.Join(dir, "cert.pem")
+	cfg.TLSKeyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(cfg.TLSCertFile, certPEM, 0o600))
+	require.NoError(t, os.WriteFile(cfg.TLSKeyFile, keyPEM, 0o600))
+
 	mockHandler := &mocks.MockURLHandler{}
 	mockHandler.On("HealthCheck", mock.Anything).Run(func(args mock.Arguments) {
 		c := args.Get(0).(*gin.Context)
-		c.JSON(http.StatusOK, gin.H{})
-	}).Return()
-
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
 	mockHandler.On("RateLimitMiddleware").Return(gin.HandlerFunc(func(c *gin.Context) {}))
+	server := setupServer(cfg, setupRouter(mockHandler, cfg, logger))
 
-	router := setupRouter(mockHandler, cfg)
-	server := setupServer(cfg, router)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go startServer(ctx, server, cfg, logger)
+
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(certPEM))
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	// Retry while the server starts
+	var resp *http.Response
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		resp, err = client.Get("https://localhost:" + strconv.Itoa(cfg.ServerPort) + "/health")
+		if err == nil {
+			break
+		}
+	}
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotNil(t, resp.TLS, "The health check should be served over TLS")
+}
 
-	// Start the server in a goroutine
-	go startServer(ctx, server, logger)
+// selfSignedCertificate returns the PEM encoded certificate and private key of a self-signed
+// certificate for localhost.
+func selfSignedCertificate(t *testing.T) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
 
-	// Simulate SIGINT
-	go func() {
-		time.Sleep(100 * time.Millisecond)
-		p, _ := os.FindProcess(os.Getpid())
-		err := p.Signal(os.Interrupt)
-		if err != nil {
-			return
-		}
-	}()
+func TestSetupServerTimeouts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.DefaultConfig()
+	cfg.WriteTimeout = 100 * time.Millisecond
 
-	// Run waitForShutdown in a goroutine
-	done := make(chan error)
-	go func() {
-		done <- waitForShutdown(ctx, server, logger)
-	}()
+	router := gin.New()
+	router.GET("/slow", func(c *gin.Context) {
+		time.Sleep(300 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	})
+	router.GET("/fast", func(c *gin.Context) {
+		c.String(http.StatusOK, "done")
+	})
+	srv := setupServer(cfg, router)
+	assert.Equal(t, cfg.ReadTimeout, srv.ReadTimeout)
+	assert.Equal(t, cfg.IdleTimeout, srv.IdleTimeout)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.Serve(listener)
+	defer srv.Close()
+	url := "http://" + listener.Addr().String()
+
+	resp, err := http.Get(url + "/fast")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
 
-	// Wait for waitForShutdown to finish or timeout
-	select {
-	case err := <-done:
-		assert.NoError(t, err)
-	case <-time.After(5 * time.Second):
-		t.Fatal("waitForShutdown did not finish within the expected time")
+	_, err = http.Get(url + "/slow")
+	assert.Error(t, err, "A response exceeding WriteTimeout should be cut off")
+}
+
+func TestWaitForShutdown(t *testing.T) {
+	for _, sig := range []os.Signal{os.Interrupt, syscall.SIGTERM} {
+		t.Run(sig.String(), func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			ctx := context.Background()
+			logger := zap.NewNop()
+			mockHandler := &mocks.MockURLHandler{}
+			mockHandler.On("HealthCheck", mock.Anything).Run(func(args mock.Arguments) {
+				c := args.Get(0).(*gin.Context)
+				c.JSON(http.StatusOK, gin.H{})
+			}).Return()
+
+			mockHandler.On("RateLimitMiddleware").Return(gin.HandlerFunc(func(c *gin.Context) {}))
+
+			router := setupRouter(mockHandler, cfg, logger)
+			server := setupServer(cfg, router)
+
+			// Start the server in a goroutine
+			go startServer(ctx, server, cfg, logger)
+
+			// Simulate the signal
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				p, _ := os.FindProcess(os.Getpid())
+				err := p.Signal(sig)
+				if err != nil {
+					return
+				}
+			}()
+
+			// Run waitForShutdown in a goroutine
+			done := make(chan error)
+			go func() {
+				done <- waitForShutdown(ctx, server, cfg.ShutdownTimeout, logger)
+			}()
+
+			// Wait for waitForShutdown to finish or timeout
+			select {
+			case err := <-done:
+				assert.NoError(t, err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("waitForShutdown did not finish within the expected time")
+			}
+		})
+	}
+}
+
+func TestShutdownServer(t *testing.T) {
+	logger := zap.NewNop()
+
+	// serve starts a server whose requests take as long as their duration query parameter
+	serve := func(t *testing.T) (*http.Server, string) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			duration, _ := time.ParseDuration(r.URL.Query().Get("duration"))
+			time.Sleep(duration)
+			w.WriteHeader(http.StatusOK)
+		})}
+		go srv.Serve(listener)
+		return srv, "http://" + listener.Addr().String()
+	}
+	// inFlight sends a request lasting duration and waits until the server is handling it
+	inFlight := func(url string, duration time.Duration) chan error {
+		result := make(chan error, 1)
+		go func() {
+			resp, err := http.Get(url + "/?duration=" + duration.String())
+			if err == nil {
+				resp.Body.Close()
+			}
+			result <- err
+		}()
+		time.Sleep(50 * time.Millisecond)
+		return result
 	}
+
+	t.Run("In-flight requests complete within the timeout", func(t *testing.T) {
+		srv, url := serve(t)
+		result := inFlight(url, 200*time.Millisecond)
+
+		assert.NoError(t, shutdownServer(context.Background(), srv, time.Second, logger))
+		assert.NoError(t, <-result)
+	})
+
+	t.Run("Requests still running at the deadline are cut off", func(t *testing.T) {
+		srv, url := serve(t)
+		result := inFlight(url, 10*time.Second)
+
+		start := time.Now()
+		err := shutdownServer(context.Background(), srv, 200*time.Millisecond, logger)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second, "Shutdown should not outlast its timeout")
+		assert.Error(t, <-result, "The connection of the unfinished request should be closed")
+	})
 }
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"go-url-shortening/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.uber.org/zap"
+)
+
+// serviceName is reported as the service.name resource attribute on exported spans.
+const serviceName = "go-url-shortening"
+
+// tracingShutdownTimeout bounds how long buffered spans may take to flush on shutdown.
+const tracingShutdownTimeout = 5 * time.Second
+
+// setupTracing installs a global tracer provider exporting spans to cfg.OTLPEndpoint over OTLP/HTTP.
+// When no endpoint is configured the global no-op provider is left in place.
+// The returned function flushes and stops the provider.
+func setupTracing(ctx context.Context, cfg *config.Config, logger *zap.Logger) (func(), error) {
+	if cfg.OTLPEndpoint == "" {
+		return func() {}, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.OTLPEndpoint))
+	if err != nil {
+		logger.Error("Failed to create OTLP exporter", zap.String("endpoint", cfg.OTLPEndpoint), zap.Error(err))
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	logger.Info("Tracing enabled", zap.String("endpoint", cfg.OTLPEndpoint))
+
+	return func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := provider.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Failed to flush spans", zap.Error(err))
+		}
+	}, nil
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-url-shortening/config"
+	"go-url-shortening/storage"
+	"go-url-shortening/types"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+func TestTracing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zap.NewNop()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	cfg := config.DefaultConfig()
+	cfg.DisableRateLimit = true
+	cfg.OTLPEndpoint = "http://localhost:4318" // Only enables the instrumentation, the exporter above is used
+	urlHandler, err := setupURLHandler(context.Background(), cfg, newURLService(cfg, storage.NewInMemoryStorage(10, logger), nil, logger), logger)
+	require.NoError(t, err)
+	router := setupRouter(urlHandler, cfg, logger)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/short", strings.NewReader(`{"url":"https://example.com"}`)))
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created types.URLResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+created.ShortURL, nil))
+	require.Equal(t, http.StatusFound, w.Code)
+
+	spans := exporter.GetSpans()
+	var serverSpans []tracetest.SpanStub
+	for _, span := range spans {
+		if span.SpanKind == trace.SpanKindServer {
+			serverSpans = append(serverSpans, span)
+		}
+	}
+	require.Len(t, serverSpans, 2, "One span should be recorded per request")
+	assert.Equal(t, "POST /api/v1/short", serverSpans[0].Name)
+	assert.Equal(t, "GET /:short_url", serverSpans[1].Name)
+
+	// Service and storage spans are nested within the request's span
+	parents := make(map[string]trace.SpanID)
+	spanIDs := make(map[string]trace.SpanID)
+	for _, span := range spans {
+		parents[span.Name] = span.Parent.SpanID()
+		spanIDs[span.Name] = span.SpanContext.SpanID()
+	}
+	assert.Equal(t, serverSpans[0].SpanContext.SpanID(), parents["URLService.CreateShortURL"])
+	assert.Equal(t, spanIDs["URLService.CreateShortURL"], parents["Storage.GetOrCreate"])
+	assert.Equal(t, serverSpans[1].SpanContext.SpanID(), parents["URLService.GetURLData"])
+	assert.Equal(t, spanIDs["URLService.GetURLData"], parents["Storage.GetURLData"])
+}
+
+func TestSetupTracingDisabled(t *testing.T) {
+	previous := otel.GetTracerProvider()
+
+	shutdown, err := setupTracing(context.Background(), config.DefaultConfig(), zap.NewNop())
+	require.NoError(t, err)
+	shutdown()
+
+	assert.Equal(t, previous, otel.GetTracerProvider(), "The no-op provider should be left in place")
+}
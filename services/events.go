@@ -0,0 +1,143 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-url-shortening/types"
+	"go-url-shortening/workerpool"
+	"go.uber.org/zap"
+)
+
+// Kinds of Event.
+const (
+	EventCreated = "created"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+)
+
+// Defaults of the webhook notifier.
+const (
+	webhookTimeout  = 5 * time.Second
+	webhookAttempts = 4
+	webhookBackoff  = 500 * time.Millisecond // Doubled after each failed attempt
+	// webhookQueueSize is how many events may wait for the sender, beyond which new ones are dropped
+	webhookQueueSize = 1000
+)
+
+// Event describes a change to a short URL, as sent to webhooks.
+type Event struct {
+	Event       string    `json:"event"`
+	ShortURL    string    `json:"short_url"`
+	OriginalURL string    `json:"original_url"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// newEvent returns the event of the given kind about urlData, happening at now.
+func newEvent(kind string, urlData types.URLData, now time.Time) Event {
+	return Event{Event: kind, ShortURL: urlData.ShortURL, OriginalURL: urlData.OriginalURL, Timestamp: now}
+}
+
+// EventNotifier is told about every short URL the service creates, updates or deletes, once the
+// change is stored. Notify must not block on delivering the event.
+type EventNotifier interface {
+	Notify(ctx context.Context, event Event)
+}
+
+// WebhookNotifier POSTs every event as JSON to a webhook URL from a sender goroutine of its own,
+// retrying failed deliveries with exponential backoff. Events wait for the sender in a bounded
+// queue, so a slow or failing webhook never holds up other background tasks.
+type WebhookNotifier struct {
+	url      string
+	sender   *workerpool.Pool // A single worker, delivering events in order
+	client   *http.Client
+	attempts int
+	backoff  time.Duration // Wait before the first retry, overridable in tests
+	logger   *zap.Logger
+}
+
+// NewWebhookNotifier returns a notifier delivering events to url until it is closed. Each attempt
+// times out after 5 seconds, and a delivery is given up after 4 attempts.
+func NewWebhookNotifier(url string, logger *zap.Logger) *WebhookNotifier {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &WebhookNotifier{
+		url:      url,
+		sender:   workerpool.New(1, webhookQueueSize),
+		client:   &http.Client{Timeout: webhookTimeout},
+		attempts: webhookAttempts,
+		backoff:  webhookBackoff,
+		logger:   logger,
+	}
+}
+
+// Notify queues the delivery of event, dropping it when the queue is full or the notifier is closed.
+func (n *WebhookNotifier) Notify(_ context.Context, event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		n.logger.Error("Failed to encode webhook event", zap.Error(err))
+		return
+	}
+	queued := n.sender.Go(func(ctx context.Context) {
+		n.deliver(ctx, event, body)
+	})
+	if !queued {
+		n.logger.Warn("Dropped webhook event, the webhook queue is full",
+			zap.String("event", event.Event), zap.String("shortURL", event.ShortURL))
+	}
+}
+
+// Close stops the sender, dropping the events still queued or being retried.
+func (n *WebhookNotifier) Close() {
+	n.sender.Stop()
+}
+
+// deliver POSTs body to the webhook until it is accepted, the attempts run out or ctx is done.
+// Only network errors, 429 and 5xx responses are retried.
+func (n *WebhookNotifier) deliver(ctx context.Context, event Event, body []byte) {
+	backoff := n.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := n.post(ctx, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= n.attempts {
+			n.logger.Warn("Failed to deliver webhook event", zap.String("event", event.Event),
+				zap.String("shortURL", event.ShortURL), zap.Int("attempts", attempt), zap.Error(err))
+			return
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// post sends body to the webhook once, reporting whether a failure is worth retrying.
+func (n *WebhookNotifier) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+	return retry, fmt.Errorf("webhook responded with %s", resp.Status)
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-url-shortening/storage"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// receiveEvent returns the next event sent to events, failing the test if none arrives in time.
+func receiveEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("No webhook event received")
+		return Event{}
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	ctx := context.Background()
+
+	events := make(chan Event, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var event Event
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		events <- event
+	}))
+	defer webhook.Close()
+
+	notifier := NewWebhookNotifier(webhook.URL, zap.NewNop())
+	defer notifier.Close()
+	service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()), WithEventNotifier(notifier))
+
+	created, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+	require.NoError(t, err)
+	event := receiveEvent(t, events)
+	assert.Equal(t, EventCreated, event.Event)
+	assert.Equal(t, created.ShortURL, event.ShortURL)
+	assert.Equal(t, "https://example.com", event.OriginalURL)
+	assert.WithinDuration(t, time.Now(), event.Timestamp, time.Minute)
+
+	_, err = service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+	require.ErrorIs(t, err, ErrShortURLExists)
+
+	_, err = service.UpdateURL(ctx, created.ShortURL, "https://example.org")
+	require.NoError(t, err)
+	event = receiveEvent(t, events)
+	assert.Equal(t, EventUpdated, event.Event, "Finding an already shortened URL should not be notified")
+	assert.Equal(t, "https://example.org", event.OriginalURL)
+
+	require.NoError(t, service.DeleteURL(ctx, created.ShortURL))
+	event = receiveEvent(t, events)
+	assert.Equal(t, EventDeleted, event.Event)
+	assert.Equal(t, created.ShortURL, event.ShortURL)
+	assert.Equal(t, "https://example.org", event.OriginalURL, "The deleted destination should be reported")
+
+	assert.Equal(t, ErrShortURLNotFound, service.DeleteURL(ctx, created.ShortURL))
+	assert.Empty(t, events, "Failed changes should not be notified")
+}
+
+func TestWebhookNotifierRetries(t *testing.T) {
+	t.Run("Server errors are retried", func(t *testing.T) {
+		var calls atomic.Int64
+		events := make(chan Event, 10)
+		webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			var event Event
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+			events <- event
+		}))
+		defer webhook.Close()
+
+		notifier := NewWebhookNotifier(webhook.URL, nil)
+		defer notifier.Close()
+		notifier.backoff = time.Millisecond
+		notifier.Notify(context.Background(), Event{Event: EventCreated, ShortURL: "abc"})
+
+		assert.Equal(t, "abc", receiveEvent(t, events).ShortURL)
+		assert.EqualValues(t, 3, calls.Load())
+	})
+
+	t.Run("Delivery gives up", func(t *testing.T) {
+		for _, status := range []int{http.StatusInternalServerError, http.StatusBadRequest} {
+			var calls atomic.Int64
+			webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(status)
+			}))
+			core, logs := observer.New(zapcore.WarnLevel)
+
+			notifier := NewWebhookNotifier(webhook.URL, zap.New(core))
+			notifier.backoff = time.Millisecond
+			notifier.Notify(context.Background(), Event{Event: EventDeleted, ShortURL: "abc"})
+
+			require.Eventually(t, func() bool {
+				return logs.FilterMessage("Failed to deliver webhook event").Len() == 1
+			}, 5*time.Second, time.Millisecond, "status %d", status)
+			webhook.Close()
+			notifier.Close()
+
+			expected := webhookAttempts
+			if status == http.StatusBadRequest {
+				expected = 1 // Client errors are not retried
+			}
+			assert.EqualValues(t, expected, calls.Load(), "status %d", status)
+		}
+	})
+}
+
+func TestWebhookNotifierQueue(t *testing.T) {
+	received, release := make(chan struct{}, 1), make(chan struct{})
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+		<-release
+	}))
+	defer webhook.Close()
+	defer close(release)
+	core, logs := observer.New(zapcore.WarnLevel)
+
+	notifier := NewWebhookNotifier(webhook.URL, zap.New(core))
+	defer notifier.Close()
+	notifier.Notify(context.Background(), Event{Event: EventCreated, ShortURL: "first"})
+	receiveSignal(t, received)
+
+	// The sender is stuck on the first event, so webhookQueueSize more fill the queue
+	for i := 0; i < webhookQueueSize; i++ {
+		notifier.Notify(context.Background(), Event{Event: EventCreated, ShortURL: "queued"})
+	}
+	assert.Zero(t, logs.FilterMessage("Dropped webhook event, the webhook queue is full").Len())
+
+	notifier.Notify(context.Background(), Event{Event: EventDeleted, ShortURL: "dropped"})
+	dropped := logs.FilterMessage("Dropped webhook event, the webhook queue is full").All()
+	require.Len(t, dropped, 1)
+	assert.Equal(t, "dropped", dropped[0].ContextMap()["shortURL"])
+}
+
+// receiveSignal waits for a value on signal, failing the test if none arrives in time.
+func receiveSignal(t *testing.T, signal <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-signal:
+	case <-time.After(5 * time.Second):
+		t.Fatal("No signal received")
+	}
+}
@@ -2,7 +2,9 @@ package mocks
 
 import (
 	"context"
+	"go-url-shortening/services"
 	"go-url-shortening/types"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -12,8 +14,13 @@ type MockURLService struct {
 	mock.Mock
 }
 
-func (m *MockURLService) CreateShortURL(ctx context.Context, originalURL string) (types.URLData, error) {
-	args := m.Called(ctx, originalURL)
+func (m *MockURLService) CreateShortURL(ctx context.Context, originalURL string, opts services.CreateOptions) (types.URLData, error) {
+	args := m.Called(ctx, originalURL, opts)
+	return args.Get(0).(types.URLData), args.Error(1)
+}
+
+func (m *MockURLService) GetByExternalID(ctx context.Context, externalID string) (types.URLData, error) {
+	args := m.Called(ctx, externalID)
 	return args.Get(0).(types.URLData), args.Error(1)
 }
 
@@ -22,12 +29,94 @@ func (m *MockURLService) GetURLData(ctx context.Context, shortURL string) (types
 	return args.Get(0).(types.URLData), args.Error(1)
 }
 
-func (m *MockURLService) UpdateURL(ctx context.Context, shortURL, newURL string) error {
+func (m *MockURLService) UpdateURL(ctx context.Context, shortURL, newURL string) (types.URLData, error) {
 	args := m.Called(ctx, shortURL, newURL)
-	return args.Error(0)
+	return args.Get(0).(types.URLData), args.Error(1)
+}
+
+func (m *MockURLService) UpdateURLIfUnmodified(ctx context.Context, shortURL, newURL string, updatedAt time.Time) (types.URLData, error) {
+	args := m.Called(ctx, shortURL, newURL, updatedAt)
+	return args.Get(0).(types.URLData), args.Error(1)
+}
+
+func (m *MockURLService) PatchURL(ctx context.Context, shortURL string, patch services.URLPatch) (types.URLData, error) {
+	args := m.Called(ctx, shortURL, patch)
+	return args.Get(0).(types.URLData), args.Error(1)
 }
 
 func (m *MockURLService) DeleteURL(ctx context.Context, shortURL string) error {
 	args := m.Called(ctx, shortURL)
 	return args.Error(0)
 }
+
+func (m *MockURLService) CreateShortURLWithAlias(ctx context.Context, originalURL, alias string) (types.URLData, error) {
+	args := m.Called(ctx, originalURL, alias)
+	return args.Get(0).(types.URLData), args.Error(1)
+}
+
+func (m *MockURLService) BatchCreate(ctx context.Context, urls []string) ([]types.URLData, []error) {
+	args := m.Called(ctx, urls)
+	return args.Get(0).([]types.URLData), args.Get(1).([]error)
+}
+
+func (m *MockURLService) BatchDelete(ctx context.Context, codes []string) map[string]error {
+	args := m.Called(ctx, codes)
+	return args.Get(0).(map[string]error)
+}
+
+func (m *MockURLService) BatchGet(ctx context.Context, codes []string) (map[string]types.URLData, map[string]error) {
+	args := m.Called(ctx, codes)
+	return args.Get(0).(map[string]types.URLData), args.Get(1).(map[string]error)
+}
+
+func (m *MockURLService) RecordAccess(ctx context.Context, shortURL string) error {
+	args := m.Called(ctx, shortURL)
+	return args.Error(0)
+}
+
+func (m *MockURLService) Ping(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockURLService) RestoreURL(ctx context.Context, shortURL string) (types.URLData, error) {
+	args := m.Called(ctx, shortURL)
+	return args.Get(0).(types.URLData), args.Error(1)
+}
+
+func (m *MockURLService) StorageStats(ctx context.Context) (types.StorageStats, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(types.StorageStats), args.Error(1)
+}
+
+func (m *MockURLService) TopN(ctx context.Context, n int) ([]types.URLData, error) {
+	args := m.Called(ctx, n)
+	return args.Get(0).([]types.URLData), args.Error(1)
+}
+
+func (m *MockURLService) ListByTag(ctx context.Context, tag string) ([]types.URLData, error) {
+	args := m.Called(ctx, tag)
+	return args.Get(0).([]types.URLData), args.Error(1)
+}
+
+func (m *MockURLService) ForEach(ctx context.Context, fn func(types.URLData) error) error {
+	args := m.Called(ctx, fn)
+	if items, ok := args.Get(0).([]types.URLData); ok {
+		for _, urlData := range items {
+			if err := fn(urlData); err != nil {
+				return err
+			}
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockURLService) ReplaceAll(ctx context.Context, urls map[string]string) error {
+	args := m.Called(ctx, urls)
+	return args.Error(0)
+}
+
+func (m *MockURLService) List(ctx context.Context, page, pageSize int) ([]types.URLData, int, error) {
+	args := m.Called(ctx, page, pageSize)
+	return args.Get(0).([]types.URLData), args.Int(1), args.Error(2)
+}
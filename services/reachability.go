@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"go-url-shortening/storage"
+	"go-url-shortening/workerpool"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// ErrChecksUnsupported is returned by NewReachabilityChecker for storage backends that cannot record check results.
+var ErrChecksUnsupported = errors.New("storage backend does not support reachability checks")
+
+// Defaults of the reachability checker.
+const (
+	defaultChecksPerSecond = 1.0
+	checkTimeout           = 10 * time.Second
+	checkPageSize          = 100
+)
+
+// ReachabilityChecker periodically sends a HEAD request to the destination of every unexpired
+// short URL and records the response status on its URLData.
+type ReachabilityChecker struct {
+	store    storage.Storage
+	recorder storage.CheckRecorder
+	client   *http.Client
+	limiter  *rate.Limiter // Spaces the checks out so destinations and the network aren't flooded
+	logger   *zap.Logger
+	now      func() time.Time
+}
+
+// NewReachabilityChecker returns a checker sending at most checksPerSecond requests, defaulting to 1.
+// It returns ErrChecksUnsupported if store does not implement storage.CheckRecorder.
+func NewReachabilityChecker(store storage.Storage, checksPerSecond float64, logger *zap.Logger) (*ReachabilityChecker, error) {
+	recorder, ok := store.(storage.CheckRecorder)
+	if !ok {
+		return nil, ErrChecksUnsupported
+	}
+	if checksPerSecond <= 0 {
+		checksPerSecond = defaultChecksPerSecond
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &ReachabilityChecker{
+		store:    store,
+		recorder: recorder,
+		client: &http.Client{
+			Timeout: checkTimeout,
+			// The destination's own status is recorded, so redirects are not followed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		limiter: rate.NewLimiter(rate.Limit(checksPerSecond), 1),
+		logger:  logger,
+		now:     time.Now,
+	}, nil
+}
+
+// Start schedules a check of every stored destination on pool, starting immediately and repeated
+// interval after each pass completes, until the pool is stopped.
+func (c *ReachabilityChecker) Start(pool *workerpool.Pool, interval time.Duration) {
+	pool.Schedule(interval, func(ctx context.Context) {
+		if err := c.CheckAll(ctx); err != nil && ctx.Err() == nil {
+			c.logger.Error("Reachability check failed", zap.Error(err))
+		}
+	})
+}
+
+// CheckAll checks the destination of every unexpired short URL once, page by page.
+func (c *ReachabilityChecker) CheckAll(ctx context.Context) error {
+	checked := 0
+	for offset := 0; ; offset += checkPageSize {
+		items, total, err := c.store.List(ctx, offset, checkPageSize)
+		if err != nil {
+			return err
+		}
+		for _, urlData := range items {
+			if urlData.Expired(c.now()) {
+				continue
+			}
+			if err := c.limiter.Wait(ctx); err != nil {
+				return err
+			}
+			status := c.check(ctx, urlData.OriginalURL)
+			err := c.recorder.RecordCheck(ctx, urlData.ShortURL, urlData.OriginalURL, c.now(), status)
+			if err != nil && !errors.Is(err, storage.ErrShortURLNotFound) { // Deleted since it was listed
+				return err
+			}
+			checked++
+		}
+		if offset+checkPageSize >= total {
+			c.logger.Debug("Reachability check completed", zap.Int("checked", checked))
+			return nil
+		}
+	}
+}
+
+// check sends a HEAD request to destination, returning the response status or 0 if it could not be reached.
+func (c *ReachabilityChecker) check(ctx context.Context, destination string) int {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, destination, nil)
+	if err != nil {
+		return 0
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.logger.Debug("Destination unreachable", zap.String("originalURL", destination), zap.Error(err))
+		return 0
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-url-shortening/storage"
+	"go-url-shortening/storage/mocks"
+	"go-url-shortening/types"
+	"go.uber.org/zap"
+)
+
+func TestReachabilityChecker(t *testing.T) {
+	ctx := context.Background()
+
+	var status atomic.Int64
+	status.Store(http.StatusOK)
+	var methods atomic.Value
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods.Store(r.Method)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer destination.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	store := storage.NewInMemoryStorage(10, zap.NewNop())
+	require.NoError(t, store.Create(ctx, types.URLData{ShortURL: "up", OriginalURL: destination.URL + "/page"}))
+	require.NoError(t, store.Create(ctx, types.URLData{ShortURL: "down", OriginalURL: unreachable.URL}))
+
+	checker, err := NewReachabilityChecker(store, 1000, zap.NewNop())
+	require.NoError(t, err)
+
+	require.NoError(t, checker.CheckAll(ctx))
+	urlData, err := store.GetURLData(ctx, "up")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, urlData.LastStatus)
+	assert.WithinDuration(t, time.Now(), urlData.LastCheckedAt, time.Second)
+	assert.Equal(t, http.MethodHead, methods.Load())
+
+	urlData, err = store.GetURLData(ctx, "down")
+	require.NoError(t, err)
+	assert.Equal(t, 0, urlData.LastStatus, "Unreachable destinations have no status")
+	assert.False(t, urlData.LastCheckedAt.IsZero())
+
+	t.Run("Status follows the destination", func(t *testing.T) {
+		status.Store(http.StatusServiceUnavailable)
+		require.NoError(t, checker.CheckAll(ctx))
+		urlData, err := store.GetURLData(ctx, "up")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, urlData.LastStatus)
+
+		status.Store(http.StatusMovedPermanently)
+		require.NoError(t, checker.CheckAll(ctx))
+		urlData, err = store.GetURLData(ctx, "up")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusMovedPermanently, urlData.LastStatus, "Redirects are recorded, not followed")
+	})
+
+	t.Run("Updating the destination clears the result", func(t *testing.T) {
+		urlData, err := store.GetURLData(ctx, "up")
+		require.NoError(t, err)
+		urlData.OriginalURL = destination.URL + "/moved"
+		_, err = store.Update(ctx, urlData)
+		require.NoError(t, err)
+
+		urlData, err = store.GetURLData(ctx, "up")
+		require.NoError(t, err)
+		assert.True(t, urlData.LastCheckedAt.IsZero())
+		assert.Equal(t, 0, urlData.LastStatus)
+	})
+
+	t.Run("Expired URLs are skipped", func(t *testing.T) {
+		require.NoError(t, store.Create(ctx, types.URLData{ShortURL: "gone", OriginalURL: destination.URL, ExpiresAt: time.Now().Add(-time.Minute)}))
+		require.NoError(t, checker.CheckAll(ctx))
+		urlData, err := store.GetURLData(ctx, "gone")
+		require.NoError(t, err)
+		assert.True(t, urlData.LastCheckedAt.IsZero())
+	})
+
+	t.Run("Unsupported storage", func(t *testing.T) {
+		_, err := NewReachabilityChecker(new(mocks.MockStorage), 1, nil)
+		assert.Equal(t, ErrChecksUnsupported, err)
+	})
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+// CreateTimings breaks down the time CreateShortURL spent in each of its phases, summed over every
+// generation attempt. DedupKey only derives the key duplicates are detected by: looking that key up
+// and storing the URL happen in one atomic storage call, all of which is counted as StorageWrite.
+// Creates with an alias generate nothing, so they only record DedupKey and StorageWrite.
+type CreateTimings struct {
+	Generation   time.Duration
+	DedupKey     time.Duration
+	StorageWrite time.Duration
+}
+
+// createTimingsKey is the context key WithCreateTimings stores the CreateTimings under.
+type createTimingsKey struct{}
+
+// WithCreateTimings returns a context that makes CreateShortURL record its timings into the
+// returned CreateTimings, which can be read once CreateShortURL has returned.
+func WithCreateTimings(ctx context.Context) (context.Context, *CreateTimings) {
+	timings := &CreateTimings{}
+	return context.WithValue(ctx, createTimingsKey{}, timings), timings
+}
+
+// createTimingsFrom returns the CreateTimings stored in ctx by WithCreateTimings, or one nobody
+// reads when timings aren't being recorded, so that callers can record unconditionally.
+func createTimingsFrom(ctx context.Context) *CreateTimings {
+	if timings, ok := ctx.Value(createTimingsKey{}).(*CreateTimings); ok {
+		return timings
+	}
+	return &CreateTimings{}
+}
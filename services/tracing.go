@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-url-shortening/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans created by this package.
+const tracerName = "go-url-shortening/services"
+
+// tracedURLService wraps a URLService, recording a span around each call.
+type tracedURLService struct {
+	next   URLService
+	tracer trace.Tracer
+}
+
+// NewTracedURLService returns a URLService that records a span for every call to next
+// using the global tracer provider.
+func NewTracedURLService(next URLService) URLService {
+	return &tracedURLService{next: next, tracer: otel.Tracer(tracerName)}
+}
+
+func (s *tracedURLService) CreateShortURL(ctx context.Context, originalURL string, opts CreateOptions) (types.URLData, error) {
+	ctx, span := s.tracer.Start(ctx, "URLService.CreateShortURL")
+	defer span.End()
+	urlData, err := s.next.CreateShortURL(ctx, originalURL, opts)
+	span.SetAttributes(attribute.String("short_url", urlData.ShortURL))
+	recordError(span, err)
+	return urlData, err
+}
+
+func (s *tracedURLService) CreateShortURLWithAlias(ctx context.Context, originalURL, alias string) (types.URLData, error) {
+	ctx, span := s.tracer.Start(ctx, "URLService.CreateShortURLWithAlias", trace.WithAttributes(attribute.String("short_url", alias)))
+	defer span.End()
+	urlData, err := s.next.CreateShortURLWithAlias(ctx, originalURL, alias)
+	recordError(span, err)
+	return urlData, err
+}
+
+func (s *tracedURLService) BatchCreate(ctx context.Context, urls []string) ([]types.URLData, []error) {
+	ctx, span := s.tracer.Start(ctx, "URLService.BatchCreate", trace.WithAttributes(attribute.Int("batch_size", len(urls))))
+	defer span.End()
+	results, errs := s.next.BatchCreate(ctx, urls)
+	failed := 0
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, ErrShortURLExists) {
+			failed++
+		}
+	}
+	span.SetAttributes(attribute.Int("failed", failed))
+	return results, errs
+}
+
+func (s *tracedURLService) GetURLData(ctx context.Context, shortURL string) (types.URLData, error) {
+	ctx, span := s.tracer.Start(ctx, "URLService.GetURLData", trace.WithAttributes(attribute.String("short_url", shortURL)))
+	defer span.End()
+	urlData, err := s.next.GetURLData(ctx, shortURL)
+	recordError(span, err)
+	return urlData, err
+}
+
+func (s *tracedURLService) GetByExternalID(ctx context.Context, externalID string) (types.URLData, error) {
+	ctx, span := s.tracer.Start(ctx, "URLService.GetByExternalID")
+	defer span.End()
+	urlData, err := s.next.GetByExternalID(ctx, externalID)
+	span.SetAttributes(attribute.String("short_url", urlData.ShortURL))
+	recordError(span, err)
+	return urlData, err
+}
+
+func (s *tracedURLService) UpdateURL(ctx context.Context, shortURL, newURL string) (types.URLData, error) {
+	ctx, span := s.tracer.Start(ctx, "URLService.UpdateURL", trace.WithAttributes(attribute.String("short_url", shortURL)))
+	defer span.End()
+	urlData, err := s.next.UpdateURL(ctx, shortURL, newURL)
+	recordError(span, err)
+	return urlData, err
+}
+
+func (s *tracedURLService) UpdateURLIfUnmodified(ctx context.Context, shortURL, newURL string, updatedAt time.Time) (types.URLData, error) {
+	ctx, span := s.tracer.Start(ctx, "URLService.UpdateURLIfUnmodified", trace.WithAttributes(attribute.String("short_url", shortURL)))
+	defer span.End()
+	urlData, err := s.next.UpdateURLIfUnmodified(ctx, shortURL, newURL, updatedAt)
+	recordError(span, err)
+	return urlData, err
+}
+
+func (s *tracedURLService) BatchDelete(ctx context.Context, codes []string) map[string]error {
+	ctx, span := s.tracer.Start(ctx, "URLService.BatchDelete", trace.WithAttributes(attribute.Int("batch_size", len(codes))))
+	defer span.End()
+	results := s.next.BatchDelete(ctx, codes)
+	failed := 0
+	for _, err := range results {
+		if err != nil {
+			failed++
+		}
+	}
+	span.SetAttributes(attribute.Int("failed", failed))
+	return results
+}
+
+func (s *tracedURLService) BatchGet(ctx context.Context, codes []string) (map[string]types.URLData, map[string]error) {
+	ctx, span := s.tracer.Start(ctx, "URLService.BatchGet", trace.WithAttributes(attribute.Int("batch_size", len(codes))))
+	defer span.End()
+	found, errs := s.next.BatchGet(ctx, codes)
+	span.SetAttributes(attribute.Int("failed", len(errs)))
+	return found, errs
+}
+
+func (s *tracedURLService) PatchURL(ctx context.Context, shortURL string, patch URLPatch) (types.URLData, error) {
+	ctx, span := s.tracer.Start(ctx, "URLService.PatchURL", trace.WithAttributes(attribute.String("short_url", shortURL)))
+	defer span.End()
+	urlData, err := s.next.PatchURL(ctx, shortURL, patch)
+	recordError(span, err)
+	return urlData, err
+}
+
+func (s *tracedURLService) DeleteURL(ctx context.Context, shortURL string) error {
+	ctx, span := s.tracer.Start(ctx, "URLService.DeleteURL", trace.WithAttributes(attribute.String("short_url", shortURL)))
+	defer span.End()
+	err := s.next.DeleteURL(ctx, shortURL)
+	recordError(span, err)
+	return err
+}
+
+func (s *tracedURLService) ListByTag(ctx context.Context, tag string) ([]types.URLData, error) {
+	ctx, span := s.tracer.Start(ctx, "URLService.ListByTag", trace.WithAttributes(attribute.String("tag", tag)))
+	defer span.End()
+	items, err := s.next.ListByTag(ctx, tag)
+	recordError(span, err)
+	return items, err
+}
+
+func (s *tracedURLService) TopN(ctx context.Context, n int) ([]types.URLData, error) {
+	ctx, span := s.tracer.Start(ctx, "URLService.TopN", trace.WithAttributes(attribute.Int("n", n)))
+	defer span.End()
+	items, err := s.next.TopN(ctx, n)
+	recordError(span, err)
+	return items, err
+}
+
+func (s *tracedURLService) List(ctx context.Context, page, pageSize int) ([]types.URLData, int, error) {
+	ctx, span := s.tracer.Start(ctx, "URLService.List", trace.WithAttributes(attribute.Int("page", page), attribute.Int("page_size", pageSize)))
+	defer span.End()
+	items, total, err := s.next.List(ctx, page, pageSize)
+	recordError(span, err)
+	return items, total, err
+}
+
+func (s *tracedURLService) ForEach(ctx context.Context, fn func(types.URLData) error) error {
+	ctx, span := s.tracer.Start(ctx, "URLService.ForEach")
+	defer span.End()
+	err := s.next.ForEach(ctx, fn)
+	recordError(span, err)
+	return err
+}
+
+func (s *tracedURLService) ReplaceAll(ctx context.Context, urls map[string]string) error {
+	ctx, span := s.tracer.Start(ctx, "URLService.ReplaceAll", trace.WithAttributes(attribute.Int("urls", len(urls))))
+	defer span.End()
+	err := s.next.ReplaceAll(ctx, urls)
+	recordError(span, err)
+	return err
+}
+
+func (s *tracedURLService) RecordAccess(ctx context.Context, shortURL string) error {
+	ctx, span := s.tracer.Start(ctx, "URLService.RecordAccess", trace.WithAttributes(attribute.String("short_url", shortURL)))
+	defer span.End()
+	err := s.next.RecordAccess(ctx, shortURL)
+	recordError(span, err)
+	return err
+}
+
+func (s *tracedURLService) Ping(ctx context.Context) error {
+	ctx, span := s.tracer.Start(ctx, "URLService.Ping")
+	defer span.End()
+	err := s.next.Ping(ctx)
+	recordError(span, err)
+	return err
+}
+
+func (s *tracedURLService) RestoreURL(ctx context.Context, shortURL string) (types.URLData, error) {
+	ctx, span := s.tracer.Start(ctx, "URLService.RestoreURL", trace.WithAttributes(attribute.String("short_url", shortURL)))
+	defer span.End()
+	urlData, err := s.next.RestoreURL(ctx, shortURL)
+	recordError(span, err)
+	return urlData, err
+}
+
+func (s *tracedURLService) StorageStats(ctx context.Context) (types.StorageStats, error) {
+	ctx, span := s.tracer.Start(ctx, "URLService.StorageStats")
+	defer span.End()
+	stats, err := s.next.StorageStats(ctx)
+	recordError(span, err)
+	return stats, err
+}
+
+// recordError marks span as failed when err is non-nil.
+func recordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -3,12 +3,39 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
 	"go-url-shortening/storage"
 	"go-url-shortening/types"
 	"go-url-shortening/urlgen"
+	"go-url-shortening/urlutil"
+	"go.uber.org/zap"
+	"slices"
+	"strings"
 	"time"
 )
 
+// Length bounds for custom aliases.
+const (
+	MinAliasLength = 3
+	MaxAliasLength = 32
+)
+
+// DefaultReservedWords are top-level paths served by the application itself, which a short URL
+// would otherwise shadow through the /:short_url redirect route, and the static routes under
+// /api/v1/short, such as top and export, which would shadow the short URL of the same name. They
+// are always reserved, alongside any words added with WithReservedWords.
+var DefaultReservedWords = []string{"api", "health", "livez", "readyz", "metrics", "top", "export", "batch-get"}
+
+// DefaultGenerationAttempts bounds how many short URLs CreateShortURL generates before giving up,
+// unless overridden with WithGenerationAttempts.
+const DefaultGenerationAttempts = 3
+
+// Reasons for generating another short URL, reported when attempt logging is enabled.
+const (
+	retryReasonCollision = "collision" // The generated short URL is already stored
+	retryReasonReserved  = "reserved"  // The generated short URL is a reserved word
+)
+
 // handleStorageError maps storage-specific errors to service-level errors.
 // This function helps in abstracting the storage layer errors from the service layer.
 func handleStorageError(err error) error {
@@ -19,6 +46,10 @@ func handleStorageError(err error) error {
 		return ErrStorageCapacityReached
 	case errors.Is(err, storage.ErrShortURLNotFound):
 		return ErrShortURLNotFound
+	case errors.Is(err, storage.ErrExternalIDExists):
+		return ErrExternalIDExists
+	case errors.Is(err, storage.ErrVersionMismatch):
+		return ErrVersionMismatch
 	default:
 		return err // If it's not a known error, return it as is
 	}
@@ -28,97 +59,848 @@ var (
 	ErrShortURLExists         = errors.New("short URL already exists")
 	ErrStorageCapacityReached = errors.New("storage capacity reached")
 	ErrShortURLNotFound       = errors.New("short URL not found")
+	ErrShortURLExpired        = errors.New("short URL expired")
+	ErrInvalidAlias           = errors.New("invalid alias")
+	ErrExternalIDExists       = errors.New("external ID already exists")
+	ErrVersionMismatch        = errors.New("short URL was modified since the expected version")
+	ErrStatsUnsupported       = errors.New("storage does not report its usage")
+	ErrSoftDeleteDisabled     = errors.New("soft deletes are not enabled")
+	// ErrAliasTaken wraps ErrShortURLExists so callers that only check for the latter keep working.
+	ErrAliasTaken = fmt.Errorf("alias already taken: %w", ErrShortURLExists)
 )
 
+// StorageFullError is returned when the storage capacity is reached and the backend
+// can report its usage. It matches ErrStorageCapacityReached with errors.Is.
+type StorageFullError struct {
+	Count    int
+	Capacity int
+}
+
+func (e *StorageFullError) Error() string {
+	return ErrStorageCapacityReached.Error()
+}
+
+// Is makes errors.Is(err, ErrStorageCapacityReached) report true for a StorageFullError.
+func (e *StorageFullError) Is(target error) bool {
+	return target == ErrStorageCapacityReached
+}
+
+// CreateOptions holds the optional per-URL settings for CreateShortURL.
+type CreateOptions struct {
+	// TTL, when positive, makes the short URL expire TTL after creation.
+	TTL time.Duration
+	// Tags are stored as-is alongside the URL.
+	Tags []string
+	// Alias, when set, is used as the short URL instead of a generated one. It must only use the
+	// service's charset, be MinAliasLength to MaxAliasLength long and not be a reserved path.
+	Alias string
+	// ExternalID, when set, is stored as the client's own reference to the short URL and must not be
+	// in use by another one. The URL is then always stored as a new short URL, without deduplication.
+	ExternalID string
+	// Imported marks Alias as a short URL restored from an export, which may have been generated with
+	// another length or charset, or stored before a word was reserved. Only the short URLs the
+	// redirect route can't serve are rejected then: see ValidateImportedShortURL.
+	Imported bool
+}
+
+// URLPatch holds the changes PatchURL makes to a short URL. Nil fields are left unchanged.
+type URLPatch struct {
+	// URL replaces the original URL.
+	URL *string
+	// TTL makes the short URL expire TTL from now.
+	TTL *time.Duration
+	// Alias moves the short URL to a new path, under the same rules as CreateOptions.Alias.
+	Alias *string
+}
+
 // URLService defines the interface for URL-related operations.
 type URLService interface {
-	CreateShortURL(ctx context.Context, originalURL string) (types.URLData, error)
+	CreateShortURL(ctx context.Context, originalURL string, opts CreateOptions) (types.URLData, error)
+	CreateShortURLWithAlias(ctx context.Context, originalURL, alias string) (types.URLData, error)
 	GetURLData(ctx context.Context, shortURL string) (types.URLData, error)
-	UpdateURL(ctx context.Context, shortURL, newURL string) error
+	GetByExternalID(ctx context.Context, externalID string) (types.URLData, error)
+	UpdateURL(ctx context.Context, shortURL, newURL string) (types.URLData, error)
+	UpdateURLIfUnmodified(ctx context.Context, shortURL, newURL string, updatedAt time.Time) (types.URLData, error)
+	PatchURL(ctx context.Context, shortURL string, patch URLPatch) (types.URLData, error)
 	DeleteURL(ctx context.Context, shortURL string) error
+	ListByTag(ctx context.Context, tag string) ([]types.URLData, error)
+	List(ctx context.Context, page, pageSize int) ([]types.URLData, int, error)
+	// ForEach calls fn with every stored URL, in no particular order, stopping at the first error fn returns.
+	ForEach(ctx context.Context, fn func(types.URLData) error) error
+	// ReplaceAll atomically replaces every stored URL with the given ones, keyed by short URL.
+	ReplaceAll(ctx context.Context, urls map[string]string) error
+	// TopN returns the n most accessed unexpired URLs, most accessed first.
+	TopN(ctx context.Context, n int) ([]types.URLData, error)
+	RecordAccess(ctx context.Context, shortURL string) error
+	BatchCreate(ctx context.Context, urls []string) ([]types.URLData, []error)
+	BatchDelete(ctx context.Context, codes []string) map[string]error
+	BatchGet(ctx context.Context, codes []string) (map[string]types.URLData, map[string]error)
+	// Ping checks that the storage backing the service is usable.
+	Ping(ctx context.Context) error
+	// RestoreURL brings back a short URL deleted while soft deletes are enabled.
+	RestoreURL(ctx context.Context, shortURL string) (types.URLData, error)
+	// StorageStats returns the usage of the storage backing the service, failing with
+	// ErrStatsUnsupported when it doesn't report it.
+	StorageStats(ctx context.Context) (types.StorageStats, error)
+}
+
+// Generator produces candidate short URLs for CreateShortURL.
+type Generator interface {
+	Generate() (string, error)
+}
+
+// generatorFunc adapts a plain function to the Generator interface.
+type generatorFunc func() (string, error)
+
+func (f generatorFunc) Generate() (string, error) {
+	return f()
 }
 
 // urlService implements the URLService interface.
 type urlService struct {
-	store storage.Storage
+	store          storage.Storage
+	shortURLLength int
+	charset        string
+	canonicalDedup bool             // Deduplicate on urlutil.Canonicalize instead of the exact URL
+	now            func() time.Time // Clock used for expiration, overridable in tests
+	generator      Generator        // Produces candidate short URLs
+	maxAttempts    int              // Short URLs generated per create before surfacing a collision
+	logger         *zap.Logger      // Receives generation attempt diagnostics
+	logAttempt     bool             // Log the generation attempts of every create at debug level
+	softDelete     bool             // Mark deleted URLs instead of removing them, when the storage supports it
+	reserved       map[string]bool  // Lowercased words never used as short URLs
+	notifier       EventNotifier    // Told about created, updated and deleted URLs, if set
+}
+
+// Option configures optional behaviour of the URL service.
+type Option func(*urlService)
+
+// WithShortURLFormat makes the service generate short URLs of the given length from the given alphabet.
+// The alphabet also restricts the characters allowed in aliases.
+func WithShortURLFormat(length int, charset string) Option {
+	return func(s *urlService) {
+		s.shortURLLength = length
+		s.charset = charset
+	}
+}
+
+// WithGenerator makes the service obtain short URLs from gen instead of generating them in the
+// format set by WithShortURLFormat. Aliases are still validated against the configured charset.
+func WithGenerator(gen Generator) Option {
+	return func(s *urlService) {
+		s.generator = gen
+	}
+}
+
+// WithGenerationAttempts makes CreateShortURL generate up to n short URLs when generated ones
+// collide with stored ones, before returning ErrShortURLExists. Values below 1 are treated as 1.
+func WithGenerationAttempts(n int) Option {
+	return func(s *urlService) {
+		s.maxAttempts = max(n, 1)
+	}
+}
+
+// WithCanonicalDedup makes the service treat equivalent URLs, such as ones differing only in host case,
+// default port or query parameter order, as duplicates. The URL is still stored exactly as first submitted.
+func WithCanonicalDedup() Option {
+	return func(s *urlService) {
+		s.canonicalDedup = true
+	}
+}
+
+// WithAttemptLogging makes the service log, at debug level, how many short URLs were generated
+// for each create, the final short URL and why each earlier attempt was discarded.
+func WithAttemptLogging(logger *zap.Logger) Option {
+	return func(s *urlService) {
+		s.logger = logger
+		s.logAttempt = true
+	}
+}
+
+// WithSoftDelete makes DeleteURL mark short URLs as deleted instead of removing them, so that
+// RestoreURL can bring them back. Soft-deleted URLs are otherwise treated as not found. It only
+// takes effect when the storage implements storage.SoftDeleter.
+func WithSoftDelete() Option {
+	return func(s *urlService) {
+		s.softDelete = true
+	}
+}
+
+// WithReservedWords makes the service never generate, nor accept as an alias, any of words as a
+// short URL either, matched case-insensitively. DefaultReservedWords stay reserved.
+func WithReservedWords(words []string) Option {
+	return func(s *urlService) {
+		for word := range reservedSet(words) {
+			s.reserved[word] = true
+		}
+	}
+}
+
+// WithEventNotifier makes the service notify n of every short URL it creates, updates or deletes.
+// Creates returning an already shortened URL and failed changes are not notified.
+func WithEventNotifier(n EventNotifier) Option {
+	return func(s *urlService) {
+		s.notifier = n
+	}
+}
+
+// reservedSet returns words lowercased as a set.
+func reservedSet(words []string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[strings.ToLower(word)] = true
+	}
+	return set
 }
 
 // NewURLService creates a new instance of URLService.
-func NewURLService(store storage.Storage) URLService {
-	return &urlService{store: store}
+func NewURLService(store storage.Storage, opts ...Option) URLService {
+	s := &urlService{
+		store:          store,
+		shortURLLength: urlgen.DefaultLength,
+		charset:        urlgen.DefaultCharset,
+		now:            time.Now,
+		maxAttempts:    DefaultGenerationAttempts,
+		logger:         zap.NewNop(),
+		reserved:       reservedSet(DefaultReservedWords),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.generator == nil {
+		s.generator = newFormatGenerator(s.shortURLLength, s.charset)
+	}
+	return s
+}
+
+// newFormatGenerator returns a urlgen.Generator for the given format. An invalid format yields
+// a Generator that fails every generation with the reason, surfacing it on the first create.
+func newFormatGenerator(length int, charset string) Generator {
+	generator, err := urlgen.NewGenerator(length, charset)
+	if err != nil {
+		return generatorFunc(func() (string, error) { return "", err })
+	}
+	return generator
 }
 
 // CreateShortURL generates a new short URL for the given original URL.
-// If the original URL already exists, it returns the existing short URL.
-func (s *urlService) CreateShortURL(ctx context.Context, originalURL string) (types.URLData, error) {
-	// Check if the original URL already exists
-	existingShortURL, err := s.store.GetShortURL(ctx, originalURL)
-	if err == nil {
-		// URL already exists, retrieve its data
-		urlData, err := s.store.GetURLData(ctx, existingShortURL)
+// If the original URL already exists and hasn't expired, it returns the existing short URL,
+// unless opts carries an external ID, and ErrExternalIDExists if that ID is taken. With an alias in opts, the alias is stored as the short URL regardless of existing entries
+// for the original URL, and ErrAliasTaken is returned if it is already in use.
+func (s *urlService) CreateShortURL(ctx context.Context, originalURL string, opts CreateOptions) (types.URLData, error) {
+	if opts.Alias != "" {
+		return s.createWithAlias(ctx, originalURL, opts)
+	}
+
+	timings := createTimingsFrom(ctx)
+
+	// Create new URLData
+	now := s.now()
+	keyStart := time.Now()
+	dedupKey := s.dedupKey(originalURL)
+	timings.DedupKey += time.Since(keyStart)
+	urlData := types.URLData{
+		OriginalURL: originalURL,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Tags:        opts.Tags,
+		DedupKey:    dedupKey,
+		ExternalID:  opts.ExternalID,
+	}
+	if opts.TTL > 0 {
+		urlData.ExpiresAt = now.Add(opts.TTL)
+	}
+
+	// Generate short URLs until one can be stored, regenerating on collisions and reserved words. The
+	// storage returns the existing short URL instead if the original URL is already stored, atomically,
+	// so that concurrent requests for a new original URL never create it twice. A URL with an external
+	// ID identifies a record of the client's, so it skips the lookup and is always created.
+	var retryReasons []string
+	var err error
+	skipLookup := opts.ExternalID != ""
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		urlData.ShortURL, err = s.generator.Generate()
+		timings.Generation += time.Since(start)
 		if err != nil {
-			return types.URLData{}, handleStorageError(err)
+			return types.URLData{}, err
+		}
+		if s.isReserved(urlData.ShortURL) {
+			// Treated like a collision, as the route of the same path already takes the short URL
+			err = storage.ErrShortURLExists
+			if attempt < s.maxAttempts {
+				retryReasons = append(retryReasons, retryReasonReserved)
+				continue
+			}
+			s.logAttempts(urlData.ShortURL, attempt, retryReasons, err)
+			break
+		}
+
+		start = time.Now()
+		if skipLookup {
+			err = s.store.Create(ctx, urlData)
+		} else {
+			// The storage skips expired and deleted entries, which no longer resolve
+			var existing types.URLData
+			var created bool
+			existing, created, err = s.store.GetOrCreate(ctx, urlData)
+			if err == nil && !created {
+				timings.StorageWrite += time.Since(start)
+				return existing, ErrShortURLExists
+			}
 		}
-		return urlData, ErrShortURLExists
+		timings.StorageWrite += time.Since(start)
+		if errors.Is(err, storage.ErrShortURLExists) && attempt < s.maxAttempts {
+			retryReasons = append(retryReasons, retryReasonCollision)
+			continue
+		}
+		s.logAttempts(urlData.ShortURL, attempt, retryReasons, err)
+		break
 	}
-	if !errors.Is(err, storage.ErrShortURLNotFound) {
+	if err != nil {
+		if errors.Is(err, storage.ErrStorageCapacityReached) {
+			return types.URLData{}, s.storageFullError(ctx)
+		}
 		return types.URLData{}, handleStorageError(err)
 	}
 
-	// Generate new short URL
-	shortURL, err := urlgen.Generate()
-	if err != nil {
+	s.notify(ctx, EventCreated, urlData)
+	return urlData, nil
+}
+
+// BatchCreate creates a short URL for each of urls, returning results and errors aligned with
+// the input. Each error is what CreateShortURL would return for that URL, and URLs repeated
+// within the batch are created once and then reported as ErrShortURLExists. Once the storage
+// is full or ctx is done, the remaining URLs are not attempted and carry that same error.
+func (s *urlService) BatchCreate(ctx context.Context, urls []string) ([]types.URLData, []error) {
+	results := make([]types.URLData, len(urls))
+	errs := make([]error, len(urls))
+	seen := make(map[string]int, len(urls)) // Lookup key -> index of its first occurrence
+
+	for i, originalURL := range urls {
+		if err := ctx.Err(); err != nil {
+			fillErrors(errs[i:], err)
+			break
+		}
+
+		key := originalURL
+		if dedupKey := s.dedupKey(originalURL); dedupKey != "" {
+			key = dedupKey
+		}
+		if first, ok := seen[key]; ok && (errs[first] == nil || errors.Is(errs[first], ErrShortURLExists)) {
+			results[i], errs[i] = results[first], ErrShortURLExists
+			continue
+		}
+
+		results[i], errs[i] = s.CreateShortURL(ctx, originalURL, CreateOptions{})
+		if errors.Is(errs[i], ErrStorageCapacityReached) {
+			fillErrors(errs[i+1:], errs[i])
+			break
+		}
+		seen[key] = i
+	}
+	return results, errs
+}
+
+// BatchDelete deletes each of the short URLs in codes, returning what DeleteURL returned for each
+// of them, keyed by short URL. A short URL repeated within the batch is only deleted once. Once ctx
+// is done, the remaining short URLs are not attempted and carry its error.
+func (s *urlService) BatchDelete(ctx context.Context, codes []string) map[string]error {
+	results := make(map[string]error, len(codes))
+	for _, code := range codes {
+		if _, ok := results[code]; ok {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			results[code] = err
+			continue
+		}
+		results[code] = s.DeleteURL(ctx, code)
+	}
+	return results
+}
+
+// BatchGet looks up each of the short URLs in codes with GetURLData, returning the URL data of those
+// found and the error of the others, each keyed by short URL. Once ctx is done, the remaining short
+// URLs are not looked up and carry its error.
+func (s *urlService) BatchGet(ctx context.Context, codes []string) (map[string]types.URLData, map[string]error) {
+	found := make(map[string]types.URLData, len(codes))
+	errs := make(map[string]error)
+	for _, code := range codes {
+		if _, ok := found[code]; ok {
+			continue
+		}
+		if _, ok := errs[code]; ok {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			errs[code] = err
+			continue
+		}
+		urlData, err := s.GetURLData(ctx, code)
+		if err != nil {
+			errs[code] = err
+			continue
+		}
+		found[code] = urlData
+	}
+	return found, errs
+}
+
+// fillErrors sets every element of errs to err.
+func fillErrors(errs []error, err error) {
+	for i := range errs {
+		errs[i] = err
+	}
+}
+
+// CreateShortURLWithAlias stores originalURL under the given alias.
+// It is shorthand for CreateShortURL with only CreateOptions.Alias set.
+func (s *urlService) CreateShortURLWithAlias(ctx context.Context, originalURL, alias string) (types.URLData, error) {
+	return s.CreateShortURL(ctx, originalURL, CreateOptions{Alias: alias})
+}
+
+// createWithAlias stores originalURL under opts.Alias after validating it.
+func (s *urlService) createWithAlias(ctx context.Context, originalURL string, opts CreateOptions) (types.URLData, error) {
+	validate := s.validateAlias
+	if opts.Imported {
+		validate = ValidateImportedShortURL
+	}
+	if err := validate(opts.Alias); err != nil {
 		return types.URLData{}, err
 	}
 
-	// Create new URLData
-	now := time.Now()
+	timings := createTimingsFrom(ctx)
+
+	now := s.now()
+	keyStart := time.Now()
+	dedupKey := s.dedupKey(originalURL)
+	timings.DedupKey += time.Since(keyStart)
 	urlData := types.URLData{
-		ShortURL:    shortURL,
+		ShortURL:    opts.Alias,
 		OriginalURL: originalURL,
 		CreatedAt:   now,
 		UpdatedAt:   now,
+		Tags:        opts.Tags,
+		DedupKey:    dedupKey,
+		ExternalID:  opts.ExternalID,
+	}
+	if opts.TTL > 0 {
+		urlData.ExpiresAt = now.Add(opts.TTL)
 	}
 
-	// Store the new URLData
-	err = s.store.Create(ctx, urlData)
-	if err != nil {
+	start := time.Now()
+	err := s.store.Create(ctx, urlData)
+	timings.StorageWrite += time.Since(start)
+	switch {
+	case err == nil:
+		s.notify(ctx, EventCreated, urlData)
+		return urlData, nil
+	case errors.Is(err, storage.ErrShortURLExists):
+		return types.URLData{}, ErrAliasTaken
+	case errors.Is(err, storage.ErrStorageCapacityReached):
+		return types.URLData{}, s.storageFullError(ctx)
+	default:
 		return types.URLData{}, handleStorageError(err)
 	}
+}
 
-	return urlData, nil
+// validateAlias returns ErrInvalidAlias unless alias is within the length bounds,
+// only uses characters from the service's charset and isn't reserved.
+func (s *urlService) validateAlias(alias string) error {
+	if len(alias) < MinAliasLength || len(alias) > MaxAliasLength || s.isReserved(alias) {
+		return ErrInvalidAlias
+	}
+	for _, char := range alias {
+		if !strings.ContainsRune(s.charset, char) {
+			return ErrInvalidAlias
+		}
+	}
+	return nil
+}
+
+// ValidateImportedShortURL returns ErrInvalidAlias unless shortURL is a path segment the redirect
+// route can serve: neither "." nor "..", which HTTP clients and servers clean away, without a
+// slash, and none of DefaultReservedWords, whose routes take precedence. Words added with
+// WithReservedWords are left to the operator, as existing short URLs may predate them.
+func ValidateImportedShortURL(shortURL string) error {
+	if shortURL == "." || shortURL == ".." || strings.Contains(shortURL, "/") {
+		return ErrInvalidAlias
+	}
+	if slices.ContainsFunc(DefaultReservedWords, func(word string) bool { return strings.EqualFold(word, shortURL) }) {
+		return ErrInvalidAlias
+	}
+	return nil
+}
+
+// isReserved reports whether shortURL is one of the service's reserved words.
+func (s *urlService) isReserved(shortURL string) bool {
+	return s.reserved[strings.ToLower(shortURL)]
+}
+
+// logAttempts records the generation attempts of a create when attempt logging is enabled.
+// err is the result of the final attempt.
+func (s *urlService) logAttempts(shortURL string, attempts int, retryReasons []string, err error) {
+	if !s.logAttempt {
+		return
+	}
+	fields := []zap.Field{
+		zap.String("shortURL", shortURL),
+		zap.Int("attempts", attempts),
+		zap.Strings("retryReasons", retryReasons),
+	}
+	if err != nil {
+		s.logger.Debug("Short URL generation failed", append(fields, zap.Error(err))...)
+		return
+	}
+	s.logger.Debug("Short URL generated", fields...)
+}
+
+// dedupKey returns the key used to detect duplicates of originalURL, or an empty string
+// when the URL itself is the key. URLs that cannot be canonicalized fall back to the URL itself.
+func (s *urlService) dedupKey(originalURL string) string {
+	if !s.canonicalDedup {
+		return ""
+	}
+	canonical, err := urlutil.Canonicalize(originalURL)
+	if err != nil || canonical == originalURL {
+		return ""
+	}
+	return canonical
+}
+
+// storageFullError returns a StorageFullError carrying the current usage when the
+// backend can report it, and ErrStorageCapacityReached otherwise.
+func (s *urlService) storageFullError(ctx context.Context) error {
+	reporter, ok := s.store.(storage.UsageReporter)
+	if !ok {
+		return ErrStorageCapacityReached
+	}
+	count, capacity, err := reporter.Usage(ctx)
+	if err != nil {
+		return ErrStorageCapacityReached
+	}
+	return &StorageFullError{Count: count, Capacity: capacity}
 }
 
 // GetURLData retrieves the URL data for a given short URL.
+// It returns ErrShortURLExpired once the URL's expiration time has been reached.
 func (s *urlService) GetURLData(ctx context.Context, shortURL string) (types.URLData, error) {
-	urlData, err := s.store.GetURLData(ctx, shortURL)
+	urlData, err := s.getStored(ctx, shortURL)
+	if err != nil {
+		return types.URLData{}, err
+	}
+	if urlData.Expired(s.now()) {
+		return types.URLData{}, ErrShortURLExpired
+	}
+	return urlData, nil
+}
+
+// GetByExternalID retrieves the URL data stored with the given external ID.
+// Like GetURLData, it returns ErrShortURLExpired once the URL's expiration time has been reached.
+func (s *urlService) GetByExternalID(ctx context.Context, externalID string) (types.URLData, error) {
+	urlData, err := s.store.GetByExternalID(ctx, externalID)
 	if err != nil {
 		return types.URLData{}, handleStorageError(err)
 	}
+	if urlData.Deleted() {
+		return types.URLData{}, ErrShortURLNotFound
+	}
+	if urlData.Expired(s.now()) {
+		return types.URLData{}, ErrShortURLExpired
+	}
 	return urlData, nil
 }
 
-// UpdateURL updates the original URL for a given short URL.
-func (s *urlService) UpdateURL(ctx context.Context, shortURL, newURL string) error {
-	urlData, err := s.store.GetURLData(ctx, shortURL)
+// UpdateURL updates the original URL for a given short URL and returns the URL data as stored.
+func (s *urlService) UpdateURL(ctx context.Context, shortURL, newURL string) (types.URLData, error) {
+	urlData, err := s.getStored(ctx, shortURL)
 	if err != nil {
-		return handleStorageError(err)
+		return types.URLData{}, err
 	}
 
 	urlData.OriginalURL = newURL
-	urlData.UpdatedAt = time.Now()
-	err = s.store.Update(ctx, urlData)
+	urlData.DedupKey = s.dedupKey(newURL)
+	urlData.UpdatedAt = s.now()
+	updated, err := s.store.Update(ctx, urlData)
 	if err != nil {
-		return handleStorageError(err)
+		return types.URLData{}, handleStorageError(err)
 	}
-	return nil
+	s.notify(ctx, EventUpdated, updated)
+	return updated, nil
+}
+
+// UpdateURLIfUnmodified is UpdateURL, provided the short URL was last updated at updatedAt. It
+// returns ErrVersionMismatch otherwise, including when another update wins a race with this one.
+func (s *urlService) UpdateURLIfUnmodified(ctx context.Context, shortURL, newURL string, updatedAt time.Time) (types.URLData, error) {
+	urlData, err := s.getStored(ctx, shortURL)
+	if err != nil {
+		return types.URLData{}, err
+	}
+	if !urlData.UpdatedAt.Equal(updatedAt) {
+		return types.URLData{}, ErrVersionMismatch
+	}
+
+	urlData.OriginalURL = newURL
+	urlData.DedupKey = s.dedupKey(newURL)
+	updated, err := s.store.CompareAndUpdate(ctx, urlData, updatedAt)
+	if err != nil {
+		return types.URLData{}, handleStorageError(err)
+	}
+	s.notify(ctx, EventUpdated, updated)
+	return updated, nil
 }
 
-// DeleteURL removes a URL entry from the storage.
+// patchAttempts is the number of times PatchURL applies a patch before giving up on short URLs
+// that keep being updated concurrently.
+const patchAttempts = 3
+
+// PatchURL applies patch to the given short URL and returns the URL data as stored. A new alias is
+// stored along with the other changes in a single write, and ErrAliasTaken is returned if it is
+// already in use. The write only succeeds if the short URL hasn't been updated since it was read,
+// and the patch is applied again to the latest version otherwise, returning ErrVersionMismatch
+// once patchAttempts attempts have lost such a race.
+func (s *urlService) PatchURL(ctx context.Context, shortURL string, patch URLPatch) (types.URLData, error) {
+	renamed := patch.Alias != nil && *patch.Alias != shortURL
+	if renamed {
+		if err := s.validateAlias(*patch.Alias); err != nil {
+			return types.URLData{}, err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		urlData, err := s.getStored(ctx, shortURL)
+		if err != nil {
+			return types.URLData{}, err
+		}
+		if !renamed && patch.URL == nil && patch.TTL == nil {
+			return urlData, nil
+		}
+
+		version := urlData.UpdatedAt
+		now := s.now()
+		if patch.URL != nil {
+			urlData.OriginalURL = *patch.URL
+			urlData.DedupKey = s.dedupKey(*patch.URL)
+		}
+		if patch.TTL != nil {
+			urlData.ExpiresAt = now.Add(*patch.TTL)
+		}
+		urlData.UpdatedAt = now
+
+		var updated types.URLData
+		if renamed {
+			urlData.ShortURL = *patch.Alias
+			updated, err = s.store.Rename(ctx, shortURL, urlData, version)
+		} else {
+			updated, err = s.store.CompareAndUpdate(ctx, urlData, version)
+		}
+		switch {
+		case err == nil:
+			s.notify(ctx, EventUpdated, updated)
+			return updated, nil
+		case errors.Is(err, storage.ErrVersionMismatch) && attempt < patchAttempts:
+			continue
+		case renamed && errors.Is(err, storage.ErrShortURLExists):
+			return types.URLData{}, ErrAliasTaken
+		default:
+			return types.URLData{}, handleStorageError(err)
+		}
+	}
+}
+
+// DeleteURL removes a URL entry from the storage. With soft deletes, the entry is only marked as
+// deleted, and deleting it again returns ErrShortURLNotFound.
 func (s *urlService) DeleteURL(ctx context.Context, shortURL string) error {
+	if deleter, ok := s.softDeleter(); ok {
+		urlData, err := s.getStored(ctx, shortURL)
+		if err != nil {
+			return err
+		}
+		if _, err := deleter.MarkDeleted(ctx, shortURL, s.now()); err != nil {
+			return handleStorageError(err)
+		}
+		s.notify(ctx, EventDeleted, urlData)
+		return nil
+	}
+
+	var urlData types.URLData
+	if s.notifier != nil {
+		// The event carries the destination, which can't be read once deleted
+		var err error
+		if urlData, err = s.store.GetURLData(ctx, shortURL); err != nil {
+			return handleStorageError(err)
+		}
+	}
 	err := s.store.Delete(ctx, shortURL)
 	if err != nil {
 		return handleStorageError(err)
 	}
+	s.notify(ctx, EventDeleted, urlData)
+	return nil
+}
+
+// RestoreURL clears the deletion mark of a soft-deleted short URL and returns its URL data. It
+// returns ErrShortURLNotFound if the short URL doesn't exist or isn't deleted, and
+// ErrSoftDeleteDisabled unless soft deletes are enabled.
+func (s *urlService) RestoreURL(ctx context.Context, shortURL string) (types.URLData, error) {
+	deleter, ok := s.softDeleter()
+	if !ok {
+		return types.URLData{}, ErrSoftDeleteDisabled
+	}
+	urlData, err := s.store.GetURLData(ctx, shortURL)
+	if err != nil {
+		return types.URLData{}, handleStorageError(err)
+	}
+	if !urlData.Deleted() {
+		return types.URLData{}, ErrShortURLNotFound
+	}
+	restored, err := deleter.MarkDeleted(ctx, shortURL, time.Time{})
+	if err != nil {
+		return types.URLData{}, handleStorageError(err)
+	}
+	return restored, nil
+}
+
+// notify tells the notifier, if any, about the change of the given kind to urlData.
+func (s *urlService) notify(ctx context.Context, kind string, urlData types.URLData) {
+	if s.notifier != nil {
+		s.notifier.Notify(ctx, newEvent(kind, urlData, s.now()))
+	}
+}
+
+// softDeleter returns the storage as a storage.SoftDeleter when soft deletes are enabled and
+// supported by it.
+func (s *urlService) softDeleter() (storage.SoftDeleter, bool) {
+	if !s.softDelete {
+		return nil, false
+	}
+	deleter, ok := s.store.(storage.SoftDeleter)
+	return deleter, ok
+}
+
+// getStored reads the URL data of shortURL from the storage, reporting soft-deleted URLs as
+// ErrShortURLNotFound. Unlike GetURLData, it returns expired URLs.
+func (s *urlService) getStored(ctx context.Context, shortURL string) (types.URLData, error) {
+	urlData, err := s.store.GetURLData(ctx, shortURL)
+	if err != nil {
+		return types.URLData{}, handleStorageError(err)
+	}
+	if urlData.Deleted() {
+		return types.URLData{}, ErrShortURLNotFound
+	}
+	return urlData, nil
+}
+
+// List returns the given 1-based page of URLs, oldest first, along with the total number of stored URLs.
+// Expired and soft-deleted URLs awaiting cleanup are included so that page boundaries stay consistent
+// with the total.
+func (s *urlService) List(ctx context.Context, page, pageSize int) ([]types.URLData, int, error) {
+	if page < 1 || pageSize < 1 {
+		return nil, 0, storage.ErrInvalidPagination
+	}
+	items, total, err := s.store.List(ctx, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, 0, handleStorageError(err)
+	}
+	return items, total, nil
+}
+
+// ForEach calls fn with every stored URL, in no particular order, in a single pass over the
+// storage, so that callers walking the whole dataset don't pay for a List per page. Errors returned
+// by fn are returned as is.
+func (s *urlService) ForEach(ctx context.Context, fn func(types.URLData) error) error {
+	var fnErr error
+	err := s.store.ForEach(ctx, func(urlData types.URLData) error {
+		fnErr = fn(urlData)
+		return fnErr
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	if err != nil {
+		return handleStorageError(err)
+	}
+	return nil
+}
+
+// ReplaceAll atomically replaces every stored URL with the original URLs of urls, keyed by their
+// short URLs, which are kept as imported short URLs are: see ValidateImportedShortURL. The new URLs
+// are created now, and the current ones are dropped along with their access counts. Nothing is
+// stored unless every short URL is valid, and no events are sent.
+func (s *urlService) ReplaceAll(ctx context.Context, urls map[string]string) error {
+	now := s.now()
+	items := make([]types.URLData, 0, len(urls))
+	for shortURL, originalURL := range urls {
+		if err := ValidateImportedShortURL(shortURL); err != nil {
+			return err
+		}
+		items = append(items, types.URLData{
+			ShortURL:    shortURL,
+			OriginalURL: originalURL,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+			DedupKey:    s.dedupKey(originalURL),
+		})
+	}
+	if err := s.store.ReplaceAll(ctx, items); err != nil {
+		return handleStorageError(err)
+	}
 	return nil
 }
+
+// RecordAccess counts a successful redirect through the given short URL.
+func (s *urlService) RecordAccess(ctx context.Context, shortURL string) error {
+	if err := s.store.IncrementAccess(ctx, shortURL); err != nil {
+		return handleStorageError(err)
+	}
+	return nil
+}
+
+// Ping checks that the storage is usable, returning its error unchanged so that the cause of an
+// outage can be logged.
+func (s *urlService) Ping(ctx context.Context) error {
+	return s.store.Ping(ctx)
+}
+
+// StorageStats returns the usage of the storage when it implements storage.UsageReporter.
+func (s *urlService) StorageStats(ctx context.Context) (types.StorageStats, error) {
+	reporter, ok := s.store.(storage.UsageReporter)
+	if !ok {
+		return types.StorageStats{}, ErrStatsUnsupported
+	}
+	count, capacity, err := reporter.Usage(ctx)
+	if err != nil {
+		return types.StorageStats{}, ErrStatsUnsupported
+	}
+	return types.StorageStats{Count: count, Capacity: capacity}, nil
+}
+
+// TopN returns the n most accessed URLs, most accessed first, leaving out expired and soft-deleted ones.
+func (s *urlService) TopN(ctx context.Context, n int) ([]types.URLData, error) {
+	if n < 1 {
+		return nil, storage.ErrInvalidPagination
+	}
+	items, err := s.store.TopN(ctx, n)
+	if err != nil {
+		return nil, handleStorageError(err)
+	}
+	return items, nil
+}
+
+// ListByTag returns the unexpired URLs carrying the given tag, leaving out soft-deleted ones.
+func (s *urlService) ListByTag(ctx context.Context, tag string) ([]types.URLData, error) {
+	items, err := s.store.ListByTag(ctx, tag)
+	if err != nil {
+		return nil, handleStorageError(err)
+	}
+
+	now := s.now()
+	active := items[:0]
+	for _, urlData := range items {
+		if !urlData.Expired(now) && !urlData.Deleted() {
+			active = append(active, urlData)
+		}
+	}
+	return active, nil
+}
@@ -2,13 +2,22 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"go-url-shortening/storage"
 	"go-url-shortening/storage/mocks"
 	"go-url-shortening/types"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestCreateShortURL(t *testing.T) {
@@ -19,10 +28,9 @@ func TestCreateShortURL(t *testing.T) {
 	originalURL := "https://example.com"
 
 	t.Run("Success", func(t *testing.T) {
-		mockStorage.On("GetShortURL", ctx, originalURL).Return("", storage.ErrShortURLNotFound).Once()
-		mockStorage.On("Create", ctx, mock.AnythingOfType("types.URLData")).Return(nil).Once()
+		mockStorage.On("GetOrCreate", ctx, mock.AnythingOfType("types.URLData")).Return(types.URLData{}, true, nil).Once()
 
-		urlData, err := service.CreateShortURL(ctx, originalURL)
+		urlData, err := service.CreateShortURL(ctx, originalURL, CreateOptions{})
 
 		assert.NoError(t, err)
 		assert.NotEmpty(t, urlData.ShortURL)
@@ -35,25 +43,170 @@ func TestCreateShortURL(t *testing.T) {
 	t.Run("ShortURLExists", func(t *testing.T) {
 		existingShortURL := "abc123"
 
-		mockStorage.On("GetShortURL", ctx, originalURL).Return(existingShortURL, storage.ErrShortURLExists).Once()
+		mockStorage.On("GetOrCreate", ctx, mock.AnythingOfType("types.URLData")).
+			Return(types.URLData{ShortURL: existingShortURL, OriginalURL: originalURL}, false, nil).Once()
 
-		_, err := service.CreateShortURL(ctx, originalURL)
+		urlData, err := service.CreateShortURL(ctx, originalURL, CreateOptions{})
 
 		assert.Equal(t, ErrShortURLExists, err)
+		assert.Equal(t, existingShortURL, urlData.ShortURL)
 		mockStorage.AssertExpectations(t)
 	})
 
 	t.Run("StorageCapacityReached", func(t *testing.T) {
-		mockStorage.On("GetShortURL", ctx, originalURL).Return("", storage.ErrShortURLNotFound).Once()
-		mockStorage.On("Create", ctx, mock.AnythingOfType("types.URLData")).Return(storage.ErrStorageCapacityReached).Once()
+		mockStorage.On("GetOrCreate", ctx, mock.AnythingOfType("types.URLData")).Return(types.URLData{}, false, storage.ErrStorageCapacityReached).Once()
 
-		_, err := service.CreateShortURL(ctx, originalURL)
+		_, err := service.CreateShortURL(ctx, originalURL, CreateOptions{})
 
 		assert.Equal(t, ErrStorageCapacityReached, err)
 		mockStorage.AssertExpectations(t)
 	})
 }
 
+func TestCreateShortURLStorageFullDetails(t *testing.T) {
+	ctx := context.Background()
+	service := NewURLService(storage.NewInMemoryStorage(1, zap.NewNop()))
+
+	_, err := service.CreateShortURL(ctx, "https://example.com/1", CreateOptions{})
+	require.NoError(t, err)
+
+	_, err = service.CreateShortURL(ctx, "https://example.com/2", CreateOptions{})
+	assert.ErrorIs(t, err, ErrStorageCapacityReached)
+
+	var fullErr *StorageFullError
+	require.ErrorAs(t, err, &fullErr)
+	assert.Equal(t, 1, fullErr.Count)
+	assert.Equal(t, 1, fullErr.Capacity)
+}
+
+func TestStorageStats(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Reported by the in-memory storage", func(t *testing.T) {
+		service := NewURLService(storage.NewTracedStorage(storage.NewInMemoryStorage(10, zap.NewNop())))
+		_, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+		require.NoError(t, err)
+
+		stats, err := service.StorageStats(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, types.StorageStats{Count: 1, Capacity: 10}, stats)
+	})
+
+	t.Run("Unsupported by other backends", func(t *testing.T) {
+		service := NewURLService(new(mocks.MockStorage))
+
+		_, err := service.StorageStats(ctx)
+		assert.Equal(t, ErrStatsUnsupported, err)
+	})
+}
+
+func TestBatchCreate(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Dedups within the batch and against storage", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()))
+		existing, err := service.CreateShortURL(ctx, "https://existing.com", CreateOptions{})
+		require.NoError(t, err)
+
+		results, errs := service.BatchCreate(ctx, []string{"https://a.com", "https://existing.com", "https://b.com", "https://a.com"})
+		require.Len(t, results, 4)
+		require.Len(t, errs, 4)
+
+		assert.NoError(t, errs[0])
+		assert.Equal(t, ErrShortURLExists, errs[1])
+		assert.Equal(t, existing.ShortURL, results[1].ShortURL)
+		assert.NoError(t, errs[2])
+		assert.Equal(t, ErrShortURLExists, errs[3])
+		assert.Equal(t, results[0].ShortURL, results[3].ShortURL, "Repeated URLs should share one short URL")
+		assert.NotEqual(t, results[0].ShortURL, results[2].ShortURL)
+	})
+
+	t.Run("Stops once the storage is full", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(2, zap.NewNop()))
+
+		results, errs := service.BatchCreate(ctx, []string{"https://a.com", "https://b.com", "https://c.com", "https://d.com"})
+		assert.NoError(t, errs[0])
+		assert.NoError(t, errs[1])
+		assert.ErrorIs(t, errs[2], ErrStorageCapacityReached)
+		assert.ErrorIs(t, errs[3], ErrStorageCapacityReached)
+		assert.Empty(t, results[3].ShortURL)
+	})
+
+	t.Run("Cancelled context", func(t *testing.T) {
+		mockStorage := new(mocks.MockStorage)
+		service := NewURLService(mockStorage)
+		cancelCtx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, errs := service.BatchCreate(cancelCtx, []string{"https://a.com", "https://b.com"})
+		assert.Equal(t, []error{context.Canceled, context.Canceled}, errs)
+		mockStorage.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+}
+
+func TestBatchDelete(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Mixes existing and missing short URLs", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()))
+		first, err := service.CreateShortURL(ctx, "https://a.com", CreateOptions{})
+		require.NoError(t, err)
+		second, err := service.CreateShortURL(ctx, "https://b.com", CreateOptions{})
+		require.NoError(t, err)
+
+		results := service.BatchDelete(ctx, []string{first.ShortURL, "missing", second.ShortURL, first.ShortURL})
+		assert.Equal(t, map[string]error{
+			first.ShortURL:  nil,
+			"missing":       ErrShortURLNotFound,
+			second.ShortURL: nil,
+		}, results, "A repeated short URL should be reported as deleted once")
+
+		_, err = service.GetURLData(ctx, first.ShortURL)
+		assert.Equal(t, ErrShortURLNotFound, err)
+		_, err = service.GetURLData(ctx, second.ShortURL)
+		assert.Equal(t, ErrShortURLNotFound, err)
+	})
+
+	t.Run("Cancelled context", func(t *testing.T) {
+		mockStorage := new(mocks.MockStorage)
+		service := NewURLService(mockStorage)
+		cancelCtx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		results := service.BatchDelete(cancelCtx, []string{"abc123", "def456"})
+		assert.Equal(t, map[string]error{"abc123": context.Canceled, "def456": context.Canceled}, results)
+		mockStorage.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	})
+}
+
+func TestBatchGet(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Mixes existing and missing short URLs", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()))
+		first, err := service.CreateShortURL(ctx, "https://a.com", CreateOptions{})
+		require.NoError(t, err)
+		first, err = service.GetURLData(ctx, first.ShortURL)
+		require.NoError(t, err)
+
+		found, errs := service.BatchGet(ctx, []string{first.ShortURL, "missing", first.ShortURL, "missing"})
+		assert.Equal(t, map[string]types.URLData{first.ShortURL: first}, found)
+		assert.Equal(t, map[string]error{"missing": ErrShortURLNotFound}, errs)
+	})
+
+	t.Run("Cancelled context", func(t *testing.T) {
+		mockStorage := new(mocks.MockStorage)
+		service := NewURLService(mockStorage)
+		cancelCtx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		found, errs := service.BatchGet(cancelCtx, []string{"abc123", "def456"})
+		assert.Empty(t, found)
+		assert.Equal(t, map[string]error{"abc123": context.Canceled, "def456": context.Canceled}, errs)
+		mockStorage.AssertNotCalled(t, "GetURLData", mock.Anything, mock.Anything)
+	})
+}
+
 func TestGetURLData(t *testing.T) {
 	mockStorage := new(mocks.MockStorage)
 	service := NewURLService(mockStorage)
@@ -82,6 +235,504 @@ func TestGetURLData(t *testing.T) {
 	})
 }
 
+func TestURLExpiration(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	shortURL := "abc123"
+	originalURL := "https://example.com"
+
+	newServiceAt := func(mockStorage *mocks.MockStorage, at time.Time) *urlService {
+		service := NewURLService(mockStorage).(*urlService)
+		service.now = func() time.Time { return at }
+		return service
+	}
+
+	t.Run("CreateShortURL sets ExpiresAt from TTL", func(t *testing.T) {
+		mockStorage := new(mocks.MockStorage)
+		service := newServiceAt(mockStorage, now)
+		mockStorage.On("GetOrCreate", ctx, mock.MatchedBy(func(urlData types.URLData) bool {
+			return urlData.ExpiresAt.Equal(now.Add(time.Hour))
+		})).Return(types.URLData{}, true, nil).Once()
+
+		urlData, err := service.CreateShortURL(ctx, originalURL, CreateOptions{TTL: time.Hour})
+
+		require.NoError(t, err)
+		assert.Equal(t, now.Add(time.Hour), urlData.ExpiresAt)
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("CreateShortURL without TTL never expires", func(t *testing.T) {
+		mockStorage := new(mocks.MockStorage)
+		service := newServiceAt(mockStorage, now)
+		mockStorage.On("GetOrCreate", ctx, mock.AnythingOfType("types.URLData")).Return(types.URLData{}, true, nil).Once()
+
+		urlData, err := service.CreateShortURL(ctx, originalURL, CreateOptions{})
+
+		require.NoError(t, err)
+		assert.True(t, urlData.ExpiresAt.IsZero())
+	})
+
+	t.Run("CreateShortURL replaces an expired duplicate", func(t *testing.T) {
+		store := storage.NewInMemoryStorage(10, zap.NewNop())
+		service := NewURLService(store)
+		require.NoError(t, store.Create(ctx, types.URLData{ShortURL: shortURL, OriginalURL: originalURL, ExpiresAt: time.Now().Add(-time.Second)}))
+
+		urlData, err := service.CreateShortURL(ctx, originalURL, CreateOptions{})
+		require.NoError(t, err)
+		assert.NotEqual(t, shortURL, urlData.ShortURL)
+
+		existing, err := service.CreateShortURL(ctx, originalURL, CreateOptions{})
+		assert.ErrorIs(t, err, ErrShortURLExists)
+		assert.Equal(t, urlData.ShortURL, existing.ShortURL, "The replacement should be found from then on")
+	})
+
+	tests := []struct {
+		name        string
+		expiresAt   time.Time
+		expectedErr error
+	}{
+		{name: "No expiration", expiresAt: time.Time{}, expectedErr: nil},
+		{name: "Expires one nanosecond after the request", expiresAt: now.Add(time.Nanosecond), expectedErr: nil},
+		{name: "Expires exactly at request time", expiresAt: now, expectedErr: ErrShortURLExpired},
+		{name: "Expired one nanosecond before the request", expiresAt: now.Add(-time.Nanosecond), expectedErr: ErrShortURLExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run("GetURLData "+tt.name, func(t *testing.T) {
+			mockStorage := new(mocks.MockStorage)
+			service := newServiceAt(mockStorage, now)
+			mockStorage.On("GetURLData", ctx, shortURL).Return(types.URLData{ShortURL: shortURL, OriginalURL: originalURL, ExpiresAt: tt.expiresAt}, nil).Once()
+
+			_, err := service.GetURLData(ctx, shortURL)
+
+			assert.Equal(t, tt.expectedErr, err)
+		})
+	}
+}
+
+func TestListByTag(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	mockStorage := new(mocks.MockStorage)
+	service := NewURLService(mockStorage)
+
+	t.Run("Success skips expired URLs", func(t *testing.T) {
+		mockStorage.On("ListByTag", ctx, "campaignX").Return([]types.URLData{
+			{ShortURL: "active", Tags: []string{"campaignX"}},
+			{ShortURL: "expired", Tags: []string{"campaignX"}, ExpiresAt: now.Add(-time.Minute)},
+		}, nil).Once()
+
+		items, err := service.ListByTag(ctx, "campaignX")
+
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		assert.Equal(t, "active", items[0].ShortURL)
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("Storage error", func(t *testing.T) {
+		mockStorage.On("ListByTag", ctx, "broken").Return([]types.URLData(nil), context.DeadlineExceeded).Once()
+
+		_, err := service.ListByTag(ctx, "broken")
+
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+
+	t.Run("CreateShortURL stores tags", func(t *testing.T) {
+		tags := []string{"campaignX", "team"}
+		mockStorage.On("GetOrCreate", ctx, mock.MatchedBy(func(urlData types.URLData) bool {
+			return assert.ObjectsAreEqual(tags, urlData.Tags)
+		})).Return(types.URLData{}, true, nil).Once()
+
+		urlData, err := service.CreateShortURL(ctx, "https://tagged.com", CreateOptions{Tags: tags})
+
+		require.NoError(t, err)
+		assert.Equal(t, tags, urlData.Tags)
+		mockStorage.AssertExpectations(t)
+	})
+}
+
+func TestCanonicalDedup(t *testing.T) {
+	ctx := context.Background()
+	first := "https://Example.com:443/path?b=2&a=1#section"
+	equivalent := "https://example.com/path?a=1&b=2"
+
+	t.Run("Equivalent URLs share one short URL", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()), WithCanonicalDedup())
+
+		created, err := service.CreateShortURL(ctx, first, CreateOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, first, created.OriginalURL)
+
+		duplicate, err := service.CreateShortURL(ctx, equivalent, CreateOptions{})
+		assert.Equal(t, ErrShortURLExists, err)
+		assert.Equal(t, created.ShortURL, duplicate.ShortURL)
+		assert.Equal(t, first, duplicate.OriginalURL, "The first submitter's exact URL should be returned")
+
+		urlData, err := service.GetURLData(ctx, created.ShortURL)
+		require.NoError(t, err)
+		assert.Equal(t, first, urlData.OriginalURL, "The stored URL should not be rewritten")
+	})
+
+	t.Run("Without the option equivalent URLs are distinct", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()))
+
+		created, err := service.CreateShortURL(ctx, first, CreateOptions{})
+		require.NoError(t, err)
+		other, err := service.CreateShortURL(ctx, equivalent, CreateOptions{})
+		require.NoError(t, err)
+		assert.NotEqual(t, created.ShortURL, other.ShortURL)
+	})
+
+	t.Run("UpdateURL re-indexes under the new canonical key", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()), WithCanonicalDedup())
+
+		created, err := service.CreateShortURL(ctx, first, CreateOptions{})
+		require.NoError(t, err)
+		_, err = service.UpdateURL(ctx, created.ShortURL, "HTTPS://other.com")
+		require.NoError(t, err)
+
+		duplicate, err := service.CreateShortURL(ctx, "https://other.com/", CreateOptions{})
+		assert.Equal(t, ErrShortURLExists, err)
+		assert.Equal(t, created.ShortURL, duplicate.ShortURL)
+		assert.Equal(t, "HTTPS://other.com", duplicate.OriginalURL)
+
+		_, err = service.CreateShortURL(ctx, equivalent, CreateOptions{})
+		assert.NoError(t, err, "The old canonical key should no longer match")
+	})
+}
+
+func TestExternalIDs(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Create and look up by external ID", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()))
+
+		created, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{ExternalID: "order-1"})
+		require.NoError(t, err)
+		assert.Equal(t, "order-1", created.ExternalID)
+
+		urlData, err := service.GetByExternalID(ctx, "order-1")
+		require.NoError(t, err)
+		assert.Equal(t, created.ShortURL, urlData.ShortURL)
+
+		_, err = service.GetByExternalID(ctx, "missing")
+		assert.Equal(t, ErrShortURLNotFound, err)
+	})
+
+	t.Run("An external ID skips deduplication", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()))
+
+		plain, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+		require.NoError(t, err)
+		tagged, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{ExternalID: "order-1"})
+		require.NoError(t, err)
+		assert.NotEqual(t, plain.ShortURL, tagged.ShortURL)
+	})
+
+	t.Run("Duplicate external IDs are rejected", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()))
+
+		_, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{ExternalID: "order-1"})
+		require.NoError(t, err)
+		_, err = service.CreateShortURL(ctx, "https://other.com", CreateOptions{ExternalID: "order-1"})
+		assert.Equal(t, ErrExternalIDExists, err)
+		_, err = service.CreateShortURL(ctx, "https://other.com", CreateOptions{Alias: "custom", ExternalID: "order-1"})
+		assert.Equal(t, ErrExternalIDExists, err)
+	})
+}
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := new(mocks.MockStorage)
+	service := NewURLService(mockStorage)
+
+	t.Run("Page is converted to an offset", func(t *testing.T) {
+		items := []types.URLData{{ShortURL: "c"}, {ShortURL: "d"}}
+		mockStorage.On("List", ctx, 4, 2).Return(items, 7, nil).Once()
+
+		page, total, err := service.List(ctx, 3, 2)
+
+		require.NoError(t, err)
+		assert.Equal(t, items, page)
+		assert.Equal(t, 7, total)
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("Invalid page", func(t *testing.T) {
+		_, _, err := service.List(ctx, 0, 10)
+		assert.ErrorIs(t, err, storage.ErrInvalidPagination)
+	})
+}
+
+// collidingGenerator returns the given codes in order, repeating the last one once exhausted.
+func collidingGenerator(codes ...string) Generator {
+	return generatorFunc(func() (string, error) {
+		code := codes[0]
+		if len(codes) > 1 {
+			codes = codes[1:]
+		}
+		return code, nil
+	})
+}
+
+func TestGenerationAttemptLogging(t *testing.T) {
+	ctx := context.Background()
+
+	newService := func(codes ...string) (*urlService, *observer.ObservedLogs) {
+		core, logs := observer.New(zapcore.DebugLevel)
+		store := storage.NewInMemoryStorage(10, zap.NewNop())
+		require.NoError(t, store.Create(ctx, types.URLData{ShortURL: "taken", OriginalURL: "https://taken.com"}))
+		service := NewURLService(store, WithAttemptLogging(zap.New(core)), WithGenerator(collidingGenerator(codes...))).(*urlService)
+		return service, logs
+	}
+
+	t.Run("Collisions are retried and logged", func(t *testing.T) {
+		service, logs := newService("taken", "fresh")
+
+		urlData, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+
+		require.NoError(t, err)
+		assert.Equal(t, "fresh", urlData.ShortURL)
+		entries := logs.FilterMessage("Short URL generated").AllUntimed()
+		require.Len(t, entries, 1)
+		fields := entries[0].ContextMap()
+		assert.Equal(t, int64(2), fields["attempts"])
+		assert.Equal(t, "fresh", fields["shortURL"])
+		assert.Equal(t, []interface{}{retryReasonCollision}, fields["retryReasons"])
+	})
+
+	t.Run("Exhausted attempts are logged", func(t *testing.T) {
+		service, logs := newService("taken")
+
+		_, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+
+		assert.Equal(t, ErrShortURLExists, err)
+		entries := logs.FilterMessage("Short URL generation failed").AllUntimed()
+		require.Len(t, entries, 1)
+		assert.Equal(t, int64(DefaultGenerationAttempts), entries[0].ContextMap()["attempts"])
+	})
+}
+
+func TestCreateTimings(t *testing.T) {
+	service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()), WithCanonicalDedup())
+
+	ctx, timings := WithCreateTimings(context.Background())
+	_, err := service.CreateShortURL(ctx, "https://Example.com/path", CreateOptions{})
+	require.NoError(t, err)
+	assert.Positive(t, timings.Generation)
+	assert.Positive(t, timings.DedupKey)
+	assert.Positive(t, timings.StorageWrite)
+
+	t.Run("Existing URLs are timed too", func(t *testing.T) {
+		ctx, timings := WithCreateTimings(context.Background())
+		_, err := service.CreateShortURL(ctx, "https://example.com/path", CreateOptions{})
+		assert.Equal(t, ErrShortURLExists, err)
+		assert.Positive(t, timings.StorageWrite)
+	})
+
+	t.Run("Aliases are timed too", func(t *testing.T) {
+		ctx, timings := WithCreateTimings(context.Background())
+		_, err := service.CreateShortURL(ctx, "https://example.com/alias", CreateOptions{Alias: "timed"})
+		require.NoError(t, err)
+		assert.Zero(t, timings.Generation)
+		assert.Positive(t, timings.DedupKey)
+		assert.Positive(t, timings.StorageWrite)
+	})
+
+	t.Run("Nothing is recorded without WithCreateTimings", func(t *testing.T) {
+		_, err := service.CreateShortURL(context.Background(), "https://example.org", CreateOptions{})
+		assert.NoError(t, err)
+	})
+}
+
+func TestShortURLGenerator(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Custom format", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()), WithShortURLFormat(12, "ab"))
+		urlData, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+		require.NoError(t, err)
+		assert.Len(t, urlData.ShortURL, 12)
+		assert.Empty(t, strings.Trim(urlData.ShortURL, "ab"), "Short URL should only use the configured alphabet")
+	})
+
+	t.Run("Invalid format fails on create", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()), WithShortURLFormat(0, "ab"))
+		_, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+		assert.EqualError(t, err, "short URL length must be positive")
+	})
+
+	t.Run("Injected generator", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()),
+			WithGenerator(collidingGenerator("first", "second")), WithShortURLFormat(4, "ab"))
+		urlData, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "first", urlData.ShortURL, "An injected generator takes precedence over the format")
+		urlData, err = service.CreateShortURL(ctx, "https://example.org", CreateOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "second", urlData.ShortURL)
+	})
+
+	t.Run("Duplicate generated codes are regenerated", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()),
+			WithGenerator(collidingGenerator("dup", "dup", "dup", "fresh")))
+		first, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "dup", first.ShortURL)
+
+		second, err := service.CreateShortURL(ctx, "https://example.org", CreateOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "fresh", second.ShortURL, "Both duplicates should be discarded")
+		assert.Equal(t, "https://example.org", second.OriginalURL)
+	})
+
+	t.Run("Reserved words are regenerated", func(t *testing.T) {
+		core, logs := observer.New(zapcore.DebugLevel)
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()),
+			WithAttemptLogging(zap.New(core)), WithGenerator(collidingGenerator("health", "Readyz", "fresh")))
+
+		urlData, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "fresh", urlData.ShortURL, "Reserved words should be skipped")
+		entries := logs.FilterMessage("Short URL generated").AllUntimed()
+		require.Len(t, entries, 1)
+		assert.Equal(t, []interface{}{retryReasonReserved, retryReasonReserved}, entries[0].ContextMap()["retryReasons"])
+
+		_, err = service.GetURLData(ctx, "health")
+		assert.Equal(t, ErrShortURLNotFound, err, "The reserved word should not have been stored")
+	})
+
+	t.Run("Static short URL routes are reserved", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()))
+
+		_, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{Alias: "top"})
+		assert.Equal(t, ErrInvalidAlias, err, "GET /api/v1/short/top would shadow the alias")
+		_, err = service.CreateShortURL(ctx, "https://example.com", CreateOptions{Alias: "Export"})
+		assert.Equal(t, ErrInvalidAlias, err, "GET /api/v1/short/export would shadow the alias")
+	})
+
+	t.Run("Custom reserved words", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()),
+			WithReservedWords([]string{"Status"}), WithGenerator(collidingGenerator("status", "health", "fresh")))
+
+		urlData, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "fresh", urlData.ShortURL, "The custom words should be reserved on top of the defaults")
+		_, err = service.CreateShortURL(ctx, "https://example.org", CreateOptions{Alias: "STATUS"})
+		assert.Equal(t, ErrInvalidAlias, err)
+	})
+
+	t.Run("Only reserved words exhaust the attempts", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()), WithGenerator(collidingGenerator("api")))
+
+		_, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+		assert.Equal(t, ErrShortURLExists, err)
+	})
+
+	t.Run("Configurable attempts", func(t *testing.T) {
+		newService := func(attempts int) URLService {
+			store := storage.NewInMemoryStorage(10, zap.NewNop())
+			require.NoError(t, store.Create(ctx, types.URLData{ShortURL: "taken", OriginalURL: "https://taken.com"}))
+			return NewURLService(store, WithGenerationAttempts(attempts),
+				WithGenerator(collidingGenerator("taken", "taken", "fresh")))
+		}
+
+		_, err := newService(2).CreateShortURL(ctx, "https://example.com", CreateOptions{})
+		assert.Equal(t, ErrShortURLExists, err, "The collision is surfaced once attempts are exhausted")
+
+		urlData, err := newService(3).CreateShortURL(ctx, "https://example.com", CreateOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, "fresh", urlData.ShortURL)
+	})
+}
+
+func TestCreateShortURLWithAlias(t *testing.T) {
+	ctx := context.Background()
+	service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()))
+
+	urlData, err := service.CreateShortURLWithAlias(ctx, "https://example.com/docs", "docs")
+	require.NoError(t, err)
+	assert.Equal(t, "docs", urlData.ShortURL)
+
+	t.Run("Taken alias", func(t *testing.T) {
+		_, err := service.CreateShortURLWithAlias(ctx, "https://example.org", "docs")
+		assert.ErrorIs(t, err, ErrAliasTaken)
+		assert.ErrorIs(t, err, ErrShortURLExists)
+	})
+
+	t.Run("Alias is created for an already shortened URL", func(t *testing.T) {
+		generated, err := service.CreateShortURL(ctx, "https://example.com/blog", CreateOptions{})
+		require.NoError(t, err)
+
+		aliased, err := service.CreateShortURL(ctx, "https://example.com/blog", CreateOptions{Alias: "blog", TTL: time.Hour})
+		require.NoError(t, err)
+		assert.Equal(t, "blog", aliased.ShortURL)
+		assert.NotEqual(t, generated.ShortURL, aliased.ShortURL)
+		assert.False(t, aliased.ExpiresAt.IsZero())
+	})
+
+	invalid := []struct {
+		name  string
+		alias string
+	}{
+		{name: "Too short", alias: "ab"},
+		{name: "Too long", alias: strings.Repeat("a", MaxAliasLength+1)},
+		{name: "Outside the charset", alias: "go/docs"},
+		{name: "Reserved path", alias: "health"},
+		{name: "Reserved path in another case", alias: "API"},
+		{name: "Reserved probe path", alias: "livez"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateShortURLWithAlias(ctx, "https://example.com", tt.alias)
+			assert.Equal(t, ErrInvalidAlias, err)
+		})
+	}
+}
+
+func TestCreateShortURLImported(t *testing.T) {
+	ctx := context.Background()
+	service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()), WithReservedWords([]string{"docs"}))
+	imported := func(shortURL string) CreateOptions { return CreateOptions{Alias: shortURL, Imported: true} }
+
+	for _, shortURL := range []string{"ab", strings.Repeat("a", MaxAliasLength+1), "a_b~c", "docs"} {
+		urlData, err := service.CreateShortURL(ctx, "https://example.com/"+shortURL, imported(shortURL))
+		require.NoError(t, err, "%q can be served, so it should be kept", shortURL)
+		assert.Equal(t, shortURL, urlData.ShortURL)
+	}
+
+	_, err := service.CreateShortURL(ctx, "https://example.org", imported("docs"))
+	assert.ErrorIs(t, err, ErrAliasTaken)
+	for _, shortURL := range []string{".", "..", "go/docs", "health", "API", "export"} {
+		_, err := service.CreateShortURL(ctx, "https://example.org", imported(shortURL))
+		assert.Equal(t, ErrInvalidAlias, err, "%q can't be served by the redirect route", shortURL)
+	}
+}
+
+func TestReplaceAll(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewInMemoryStorage(10, zap.NewNop())
+	service := NewURLService(store, WithReservedWords([]string{"docs"})).(*urlService)
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+	_, err := service.CreateShortURL(ctx, "https://example.com/old", CreateOptions{Alias: "old123"})
+	require.NoError(t, err)
+
+	assert.Equal(t, ErrInvalidAlias, service.ReplaceAll(ctx, map[string]string{"abc123": "https://example.com", "api": "https://example.org"}))
+	_, err = service.GetURLData(ctx, "old123")
+	assert.NoError(t, err, "Nothing should be replaced unless every short URL is valid")
+
+	require.NoError(t, service.ReplaceAll(ctx, map[string]string{"abc123": "https://example.com", "docs": "https://example.org"}))
+	_, err = service.GetURLData(ctx, "old123")
+	assert.Equal(t, ErrShortURLNotFound, err)
+	urlData, err := service.GetURLData(ctx, "docs")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.org", urlData.OriginalURL)
+	assert.True(t, urlData.CreatedAt.Equal(now))
+	assert.True(t, urlData.UpdatedAt.Equal(now))
+}
+
 func TestUpdateURL(t *testing.T) {
 	mockStorage := new(mocks.MockStorage)
 	service := NewURLService(mockStorage)
@@ -92,9 +743,28 @@ func TestUpdateURL(t *testing.T) {
 
 	t.Run("Success", func(t *testing.T) {
 		mockStorage.On("GetURLData", ctx, shortURL).Return(types.URLData{OriginalURL: "https://oldexample.com"}, nil).Once()
-		mockStorage.On("Update", ctx, mock.AnythingOfType("types.URLData")).Return(nil).Once()
+		stored := types.URLData{ShortURL: shortURL, OriginalURL: newURL, AccessCount: 7}
+		mockStorage.On("Update", ctx, mock.MatchedBy(func(urlData types.URLData) bool {
+			return urlData.OriginalURL == newURL
+		})).Return(stored, nil).Once()
 
-		err := service.UpdateURL(ctx, shortURL, newURL)
+		urlData, err := service.UpdateURL(ctx, shortURL, newURL)
+
+		assert.NoError(t, err)
+		assert.Equal(t, stored, urlData, "The record returned by the storage should be passed through")
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("Stamps the update with the service clock", func(t *testing.T) {
+		now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+		service.(*urlService).now = func() time.Time { return now }
+		defer func() { service.(*urlService).now = time.Now }()
+		mockStorage.On("GetURLData", ctx, shortURL).Return(types.URLData{OriginalURL: "https://oldexample.com"}, nil).Once()
+		mockStorage.On("Update", ctx, mock.MatchedBy(func(urlData types.URLData) bool {
+			return urlData.UpdatedAt.Equal(now)
+		})).Return(types.URLData{ShortURL: shortURL, OriginalURL: newURL, UpdatedAt: now}, nil).Once()
+
+		_, err := service.UpdateURL(ctx, shortURL, newURL)
 
 		assert.NoError(t, err)
 		mockStorage.AssertExpectations(t)
@@ -103,10 +773,181 @@ func TestUpdateURL(t *testing.T) {
 	t.Run("ShortURLNotFound", func(t *testing.T) {
 		mockStorage.On("GetURLData", ctx, shortURL).Return(types.URLData{}, storage.ErrShortURLNotFound).Once()
 
-		err := service.UpdateURL(ctx, shortURL, newURL)
+		_, err := service.UpdateURL(ctx, shortURL, newURL)
+
+		assert.Equal(t, ErrShortURLNotFound, err)
+		mockStorage.AssertExpectations(t)
+	})
+}
+
+func TestUpdateURLIfUnmodified(t *testing.T) {
+	ctx := context.Background()
+	service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()))
+	created, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+	require.NoError(t, err)
+	created, err = service.GetURLData(ctx, created.ShortURL) // As stored, with the storage's UpdatedAt
+	require.NoError(t, err)
+
+	t.Run("Current version", func(t *testing.T) {
+		updated, err := service.UpdateURLIfUnmodified(ctx, created.ShortURL, "https://first.com", created.UpdatedAt)
+		require.NoError(t, err)
+		assert.Equal(t, "https://first.com", updated.OriginalURL)
+		assert.True(t, updated.UpdatedAt.After(created.UpdatedAt))
+	})
+
+	t.Run("Stale version", func(t *testing.T) {
+		_, err := service.UpdateURLIfUnmodified(ctx, created.ShortURL, "https://second.com", created.UpdatedAt)
+		assert.Equal(t, ErrVersionMismatch, err)
+
+		urlData, err := service.GetURLData(ctx, created.ShortURL)
+		require.NoError(t, err)
+		assert.Equal(t, "https://first.com", urlData.OriginalURL, "A stale update should not be applied")
+	})
+
+	t.Run("Lost race", func(t *testing.T) {
+		mockStorage := new(mocks.MockStorage)
+		service := NewURLService(mockStorage)
+		mockStorage.On("GetURLData", ctx, "abc123").Return(types.URLData{ShortURL: "abc123", UpdatedAt: created.UpdatedAt}, nil).Once()
+		mockStorage.On("CompareAndUpdate", ctx, mock.Anything, created.UpdatedAt).Return(types.URLData{}, storage.ErrVersionMismatch).Once()
+
+		_, err := service.UpdateURLIfUnmodified(ctx, "abc123", "https://second.com", created.UpdatedAt)
+
+		assert.Equal(t, ErrVersionMismatch, err)
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("ShortURLNotFound", func(t *testing.T) {
+		_, err := service.UpdateURLIfUnmodified(ctx, "missing", "https://second.com", created.UpdatedAt)
+		assert.Equal(t, ErrShortURLNotFound, err)
+	})
+}
+
+func TestPatchURL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	newService := func() *urlService {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop())).(*urlService)
+		service.now = func() time.Time { return now }
+		return service
+	}
+	ptr := func(s string) *string { return &s }
+
+	t.Run("Only the TTL", func(t *testing.T) {
+		service := newService()
+		created, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+		require.NoError(t, err)
+
+		ttl := time.Hour
+		patched, err := service.PatchURL(ctx, created.ShortURL, URLPatch{TTL: &ttl})
+		require.NoError(t, err)
+		assert.Equal(t, created.ShortURL, patched.ShortURL)
+		assert.Equal(t, "https://example.com", patched.OriginalURL, "The URL should be left unchanged")
+		assert.Equal(t, now.Add(time.Hour), patched.ExpiresAt)
+	})
+
+	t.Run("Only the URL", func(t *testing.T) {
+		service := newService()
+		created, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{TTL: time.Hour})
+		require.NoError(t, err)
 
+		patched, err := service.PatchURL(ctx, created.ShortURL, URLPatch{URL: ptr("https://example.org")})
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.org", patched.OriginalURL)
+		assert.Equal(t, created.ExpiresAt, patched.ExpiresAt, "The expiration should be left unchanged")
+		shortURL, err := service.store.GetShortURL(ctx, "https://example.org")
+		require.NoError(t, err)
+		assert.Equal(t, created.ShortURL, shortURL, "The URL should be indexed under its new key")
+	})
+
+	t.Run("Alias with the other fields", func(t *testing.T) {
+		service := newService()
+		created, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+		require.NoError(t, err)
+
+		ttl := time.Minute
+		patched, err := service.PatchURL(ctx, created.ShortURL, URLPatch{URL: ptr("https://example.org"), TTL: &ttl, Alias: ptr("docs")})
+		require.NoError(t, err)
+		assert.Equal(t, "docs", patched.ShortURL)
+		assert.Equal(t, "https://example.org", patched.OriginalURL)
+		assert.Equal(t, now.Add(time.Minute), patched.ExpiresAt)
+		_, err = service.GetURLData(ctx, created.ShortURL)
 		assert.Equal(t, ErrShortURLNotFound, err)
+	})
+
+	t.Run("Alias errors", func(t *testing.T) {
+		service := newService()
+		created, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+		require.NoError(t, err)
+		_, err = service.CreateShortURLWithAlias(ctx, "https://example.org", "taken")
+		require.NoError(t, err)
+
+		_, err = service.PatchURL(ctx, created.ShortURL, URLPatch{Alias: ptr("taken")})
+		assert.ErrorIs(t, err, ErrAliasTaken)
+		_, err = service.PatchURL(ctx, created.ShortURL, URLPatch{Alias: ptr("health")})
+		assert.Equal(t, ErrInvalidAlias, err)
+
+		unchanged, err := service.PatchURL(ctx, "taken", URLPatch{Alias: ptr("taken")})
+		require.NoError(t, err, "Keeping the current alias is not a conflict")
+		assert.Equal(t, "taken", unchanged.ShortURL)
+	})
+
+	t.Run("A failed write leaves the short URL untouched", func(t *testing.T) {
+		mockStorage := new(mocks.MockStorage)
+		service := NewURLService(mockStorage).(*urlService)
+		service.now = func() time.Time { return now }
+		stored := types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com", UpdatedAt: now.Add(-time.Hour)}
+		mockStorage.On("GetURLData", ctx, "abc123").Return(stored, nil)
+		patched := stored
+		patched.ShortURL, patched.OriginalURL, patched.UpdatedAt = "docs", "https://example.org", now
+		mockStorage.On("Rename", ctx, "abc123", patched, stored.UpdatedAt).Return(types.URLData{}, errors.New("storage down")).Once()
+
+		_, err := service.PatchURL(ctx, "abc123", URLPatch{URL: ptr("https://example.org"), Alias: ptr("docs")})
+		assert.EqualError(t, err, "storage down")
+		// The rename and the new URL are a single write, so nothing was stored and a retry can succeed
+		mockStorage.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+		mockStorage.AssertNotCalled(t, "CompareAndUpdate", mock.Anything, mock.Anything, mock.Anything)
+
+		mockStorage.On("Rename", ctx, "abc123", patched, stored.UpdatedAt).Return(patched, nil).Once()
+		renamed, err := service.PatchURL(ctx, "abc123", URLPatch{URL: ptr("https://example.org"), Alias: ptr("docs")})
+		require.NoError(t, err)
+		assert.Equal(t, "docs", renamed.ShortURL)
+		mockStorage.AssertExpectations(t)
+	})
+
+	t.Run("Concurrent updates are not overwritten", func(t *testing.T) {
+		mockStorage := new(mocks.MockStorage)
+		service := NewURLService(mockStorage).(*urlService)
+		service.now = func() time.Time { return now }
+		first := types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com", UpdatedAt: now.Add(-time.Hour)}
+		second := first
+		second.OriginalURL, second.UpdatedAt = "https://example.net", now.Add(-time.Minute)
+		mockStorage.On("GetURLData", ctx, "abc123").Return(first, nil).Once()
+		mockStorage.On("GetURLData", ctx, "abc123").Return(second, nil).Once()
+
+		ttl := time.Hour
+		mockStorage.On("CompareAndUpdate", ctx, mock.Anything, first.UpdatedAt).Return(types.URLData{}, storage.ErrVersionMismatch).Once()
+		expected := second
+		expected.ExpiresAt, expected.UpdatedAt = now.Add(ttl), now
+		mockStorage.On("CompareAndUpdate", ctx, expected, second.UpdatedAt).Return(expected, nil).Once()
+
+		patched, err := service.PatchURL(ctx, "abc123", URLPatch{TTL: &ttl})
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.net", patched.OriginalURL, "The patch should be applied to the latest version")
 		mockStorage.AssertExpectations(t)
+
+		mockStorage.On("GetURLData", ctx, "abc123").Return(second, nil)
+		mockStorage.On("CompareAndUpdate", ctx, mock.Anything, second.UpdatedAt).Return(types.URLData{}, storage.ErrVersionMismatch)
+		_, err = service.PatchURL(ctx, "abc123", URLPatch{TTL: &ttl})
+		assert.Equal(t, ErrVersionMismatch, err)
+		mockStorage.AssertNumberOfCalls(t, "CompareAndUpdate", 2+patchAttempts)
+	})
+
+	t.Run("ShortURLNotFound", func(t *testing.T) {
+		service := newService()
+		_, err := service.PatchURL(ctx, "missing", URLPatch{URL: ptr("https://example.org")})
+		assert.Equal(t, ErrShortURLNotFound, err)
+		_, err = service.PatchURL(ctx, "missing", URLPatch{Alias: ptr("docs")})
+		assert.Equal(t, ErrShortURLNotFound, err)
 	})
 }
 
@@ -136,6 +977,115 @@ func TestDeleteURL(t *testing.T) {
 	})
 }
 
+func TestSoftDelete(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Deleted URLs are not found until restored", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()), WithSoftDelete())
+		created, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{Tags: []string{"docs"}})
+		require.NoError(t, err)
+
+		require.NoError(t, service.DeleteURL(ctx, created.ShortURL))
+		assert.Equal(t, ErrShortURLNotFound, service.DeleteURL(ctx, created.ShortURL), "A deleted URL can't be deleted again")
+		_, err = service.GetURLData(ctx, created.ShortURL)
+		assert.Equal(t, ErrShortURLNotFound, err)
+		_, err = service.UpdateURL(ctx, created.ShortURL, "https://example.org")
+		assert.Equal(t, ErrShortURLNotFound, err)
+		tagged, err := service.ListByTag(ctx, "docs")
+		require.NoError(t, err)
+		assert.Empty(t, tagged)
+
+		items, total, err := service.List(ctx, 1, 10)
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+		require.Len(t, items, 1)
+		assert.True(t, items[0].Deleted(), "Listings should include deleted URLs with their deletion time")
+
+		restored, err := service.RestoreURL(ctx, created.ShortURL)
+		require.NoError(t, err)
+		assert.False(t, restored.Deleted())
+		assert.Equal(t, "https://example.com", restored.OriginalURL)
+
+		urlData, err := service.GetURLData(ctx, created.ShortURL)
+		require.NoError(t, err)
+		assert.Equal(t, created.ShortURL, urlData.ShortURL)
+	})
+
+	t.Run("Only deleted URLs can be restored", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()), WithSoftDelete())
+		created, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+		require.NoError(t, err)
+
+		_, err = service.RestoreURL(ctx, created.ShortURL)
+		assert.Equal(t, ErrShortURLNotFound, err)
+		_, err = service.RestoreURL(ctx, "missing")
+		assert.Equal(t, ErrShortURLNotFound, err)
+	})
+
+	t.Run("Creating a deleted URL again gives it a new short URL", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()), WithSoftDelete())
+		created, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+		require.NoError(t, err)
+		require.NoError(t, service.DeleteURL(ctx, created.ShortURL))
+
+		recreated, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+		require.NoError(t, err)
+		assert.NotEqual(t, created.ShortURL, recreated.ShortURL)
+	})
+
+	t.Run("Deletes are permanent without soft deletes", func(t *testing.T) {
+		service := NewURLService(storage.NewInMemoryStorage(10, zap.NewNop()))
+		created, err := service.CreateShortURL(ctx, "https://example.com", CreateOptions{})
+		require.NoError(t, err)
+		require.NoError(t, service.DeleteURL(ctx, created.ShortURL))
+
+		_, err = service.RestoreURL(ctx, created.ShortURL)
+		assert.Equal(t, ErrSoftDeleteDisabled, err)
+		_, total, err := service.List(ctx, 1, 10)
+		require.NoError(t, err)
+		assert.Zero(t, total)
+	})
+}
+
+func TestTopN(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewInMemoryStorage(10, zap.NewNop())
+	service := NewURLService(store)
+
+	for i, visits := range []int{2, 5, 0} {
+		created, err := service.CreateShortURL(ctx, fmt.Sprintf("https://example.com/%d", i), CreateOptions{})
+		require.NoError(t, err)
+		for j := 0; j < visits; j++ {
+			require.NoError(t, service.RecordAccess(ctx, created.ShortURL))
+		}
+	}
+
+	items, err := service.TopN(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "https://example.com/1", items[0].OriginalURL)
+	assert.Equal(t, int64(5), items[0].AccessCount)
+	assert.Equal(t, "https://example.com/0", items[1].OriginalURL)
+	assert.Equal(t, int64(2), items[1].AccessCount)
+
+	_, err = service.TopN(ctx, 0)
+	assert.Equal(t, storage.ErrInvalidPagination, err)
+}
+
+func TestRecordAccess(t *testing.T) {
+	mockStorage := new(mocks.MockStorage)
+	service := NewURLService(mockStorage)
+	ctx := context.Background()
+
+	mockStorage.On("IncrementAccess", ctx, "abc123").Return(nil).Once()
+	assert.NoError(t, service.RecordAccess(ctx, "abc123"))
+
+	mockStorage.On("IncrementAccess", ctx, "missing").Return(storage.ErrShortURLNotFound).Once()
+	assert.Equal(t, ErrShortURLNotFound, service.RecordAccess(ctx, "missing"))
+
+	mockStorage.AssertExpectations(t)
+}
+
 func TestConcurrentAccess(t *testing.T) {
 	mockStorage := new(mocks.MockStorage)
 	service := NewURLService(mockStorage)
@@ -143,8 +1093,7 @@ func TestConcurrentAccess(t *testing.T) {
 	ctx := context.Background()
 	originalURL := "https://example.com"
 
-	mockStorage.On("GetShortURL", ctx, originalURL).Return("", storage.ErrShortURLNotFound)
-	mockStorage.On("Create", ctx, mock.AnythingOfType("types.URLData")).Return(nil)
+	mockStorage.On("GetOrCreate", ctx, mock.AnythingOfType("types.URLData")).Return(types.URLData{}, true, nil)
 
 	var wg sync.WaitGroup
 	concurrentRequests := 100
@@ -153,12 +1102,47 @@ func TestConcurrentAccess(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			_, err := service.CreateShortURL(ctx, originalURL)
+			_, err := service.CreateShortURL(ctx, originalURL, CreateOptions{})
 			assert.NoError(t, err)
 		}()
 	}
 
 	wg.Wait()
-	mockStorage.AssertNumberOfCalls(t, "GetShortURL", concurrentRequests)
-	mockStorage.AssertNumberOfCalls(t, "Create", concurrentRequests)
+	mockStorage.AssertNumberOfCalls(t, "GetOrCreate", concurrentRequests)
+}
+
+func TestConcurrentCreatesOfOneURL(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewInMemoryStorage(1000, zap.NewNop())
+	service := NewURLService(store)
+
+	const concurrentRequests = 50
+	shortURLs := make([]string, concurrentRequests)
+	var created atomic.Int32
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < concurrentRequests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			urlData, err := service.CreateShortURL(ctx, "https://example.com/new", CreateOptions{})
+			if err == nil {
+				created.Add(1)
+			} else {
+				assert.Equal(t, ErrShortURLExists, err)
+			}
+			shortURLs[i] = urlData.ShortURL
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), created.Load(), "Exactly one request should create the short URL")
+	for _, shortURL := range shortURLs {
+		assert.Equal(t, shortURLs[0], shortURL, "Every request should get the same short URL")
+	}
+	usage, _, err := store.Usage(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, usage)
 }
@@ -0,0 +1,4 @@
+// Package shortenerpb holds the gRPC API of the URL shortener, generated from shortener.proto.
+package shortenerpb
+
+//go:generate protoc --proto_path=.. --go_out=.. --go_opt=paths=source_relative --go-grpc_out=.. --go-grpc_opt=paths=source_relative shortenerpb/shortener.proto
@@ -1,33 +1,143 @@
 package storage
 
 import (
+	"container/list"
 	"context"
+	"fmt"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go-url-shortening/types"
+	"go-url-shortening/workerpool"
 	"go.uber.org/zap"
 )
 
-// InMemoryStorage implements the Storage interface using an in-memory map.
+// EvictionPolicy decides what InMemoryStorage does when Create is called at capacity.
+type EvictionPolicy int
+
+const (
+	// EvictionReject makes Create fail with ErrStorageCapacityReached. This is the default.
+	EvictionReject EvictionPolicy = iota
+	// EvictionLRU makes Create evict the least recently accessed short URL to make room.
+	EvictionLRU
+)
+
+// ParseEvictionPolicy converts a configuration value ("reject" or "lru") into an EvictionPolicy.
+// An empty string selects EvictionReject.
+func ParseEvictionPolicy(value string) (EvictionPolicy, error) {
+	switch value {
+	case "", "reject":
+		return EvictionReject, nil
+	case "lru":
+		return EvictionLRU, nil
+	default:
+		return EvictionReject, fmt.Errorf("unknown eviction policy %q", value)
+	}
+}
+
+// scanCancellationInterval is the number of records a scan of every shard goes through between
+// checks of its context, so that a cancelled request doesn't keep holding the locks of a large map.
+const scanCancellationInterval = 1024
+
+// defaultInMemoryShards is the number of shards an InMemoryStorage splits its data into.
+const defaultInMemoryShards = 16
+
+// defaultForEachPageSize is the number of records ForEach copies from a shard per read lock, and so
+// the most it holds at a time.
+const defaultForEachPageSize = 500
+
+// inMemoryShard holds the part of the data of an InMemoryStorage whose keys hash to it: the records
+// of its short URLs, and the reverse index entries of its lookup keys and external IDs. A record
+// and its index entries usually live in different shards.
+type inMemoryShard struct {
+	mu              sync.RWMutex             // Guards the maps of the shard
+	urls            map[string]types.URLData // Map to store short URL to URLData mappings
+	originalToShort map[string]string        // Reverse index backing GetShortURL, pointing at the latest short URL per lookup key
+	externalToShort map[string]string        // Index backing GetByExternalID, holding the short URL of each non-empty external ID
+	// accessCounts holds the authoritative access count per short URL, so IncrementAccess only
+	// needs mu for reading. The AccessCount field of the URLData stored in urls is always zero.
+	accessCounts map[string]*atomic.Int64
+}
+
+// newInMemoryShard creates an empty shard sized for capacity records.
+func newInMemoryShard(capacity int) *inMemoryShard {
+	return &inMemoryShard{
+		urls:            make(map[string]types.URLData, capacity), // pre-allocates the maps with the given capacity,
+		originalToShort: make(map[string]string, capacity),        // can improve performance by reducing dynamic resizing
+		externalToShort: make(map[string]string),
+		accessCounts:    make(map[string]*atomic.Int64, capacity),
+	}
+}
+
+// InMemoryStorage implements the Storage interface using in-memory maps, split into shards by a hash
+// of their keys so that writes of unrelated short URLs don't contend for the same lock.
 type InMemoryStorage struct {
-	urls     map[string]types.URLData // Map to store short URL to URLData mappings
-	mu       sync.RWMutex             // Read-write mutex for thread-safe access to the map
-	capacity int                      // Maximum number of URLs that can be stored
-	count    int                      // Current number of stored URLs
-	logger   *zap.Logger              // Logger for InMemoryStorage operations
+	shards   []*inMemoryShard // Shards the data is split into, selected by shardIndex
+	capacity int              // Maximum number of URLs that can be stored
+	count    atomic.Int64     // Current number of stored URLs, across all shards
+	logger   *zap.Logger      // Logger for InMemoryStorage operations
+	// compressSnapshots makes SaveToFile gzip the snapshot it writes
+	compressSnapshots bool
+	// softDeleteRetention is how long the cleanup keeps soft-deleted URLs before deleting them for
+	// good. Non-positive values keep them until they are restored or deleted.
+	softDeleteRetention time.Duration
+	// forEachPageSize is the number of records ForEach copies per read lock
+	forEachPageSize int
+
+	eviction EvictionPolicy           // Behaviour of Create when the storage is full
+	lruMu    sync.Mutex               // Guards recency, so readers holding only a shard's read lock can record accesses
+	recency  *list.List               // Short URLs ordered from most to least recently accessed (LRU only)
+	elements map[string]*list.Element // Short URL -> its element in recency (LRU only)
 }
 
-// The sync.RWMutex (mu) is used to ensure thread-safe access to the shared resources (urls and count).
-// It allows multiple readers to access the data simultaneously, but ensures exclusive access for writers.
-// This is particularly useful for operations that only read data (like Read) to proceed concurrently,
-// while write operations (like Create, Update, and Delete) have exclusive access.
+// InMemoryOption configures optional behaviour of an InMemoryStorage.
+type InMemoryOption func(*InMemoryStorage)
+
+// WithEvictionPolicy sets what Create does when the storage is full.
+func WithEvictionPolicy(policy EvictionPolicy) InMemoryOption {
+	return func(s *InMemoryStorage) {
+		s.eviction = policy
+	}
+}
+
+// WithSoftDeleteRetention makes the cleanup started by StartCleanup delete soft-deleted URLs
+// for good once they have been deleted for retention.
+func WithSoftDeleteRetention(retention time.Duration) InMemoryOption {
+	return func(s *InMemoryStorage) {
+		s.softDeleteRetention = retention
+	}
+}
+
+// withShards sets the number of shards, defaultInMemoryShards unless given. A single shard
+// serializes all writes behind one lock, which the benchmarks compare against.
+func withShards(n int) InMemoryOption {
+	return func(s *InMemoryStorage) {
+		s.shards = make([]*inMemoryShard, n)
+	}
+}
+
+// withForEachPageSize sets the number of records ForEach copies per read lock,
+// defaultForEachPageSize unless given.
+func withForEachPageSize(n int) InMemoryOption {
+	return func(s *InMemoryStorage) {
+		s.forEachPageSize = n
+	}
+}
+
+// Each shard has a sync.RWMutex (mu) ensuring thread-safe access to its maps. It allows multiple
+// readers to access the data simultaneously, but ensures exclusive access for writers. An operation
+// spanning several shards, such as a Create indexing its record in the shards of its lookup key and
+// external ID, locks them all, always in ascending shard order so that no two operations deadlock.
+// The count is kept in an atomic, and reserved before a record is added so it never exceeds capacity.
 
 // Note: URL validation is performed at the handler level, not in the storage layer.
 // This design decision allows for more flexibility in URL handling and validation.
 
 // NewInMemoryStorage creates and returns a new InMemoryStorage instance
-func NewInMemoryStorage(capacity int, logger *zap.Logger) *InMemoryStorage {
+func NewInMemoryStorage(capacity int, logger *zap.Logger, opts ...InMemoryOption) *InMemoryStorage {
 	if capacity <= 0 {
 		capacity = 1000 // Default capacity if an invalid value is provided
 	}
@@ -38,11 +148,23 @@ func NewInMemoryStorage(capacity int, logger *zap.Logger) *InMemoryStorage {
 			panic("Failed to initialize zap logger: " + err.Error())
 		}
 	}
-	return &InMemoryStorage{
-		urls:     make(map[string]types.URLData, capacity), // pre-allocates the map with the given capacity,
-		capacity: capacity,                                 // can improve performance by reducing dynamic resizing
-		logger:   logger,
+	s := &InMemoryStorage{
+		shards:          make([]*inMemoryShard, defaultInMemoryShards),
+		capacity:        capacity,
+		logger:          logger,
+		forEachPageSize: defaultForEachPageSize,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	for i := range s.shards {
+		s.shards[i] = newInMemoryShard(capacity / len(s.shards))
 	}
+	if s.eviction == EvictionLRU {
+		s.recency = list.New()
+		s.elements = make(map[string]*list.Element, capacity)
+	}
+	return s
 }
 
 // Note: This is an in-memory implementation. For production use,
@@ -56,27 +178,115 @@ func (s *InMemoryStorage) Create(ctx context.Context, urlData types.URLData) err
 		s.logger.Warn("Create operation cancelled", zap.String("shortURL", urlData.ShortURL))
 		return ctx.Err()
 	default:
-		s.mu.Lock()
-		defer s.mu.Unlock()
+		for {
+			unlock := s.lockShards(append([]string{urlData.ShortURL}, indexKeys(urlData)...)...)
+			_, err := s.create(urlData)
+			unlock()
+			if err != errNeedsEviction || !s.evictLeastRecentlyUsed() {
+				return err
+			}
+		}
+	}
+}
 
-		if s.count >= s.capacity {
-			s.logger.Error("Storage capacity reached. Cannot create shortURL", zap.String("shortURL", urlData.ShortURL))
-			return ErrStorageCapacityReached
+// GetOrCreate returns the live URLData indexed under the lookup key of urlData, or creates urlData
+// if there is none, indexing it in place of an expired or deleted record. Both happen under the
+// locks of every shard involved.
+func (s *InMemoryStorage) GetOrCreate(ctx context.Context, urlData types.URLData) (types.URLData, bool, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("GetOrCreate operation cancelled", zap.String("shortURL", urlData.ShortURL))
+		return types.URLData{}, false, ctx.Err()
+	default:
+		lookupKey := urlData.LookupKey()
+		keys := append([]string{urlData.ShortURL}, indexKeys(urlData)...)
+		for {
+			unlock := s.lockShards(keys...)
+			if shortURL, exists := s.shard(lookupKey).originalToShort[lookupKey]; exists {
+				if !s.covers(keys, shortURL) {
+					// The existing record lives in a shard that isn't locked, so lock it too and look again
+					unlock()
+					keys = append(keys, shortURL)
+					continue
+				}
+				if existing, exists := s.shard(shortURL).urls[shortURL]; exists && !existing.Expired(time.Now()) && !existing.Deleted() {
+					s.touch(shortURL)
+					existing = s.export(existing)
+					unlock()
+					return existing, false, nil
+				}
+			}
+			created, err := s.create(urlData)
+			if err == nil {
+				created = s.export(created)
+			}
+			unlock()
+			if err == errNeedsEviction && s.evictLeastRecentlyUsed() {
+				continue
+			}
+			if err != nil {
+				return types.URLData{}, false, err
+			}
+			return created, true, nil
+		}
+	}
+}
+
+// errNeedsEviction is returned by create when the storage is full and uses EvictionLRU, for the
+// caller to evict an entry once it has released its locks and try again.
+var errNeedsEviction = fmt.Errorf("%w: eviction needed", ErrStorageCapacityReached)
+
+// create stores urlData as a new short URL and returns it as stored. When the storage is full, it
+// fails with errNeedsEviction if it uses EvictionLRU. The caller must hold the shards of the short
+// URL and of indexKeys(urlData) for writing.
+func (s *InMemoryStorage) create(urlData types.URLData) (types.URLData, error) {
+	if s.eviction != EvictionLRU && s.count.Load() >= int64(s.capacity) {
+		s.logger.Error("Storage capacity reached. Cannot create shortURL", zap.String("shortURL", urlData.ShortURL))
+		return types.URLData{}, ErrStorageCapacityReached
+	}
+	shard := s.shard(urlData.ShortURL)
+	if _, exists := shard.urls[urlData.ShortURL]; exists {
+		s.logger.Warn("Attempt to create duplicate shortURL", zap.String("shortURL", urlData.ShortURL))
+		return types.URLData{}, ErrShortURLExists
+	}
+	if urlData.ExternalID != "" {
+		if _, exists := s.shard(urlData.ExternalID).externalToShort[urlData.ExternalID]; exists {
+			s.logger.Warn("Attempt to create duplicate external ID", zap.String("externalID", urlData.ExternalID))
+			return types.URLData{}, ErrExternalIDExists
 		}
-		if _, exists := s.urls[urlData.ShortURL]; exists {
-			s.logger.Warn("Attempt to create duplicate shortURL", zap.String("shortURL", urlData.ShortURL))
-			return ErrShortURLExists
+	}
+	if !s.reserve() {
+		if s.eviction == EvictionLRU {
+			return types.URLData{}, errNeedsEviction
 		}
+		s.logger.Error("Storage capacity reached. Cannot create shortURL", zap.String("shortURL", urlData.ShortURL))
+		return types.URLData{}, ErrStorageCapacityReached
+	}
 
-		urlData.CreatedAt = time.Now().UTC()
-		urlData.UpdatedAt = urlData.CreatedAt
-		s.urls[urlData.ShortURL] = urlData
-		s.count++
-		s.logger.Info("Short URL created successfully",
-			zap.String("shortURL", urlData.ShortURL),
-			zap.String("originalURL", urlData.OriginalURL),
-			zap.Time("createdAt", urlData.CreatedAt))
-		return nil
+	urlData.CreatedAt = time.Now().UTC()
+	urlData.UpdatedAt = urlData.CreatedAt
+	urlData.AccessCount = 0
+	shard.urls[urlData.ShortURL] = urlData
+	s.index(urlData)
+	shard.accessCounts[urlData.ShortURL] = new(atomic.Int64)
+	s.touch(urlData.ShortURL)
+	s.logger.Info("Short URL created successfully",
+		zap.String("shortURL", urlData.ShortURL),
+		zap.String("originalURL", urlData.OriginalURL),
+		zap.Time("createdAt", urlData.CreatedAt))
+	return urlData, nil
+}
+
+// reserve adds one to the count unless the storage is full, and reports whether it did.
+func (s *InMemoryStorage) reserve() bool {
+	for {
+		count := s.count.Load()
+		if count >= int64(s.capacity) {
+			return false
+		}
+		if s.count.CompareAndSwap(count, count+1) {
+			return true
+		}
 	}
 }
 
@@ -87,19 +297,51 @@ func (s *InMemoryStorage) GetURLData(ctx context.Context, shortURL string) (type
 		s.logger.Warn("Read operation cancelled", zap.String("shortURL", shortURL))
 		return types.URLData{}, ctx.Err()
 	default:
-		s.mu.RLock()
-		defer s.mu.RUnlock()
+		shard := s.shard(shortURL)
+		shard.mu.RLock()
+		defer shard.mu.RUnlock()
 
-		if urlData, exists := s.urls[shortURL]; exists {
+		if urlData, exists := shard.urls[shortURL]; exists {
+			s.touch(shortURL)
 			s.logger.Info("URL data retrieved successfully",
 				zap.String("shortURL", shortURL),
 				zap.String("originalURL", urlData.OriginalURL))
-			return urlData, nil
+			return s.export(urlData), nil
 		}
 		return types.URLData{}, ErrShortURLNotFound
 	}
 }
 
+// GetByExternalID retrieves the URLData stored with the given external ID.
+func (s *InMemoryStorage) GetByExternalID(ctx context.Context, externalID string) (types.URLData, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("GetByExternalID operation cancelled", zap.String("externalID", externalID))
+		return types.URLData{}, ctx.Err()
+	default:
+		index := s.shard(externalID)
+		for {
+			index.mu.RLock()
+			shortURL, exists := index.externalToShort[externalID]
+			index.mu.RUnlock()
+			if !exists {
+				return types.URLData{}, ErrShortURLNotFound
+			}
+
+			// Read the record with the index locked too, so that it can't be moved in between
+			unlock := s.rlockShards(externalID, shortURL)
+			if index.externalToShort[externalID] != shortURL {
+				unlock()
+				continue
+			}
+			s.touch(shortURL)
+			urlData := s.export(s.shard(shortURL).urls[shortURL])
+			unlock()
+			return urlData, nil
+		}
+	}
+}
+
 // GetShortURL retrieves the short URL for a given original URL.
 func (s *InMemoryStorage) GetShortURL(ctx context.Context, originalURL string) (string, error) {
 	select {
@@ -107,46 +349,136 @@ func (s *InMemoryStorage) GetShortURL(ctx context.Context, originalURL string) (
 		s.logger.Warn("GetShortURL operation cancelled", zap.String("originalURL", originalURL))
 		return "", ctx.Err()
 	default:
-		s.mu.RLock()
-		defer s.mu.RUnlock()
+		shard := s.shard(originalURL)
+		shard.mu.RLock()
+		defer shard.mu.RUnlock()
 
-		for shortURL, storedOriginalURL := range s.urls {
-			if storedOriginalURL.OriginalURL == originalURL {
-				s.logger.Debug("Short URL retrieved successfully",
-					zap.String("shortURL", shortURL),
-					zap.String("originalURL", originalURL))
-				return shortURL, nil
-			}
+		if shortURL, exists := shard.originalToShort[originalURL]; exists {
+			s.logger.Debug("Short URL retrieved successfully",
+				zap.String("shortURL", shortURL),
+				zap.String("originalURL", originalURL))
+			return shortURL, nil
 		}
 		return "", ErrShortURLNotFound
 	}
 }
 
-// Update modifies the URLData for a given short URL.
-func (s *InMemoryStorage) Update(ctx context.Context, urlData types.URLData) error {
+// Update modifies the URLData for a given short URL and returns it as stored.
+func (s *InMemoryStorage) Update(ctx context.Context, urlData types.URLData) (types.URLData, error) {
+	return s.CompareAndUpdate(ctx, urlData, time.Time{})
+}
+
+// CompareAndUpdate is Update, provided the stored record was last updated at expectedUpdatedAt.
+// The comparison is made under the write lock, so of two updates expecting the same version only
+// the first one succeeds.
+func (s *InMemoryStorage) CompareAndUpdate(ctx context.Context, urlData types.URLData, expectedUpdatedAt time.Time) (types.URLData, error) {
 	select {
 	case <-ctx.Done():
 		s.logger.Warn("Update operation cancelled", zap.String("shortURL", urlData.ShortURL))
-		return ctx.Err()
+		return types.URLData{}, ctx.Err()
 	default:
-		s.mu.Lock()
-		defer s.mu.Unlock()
+		oldURLData, exists, unlock := s.lockRecord(urlData.ShortURL, urlData.LookupKey())
+		defer unlock()
 
-		if _, exists := s.urls[urlData.ShortURL]; !exists {
+		if !exists {
 			s.logger.Warn("Attempt to update non-existent shortURL", zap.String("shortURL", urlData.ShortURL))
-			return ErrShortURLNotFound
+			return types.URLData{}, ErrShortURLNotFound
 		}
 
-		oldURLData := s.urls[urlData.ShortURL]
-		urlData.CreatedAt = oldURLData.CreatedAt
-		urlData.UpdatedAt = time.Now().UTC()
-		s.urls[urlData.ShortURL] = urlData
+		if !expectedUpdatedAt.IsZero() && !oldURLData.UpdatedAt.Equal(expectedUpdatedAt) {
+			s.logger.Warn("Attempt to update a stale version of shortURL", zap.String("shortURL", urlData.ShortURL))
+			return types.URLData{}, ErrVersionMismatch
+		}
+		urlData = updatedRecord(oldURLData, urlData)
+		s.shard(urlData.ShortURL).urls[urlData.ShortURL] = urlData
+		s.unindex(oldURLData)
+		s.index(urlData)
 		s.logger.Info("Updated shortURL",
 			zap.String("shortURL", urlData.ShortURL),
 			zap.String("oldURL", oldURLData.OriginalURL),
 			zap.String("newURL", urlData.OriginalURL),
 			zap.Time("updatedAt", urlData.UpdatedAt))
-		return nil
+		return s.export(urlData), nil
+	}
+}
+
+// MarkDeleted sets or, when deletedAt is zero, clears the DeletedAt of shortURL.
+func (s *InMemoryStorage) MarkDeleted(ctx context.Context, shortURL string, deletedAt time.Time) (types.URLData, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("MarkDeleted operation cancelled", zap.String("shortURL", shortURL))
+		return types.URLData{}, ctx.Err()
+	default:
+		shard := s.shard(shortURL)
+		shard.mu.Lock()
+		defer shard.mu.Unlock()
+
+		urlData, exists := shard.urls[shortURL]
+		if !exists {
+			s.logger.Warn("Attempt to mark non-existent shortURL as deleted", zap.String("shortURL", shortURL))
+			return types.URLData{}, ErrShortURLNotFound
+		}
+		urlData.DeletedAt = deletedAt.UTC()
+		shard.urls[shortURL] = urlData
+		s.logger.Info("Marked shortURL as deleted",
+			zap.String("shortURL", shortURL),
+			zap.Bool("deleted", urlData.Deleted()))
+		return s.export(urlData), nil
+	}
+}
+
+// updatedRecord returns urlData as CompareAndUpdate and Rename store it over oldURLData, keeping
+// the fields updates don't change.
+func updatedRecord(oldURLData, urlData types.URLData) types.URLData {
+	urlData.CreatedAt = oldURLData.CreatedAt
+	urlData.UpdatedAt = time.Now().UTC()
+	urlData.AccessCount = 0 // The count is kept in accessCounts and survives updates
+	urlData.ExternalID = oldURLData.ExternalID
+	urlData.DeletedAt = oldURLData.DeletedAt
+	if urlData.OriginalURL != oldURLData.OriginalURL {
+		// A reachability check only describes the destination it was taken for
+		urlData.LastCheckedAt, urlData.LastStatus = time.Time{}, 0
+	}
+	return urlData
+}
+
+// Rename moves the record of shortURL, with its access count and indexes, to urlData.ShortURL
+// and updates it with urlData, all under the write locks of both records and their index keys.
+func (s *InMemoryStorage) Rename(ctx context.Context, shortURL string, urlData types.URLData, expectedUpdatedAt time.Time) (types.URLData, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("Rename operation cancelled", zap.String("shortURL", shortURL))
+		return types.URLData{}, ctx.Err()
+	default:
+		newShortURL := urlData.ShortURL
+		oldURLData, exists, unlock := s.lockRecord(shortURL, newShortURL, urlData.LookupKey())
+		defer unlock()
+
+		if !exists {
+			s.logger.Warn("Attempt to rename non-existent shortURL", zap.String("shortURL", shortURL))
+			return types.URLData{}, ErrShortURLNotFound
+		}
+		if !expectedUpdatedAt.IsZero() && !oldURLData.UpdatedAt.Equal(expectedUpdatedAt) {
+			s.logger.Warn("Attempt to rename a stale version of shortURL", zap.String("shortURL", shortURL))
+			return types.URLData{}, ErrVersionMismatch
+		}
+		from, to := s.shard(shortURL), s.shard(newShortURL)
+		if _, exists := to.urls[newShortURL]; exists {
+			s.logger.Warn("Attempt to rename to existing shortURL", zap.String("shortURL", newShortURL))
+			return types.URLData{}, ErrShortURLExists
+		}
+
+		urlData = updatedRecord(oldURLData, urlData)
+		s.unindex(oldURLData)
+		delete(from.urls, shortURL)
+		to.urls[newShortURL] = urlData
+		to.accessCounts[newShortURL] = from.accessCounts[shortURL]
+		delete(from.accessCounts, shortURL)
+		s.index(urlData)
+		s.forget(shortURL)
+		s.touch(newShortURL)
+		s.logger.Info("Renamed shortURL", zap.String("shortURL", shortURL), zap.String("newShortURL", newShortURL))
+		return s.export(urlData), nil
 	}
 }
 
@@ -157,17 +489,580 @@ func (s *InMemoryStorage) Delete(ctx context.Context, shortURL string) error {
 		s.logger.Warn("Delete operation cancelled", zap.String("shortURL", shortURL))
 		return ctx.Err()
 	default:
-		s.mu.Lock()
-		defer s.mu.Unlock()
+		urlData, exists, unlock := s.lockRecord(shortURL)
+		defer unlock()
 
-		if _, exists := s.urls[shortURL]; !exists {
+		if !exists {
 			s.logger.Warn("Attempt to delete non-existent shortURL", zap.String("shortURL", shortURL))
 			return ErrShortURLNotFound
 		}
 
-		delete(s.urls, shortURL)
-		s.count--
+		s.remove(shortURL, urlData)
 		s.logger.Info("Deleted shortURL", zap.String("shortURL", shortURL))
 		return nil
 	}
 }
+
+// ReplaceAll atomically swaps the entire dataset for the given items.
+// The new dataset is validated before the existing one is discarded, so on error
+// the storage is left untouched. Timestamps are preserved as provided, which makes
+// this suitable for restoring from a backup.
+func (s *InMemoryStorage) ReplaceAll(ctx context.Context, items []types.URLData) error {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("ReplaceAll operation cancelled", zap.Int("items", len(items)))
+		return ctx.Err()
+	default:
+		if len(items) > s.capacity {
+			s.logger.Error("Storage capacity reached. Cannot replace dataset",
+				zap.Int("items", len(items)),
+				zap.Int("capacity", s.capacity))
+			return ErrStorageCapacityReached
+		}
+
+		shards := make([]*inMemoryShard, len(s.shards))
+		for i := range shards {
+			shards[i] = newInMemoryShard(s.capacity / len(shards))
+		}
+		now := time.Now().UTC()
+		for _, urlData := range items {
+			shard := shards[s.shardIndex(urlData.ShortURL)]
+			if _, exists := shard.urls[urlData.ShortURL]; exists {
+				s.logger.Warn("Duplicate shortURL in replacement dataset", zap.String("shortURL", urlData.ShortURL))
+				return ErrShortURLExists
+			}
+			external := shards[s.shardIndex(urlData.ExternalID)]
+			if _, exists := external.externalToShort[urlData.ExternalID]; exists {
+				s.logger.Warn("Duplicate external ID in replacement dataset", zap.String("externalID", urlData.ExternalID))
+				return ErrExternalIDExists
+			}
+			if urlData.CreatedAt.IsZero() {
+				urlData.CreatedAt = now
+			}
+			if urlData.UpdatedAt.IsZero() {
+				urlData.UpdatedAt = urlData.CreatedAt
+			}
+			shard.accessCounts[urlData.ShortURL] = new(atomic.Int64)
+			shard.accessCounts[urlData.ShortURL].Store(urlData.AccessCount)
+			urlData.AccessCount = 0
+			shard.urls[urlData.ShortURL] = urlData
+			shards[s.shardIndex(urlData.LookupKey())].originalToShort[urlData.LookupKey()] = urlData.ShortURL
+			if urlData.ExternalID != "" {
+				external.externalToShort[urlData.ExternalID] = urlData.ShortURL
+			}
+		}
+
+		unlock := s.lockAll()
+		defer unlock()
+
+		for i, shard := range shards {
+			s.shards[i].urls = shard.urls
+			s.shards[i].originalToShort = shard.originalToShort
+			s.shards[i].externalToShort = shard.externalToShort
+			s.shards[i].accessCounts = shard.accessCounts
+		}
+		s.count.Store(int64(len(items)))
+		if s.eviction == EvictionLRU {
+			s.recency.Init()
+			s.elements = make(map[string]*list.Element, s.capacity)
+			for _, urlData := range items {
+				s.touch(urlData.ShortURL)
+			}
+		}
+		s.logger.Info("Replaced storage dataset", zap.Int("count", len(items)))
+		return nil
+	}
+}
+
+// ListByTag returns every stored URL carrying the given tag, oldest first.
+func (s *InMemoryStorage) ListByTag(ctx context.Context, tag string) ([]types.URLData, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("ListByTag operation cancelled", zap.String("tag", tag))
+		return nil, ctx.Err()
+	default:
+		unlock := s.rlockAll()
+		defer unlock()
+
+		var items []types.URLData
+		scanned := 0
+		for _, shard := range s.shards {
+			for _, urlData := range shard.urls {
+				if scanned++; scanned%scanCancellationInterval == 0 {
+					if err := ctx.Err(); err != nil {
+						s.logger.Warn("ListByTag operation cancelled", zap.String("tag", tag))
+						return nil, err
+					}
+				}
+				if hasTag(urlData, tag) {
+					items = append(items, s.export(urlData))
+				}
+			}
+		}
+		sortByCreation(items)
+		s.logger.Debug("Listed URLs by tag", zap.String("tag", tag), zap.Int("count", len(items)))
+		return items, nil
+	}
+}
+
+// TopN returns the n most accessed unexpired URLs, most accessed first. Only the top n are kept
+// while scanning, so the whole dataset is never copied or sorted.
+func (s *InMemoryStorage) TopN(ctx context.Context, n int) ([]types.URLData, error) {
+	if n <= 0 {
+		return nil, ErrInvalidPagination
+	}
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("TopN operation cancelled", zap.Int("n", n))
+		return nil, ctx.Err()
+	default:
+		unlock := s.rlockAll()
+		defer unlock()
+
+		now := time.Now()
+		ranking := newAccessRanking(n)
+		scanned := 0
+		for _, shard := range s.shards {
+			for shortURL, urlData := range shard.urls {
+				if scanned++; scanned%scanCancellationInterval == 0 {
+					if err := ctx.Err(); err != nil {
+						s.logger.Warn("TopN operation cancelled", zap.Int("n", n))
+						return nil, err
+					}
+				}
+				if urlData.Expired(now) || urlData.Deleted() {
+					continue
+				}
+				if counter, exists := shard.accessCounts[shortURL]; exists {
+					urlData.AccessCount = counter.Load()
+				}
+				ranking.add(urlData)
+			}
+		}
+
+		items := ranking.sorted()
+		for i := range items {
+			items[i] = cloneURLData(items[i])
+		}
+		return items, nil
+	}
+}
+
+// List returns a page of stored URLs ordered by creation time, and the total number of stored URLs.
+// The returned items are copies, so callers can't mutate the storage's internal state.
+func (s *InMemoryStorage) List(ctx context.Context, offset, limit int) ([]types.URLData, int, error) {
+	if err := validatePagination(offset, limit); err != nil {
+		return nil, 0, err
+	}
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("List operation cancelled", zap.Int("offset", offset), zap.Int("limit", limit))
+		return nil, 0, ctx.Err()
+	default:
+		unlock := s.rlockAll()
+		defer unlock()
+
+		items := make([]types.URLData, 0, s.count.Load())
+		for _, shard := range s.shards {
+			for _, urlData := range shard.urls {
+				if len(items)%scanCancellationInterval == 0 {
+					if err := ctx.Err(); err != nil {
+						s.logger.Warn("List operation cancelled", zap.Int("offset", offset), zap.Int("limit", limit))
+						return nil, 0, err
+					}
+				}
+				items = append(items, urlData)
+			}
+		}
+
+		sortByCreation(items)
+		page := paginate(items, offset, limit)
+		for i := range page {
+			page[i] = s.export(page[i])
+		}
+		return page, len(items), nil
+	}
+}
+
+// ForEach calls fn with a copy of every stored URL, shard by shard and by short URL within a
+// shard. Each shard is read a page of forEachPageSize records at a time, resuming after the last
+// short URL of the previous page, so that no more than a page is ever copied and the read lock of
+// a shard is released before fn is called.
+func (s *InMemoryStorage) ForEach(ctx context.Context, fn func(types.URLData) error) error {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("ForEach operation cancelled")
+		return ctx.Err()
+	default:
+		for _, shard := range s.shards {
+			after, first := "", true
+			for {
+				page, err := s.shardPage(ctx, shard, after, first)
+				if err != nil {
+					s.logger.Warn("ForEach operation cancelled")
+					return err
+				}
+				for _, urlData := range page {
+					if err := fn(urlData); err != nil {
+						return err
+					}
+				}
+				if len(page) < s.forEachPageSize {
+					break
+				}
+				after, first = page[len(page)-1].ShortURL, false
+			}
+		}
+		return nil
+	}
+}
+
+// shardPage returns copies of the forEachPageSize records of shard with the lowest short URLs
+// after the given one, or from the lowest one on when first is set, ordered by short URL. Only
+// twice a page of candidates is kept while scanning.
+func (s *InMemoryStorage) shardPage(ctx context.Context, shard *inMemoryShard, after string, first bool) ([]types.URLData, error) {
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	size := s.forEachPageSize
+	byShortURL := func(a, b types.URLData) int { return strings.Compare(a.ShortURL, b.ShortURL) }
+	page := make([]types.URLData, 0, 2*size)
+	scanned := 0
+	for shortURL, urlData := range shard.urls {
+		if scanned++; scanned%scanCancellationInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if !first && shortURL <= after {
+			continue
+		}
+		if page = append(page, urlData); len(page) == 2*size {
+			slices.SortFunc(page, byShortURL)
+			page = page[:size]
+		}
+	}
+	slices.SortFunc(page, byShortURL)
+	page = page[:min(len(page), size)]
+	for i := range page {
+		page[i] = s.export(page[i])
+	}
+	return page, nil
+}
+
+// Ping always succeeds, as the in-memory storage has no external dependency.
+func (s *InMemoryStorage) Ping(ctx context.Context) error {
+	return nil
+}
+
+// IncrementAccess adds one to the access count of a short URL.
+// It only takes the read lock, so concurrent redirects don't serialize on each other.
+func (s *InMemoryStorage) IncrementAccess(ctx context.Context, shortURL string) error {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("IncrementAccess operation cancelled", zap.String("shortURL", shortURL))
+		return ctx.Err()
+	default:
+		shard := s.shard(shortURL)
+		shard.mu.RLock()
+		defer shard.mu.RUnlock()
+
+		counter, exists := shard.accessCounts[shortURL]
+		if !exists {
+			return ErrShortURLNotFound
+		}
+		counter.Add(1)
+		return nil
+	}
+}
+
+// RecordCheck stores the result of a reachability check without touching UpdatedAt or the LRU order.
+func (s *InMemoryStorage) RecordCheck(ctx context.Context, shortURL, originalURL string, checkedAt time.Time, status int) error {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("RecordCheck operation cancelled", zap.String("shortURL", shortURL))
+		return ctx.Err()
+	default:
+		shard := s.shard(shortURL)
+		shard.mu.Lock()
+		defer shard.mu.Unlock()
+
+		urlData, exists := shard.urls[shortURL]
+		if !exists {
+			return ErrShortURLNotFound
+		}
+		if urlData.OriginalURL != originalURL {
+			return nil
+		}
+		urlData.LastCheckedAt = checkedAt.UTC()
+		urlData.LastStatus = status
+		shard.urls[shortURL] = urlData
+		return nil
+	}
+}
+
+// StartCleanup schedules a purge of expired and long soft-deleted URLs on pool every interval, until the pool is stopped.
+// A non-positive interval disables the cleanup.
+func (s *InMemoryStorage) StartCleanup(pool *workerpool.Pool, interval time.Duration) {
+	if interval <= 0 {
+		s.logger.Warn("Expired URL cleanup disabled", zap.Duration("interval", interval))
+		return
+	}
+	pool.Schedule(interval, func(context.Context) {
+		if purged := s.purgeExpired(time.Now()); purged > 0 {
+			s.logger.Info("Purged expired URLs", zap.Int("purged", purged))
+		}
+	})
+}
+
+// purgeExpired deletes every URL that has expired at now, or was soft-deleted longer than the soft
+// delete retention before it, and returns how many were removed.
+func (s *InMemoryStorage) purgeExpired(now time.Time) int {
+	unlock := s.lockAll()
+	defer unlock()
+
+	purged := 0
+	for _, shard := range s.shards {
+		for shortURL, urlData := range shard.urls {
+			if urlData.Expired(now) || s.retentionElapsed(urlData, now) {
+				s.remove(shortURL, urlData)
+				purged++
+			}
+		}
+	}
+	return purged
+}
+
+// retentionElapsed reports whether urlData was soft-deleted at least the soft delete retention before now.
+func (s *InMemoryStorage) retentionElapsed(urlData types.URLData, now time.Time) bool {
+	return urlData.Deleted() && s.softDeleteRetention > 0 && !now.Before(urlData.DeletedAt.Add(s.softDeleteRetention))
+}
+
+// Usage returns the current number of stored URLs and the storage capacity, without taking any
+// lock, so it can be polled, e.g. by monitoring, without slowing down writes.
+func (s *InMemoryStorage) Usage(ctx context.Context) (int, int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	return s.Len(), s.Cap(), nil
+}
+
+// Len returns the current number of stored URLs. It reads the atomic count, without taking any lock.
+func (s *InMemoryStorage) Len() int {
+	return int(s.count.Load())
+}
+
+// Cap returns the maximum number of URLs that can be stored.
+func (s *InMemoryStorage) Cap() int {
+	return s.capacity
+}
+
+// shardIndex returns the index of the shard key belongs to, from its FNV-1a hash.
+func (s *InMemoryStorage) shardIndex(key string) int {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return int(hash % uint32(len(s.shards)))
+}
+
+// shard returns the shard key belongs to.
+func (s *InMemoryStorage) shard(key string) *inMemoryShard {
+	return s.shards[s.shardIndex(key)]
+}
+
+// covers reports whether the shard of key is among the shards of keys.
+func (s *InMemoryStorage) covers(keys []string, key string) bool {
+	index := s.shardIndex(key)
+	return slices.ContainsFunc(keys, func(k string) bool { return s.shardIndex(k) == index })
+}
+
+// shardIndexes returns the distinct indexes of the shards of keys, in ascending order.
+func (s *InMemoryStorage) shardIndexes(keys []string) []int {
+	indexes := make([]int, 0, len(keys))
+	for _, key := range keys {
+		indexes = append(indexes, s.shardIndex(key))
+	}
+	slices.Sort(indexes)
+	return slices.Compact(indexes)
+}
+
+// lockShards write-locks the shards of keys and returns the function unlocking them.
+func (s *InMemoryStorage) lockShards(keys ...string) func() {
+	indexes := s.shardIndexes(keys)
+	for _, i := range indexes {
+		s.shards[i].mu.Lock()
+	}
+	return func() {
+		for _, i := range indexes {
+			s.shards[i].mu.Unlock()
+		}
+	}
+}
+
+// rlockShards read-locks the shards of keys and returns the function unlocking them.
+func (s *InMemoryStorage) rlockShards(keys ...string) func() {
+	indexes := s.shardIndexes(keys)
+	for _, i := range indexes {
+		s.shards[i].mu.RLock()
+	}
+	return func() {
+		for _, i := range indexes {
+			s.shards[i].mu.RUnlock()
+		}
+	}
+}
+
+// lockAll write-locks every shard and returns the function unlocking them.
+func (s *InMemoryStorage) lockAll() func() {
+	for _, shard := range s.shards {
+		shard.mu.Lock()
+	}
+	return func() {
+		for _, shard := range s.shards {
+			shard.mu.Unlock()
+		}
+	}
+}
+
+// rlockAll read-locks every shard and returns the function unlocking them.
+func (s *InMemoryStorage) rlockAll() func() {
+	for _, shard := range s.shards {
+		shard.mu.RLock()
+	}
+	return func() {
+		for _, shard := range s.shards {
+			shard.mu.RUnlock()
+		}
+	}
+}
+
+// lockRecord write-locks the shards of shortURL, of the index entries of its record and of
+// extraKeys, and returns the record, whether it exists and the function unlocking them. The
+// record is read first to learn its index keys, and read again once they are locked, until it
+// hasn't changed them in between.
+func (s *InMemoryStorage) lockRecord(shortURL string, extraKeys ...string) (types.URLData, bool, func()) {
+	shard := s.shard(shortURL)
+	for {
+		shard.mu.RLock()
+		peeked, existed := shard.urls[shortURL]
+		shard.mu.RUnlock()
+
+		keys := append([]string{shortURL}, extraKeys...)
+		if existed {
+			keys = append(keys, indexKeys(peeked)...)
+		}
+		unlock := s.lockShards(keys...)
+		urlData, exists := shard.urls[shortURL]
+		if exists == existed && slices.Equal(indexKeys(urlData), indexKeys(peeked)) {
+			return urlData, exists, unlock
+		}
+		unlock()
+	}
+}
+
+// indexKeys returns the keys urlData is indexed under: its lookup key and, if any, its external ID.
+func indexKeys(urlData types.URLData) []string {
+	if urlData.ExternalID == "" {
+		return []string{urlData.LookupKey()}
+	}
+	return []string{urlData.LookupKey(), urlData.ExternalID}
+}
+
+// remove deletes the record urlData of shortURL, with its access count and index entries. The
+// caller must hold the shards of shortURL and of the index keys of urlData for writing.
+func (s *InMemoryStorage) remove(shortURL string, urlData types.URLData) {
+	shard := s.shard(shortURL)
+	delete(shard.urls, shortURL)
+	delete(shard.accessCounts, shortURL)
+	s.unindex(urlData)
+	s.count.Add(-1)
+	s.forget(shortURL)
+}
+
+// export returns a copy of a stored URLData carrying its current access count.
+// The caller must hold the shard of its short URL for reading.
+func (s *InMemoryStorage) export(urlData types.URLData) types.URLData {
+	urlData = cloneURLData(urlData)
+	if counter, exists := s.shard(urlData.ShortURL).accessCounts[urlData.ShortURL]; exists {
+		urlData.AccessCount = counter.Load()
+	}
+	return urlData
+}
+
+// index points the reverse index at urlData. The caller must hold the shards of its index keys
+// for writing.
+func (s *InMemoryStorage) index(urlData types.URLData) {
+	lookupKey := urlData.LookupKey()
+	s.shard(lookupKey).originalToShort[lookupKey] = urlData.ShortURL
+	if urlData.ExternalID != "" {
+		s.shard(urlData.ExternalID).externalToShort[urlData.ExternalID] = urlData.ShortURL
+	}
+}
+
+// unindex removes urlData from the reverse index and the external ID index if they still
+// point at it. The caller must hold the shards of its index keys for writing.
+func (s *InMemoryStorage) unindex(urlData types.URLData) {
+	lookupKey := urlData.LookupKey()
+	if index := s.shard(lookupKey); index.originalToShort[lookupKey] == urlData.ShortURL {
+		delete(index.originalToShort, lookupKey)
+	}
+	if urlData.ExternalID == "" {
+		return
+	}
+	if index := s.shard(urlData.ExternalID); index.externalToShort[urlData.ExternalID] == urlData.ShortURL {
+		delete(index.externalToShort, urlData.ExternalID)
+	}
+}
+
+// touch marks shortURL as the most recently accessed entry. It is a no-op unless LRU eviction
+// is enabled, and only needs its shard held for reading since recency has its own lock.
+func (s *InMemoryStorage) touch(shortURL string) {
+	if s.eviction != EvictionLRU {
+		return
+	}
+	s.lruMu.Lock()
+	defer s.lruMu.Unlock()
+
+	if element, ok := s.elements[shortURL]; ok {
+		s.recency.MoveToFront(element)
+		return
+	}
+	s.elements[shortURL] = s.recency.PushFront(shortURL)
+}
+
+// forget drops shortURL from the recency list. The caller must hold its shard for writing.
+func (s *InMemoryStorage) forget(shortURL string) {
+	if s.eviction != EvictionLRU {
+		return
+	}
+	s.lruMu.Lock()
+	defer s.lruMu.Unlock()
+
+	if element, ok := s.elements[shortURL]; ok {
+		s.recency.Remove(element)
+		delete(s.elements, shortURL)
+	}
+}
+
+// evictLeastRecentlyUsed removes the least recently accessed entry, and reports whether there was
+// one. The caller must hold no shard, as the entry's shards are locked to remove it.
+func (s *InMemoryStorage) evictLeastRecentlyUsed() bool {
+	s.lruMu.Lock()
+	oldest := s.recency.Back()
+	s.lruMu.Unlock()
+	if oldest == nil {
+		return false
+	}
+	shortURL := oldest.Value.(string)
+
+	urlData, exists, unlock := s.lockRecord(shortURL)
+	defer unlock()
+	if exists {
+		// Removed by someone else in the meantime otherwise, which made room all the same
+		s.remove(shortURL, urlData)
+		s.logger.Info("Evicted least recently used shortURL", zap.String("shortURL", shortURL))
+	}
+	return true
+}
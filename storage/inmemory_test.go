@@ -2,13 +2,17 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go-url-shortening/types"
+	"go-url-shortening/workerpool"
 	"go.uber.org/zap"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestInMemoryStorage(t *testing.T) {
@@ -61,7 +65,7 @@ func TestInMemoryStorage(t *testing.T) {
 		assert.Equal(t, ErrShortURLNotFound, err, "ShortURL should not have been added to the storage")
 
 		// Verify that the count hasn't increased
-		assert.Equal(t, 0, cancelStorage.count, "Storage count should remain 0")
+		assert.Equal(t, 0, int(cancelStorage.count.Load()), "Storage count should remain 0")
 	})
 
 	t.Run("Read", func(t *testing.T) {
@@ -84,22 +88,23 @@ func TestInMemoryStorage(t *testing.T) {
 
 	t.Run("Update", func(t *testing.T) {
 		// Test updating existent URL
-		storage.urls["abc123"] = types.URLData{ShortURL: "abc123", OriginalURL: "http://example.com"}
-		err := storage.Update(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://updated.com"})
+		storage.shard("abc123").urls["abc123"] = types.URLData{ShortURL: "abc123", OriginalURL: "http://example.com"}
+		updated, err := storage.Update(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://updated.com"})
 		assert.NoError(t, err)
 
 		urlData, err := storage.GetURLData(ctx, "abc123")
 		assert.NoError(t, err)
 		assert.Equal(t, "https://updated.com", urlData.OriginalURL)
+		assert.Equal(t, urlData, updated, "Update should return the record as stored")
 
 		// Test updating non-existent URL
-		err = storage.Update(ctx, types.URLData{ShortURL: "nonexistent", OriginalURL: "https://new.com"})
+		_, err = storage.Update(ctx, types.URLData{ShortURL: "nonexistent", OriginalURL: "https://new.com"})
 		assert.Equal(t, ErrShortURLNotFound, err)
 
 		// Test context cancellation
 		cancelCtx, cancel := context.WithCancel(ctx)
 		cancel()
-		err = storage.Update(cancelCtx, types.URLData{ShortURL: "abc123", OriginalURL: "https://cancelled.com"})
+		_, err = storage.Update(cancelCtx, types.URLData{ShortURL: "abc123", OriginalURL: "https://cancelled.com"})
 		assert.Equal(t, context.Canceled, err)
 
 		// Verify that the URL was not updated after cancellation
@@ -108,9 +113,72 @@ func TestInMemoryStorage(t *testing.T) {
 		assert.Equal(t, "https://updated.com", urlData.OriginalURL)
 	})
 
+	t.Run("CompareAndUpdate", func(t *testing.T) {
+		storage := NewInMemoryStorage(10, logger)
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}))
+		read, err := storage.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+
+		// Two updates of the version just read race; only one of them may win
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = storage.CompareAndUpdate(ctx,
+					types.URLData{ShortURL: "abc123", OriginalURL: fmt.Sprintf("https://update%d.com", i)}, read.UpdatedAt)
+			}(i)
+		}
+		wg.Wait()
+		assert.ElementsMatch(t, []error{nil, ErrVersionMismatch}, errs)
+
+		_, err = storage.CompareAndUpdate(ctx, types.URLData{ShortURL: "missing", OriginalURL: "https://new.com"}, read.UpdatedAt)
+		assert.Equal(t, ErrShortURLNotFound, err)
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		storage := NewInMemoryStorage(10, logger, WithEvictionPolicy(EvictionLRU))
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com", ExternalID: "order-1"}))
+		require.NoError(t, storage.IncrementAccess(ctx, "abc123"))
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "taken", OriginalURL: "https://other.com"}))
+		before, err := storage.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+
+		_, err = storage.Rename(ctx, "abc123", types.URLData{ShortURL: "docs", OriginalURL: "https://example.org"}, before.UpdatedAt.Add(-time.Second))
+		assert.Equal(t, ErrVersionMismatch, err)
+
+		renamed, err := storage.Rename(ctx, "abc123", types.URLData{ShortURL: "docs", OriginalURL: "https://example.org"}, before.UpdatedAt)
+		require.NoError(t, err)
+		assert.Equal(t, "docs", renamed.ShortURL)
+		assert.Equal(t, "https://example.org", renamed.OriginalURL, "The update should be stored along with the rename")
+		assert.Equal(t, "order-1", renamed.ExternalID)
+		assert.Equal(t, before.CreatedAt, renamed.CreatedAt)
+		assert.Equal(t, int64(1), renamed.AccessCount, "The access count moves with the record")
+
+		_, err = storage.GetURLData(ctx, "abc123")
+		assert.Equal(t, ErrShortURLNotFound, err)
+		_, err = storage.GetShortURL(ctx, "https://example.com")
+		assert.Equal(t, ErrShortURLNotFound, err, "The old destination should no longer be indexed")
+		shortURL, err := storage.GetShortURL(ctx, "https://example.org")
+		require.NoError(t, err)
+		assert.Equal(t, "docs", shortURL)
+		byExternal, err := storage.GetByExternalID(ctx, "order-1")
+		require.NoError(t, err)
+		assert.Equal(t, "docs", byExternal.ShortURL)
+		assert.Len(t, storage.elements, 2, "The recency list should follow the rename")
+		assert.Contains(t, storage.elements, "docs")
+
+		_, err = storage.Rename(ctx, "docs", types.URLData{ShortURL: "taken", OriginalURL: "https://example.org"}, time.Time{})
+		assert.Equal(t, ErrShortURLExists, err)
+		_, err = storage.Rename(ctx, "missing", types.URLData{ShortURL: "free", OriginalURL: "https://example.org"}, time.Time{})
+		assert.Equal(t, ErrShortURLNotFound, err)
+		assert.Equal(t, 2, int(storage.count.Load()))
+	})
+
 	t.Run("Delete", func(t *testing.T) {
 		// Test deleting existent URL
-		storage.urls["abc123"] = types.URLData{OriginalURL: "http://example.com"}
+		storage.shard("abc123").urls["abc123"] = types.URLData{OriginalURL: "http://example.com"}
 		err := storage.Delete(ctx, "abc123")
 		assert.NoError(t, err)
 
@@ -143,7 +211,7 @@ func TestInMemoryStorage(t *testing.T) {
 		assert.NoError(t, err, "ShortURL should still exist in the storage")
 
 		// Verify that the count hasn't decreased
-		assert.Equal(t, 1, cancelStorage.count, "Storage count should remain 1")
+		assert.Equal(t, 1, int(cancelStorage.count.Load()), "Storage count should remain 1")
 	})
 
 	t.Run("Concurrent operations", func(t *testing.T) {
@@ -167,7 +235,7 @@ func TestInMemoryStorage(t *testing.T) {
 				assert.Equal(t, originalURL, urlData.OriginalURL)
 
 				newURL := fmt.Sprintf("https://updated.com/%d", i)
-				err = storage.Update(context.Background(), types.URLData{ShortURL: shortURL, OriginalURL: newURL})
+				_, err = storage.Update(context.Background(), types.URLData{ShortURL: shortURL, OriginalURL: newURL})
 				assert.NoError(t, err)
 
 				err = storage.Delete(context.Background(), shortURL)
@@ -177,7 +245,7 @@ func TestInMemoryStorage(t *testing.T) {
 
 		wg.Wait()
 
-		assert.Equal(t, 0, storage.count, "All entries should have been deleted")
+		assert.Equal(t, 0, int(storage.count.Load()), "All entries should have been deleted")
 	})
 
 	t.Run("GetShortURL", func(t *testing.T) {
@@ -206,6 +274,77 @@ func TestInMemoryStorage(t *testing.T) {
 		assert.Equal(t, context.Canceled, err)
 	})
 
+	t.Run("GetOrCreate", func(t *testing.T) {
+		storage := NewInMemoryStorage(10, zap.NewNop())
+
+		created, isNew, err := storage.GetOrCreate(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"})
+		require.NoError(t, err)
+		assert.True(t, isNew)
+		assert.Equal(t, "abc123", created.ShortURL)
+		assert.False(t, created.CreatedAt.IsZero())
+
+		require.NoError(t, storage.IncrementAccess(ctx, "abc123"))
+		existing, isNew, err := storage.GetOrCreate(ctx, types.URLData{ShortURL: "def456", OriginalURL: "https://example.com"})
+		require.NoError(t, err)
+		assert.False(t, isNew)
+		assert.Equal(t, "abc123", existing.ShortURL)
+		assert.Equal(t, int64(1), existing.AccessCount)
+		_, err = storage.GetURLData(ctx, "def456")
+		assert.Equal(t, ErrShortURLNotFound, err, "Nothing should be created for a stored original URL")
+
+		_, _, err = storage.GetOrCreate(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://other.com"})
+		assert.Equal(t, ErrShortURLExists, err)
+
+		cancelCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, _, err = storage.GetOrCreate(cancelCtx, types.URLData{ShortURL: "ghi789", OriginalURL: "https://cancelled.com"})
+		assert.Equal(t, context.Canceled, err)
+	})
+
+	t.Run("GetOrCreate replaces expired and deleted records", func(t *testing.T) {
+		storage := NewInMemoryStorage(10, logger)
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "expired", OriginalURL: "https://example.com", ExpiresAt: time.Now().Add(-time.Second)}))
+
+		created, isNew, err := storage.GetOrCreate(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"})
+		require.NoError(t, err)
+		assert.True(t, isNew)
+		assert.Equal(t, "abc123", created.ShortURL)
+
+		_, err = storage.MarkDeleted(ctx, "abc123", time.Now())
+		require.NoError(t, err)
+		created, isNew, err = storage.GetOrCreate(ctx, types.URLData{ShortURL: "def456", OriginalURL: "https://example.com"})
+		require.NoError(t, err)
+		assert.True(t, isNew)
+		assert.Equal(t, "def456", created.ShortURL)
+
+		existing, isNew, err := storage.GetOrCreate(ctx, types.URLData{ShortURL: "ghi789", OriginalURL: "https://example.com"})
+		require.NoError(t, err)
+		assert.False(t, isNew, "The index should point at the replacement")
+		assert.Equal(t, "def456", existing.ShortURL)
+	})
+
+	t.Run("Concurrent GetOrCreate of one original URL", func(t *testing.T) {
+		storage := NewInMemoryStorage(100, zap.NewNop())
+
+		var wg sync.WaitGroup
+		var created atomic.Int32
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, isNew, err := storage.GetOrCreate(ctx, types.URLData{ShortURL: fmt.Sprintf("code%d", i), OriginalURL: "https://example.com"})
+				assert.NoError(t, err)
+				if isNew {
+					created.Add(1)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), created.Load())
+		assert.Equal(t, 1, int(storage.count.Load()))
+	})
+
 	t.Run("Storage count accuracy", func(t *testing.T) {
 		logger := zap.NewNop()
 		storage := NewInMemoryStorage(10, logger)
@@ -215,22 +354,22 @@ func TestInMemoryStorage(t *testing.T) {
 			err := storage.Create(ctx, types.URLData{ShortURL: fmt.Sprintf("short%d", i), OriginalURL: fmt.Sprintf("https://example%d.com", i)})
 			require.NoError(t, err)
 		}
-		assert.Equal(t, 5, storage.count)
+		assert.Equal(t, 5, int(storage.count.Load()))
 
 		// Update an entry (shouldn't change count)
-		err := storage.Update(ctx, types.URLData{ShortURL: "short0", OriginalURL: "https://updated.com"})
+		_, err := storage.Update(ctx, types.URLData{ShortURL: "short0", OriginalURL: "https://updated.com"})
 		require.NoError(t, err)
-		assert.Equal(t, 5, storage.count)
+		assert.Equal(t, 5, int(storage.count.Load()))
 
 		// Delete an entry
 		err = storage.Delete(ctx, "short1")
 		require.NoError(t, err)
-		assert.Equal(t, 4, storage.count)
+		assert.Equal(t, 4, int(storage.count.Load()))
 
 		// Try to create a duplicate (shouldn't change count)
 		err = storage.Create(ctx, types.URLData{ShortURL: "short2", OriginalURL: "https://duplicate.com"})
 		assert.Equal(t, ErrShortURLExists, err)
-		assert.Equal(t, 4, storage.count)
+		assert.Equal(t, 4, int(storage.count.Load()))
 	})
 
 	t.Run("Concurrent operations with specific scenarios", func(t *testing.T) {
@@ -251,7 +390,7 @@ func TestInMemoryStorage(t *testing.T) {
 			}()
 		}
 		wg.Wait()
-		assert.Equal(t, 1, storage.count, "Only one entry should have been created")
+		assert.Equal(t, 1, int(storage.count.Load()), "Only one entry should have been created")
 
 		// Scenario 2: Concurrent reads and updates
 		err := storage.Create(context.Background(), types.URLData{ShortURL: "readupdate", OriginalURL: "https://original.com"})
@@ -265,12 +404,837 @@ func TestInMemoryStorage(t *testing.T) {
 					_, err := storage.GetURLData(context.Background(), "readupdate")
 					assert.NoError(t, err)
 				} else {
-					err := storage.Update(context.Background(), types.URLData{ShortURL: "readupdate", OriginalURL: fmt.Sprintf("https://updated%d.com", i)})
+					_, err := storage.Update(context.Background(), types.URLData{ShortURL: "readupdate", OriginalURL: fmt.Sprintf("https://updated%d.com", i)})
 					assert.NoError(t, err)
 				}
 			}(i)
 		}
 		wg.Wait()
-		assert.Equal(t, 2, storage.count, "Count should remain 2 after concurrent reads and updates")
+		assert.Equal(t, 2, int(storage.count.Load()), "Count should remain 2 after concurrent reads and updates")
+		assert.Equal(t, len(shardedURLs(storage)), storage.Len())
+		assert.Equal(t, 1000, storage.Cap())
+	})
+
+	t.Run("Concurrent creates across shards never exceed the capacity", func(t *testing.T) {
+		storage := NewInMemoryStorage(10, zap.NewNop())
+		var wg sync.WaitGroup
+		var created atomic.Int64
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				err := storage.Create(ctx, types.URLData{ShortURL: fmt.Sprintf("url%d", i), OriginalURL: fmt.Sprintf("https://example.com/%d", i)})
+				if err == nil {
+					created.Add(1)
+				} else if err != ErrStorageCapacityReached {
+					t.Errorf("Unexpected error: %v", err)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Equal(t, int64(10), created.Load())
+		assert.Equal(t, 10, storage.Len())
+		assert.Len(t, shardedURLs(storage), 10)
+	})
+}
+
+func TestInMemoryStorageReplaceAll(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+
+	t.Run("Store exactly equals provided items", func(t *testing.T) {
+		storage := NewInMemoryStorage(10, logger)
+		for i := 0; i < 3; i++ {
+			err := storage.Create(ctx, types.URLData{ShortURL: fmt.Sprintf("old%d", i), OriginalURL: fmt.Sprintf("https://old%d.com", i)})
+			require.NoError(t, err)
+		}
+
+		createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		items := []types.URLData{
+			{ShortURL: "new0", OriginalURL: "https://new0.com", CreatedAt: createdAt, UpdatedAt: createdAt},
+			{ShortURL: "new1", OriginalURL: "https://new1.com", CreatedAt: createdAt, UpdatedAt: createdAt.Add(time.Hour)},
+		}
+		err := storage.ReplaceAll(ctx, items)
+		require.NoError(t, err)
+
+		expected := map[string]types.URLData{
+			"new0": items[0],
+			"new1": items[1],
+		}
+		assert.Equal(t, expected, shardedURLs(storage))
+		assert.Equal(t, len(items), int(storage.count.Load()))
+
+		_, err = storage.GetURLData(ctx, "old0")
+		assert.Equal(t, ErrShortURLNotFound, err)
+	})
+
+	t.Run("Invalid dataset leaves storage untouched", func(t *testing.T) {
+		storage := NewInMemoryStorage(2, logger)
+		err := storage.Create(ctx, types.URLData{ShortURL: "keep", OriginalURL: "https://keep.com"})
+		require.NoError(t, err)
+
+		err = storage.ReplaceAll(ctx, []types.URLData{
+			{ShortURL: "dup", OriginalURL: "https://a.com"},
+			{ShortURL: "dup", OriginalURL: "https://b.com"},
+		})
+		assert.Equal(t, ErrShortURLExists, err)
+
+		err = storage.ReplaceAll(ctx, []types.URLData{{ShortURL: "a"}, {ShortURL: "b"}, {ShortURL: "c"}})
+		assert.Equal(t, ErrStorageCapacityReached, err)
+
+		_, err = storage.GetURLData(ctx, "keep")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, int(storage.count.Load()))
+	})
+
+	t.Run("Context cancellation", func(t *testing.T) {
+		storage := NewInMemoryStorage(10, logger)
+		cancelCtx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		err := storage.ReplaceAll(cancelCtx, []types.URLData{{ShortURL: "cancelled"}})
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, 0, int(storage.count.Load()))
+	})
+}
+
+func TestInMemoryStorageCleanup(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	newStorageWithExpiries := func(t *testing.T) *InMemoryStorage {
+		storage := NewInMemoryStorage(10, zap.NewNop())
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "expired", OriginalURL: "https://expired.com", ExpiresAt: now.Add(-time.Minute)}))
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "boundary", OriginalURL: "https://boundary.com", ExpiresAt: now}))
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "future", OriginalURL: "https://future.com", ExpiresAt: now.Add(time.Hour)}))
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "forever", OriginalURL: "https://forever.com"}))
+		return storage
+	}
+
+	t.Run("purgeExpired removes only expired entries", func(t *testing.T) {
+		storage := newStorageWithExpiries(t)
+
+		assert.Equal(t, 2, storage.purgeExpired(now))
+		assert.Equal(t, 2, int(storage.count.Load()))
+		for _, shortURL := range []string{"expired", "boundary"} {
+			_, err := storage.GetURLData(ctx, shortURL)
+			assert.Equal(t, ErrShortURLNotFound, err, "%s should have been purged", shortURL)
+		}
+		for _, shortURL := range []string{"future", "forever"} {
+			_, err := storage.GetURLData(ctx, shortURL)
+			assert.NoError(t, err, "%s should have been kept", shortURL)
+		}
+	})
+
+	t.Run("StartCleanup purges periodically", func(t *testing.T) {
+		storage := newStorageWithExpiries(t)
+		pool := workerpool.New(1, 10)
+		defer pool.Stop()
+
+		storage.StartCleanup(pool, 10*time.Millisecond)
+
+		assert.Eventually(t, func() bool {
+			count, _, err := storage.Usage(ctx)
+			return err == nil && count == 2
+		}, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestInMemoryStorageSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	t.Run("MarkDeleted sets and clears the deletion time", func(t *testing.T) {
+		storage := NewInMemoryStorage(10, zap.NewNop())
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}))
+		created, err := storage.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+
+		deleted, err := storage.MarkDeleted(ctx, "abc123", now)
+		require.NoError(t, err)
+		assert.True(t, deleted.Deleted())
+		assert.True(t, now.Equal(deleted.DeletedAt))
+		assert.Equal(t, created.UpdatedAt, deleted.UpdatedAt, "Marking a URL deleted should not update it")
+
+		updated, err := storage.Update(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.org"})
+		require.NoError(t, err)
+		assert.True(t, updated.Deleted(), "Updates should keep the deletion mark")
+
+		restored, err := storage.MarkDeleted(ctx, "abc123", time.Time{})
+		require.NoError(t, err)
+		assert.False(t, restored.Deleted())
+
+		_, err = storage.MarkDeleted(ctx, "missing", now)
+		assert.Equal(t, ErrShortURLNotFound, err)
+	})
+
+	t.Run("purgeExpired removes URLs deleted longer than the retention", func(t *testing.T) {
+		storage := NewInMemoryStorage(10, zap.NewNop(), WithSoftDeleteRetention(time.Hour))
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "old", OriginalURL: "https://old.com"}))
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "recent", OriginalURL: "https://recent.com"}))
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "live", OriginalURL: "https://live.com"}))
+		_, err := storage.MarkDeleted(ctx, "old", now.Add(-time.Hour))
+		require.NoError(t, err)
+		_, err = storage.MarkDeleted(ctx, "recent", now.Add(-time.Minute))
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, storage.purgeExpired(now))
+		_, err = storage.GetURLData(ctx, "old")
+		assert.Equal(t, ErrShortURLNotFound, err)
+		for _, shortURL := range []string{"recent", "live"} {
+			_, err := storage.GetURLData(ctx, shortURL)
+			assert.NoError(t, err, "%s should have been kept", shortURL)
+		}
+	})
+
+	t.Run("purgeExpired keeps deleted URLs without a retention", func(t *testing.T) {
+		storage := NewInMemoryStorage(10, zap.NewNop())
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "old", OriginalURL: "https://old.com"}))
+		_, err := storage.MarkDeleted(ctx, "old", now.Add(-365*24*time.Hour))
+		require.NoError(t, err)
+
+		assert.Zero(t, storage.purgeExpired(now))
+	})
+}
+
+func TestInMemoryStorageListByTag(t *testing.T) {
+	ctx := context.Background()
+	storage := NewInMemoryStorage(10, zap.NewNop())
+	require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "a", OriginalURL: "https://a.com", Tags: []string{"campaignX", "team"}}))
+	require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "b", OriginalURL: "https://b.com", Tags: []string{"team"}}))
+	require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "c", OriginalURL: "https://c.com", Tags: []string{"campaignX"}}))
+	require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "d", OriginalURL: "https://d.com"}))
+
+	items, err := storage.ListByTag(ctx, "campaignX")
+	require.NoError(t, err)
+	shortURLs := make([]string, 0, len(items))
+	for _, item := range items {
+		shortURLs = append(shortURLs, item.ShortURL)
+	}
+	assert.Equal(t, []string{"a", "c"}, shortURLs, "Items should be listed oldest first")
+	assert.Equal(t, []string{"campaignX", "team"}, items[0].Tags)
+
+	items, err = storage.ListByTag(ctx, "unknown")
+	require.NoError(t, err)
+	assert.Empty(t, items)
+
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = storage.ListByTag(cancelCtx, "campaignX")
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestParseEvictionPolicy(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected EvictionPolicy
+		wantErr  bool
+	}{
+		{value: "", expected: EvictionReject},
+		{value: "reject", expected: EvictionReject},
+		{value: "lru", expected: EvictionLRU},
+		{value: "fifo", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		policy, err := ParseEvictionPolicy(tt.value)
+		if tt.wantErr {
+			assert.Error(t, err, "Expected an error for %q", tt.value)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, policy, "Unexpected policy for %q", tt.value)
+	}
+}
+
+func TestInMemoryStorageLRUEviction(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+
+	t.Run("Reject is the default", func(t *testing.T) {
+		storage := NewInMemoryStorage(1, logger)
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "a", OriginalURL: "https://a.com"}))
+		assert.Equal(t, ErrStorageCapacityReached, storage.Create(ctx, types.URLData{ShortURL: "b", OriginalURL: "https://b.com"}))
+	})
+
+	t.Run("Create evicts the least recently accessed URL", func(t *testing.T) {
+		storage := NewInMemoryStorage(2, logger, WithEvictionPolicy(EvictionLRU))
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "a", OriginalURL: "https://a.com"}))
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "b", OriginalURL: "https://b.com"}))
+
+		// Reading "a" makes "b" the least recently used entry
+		_, err := storage.GetURLData(ctx, "a")
+		require.NoError(t, err)
+
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "c", OriginalURL: "https://c.com"}))
+		assert.Equal(t, 2, int(storage.count.Load()))
+		_, err = storage.GetURLData(ctx, "b")
+		assert.Equal(t, ErrShortURLNotFound, err, "b should have been evicted")
+		for _, shortURL := range []string{"a", "c"} {
+			_, err := storage.GetURLData(ctx, shortURL)
+			assert.NoError(t, err, "%s should have been kept", shortURL)
+		}
+	})
+
+	t.Run("Duplicate create does not evict", func(t *testing.T) {
+		storage := NewInMemoryStorage(1, logger, WithEvictionPolicy(EvictionLRU))
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "a", OriginalURL: "https://a.com"}))
+
+		assert.Equal(t, ErrShortURLExists, storage.Create(ctx, types.URLData{ShortURL: "a", OriginalURL: "https://a.com"}))
+		_, err := storage.GetURLData(ctx, "a")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Deleted and replaced entries leave the recency list", func(t *testing.T) {
+		storage := NewInMemoryStorage(2, logger, WithEvictionPolicy(EvictionLRU))
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "a", OriginalURL: "https://a.com"}))
+		require.NoError(t, storage.Delete(ctx, "a"))
+		assert.Equal(t, 0, storage.recency.Len())
+
+		require.NoError(t, storage.ReplaceAll(ctx, []types.URLData{
+			{ShortURL: "x", OriginalURL: "https://x.com"},
+			{ShortURL: "y", OriginalURL: "https://y.com"},
+		}))
+		assert.Equal(t, 2, storage.recency.Len())
+		assert.Len(t, storage.elements, 2)
+	})
+
+	t.Run("Concurrent reads and creates", func(t *testing.T) {
+		storage := NewInMemoryStorage(10, logger, WithEvictionPolicy(EvictionLRU))
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+				assert.NoError(t, storage.Create(ctx, types.URLData{ShortURL: fmt.Sprintf("url%d", i), OriginalURL: "https://example.com"}))
+			}(i)
+			go func(i int) {
+				defer wg.Done()
+				_, _ = storage.GetURLData(ctx, fmt.Sprintf("url%d", i/2))
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Equal(t, 10, int(storage.count.Load()))
+		assert.Equal(t, 10, storage.recency.Len())
+		assert.Len(t, shardedURLs(storage), 10)
+	})
+}
+
+// shardedURLs merges the records of every shard of storage.
+func shardedURLs(storage *InMemoryStorage) map[string]types.URLData {
+	unlock := storage.rlockAll()
+	defer unlock()
+
+	urls := make(map[string]types.URLData)
+	for _, shard := range storage.shards {
+		for shortURL, urlData := range shard.urls {
+			urls[shortURL] = urlData
+		}
+	}
+	return urls
+}
+
+// shardedIndex merges the index picked by index from every shard of storage.
+func shardedIndex(storage *InMemoryStorage, index func(*inMemoryShard) map[string]string) map[string]string {
+	unlock := storage.rlockAll()
+	defer unlock()
+
+	merged := make(map[string]string)
+	for _, shard := range storage.shards {
+		for key, shortURL := range index(shard) {
+			merged[key] = shortURL
+		}
+	}
+	return merged
+}
+
+// assertIndexConsistent checks that the reverse index and the primary map describe the same data.
+func assertIndexConsistent(t *testing.T, storage *InMemoryStorage) {
+	t.Helper()
+	urls := shardedURLs(storage)
+	originalToShort := shardedIndex(storage, func(shard *inMemoryShard) map[string]string { return shard.originalToShort })
+
+	for lookupKey, shortURL := range originalToShort {
+		urlData, exists := urls[shortURL]
+		if assert.True(t, exists, "Index points at missing shortURL %s", shortURL) {
+			assert.Equal(t, lookupKey, urlData.LookupKey(), "Index entry for %s is stale", shortURL)
+		}
+	}
+	for shortURL, urlData := range urls {
+		_, indexed := originalToShort[urlData.LookupKey()]
+		assert.True(t, indexed, "Lookup key of %s is missing from the index", shortURL)
+	}
+}
+
+func TestInMemoryStorageReverseIndex(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Index follows create, update and delete", func(t *testing.T) {
+		storage := NewInMemoryStorage(10, zap.NewNop())
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://old.com"}))
+
+		_, err := storage.Update(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://new.com"})
+		require.NoError(t, err)
+		_, err = storage.GetShortURL(ctx, "https://old.com")
+		assert.Equal(t, ErrShortURLNotFound, err, "The old original URL should be dropped from the index")
+		shortURL, err := storage.GetShortURL(ctx, "https://new.com")
+		require.NoError(t, err)
+		assert.Equal(t, "abc123", shortURL)
+
+		require.NoError(t, storage.Delete(ctx, "abc123"))
+		_, err = storage.GetShortURL(ctx, "https://new.com")
+		assert.Equal(t, ErrShortURLNotFound, err)
+		assert.Empty(t, shardedIndex(storage, func(shard *inMemoryShard) map[string]string { return shard.originalToShort }))
+	})
+
+	t.Run("Index points at the latest short URL for a shared original", func(t *testing.T) {
+		storage := NewInMemoryStorage(10, zap.NewNop())
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "first", OriginalURL: "https://example.com"}))
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "second", OriginalURL: "https://example.com"}))
+
+		shortURL, err := storage.GetShortURL(ctx, "https://example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "second", shortURL)
+
+		// Removing an entry the index doesn't point at leaves the index alone
+		require.NoError(t, storage.Delete(ctx, "first"))
+		shortURL, err = storage.GetShortURL(ctx, "https://example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "second", shortURL)
+	})
+
+	t.Run("ReplaceAll and purge rebuild the index", func(t *testing.T) {
+		storage := NewInMemoryStorage(10, zap.NewNop())
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "stale", OriginalURL: "https://stale.com"}))
+		require.NoError(t, storage.ReplaceAll(ctx, []types.URLData{
+			{ShortURL: "a", OriginalURL: "https://a.com"},
+			{ShortURL: "b", OriginalURL: "https://b.com", ExpiresAt: time.Now().Add(-time.Minute)},
+		}))
+		_, err := storage.GetShortURL(ctx, "https://stale.com")
+		assert.Equal(t, ErrShortURLNotFound, err)
+		assertIndexConsistent(t, storage)
+
+		storage.purgeExpired(time.Now())
+		_, err = storage.GetShortURL(ctx, "https://b.com")
+		assert.Equal(t, ErrShortURLNotFound, err)
+		assertIndexConsistent(t, storage)
+	})
+
+	t.Run("Index uses the dedup key when one is set", func(t *testing.T) {
+		storage := NewInMemoryStorage(10, zap.NewNop())
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://Example.com", DedupKey: "https://example.com/"}))
+
+		shortURL, err := storage.GetShortURL(ctx, "https://example.com/")
+		require.NoError(t, err)
+		assert.Equal(t, "abc123", shortURL)
+		_, err = storage.GetShortURL(ctx, "https://Example.com")
+		assert.Equal(t, ErrShortURLNotFound, err, "The verbatim URL should not be indexed when a dedup key is set")
+
+		urlData, err := storage.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+		assert.Equal(t, "https://Example.com", urlData.OriginalURL)
+
+		_, err = storage.Update(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://other.com"})
+		require.NoError(t, err)
+		_, err = storage.GetShortURL(ctx, "https://example.com/")
+		assert.Equal(t, ErrShortURLNotFound, err)
+		assertIndexConsistent(t, storage)
+	})
+
+	t.Run("External ID index follows create, update and delete", func(t *testing.T) {
+		storage := NewInMemoryStorage(10, zap.NewNop())
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com", ExternalID: "order-1"}))
+
+		urlData, err := storage.GetByExternalID(ctx, "order-1")
+		require.NoError(t, err)
+		assert.Equal(t, "abc123", urlData.ShortURL)
+
+		err = storage.Create(ctx, types.URLData{ShortURL: "def456", OriginalURL: "https://other.com", ExternalID: "order-1"})
+		assert.Equal(t, ErrExternalIDExists, err)
+		_, err = storage.GetURLData(ctx, "def456")
+		assert.Equal(t, ErrShortURLNotFound, err, "A rejected create should store nothing")
+
+		// Updates keep the external ID even when the caller leaves it out
+		updated, err := storage.Update(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://new.com"})
+		require.NoError(t, err)
+		assert.Equal(t, "order-1", updated.ExternalID)
+
+		require.NoError(t, storage.Delete(ctx, "abc123"))
+		_, err = storage.GetByExternalID(ctx, "order-1")
+		assert.Equal(t, ErrShortURLNotFound, err)
+		assert.Empty(t, shardedIndex(storage, func(shard *inMemoryShard) map[string]string { return shard.externalToShort }))
+
+		_, err = storage.GetByExternalID(ctx, "")
+		assert.Equal(t, ErrShortURLNotFound, err)
+	})
+
+	t.Run("ReplaceAll rejects duplicate external IDs", func(t *testing.T) {
+		storage := NewInMemoryStorage(10, zap.NewNop())
+		err := storage.ReplaceAll(ctx, []types.URLData{
+			{ShortURL: "a", OriginalURL: "https://a.com", ExternalID: "order-1"},
+			{ShortURL: "b", OriginalURL: "https://b.com", ExternalID: "order-1"},
+		})
+		assert.Equal(t, ErrExternalIDExists, err)
+
+		require.NoError(t, storage.ReplaceAll(ctx, []types.URLData{{ShortURL: "a", OriginalURL: "https://a.com", ExternalID: "order-1"}}))
+		urlData, err := storage.GetByExternalID(ctx, "order-1")
+		require.NoError(t, err)
+		assert.Equal(t, "a", urlData.ShortURL)
+	})
+
+	t.Run("Concurrent writes never let the maps diverge", func(t *testing.T) {
+		storage := NewInMemoryStorage(100, zap.NewNop())
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				shortURL := fmt.Sprintf("url%d", i)
+				_ = storage.Create(ctx, types.URLData{ShortURL: shortURL, OriginalURL: fmt.Sprintf("https://example.com/%d", i)})
+				_, _ = storage.Update(ctx, types.URLData{ShortURL: shortURL, OriginalURL: fmt.Sprintf("https://example.com/%d/updated", i)})
+				_, _ = storage.GetShortURL(ctx, fmt.Sprintf("https://example.com/%d/updated", i))
+				if i%3 == 0 {
+					_ = storage.Delete(ctx, shortURL)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		assertIndexConsistent(t, storage)
+		assert.Equal(t, len(shardedURLs(storage)), storage.Len(), "The count should match the stored URLs")
+		assert.Len(t, shardedIndex(storage, func(shard *inMemoryShard) map[string]string { return shard.originalToShort }), len(shardedURLs(storage)))
+	})
+}
+
+func TestInMemoryStorageList(t *testing.T) {
+	ctx := context.Background()
+	storage := NewInMemoryStorage(10, zap.NewNop())
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, storage.ReplaceAll(ctx, []types.URLData{
+		{ShortURL: "d", OriginalURL: "https://d.com", CreatedAt: base.Add(2 * time.Second), Tags: []string{"team"}},
+		{ShortURL: "b", OriginalURL: "https://b.com", CreatedAt: base},
+		{ShortURL: "a", OriginalURL: "https://a.com", CreatedAt: base},
+		{ShortURL: "c", OriginalURL: "https://c.com", CreatedAt: base.Add(time.Second)},
+	}))
+
+	shortURLs := func(items []types.URLData) []string {
+		result := make([]string, 0, len(items))
+		for _, item := range items {
+			result = append(result, item.ShortURL)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name     string
+		offset   int
+		limit    int
+		expected []string
+	}{
+		{name: "First page", offset: 0, limit: 2, expected: []string{"a", "b"}},
+		{name: "Second page", offset: 2, limit: 2, expected: []string{"c", "d"}},
+		{name: "Partial last page", offset: 3, limit: 2, expected: []string{"d"}},
+		{name: "Offset past the end", offset: 10, limit: 2, expected: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, total, err := storage.List(ctx, tt.offset, tt.limit)
+			require.NoError(t, err)
+			assert.Equal(t, 4, total)
+			assert.Equal(t, tt.expected, shortURLs(page))
+		})
+	}
+
+	t.Run("Invalid pagination", func(t *testing.T) {
+		_, _, err := storage.List(ctx, -1, 2)
+		assert.Equal(t, ErrInvalidPagination, err)
+		_, _, err = storage.List(ctx, 0, 0)
+		assert.Equal(t, ErrInvalidPagination, err)
 	})
+
+	t.Run("Results are copies", func(t *testing.T) {
+		page, _, err := storage.List(ctx, 3, 1)
+		require.NoError(t, err)
+		page[0].OriginalURL = "https://mutated.com"
+		page[0].Tags[0] = "mutated"
+
+		urlData, err := storage.GetURLData(ctx, "d")
+		require.NoError(t, err)
+		assert.Equal(t, "https://d.com", urlData.OriginalURL)
+		assert.Equal(t, []string{"team"}, urlData.Tags)
+	})
+}
+
+func TestInMemoryStorageForEach(t *testing.T) {
+	ctx := context.Background()
+	storage := NewInMemoryStorage(10, zap.NewNop())
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, storage.ReplaceAll(ctx, []types.URLData{
+		{ShortURL: "c", OriginalURL: "https://c.com", CreatedAt: base.Add(time.Second)},
+		{ShortURL: "b", OriginalURL: "https://b.com", CreatedAt: base},
+		{ShortURL: "a", OriginalURL: "https://a.com", CreatedAt: base},
+	}))
+
+	t.Run("Every URL, without holding the locks", func(t *testing.T) {
+		var visited []string
+		err := storage.ForEach(ctx, func(urlData types.URLData) error {
+			visited = append(visited, urlData.ShortURL)
+			// Writing from fn would deadlock if the locks were still held
+			return storage.IncrementAccess(ctx, urlData.ShortURL)
+		})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"a", "b", "c"}, visited)
+	})
+
+	t.Run("Reads one page at a time", func(t *testing.T) {
+		storage := NewInMemoryStorage(10, zap.NewNop(), withShards(1), withForEachPageSize(2))
+		for _, shortURL := range []string{"a", "b", "c", "d", "e"} {
+			require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: shortURL, OriginalURL: "https://" + shortURL + ".com"}))
+		}
+
+		var visited []string
+		err := storage.ForEach(ctx, func(urlData types.URLData) error {
+			visited = append(visited, urlData.ShortURL)
+			if urlData.ShortURL == "a" {
+				// Changes beyond the current page are seen, as nothing past it has been read yet
+				require.NoError(t, storage.Delete(ctx, "d"))
+				require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "f", OriginalURL: "https://f.com"}))
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b", "c", "e", "f"}, visited)
+	})
+
+	t.Run("Stops at the first error", func(t *testing.T) {
+		stop := errors.New("stop")
+		calls := 0
+		err := storage.ForEach(ctx, func(types.URLData) error {
+			calls++
+			return stop
+		})
+		assert.Equal(t, stop, err)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+// cancelledAfterContext is a context whose Err reports it cancelled from its calls-th call on,
+// while its Done channel never closes, to cancel a scan once it is under way.
+type cancelledAfterContext struct {
+	context.Context
+	calls atomic.Int64
+}
+
+func (c *cancelledAfterContext) Err() error {
+	if c.calls.Add(-1) <= 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestInMemoryStorageTopN(t *testing.T) {
+	ctx := context.Background()
+	storage := NewInMemoryStorage(10, zap.NewNop(), WithSoftDeleteRetention(time.Hour))
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, storage.ReplaceAll(ctx, []types.URLData{
+		{ShortURL: "low", OriginalURL: "https://low.com", CreatedAt: base, AccessCount: 1},
+		{ShortURL: "high", OriginalURL: "https://high.com", CreatedAt: base, AccessCount: 50, Tags: []string{"team"}},
+		{ShortURL: "tie-new", OriginalURL: "https://tie-new.com", CreatedAt: base.Add(time.Hour), AccessCount: 10},
+		{ShortURL: "tie-old", OriginalURL: "https://tie-old.com", CreatedAt: base, AccessCount: 10},
+		{ShortURL: "unvisited", OriginalURL: "https://unvisited.com", CreatedAt: base},
+		{ShortURL: "expired", OriginalURL: "https://expired.com", CreatedAt: base, AccessCount: 100, ExpiresAt: time.Now().Add(-time.Minute)},
+		{ShortURL: "deleted", OriginalURL: "https://deleted.com", CreatedAt: base, AccessCount: 100, DeletedAt: time.Now()},
+	}))
+	require.NoError(t, storage.IncrementAccess(ctx, "low"))
+
+	shortURLs := func(items []types.URLData) []string {
+		codes := make([]string, 0, len(items))
+		for _, item := range items {
+			codes = append(codes, item.ShortURL)
+		}
+		return codes
+	}
+
+	items, err := storage.TopN(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"high", "tie-old", "tie-new"}, shortURLs(items), "Ties should go to the oldest URL")
+	assert.Equal(t, int64(50), items[0].AccessCount)
+	assert.Equal(t, []string{"team"}, items[0].Tags)
+
+	items, err = storage.TopN(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"high", "tie-old", "tie-new", "low", "unvisited"}, shortURLs(items),
+		"Expired and deleted URLs should be left out")
+	assert.Equal(t, int64(2), items[3].AccessCount, "Counted accesses should be ranked")
+
+	items[0].Tags[0] = "mutated"
+	items, err = storage.TopN(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team"}, items[0].Tags, "Returned items should be copies")
+
+	_, err = storage.TopN(ctx, 0)
+	assert.Equal(t, ErrInvalidPagination, err)
+}
+
+func TestInMemoryStorageScanCancellation(t *testing.T) {
+	const size = 100000
+	storage := NewInMemoryStorage(size, zap.NewNop())
+	items := make([]types.URLData, 0, size)
+	for i := 0; i < size; i++ {
+		items = append(items, types.URLData{ShortURL: fmt.Sprintf("url%d", i), OriginalURL: fmt.Sprintf("https://example.com/%d", i), Tags: []string{"team"}})
+	}
+	require.NoError(t, storage.ReplaceAll(context.Background(), items))
+
+	t.Run("GetShortURL with a cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := storage.GetShortURL(ctx, "https://example.com/1")
+		assert.Equal(t, context.Canceled, err)
+	})
+
+	t.Run("List stops when cancelled mid-scan", func(t *testing.T) {
+		ctx := &cancelledAfterContext{Context: context.Background()}
+		ctx.calls.Store(2)
+
+		_, _, err := storage.List(ctx, 0, 10)
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, int64(0), ctx.calls.Load(), "The scan should stop at the first check after the cancellation")
+	})
+
+	t.Run("ListByTag stops when cancelled mid-scan", func(t *testing.T) {
+		ctx := &cancelledAfterContext{Context: context.Background()}
+		ctx.calls.Store(2)
+
+		_, err := storage.ListByTag(ctx, "team")
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, int64(0), ctx.calls.Load(), "The scan should stop at the first check after the cancellation")
+	})
+
+	t.Run("TopN stops when cancelled mid-scan", func(t *testing.T) {
+		ctx := &cancelledAfterContext{Context: context.Background()}
+		ctx.calls.Store(2)
+
+		_, err := storage.TopN(ctx, 10)
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, int64(0), ctx.calls.Load(), "The scan should stop at the first check after the cancellation")
+	})
+}
+
+func TestInMemoryStorageIncrementAccess(t *testing.T) {
+	ctx := context.Background()
+	storage := NewInMemoryStorage(10, zap.NewNop())
+	require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com", AccessCount: 5}))
+
+	urlData, err := storage.GetURLData(ctx, "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), urlData.AccessCount, "Create should start counting from zero")
+
+	t.Run("Concurrent increments are all counted", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, storage.IncrementAccess(ctx, "abc123"))
+			}()
+		}
+		wg.Wait()
+
+		urlData, err := storage.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+		assert.Equal(t, int64(100), urlData.AccessCount)
+	})
+
+	t.Run("Update keeps the count", func(t *testing.T) {
+		_, err := storage.Update(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.org"})
+		require.NoError(t, err)
+		urlData, err := storage.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+		assert.Equal(t, int64(100), urlData.AccessCount)
+	})
+
+	t.Run("ReplaceAll restores counts", func(t *testing.T) {
+		target := NewInMemoryStorage(10, zap.NewNop())
+		require.NoError(t, target.ReplaceAll(ctx, []types.URLData{{ShortURL: "def456", OriginalURL: "https://example.net", AccessCount: 7}}))
+		require.NoError(t, target.IncrementAccess(ctx, "def456"))
+		urlData, err := target.GetURLData(ctx, "def456")
+		require.NoError(t, err)
+		assert.Equal(t, int64(8), urlData.AccessCount)
+	})
+
+	t.Run("Missing short URL", func(t *testing.T) {
+		assert.Equal(t, ErrShortURLNotFound, storage.IncrementAccess(ctx, "missing"))
+		require.NoError(t, storage.Delete(ctx, "abc123"))
+		assert.Equal(t, ErrShortURLNotFound, storage.IncrementAccess(ctx, "abc123"))
+	})
+}
+
+func TestInMemoryStorageRecordCheck(t *testing.T) {
+	ctx := context.Background()
+	storage := NewInMemoryStorage(10, zap.NewNop())
+	require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}))
+	before, err := storage.GetURLData(ctx, "abc123")
+	require.NoError(t, err)
+	checkedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	require.NoError(t, storage.RecordCheck(ctx, "abc123", "https://example.com", checkedAt, 200))
+	urlData, err := storage.GetURLData(ctx, "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, checkedAt, urlData.LastCheckedAt)
+	assert.Equal(t, 200, urlData.LastStatus)
+	assert.Equal(t, before.UpdatedAt, urlData.UpdatedAt, "Recording a check is not an update")
+
+	require.NoError(t, storage.RecordCheck(ctx, "abc123", "https://stale.com", checkedAt, 500), "Checks of a previous destination are ignored")
+	urlData, err = storage.GetURLData(ctx, "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, 200, urlData.LastStatus)
+
+	assert.Equal(t, ErrShortURLNotFound, storage.RecordCheck(ctx, "missing", "https://example.com", checkedAt, 200))
+}
+
+// benchmarkInMemoryStorageContention creates, reads and deletes distinct short URLs from 100
+// goroutines, which contend for the shard locks of the storage.
+func benchmarkInMemoryStorageContention(b *testing.B, shards int) {
+	const goroutines = 100
+	storage := NewInMemoryStorage(goroutines, zap.NewNop(), withShards(shards))
+	ctx := context.Background()
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	b.ResetTimer()
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := next.Add(1); i <= int64(b.N); i = next.Add(1) {
+				shortURL := fmt.Sprintf("url%d", i)
+				if err := storage.Create(ctx, types.URLData{ShortURL: shortURL, OriginalURL: "https://example.com/" + shortURL}); err != nil {
+					b.Error(err)
+					return
+				}
+				if _, err := storage.GetURLData(ctx, shortURL); err != nil {
+					b.Error(err)
+					return
+				}
+				if err := storage.Delete(ctx, shortURL); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// BenchmarkInMemoryStorageSingleMutex measures concurrent writes serialized behind a single lock.
+func BenchmarkInMemoryStorageSingleMutex(b *testing.B) {
+	benchmarkInMemoryStorageContention(b, 1)
+}
+
+// BenchmarkInMemoryStorageSharded measures concurrent writes spread over the default shards.
+func BenchmarkInMemoryStorageSharded(b *testing.B) {
+	benchmarkInMemoryStorageContention(b, defaultInMemoryShards)
 }
@@ -3,6 +3,7 @@ package mocks
 import (
 	"context"
 	"go-url-shortening/types"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -17,22 +18,84 @@ func (m *MockStorage) Create(ctx context.Context, urlData types.URLData) error {
 	return args.Error(0)
 }
 
+func (m *MockStorage) GetOrCreate(ctx context.Context, urlData types.URLData) (types.URLData, bool, error) {
+	args := m.Called(ctx, urlData)
+	return args.Get(0).(types.URLData), args.Bool(1), args.Error(2)
+}
+
 func (m *MockStorage) GetURLData(ctx context.Context, shortURL string) (types.URLData, error) {
 	args := m.Called(ctx, shortURL)
 	return args.Get(0).(types.URLData), args.Error(1)
 }
 
+func (m *MockStorage) GetByExternalID(ctx context.Context, externalID string) (types.URLData, error) {
+	args := m.Called(ctx, externalID)
+	return args.Get(0).(types.URLData), args.Error(1)
+}
+
 func (m *MockStorage) GetShortURL(ctx context.Context, originalURL string) (string, error) {
 	args := m.Called(ctx, originalURL)
 	return args.String(0), args.Error(1)
 }
 
-func (m *MockStorage) Update(ctx context.Context, urlData types.URLData) error {
+func (m *MockStorage) Update(ctx context.Context, urlData types.URLData) (types.URLData, error) {
 	args := m.Called(ctx, urlData)
-	return args.Error(0)
+	return args.Get(0).(types.URLData), args.Error(1)
+}
+
+func (m *MockStorage) CompareAndUpdate(ctx context.Context, urlData types.URLData, expectedUpdatedAt time.Time) (types.URLData, error) {
+	args := m.Called(ctx, urlData, expectedUpdatedAt)
+	return args.Get(0).(types.URLData), args.Error(1)
 }
 
 func (m *MockStorage) Delete(ctx context.Context, shortURL string) error {
 	args := m.Called(ctx, shortURL)
 	return args.Error(0)
 }
+
+func (m *MockStorage) ReplaceAll(ctx context.Context, items []types.URLData) error {
+	args := m.Called(ctx, items)
+	return args.Error(0)
+}
+
+func (m *MockStorage) ListByTag(ctx context.Context, tag string) ([]types.URLData, error) {
+	args := m.Called(ctx, tag)
+	return args.Get(0).([]types.URLData), args.Error(1)
+}
+
+func (m *MockStorage) List(ctx context.Context, offset, limit int) ([]types.URLData, int, error) {
+	args := m.Called(ctx, offset, limit)
+	return args.Get(0).([]types.URLData), args.Int(1), args.Error(2)
+}
+
+func (m *MockStorage) ForEach(ctx context.Context, fn func(types.URLData) error) error {
+	args := m.Called(ctx, fn)
+	if items, ok := args.Get(0).([]types.URLData); ok {
+		for _, urlData := range items {
+			if err := fn(urlData); err != nil {
+				return err
+			}
+		}
+	}
+	return args.Error(1)
+}
+
+func (m *MockStorage) TopN(ctx context.Context, n int) ([]types.URLData, error) {
+	args := m.Called(ctx, n)
+	return args.Get(0).([]types.URLData), args.Error(1)
+}
+
+func (m *MockStorage) IncrementAccess(ctx context.Context, shortURL string) error {
+	args := m.Called(ctx, shortURL)
+	return args.Error(0)
+}
+
+func (m *MockStorage) Rename(ctx context.Context, shortURL string, urlData types.URLData, expectedUpdatedAt time.Time) (types.URLData, error) {
+	args := m.Called(ctx, shortURL, urlData, expectedUpdatedAt)
+	return args.Get(0).(types.URLData), args.Error(1)
+}
+
+func (m *MockStorage) Ping(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
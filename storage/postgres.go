@@ -0,0 +1,634 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"go-url-shortening/types"
+	"go.uber.org/zap"
+)
+
+// pqUniqueViolation is the PostgreSQL error code for a unique constraint violation.
+const pqUniqueViolation = "23505"
+
+// postgresExternalIDIndex is the unique index enforcing that external IDs are not reused.
+const postgresExternalIDIndex = "urls_external_id_idx"
+
+// postgresMigrations create the schema if it doesn't exist yet. They are idempotent
+// and run every time a PostgresStorage is created.
+var postgresMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS urls (
+		short_url    TEXT PRIMARY KEY,
+		original_url TEXT NOT NULL,
+		created_at   TIMESTAMPTZ NOT NULL,
+		updated_at   TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS urls_original_url_idx ON urls (original_url)`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS tags TEXT[] NOT NULL DEFAULT '{}'`,
+	`CREATE INDEX IF NOT EXISTS urls_tags_idx ON urls USING GIN (tags)`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS dedup_key TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX IF NOT EXISTS urls_dedup_key_idx ON urls (dedup_key)`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS access_count BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE urls ADD COLUMN IF NOT EXISTS external_id TEXT NOT NULL DEFAULT ''`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS ` + postgresExternalIDIndex + ` ON urls (external_id) WHERE external_id <> ''`,
+}
+
+// PostgresStorage implements the Storage interface using a PostgreSQL database via database/sql.
+type PostgresStorage struct {
+	db     *sql.DB     // Database handle (connection pool)
+	logger *zap.Logger // Logger for PostgresStorage operations
+}
+
+// NewPostgresStorage connects to the PostgreSQL database described by dsn,
+// applies the schema migrations and returns a ready-to-use PostgresStorage.
+func NewPostgresStorage(dsn string, logger *zap.Logger) (*PostgresStorage, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newPostgresStorageFromDB(db, logger)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewPostgresReplicaStorage connects to a read replica of a PostgreSQL database. Replicas are
+// read-only and receive the schema from their primary, so no migrations are applied.
+func NewPostgresReplicaStorage(dsn string, logger *zap.Logger) (*PostgresStorage, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &PostgresStorage{db: db, logger: logger}, nil
+}
+
+// newPostgresStorageFromDB wraps an existing database handle, applying the schema migrations.
+func newPostgresStorageFromDB(db *sql.DB, logger *zap.Logger) (*PostgresStorage, error) {
+	if logger == nil {
+		var err error
+		logger, err = zap.NewProduction()
+		if err != nil {
+			panic("Failed to initialize zap logger: " + err.Error())
+		}
+	}
+	for _, migration := range postgresMigrations {
+		if _, err := db.Exec(migration); err != nil {
+			logger.Error("Failed to apply migration", zap.Error(err))
+			return nil, err
+		}
+	}
+	return &PostgresStorage{db: db, logger: logger}, nil
+}
+
+// Ping checks that the PostgreSQL server is reachable.
+func (s *PostgresStorage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the underlying database handle.
+func (s *PostgresStorage) Close() error {
+	return s.db.Close()
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique constraint violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation
+}
+
+// isExternalIDViolation reports whether err is a violation of the external ID unique index.
+func isExternalIDViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation && pqErr.Constraint == postgresExternalIDIndex
+}
+
+// postgresURLColumns lists the columns read back into a URLData, in scan order.
+const postgresURLColumns = `short_url, original_url, created_at, updated_at, expires_at, tags, dedup_key, access_count, external_id`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanPostgresURLData scans a row selected with postgresURLColumns into a URLData.
+func scanPostgresURLData(row rowScanner) (types.URLData, error) {
+	var urlData types.URLData
+	var expiresAt sql.NullTime
+	err := row.Scan(&urlData.ShortURL, &urlData.OriginalURL, &urlData.CreatedAt, &urlData.UpdatedAt,
+		&expiresAt, pq.Array(&urlData.Tags), &urlData.DedupKey, &urlData.AccessCount, &urlData.ExternalID)
+	if err != nil {
+		return types.URLData{}, err
+	}
+	urlData.ExpiresAt = expiresAt.Time
+	if len(urlData.Tags) == 0 {
+		urlData.Tags = nil
+	}
+	return urlData, nil
+}
+
+// nullTime maps the zero time to SQL NULL, which is how a missing expiration is stored.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// Create adds a new short URL and its corresponding URLData to the storage
+func (s *PostgresStorage) Create(ctx context.Context, urlData types.URLData) error {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("Create operation cancelled", zap.String("shortURL", urlData.ShortURL))
+		return ctx.Err()
+	default:
+		urlData.CreatedAt = time.Now().UTC()
+		urlData.UpdatedAt = urlData.CreatedAt
+
+		_, err := s.db.ExecContext(ctx,
+			`INSERT INTO urls (short_url, original_url, created_at, updated_at, expires_at, tags, dedup_key, external_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			urlData.ShortURL, urlData.OriginalURL, urlData.CreatedAt, urlData.UpdatedAt, nullTime(urlData.ExpiresAt), pq.Array(urlData.Tags), urlData.DedupKey, urlData.ExternalID)
+		if isExternalIDViolation(err) {
+			s.logger.Warn("Attempt to create duplicate external ID", zap.String("externalID", urlData.ExternalID))
+			return ErrExternalIDExists
+		}
+		if isUniqueViolation(err) {
+			s.logger.Warn("Attempt to create duplicate shortURL", zap.String("shortURL", urlData.ShortURL))
+			return ErrShortURLExists
+		}
+		if err != nil {
+			s.logger.Error("Postgres create failed", zap.String("shortURL", urlData.ShortURL), zap.Error(err))
+			return err
+		}
+
+		s.logger.Info("Short URL created successfully",
+			zap.String("shortURL", urlData.ShortURL),
+			zap.String("originalURL", urlData.OriginalURL),
+			zap.Time("createdAt", urlData.CreatedAt))
+		return nil
+	}
+}
+
+// GetOrCreate returns the oldest unexpired URLData with the lookup key of urlData, or creates
+// urlData if there is none. The lookup and the insert run in one transaction holding an advisory lock on the
+// lookup key, so concurrent calls for the same key are serialized.
+func (s *PostgresStorage) GetOrCreate(ctx context.Context, urlData types.URLData) (types.URLData, bool, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("GetOrCreate operation cancelled", zap.String("shortURL", urlData.ShortURL))
+		return types.URLData{}, false, ctx.Err()
+	default:
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return types.URLData{}, false, err
+		}
+		defer tx.Rollback() // No-op once the transaction is committed
+
+		lookupKey := urlData.LookupKey()
+		if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, lookupKey); err != nil {
+			s.logger.Error("Postgres lock failed", zap.String("lookupKey", lookupKey), zap.Error(err))
+			return types.URLData{}, false, err
+		}
+
+		existing, err := scanPostgresURLData(tx.QueryRowContext(ctx,
+			`SELECT `+postgresURLColumns+` FROM urls WHERE (dedup_key = $1 OR (dedup_key = '' AND original_url = $1))
+			AND (expires_at IS NULL OR expires_at > now()) ORDER BY created_at LIMIT 1`,
+			lookupKey))
+		if err == nil {
+			return existing, false, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			s.logger.Error("Postgres index lookup failed", zap.String("lookupKey", lookupKey), zap.Error(err))
+			return types.URLData{}, false, err
+		}
+
+		urlData.CreatedAt = time.Now().UTC()
+		urlData.UpdatedAt = urlData.CreatedAt
+		urlData.AccessCount = 0
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO urls (short_url, original_url, created_at, updated_at, expires_at, tags, dedup_key, external_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			urlData.ShortURL, urlData.OriginalURL, urlData.CreatedAt, urlData.UpdatedAt, nullTime(urlData.ExpiresAt), pq.Array(urlData.Tags), urlData.DedupKey, urlData.ExternalID)
+		if isExternalIDViolation(err) {
+			s.logger.Warn("Attempt to create duplicate external ID", zap.String("externalID", urlData.ExternalID))
+			return types.URLData{}, false, ErrExternalIDExists
+		}
+		if isUniqueViolation(err) {
+			s.logger.Warn("Attempt to create duplicate shortURL", zap.String("shortURL", urlData.ShortURL))
+			return types.URLData{}, false, ErrShortURLExists
+		}
+		if err != nil {
+			s.logger.Error("Postgres create failed", zap.String("shortURL", urlData.ShortURL), zap.Error(err))
+			return types.URLData{}, false, err
+		}
+		if err := tx.Commit(); err != nil {
+			s.logger.Error("Postgres create commit failed", zap.String("shortURL", urlData.ShortURL), zap.Error(err))
+			return types.URLData{}, false, err
+		}
+
+		s.logger.Info("Short URL created successfully",
+			zap.String("shortURL", urlData.ShortURL),
+			zap.String("originalURL", urlData.OriginalURL),
+			zap.Time("createdAt", urlData.CreatedAt))
+		return urlData, true, nil
+	}
+}
+
+// GetURLData retrieves the URLData for a given short URL.
+func (s *PostgresStorage) GetURLData(ctx context.Context, shortURL string) (types.URLData, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("Read operation cancelled", zap.String("shortURL", shortURL))
+		return types.URLData{}, ctx.Err()
+	default:
+		urlData, err := scanPostgresURLData(s.db.QueryRowContext(ctx,
+			`SELECT `+postgresURLColumns+` FROM urls WHERE short_url = $1`, shortURL))
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.URLData{}, ErrShortURLNotFound
+		}
+		if err != nil {
+			s.logger.Error("Postgres read failed", zap.String("shortURL", shortURL), zap.Error(err))
+			return types.URLData{}, err
+		}
+
+		s.logger.Info("URL data retrieved successfully",
+			zap.String("shortURL", shortURL),
+			zap.String("originalURL", urlData.OriginalURL))
+		return urlData, nil
+	}
+}
+
+// GetByExternalID retrieves the URLData stored with the given external ID, using its unique index.
+func (s *PostgresStorage) GetByExternalID(ctx context.Context, externalID string) (types.URLData, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("GetByExternalID operation cancelled", zap.String("externalID", externalID))
+		return types.URLData{}, ctx.Err()
+	default:
+		urlData, err := scanPostgresURLData(s.db.QueryRowContext(ctx,
+			`SELECT `+postgresURLColumns+` FROM urls WHERE external_id = $1 AND external_id <> ''`, externalID))
+		if errors.Is(err, sql.ErrNoRows) {
+			return types.URLData{}, ErrShortURLNotFound
+		}
+		if err != nil {
+			s.logger.Error("Postgres external ID lookup failed", zap.String("externalID", externalID), zap.Error(err))
+			return types.URLData{}, err
+		}
+		return urlData, nil
+	}
+}
+
+// GetShortURL retrieves the short URL for a given lookup key. Rows without a dedup key are
+// matched on original_url, so both the dedup_key and original_url indexes are used.
+func (s *PostgresStorage) GetShortURL(ctx context.Context, originalURL string) (string, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("GetShortURL operation cancelled", zap.String("originalURL", originalURL))
+		return "", ctx.Err()
+	default:
+		var shortURL string
+		err := s.db.QueryRowContext(ctx,
+			`SELECT short_url FROM urls WHERE dedup_key = $1 OR (dedup_key = '' AND original_url = $1) ORDER BY created_at LIMIT 1`,
+			originalURL).Scan(&shortURL)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrShortURLNotFound
+		}
+		if err != nil {
+			s.logger.Error("Postgres index lookup failed", zap.String("originalURL", originalURL), zap.Error(err))
+			return "", err
+		}
+
+		s.logger.Debug("Short URL retrieved successfully",
+			zap.String("shortURL", shortURL),
+			zap.String("originalURL", originalURL))
+		return shortURL, nil
+	}
+}
+
+// Update modifies the URLData for a given short URL and returns the updated row.
+func (s *PostgresStorage) Update(ctx context.Context, urlData types.URLData) (types.URLData, error) {
+	return s.CompareAndUpdate(ctx, urlData, time.Time{})
+}
+
+// CompareAndUpdate is Update, provided the row was last updated at expectedUpdatedAt. The version
+// is compared in the WHERE clause of the UPDATE, so the row lock it takes covers the comparison.
+func (s *PostgresStorage) CompareAndUpdate(ctx context.Context, urlData types.URLData, expectedUpdatedAt time.Time) (types.URLData, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("Update operation cancelled", zap.String("shortURL", urlData.ShortURL))
+		return types.URLData{}, ctx.Err()
+	default:
+		updated, err := scanPostgresURLData(s.db.QueryRowContext(ctx,
+			`UPDATE urls SET original_url = $2, updated_at = $3, dedup_key = $4, expires_at = $5
+			WHERE short_url = $1 AND ($6::timestamptz IS NULL OR updated_at = $6)
+			RETURNING `+postgresURLColumns,
+			urlData.ShortURL, urlData.OriginalURL, time.Now().UTC(), urlData.DedupKey, nullTime(urlData.ExpiresAt),
+			nullTime(expectedUpdatedAt)))
+		if errors.Is(err, sql.ErrNoRows) && !expectedUpdatedAt.IsZero() {
+			// The row is either missing or at another version; which one only matters for the error
+			if _, err := s.GetURLData(ctx, urlData.ShortURL); err == nil {
+				s.logger.Warn("Attempt to update a stale version of shortURL", zap.String("shortURL", urlData.ShortURL))
+				return types.URLData{}, ErrVersionMismatch
+			}
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			s.logger.Warn("Attempt to update non-existent shortURL", zap.String("shortURL", urlData.ShortURL))
+			return types.URLData{}, ErrShortURLNotFound
+		}
+		if err != nil {
+			s.logger.Error("Postgres update failed", zap.String("shortURL", urlData.ShortURL), zap.Error(err))
+			return types.URLData{}, err
+		}
+
+		s.logger.Info("Updated shortURL",
+			zap.String("shortURL", updated.ShortURL),
+			zap.String("newURL", updated.OriginalURL),
+			zap.Time("updatedAt", updated.UpdatedAt))
+		return updated, nil
+	}
+}
+
+// Rename changes the primary key of the row of shortURL to urlData.ShortURL and updates the row
+// with urlData in the same UPDATE, whose WHERE clause compares the version as CompareAndUpdate does.
+func (s *PostgresStorage) Rename(ctx context.Context, shortURL string, urlData types.URLData, expectedUpdatedAt time.Time) (types.URLData, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("Rename operation cancelled", zap.String("shortURL", shortURL))
+		return types.URLData{}, ctx.Err()
+	default:
+		newShortURL := urlData.ShortURL
+		renamed, err := scanPostgresURLData(s.db.QueryRowContext(ctx,
+			`UPDATE urls SET short_url = $2, original_url = $3, updated_at = $4, dedup_key = $5, expires_at = $6
+			WHERE short_url = $1 AND ($7::timestamptz IS NULL OR updated_at = $7)
+			RETURNING `+postgresURLColumns,
+			shortURL, newShortURL, urlData.OriginalURL, time.Now().UTC(), urlData.DedupKey, nullTime(urlData.ExpiresAt),
+			nullTime(expectedUpdatedAt)))
+		if errors.Is(err, sql.ErrNoRows) && !expectedUpdatedAt.IsZero() {
+			if _, err := s.GetURLData(ctx, shortURL); err == nil {
+				s.logger.Warn("Attempt to rename a stale version of shortURL", zap.String("shortURL", shortURL))
+				return types.URLData{}, ErrVersionMismatch
+			}
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			s.logger.Warn("Attempt to rename non-existent shortURL", zap.String("shortURL", shortURL))
+			return types.URLData{}, ErrShortURLNotFound
+		}
+		if isUniqueViolation(err) {
+			s.logger.Warn("Attempt to rename to existing shortURL", zap.String("shortURL", newShortURL))
+			return types.URLData{}, ErrShortURLExists
+		}
+		if err != nil {
+			s.logger.Error("Postgres rename failed", zap.String("shortURL", shortURL), zap.Error(err))
+			return types.URLData{}, err
+		}
+
+		s.logger.Info("Renamed shortURL", zap.String("shortURL", shortURL), zap.String("newShortURL", newShortURL))
+		return renamed, nil
+	}
+}
+
+// Delete removes a short URL and its corresponding original URL from the storage.
+func (s *PostgresStorage) Delete(ctx context.Context, shortURL string) error {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("Delete operation cancelled", zap.String("shortURL", shortURL))
+		return ctx.Err()
+	default:
+		result, err := s.db.ExecContext(ctx, `DELETE FROM urls WHERE short_url = $1`, shortURL)
+		if err != nil {
+			s.logger.Error("Postgres delete failed", zap.String("shortURL", shortURL), zap.Error(err))
+			return err
+		}
+		if rows, err := result.RowsAffected(); err != nil {
+			return err
+		} else if rows == 0 {
+			s.logger.Warn("Attempt to delete non-existent shortURL", zap.String("shortURL", shortURL))
+			return ErrShortURLNotFound
+		}
+
+		s.logger.Info("Deleted shortURL", zap.String("shortURL", shortURL))
+		return nil
+	}
+}
+
+// IncrementAccess adds one to the access count of a short URL in a single UPDATE,
+// so concurrent increments never lose counts.
+func (s *PostgresStorage) IncrementAccess(ctx context.Context, shortURL string) error {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("IncrementAccess operation cancelled", zap.String("shortURL", shortURL))
+		return ctx.Err()
+	default:
+		result, err := s.db.ExecContext(ctx, `UPDATE urls SET access_count = access_count + 1 WHERE short_url = $1`, shortURL)
+		if err != nil {
+			s.logger.Error("Postgres access increment failed", zap.String("shortURL", shortURL), zap.Error(err))
+			return err
+		}
+		if rows, err := result.RowsAffected(); err != nil {
+			return err
+		} else if rows == 0 {
+			return ErrShortURLNotFound
+		}
+		return nil
+	}
+}
+
+// ReplaceAll atomically swaps the entire dataset for the given items inside a single transaction.
+// On any error the transaction is rolled back and the storage is left untouched.
+func (s *PostgresStorage) ReplaceAll(ctx context.Context, items []types.URLData) error {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("ReplaceAll operation cancelled", zap.Int("items", len(items)))
+		return ctx.Err()
+	default:
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback() // No-op once the transaction is committed
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM urls`); err != nil {
+			s.logger.Error("Postgres replace failed", zap.Error(err))
+			return err
+		}
+
+		now := time.Now().UTC()
+		for _, urlData := range items {
+			if urlData.CreatedAt.IsZero() {
+				urlData.CreatedAt = now
+			}
+			if urlData.UpdatedAt.IsZero() {
+				urlData.UpdatedAt = urlData.CreatedAt
+			}
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO urls (short_url, original_url, created_at, updated_at, expires_at, tags, dedup_key, access_count, external_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+				urlData.ShortURL, urlData.OriginalURL, urlData.CreatedAt, urlData.UpdatedAt, nullTime(urlData.ExpiresAt), pq.Array(urlData.Tags), urlData.DedupKey, urlData.AccessCount, urlData.ExternalID)
+			if isExternalIDViolation(err) {
+				s.logger.Warn("Duplicate external ID in replacement dataset", zap.String("externalID", urlData.ExternalID))
+				return ErrExternalIDExists
+			}
+			if isUniqueViolation(err) {
+				s.logger.Warn("Duplicate shortURL in replacement dataset", zap.String("shortURL", urlData.ShortURL))
+				return ErrShortURLExists
+			}
+			if err != nil {
+				s.logger.Error("Postgres replace failed", zap.String("shortURL", urlData.ShortURL), zap.Error(err))
+				return err
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			s.logger.Error("Postgres replace commit failed", zap.Error(err))
+			return err
+		}
+		s.logger.Info("Replaced storage dataset", zap.Int("count", len(items)))
+		return nil
+	}
+}
+
+// ListByTag returns every stored URL carrying the given tag, oldest first, using the tags GIN index.
+func (s *PostgresStorage) ListByTag(ctx context.Context, tag string) ([]types.URLData, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("ListByTag operation cancelled", zap.String("tag", tag))
+		return nil, ctx.Err()
+	default:
+		rows, err := s.db.QueryContext(ctx,
+			`SELECT `+postgresURLColumns+` FROM urls WHERE tags @> ARRAY[$1]::TEXT[] ORDER BY created_at, short_url`, tag)
+		if err != nil {
+			s.logger.Error("Postgres list failed", zap.String("tag", tag), zap.Error(err))
+			return nil, err
+		}
+		defer rows.Close()
+
+		var items []types.URLData
+		for rows.Next() {
+			urlData, err := scanPostgresURLData(rows)
+			if err != nil {
+				s.logger.Error("Postgres list failed", zap.String("tag", tag), zap.Error(err))
+				return nil, err
+			}
+			items = append(items, urlData)
+		}
+		if err := rows.Err(); err != nil {
+			s.logger.Error("Postgres list failed", zap.String("tag", tag), zap.Error(err))
+			return nil, err
+		}
+		s.logger.Debug("Listed URLs by tag", zap.String("tag", tag), zap.Int("count", len(items)))
+		return items, nil
+	}
+}
+
+// TopN returns the n most accessed unexpired URLs, most accessed first.
+func (s *PostgresStorage) TopN(ctx context.Context, n int) ([]types.URLData, error) {
+	if n <= 0 {
+		return nil, ErrInvalidPagination
+	}
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("TopN operation cancelled", zap.Int("n", n))
+		return nil, ctx.Err()
+	default:
+		rows, err := s.db.QueryContext(ctx,
+			`SELECT `+postgresURLColumns+` FROM urls WHERE expires_at IS NULL OR expires_at > $1
+			ORDER BY access_count DESC, created_at, short_url LIMIT $2`, time.Now().UTC(), n)
+		if err != nil {
+			s.logger.Error("Postgres top list failed", zap.Int("n", n), zap.Error(err))
+			return nil, err
+		}
+		defer rows.Close()
+
+		items := []types.URLData{}
+		for rows.Next() {
+			urlData, err := scanPostgresURLData(rows)
+			if err != nil {
+				s.logger.Error("Postgres top list failed", zap.Int("n", n), zap.Error(err))
+				return nil, err
+			}
+			items = append(items, urlData)
+		}
+		if err := rows.Err(); err != nil {
+			s.logger.Error("Postgres top list failed", zap.Int("n", n), zap.Error(err))
+			return nil, err
+		}
+		return items, nil
+	}
+}
+
+// List returns a page of stored URLs ordered by creation time, and the total number of stored URLs.
+func (s *PostgresStorage) List(ctx context.Context, offset, limit int) ([]types.URLData, int, error) {
+	if err := validatePagination(offset, limit); err != nil {
+		return nil, 0, err
+	}
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("List operation cancelled", zap.Int("offset", offset), zap.Int("limit", limit))
+		return nil, 0, ctx.Err()
+	default:
+		var total int
+		if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM urls`).Scan(&total); err != nil {
+			s.logger.Error("Postgres count failed", zap.Error(err))
+			return nil, 0, err
+		}
+
+		rows, err := s.db.QueryContext(ctx,
+			`SELECT `+postgresURLColumns+` FROM urls ORDER BY created_at, short_url LIMIT $1 OFFSET $2`, limit, offset)
+		if err != nil {
+			s.logger.Error("Postgres list failed", zap.Error(err))
+			return nil, 0, err
+		}
+		defer rows.Close()
+
+		items := []types.URLData{}
+		for rows.Next() {
+			urlData, err := scanPostgresURLData(rows)
+			if err != nil {
+				s.logger.Error("Postgres list failed", zap.Error(err))
+				return nil, 0, err
+			}
+			items = append(items, urlData)
+		}
+		if err := rows.Err(); err != nil {
+			s.logger.Error("Postgres list failed", zap.Error(err))
+			return nil, 0, err
+		}
+		return items, total, nil
+	}
+}
+
+// ForEach calls fn with every stored URL, ordered by creation time, as the rows are read from a
+// single query, so the dataset is never held in memory.
+func (s *PostgresStorage) ForEach(ctx context.Context, fn func(types.URLData) error) error {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("ForEach operation cancelled")
+		return ctx.Err()
+	default:
+		rows, err := s.db.QueryContext(ctx, `SELECT `+postgresURLColumns+` FROM urls ORDER BY created_at, short_url`)
+		if err != nil {
+			s.logger.Error("Postgres list failed", zap.Error(err))
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			urlData, err := scanPostgresURLData(rows)
+			if err != nil {
+				s.logger.Error("Postgres list failed", zap.Error(err))
+				return err
+			}
+			if err := fn(urlData); err != nil {
+				return err
+			}
+		}
+		if err := rows.Err(); err != nil {
+			s.logger.Error("Postgres list failed", zap.Error(err))
+			return err
+		}
+		return nil
+	}
+}
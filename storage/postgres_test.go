@@ -0,0 +1,428 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-url-shortening/types"
+	"go.uber.org/zap"
+)
+
+func newTestPostgresStorage(t *testing.T) (*PostgresStorage, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS urls")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE INDEX IF NOT EXISTS urls_original_url_idx")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE urls ADD COLUMN IF NOT EXISTS expires_at")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE urls ADD COLUMN IF NOT EXISTS tags")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE INDEX IF NOT EXISTS urls_tags_idx")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE urls ADD COLUMN IF NOT EXISTS dedup_key")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE INDEX IF NOT EXISTS urls_dedup_key_idx")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE urls ADD COLUMN IF NOT EXISTS access_count")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE urls ADD COLUMN IF NOT EXISTS external_id")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE UNIQUE INDEX IF NOT EXISTS urls_external_id_idx")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	storage, err := newPostgresStorageFromDB(db, zap.NewNop())
+	require.NoError(t, err)
+	return storage, mock
+}
+
+func TestPostgresStorage(t *testing.T) {
+	ctx := context.Background()
+	urlColumns := []string{"short_url", "original_url", "created_at", "updated_at", "expires_at", "tags", "dedup_key", "access_count", "external_id"}
+
+	t.Run("Migration failure", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer db.Close()
+		mock.ExpectExec("CREATE TABLE").WillReturnError(errors.New("permission denied"))
+
+		_, err = newPostgresStorageFromDB(db, zap.NewNop())
+		assert.EqualError(t, err, "permission denied")
+	})
+
+	t.Run("Create", func(t *testing.T) {
+		storage, mock := newTestPostgresStorage(t)
+
+		mock.ExpectExec("INSERT INTO urls").
+			WithArgs("abc123", "https://example.com", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		assert.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}))
+
+		mock.ExpectExec("INSERT INTO urls").
+			WithArgs("abc123", "https://example.com", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnError(&pq.Error{Code: pqUniqueViolation})
+		assert.Equal(t, ErrShortURLExists, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}))
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("GetOrCreate", func(t *testing.T) {
+		storage, mock := newTestPostgresStorage(t)
+		now := time.Now().UTC()
+
+		mock.ExpectBegin()
+		mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs("https://example.com").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT short_url, .* FROM urls WHERE \(dedup_key .* AND \(expires_at IS NULL OR expires_at > now\(\)\)`).
+			WithArgs("https://example.com").
+			WillReturnRows(sqlmock.NewRows(urlColumns))
+		mock.ExpectExec("INSERT INTO urls").
+			WithArgs("abc123", "https://example.com", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		created, isNew, err := storage.GetOrCreate(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"})
+		require.NoError(t, err)
+		assert.True(t, isNew)
+		assert.Equal(t, "abc123", created.ShortURL)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("SELECT pg_advisory_xact_lock").WithArgs("https://example.com").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT short_url, .* FROM urls WHERE \(dedup_key .* AND \(expires_at IS NULL OR expires_at > now\(\)\)`).
+			WithArgs("https://example.com").
+			WillReturnRows(sqlmock.NewRows(urlColumns).AddRow("abc123", "https://example.com", now, now, nil, "{}", "", 2, ""))
+		mock.ExpectRollback()
+		existing, isNew, err := storage.GetOrCreate(ctx, types.URLData{ShortURL: "def456", OriginalURL: "https://example.com"})
+		require.NoError(t, err)
+		assert.False(t, isNew)
+		assert.Equal(t, "abc123", existing.ShortURL)
+		assert.Equal(t, int64(2), existing.AccessCount)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("GetURLData", func(t *testing.T) {
+		storage, mock := newTestPostgresStorage(t)
+		now := time.Now().UTC()
+
+		mock.ExpectQuery("SELECT short_url, original_url, created_at, updated_at, expires_at, tags, dedup_key, access_count, external_id FROM urls WHERE short_url").
+			WithArgs("abc123").
+			WillReturnRows(sqlmock.NewRows(urlColumns).AddRow("abc123", "https://example.com", now, now, nil, "{}", "", 0, ""))
+		urlData, err := storage.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+		assert.Equal(t, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com", CreatedAt: now, UpdatedAt: now}, urlData)
+
+		expiresAt := now.Add(time.Hour)
+		mock.ExpectQuery("SELECT short_url, original_url, created_at, updated_at, expires_at, tags, dedup_key, access_count, external_id FROM urls WHERE short_url").
+			WithArgs("ttl123").
+			WillReturnRows(sqlmock.NewRows(urlColumns).AddRow("ttl123", "https://example.com", now, now, expiresAt, "{}", "", 0, ""))
+		urlData, err = storage.GetURLData(ctx, "ttl123")
+		require.NoError(t, err)
+		assert.Equal(t, expiresAt, urlData.ExpiresAt)
+
+		mock.ExpectQuery("SELECT short_url, original_url, created_at, updated_at, expires_at, tags, dedup_key, access_count, external_id FROM urls WHERE short_url").
+			WithArgs("missing").
+			WillReturnRows(sqlmock.NewRows(urlColumns))
+		_, err = storage.GetURLData(ctx, "missing")
+		assert.Equal(t, ErrShortURLNotFound, err)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("External IDs", func(t *testing.T) {
+		storage, mock := newTestPostgresStorage(t)
+		now := time.Now().UTC()
+
+		mock.ExpectExec("INSERT INTO urls").
+			WithArgs("def456", "https://example.com", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "order-1").
+			WillReturnError(&pq.Error{Code: pqUniqueViolation, Constraint: postgresExternalIDIndex})
+		err := storage.Create(ctx, types.URLData{ShortURL: "def456", OriginalURL: "https://example.com", ExternalID: "order-1"})
+		assert.Equal(t, ErrExternalIDExists, err)
+
+		mock.ExpectQuery(regexp.QuoteMeta("FROM urls WHERE external_id = $1 AND external_id <> ''")).
+			WithArgs("order-1").
+			WillReturnRows(sqlmock.NewRows(urlColumns).AddRow("abc123", "https://example.com", now, now, nil, "{}", "", 0, "order-1"))
+		urlData, err := storage.GetByExternalID(ctx, "order-1")
+		require.NoError(t, err)
+		assert.Equal(t, "abc123", urlData.ShortURL)
+		assert.Equal(t, "order-1", urlData.ExternalID)
+
+		mock.ExpectQuery(regexp.QuoteMeta("FROM urls WHERE external_id = $1")).
+			WithArgs("missing").
+			WillReturnRows(sqlmock.NewRows(urlColumns))
+		_, err = storage.GetByExternalID(ctx, "missing")
+		assert.Equal(t, ErrShortURLNotFound, err)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("GetShortURL uses an indexed lookup", func(t *testing.T) {
+		storage, mock := newTestPostgresStorage(t)
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT short_url FROM urls WHERE dedup_key = $1 OR (dedup_key = '' AND original_url = $1)")).
+			WithArgs("https://example.com").
+			WillReturnRows(sqlmock.NewRows([]string{"short_url"}).AddRow("abc123"))
+		shortURL, err := storage.GetShortURL(ctx, "https://example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "abc123", shortURL)
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT short_url FROM urls WHERE dedup_key = $1 OR (dedup_key = '' AND original_url = $1)")).
+			WithArgs("https://missing.com").
+			WillReturnRows(sqlmock.NewRows([]string{"short_url"}))
+		_, err = storage.GetShortURL(ctx, "https://missing.com")
+		assert.Equal(t, ErrShortURLNotFound, err)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ListByTag", func(t *testing.T) {
+		storage, mock := newTestPostgresStorage(t)
+		now := time.Now().UTC()
+
+		mock.ExpectQuery(regexp.QuoteMeta("FROM urls WHERE tags @> ARRAY[$1]::TEXT[] ORDER BY created_at, short_url")).
+			WithArgs("campaignX").
+			WillReturnRows(sqlmock.NewRows(urlColumns).
+				AddRow("a", "https://a.com", now, now, nil, "{campaignX}", "", 0, "").
+				AddRow("b", "https://b.com", now, now, nil, "{campaignX,team}", "", 0, ""))
+		items, err := storage.ListByTag(ctx, "campaignX")
+		require.NoError(t, err)
+		require.Len(t, items, 2)
+		assert.Equal(t, []string{"campaignX"}, items[0].Tags)
+		assert.Equal(t, []string{"campaignX", "team"}, items[1].Tags)
+
+		mock.ExpectQuery("FROM urls WHERE tags").
+			WithArgs("missing").
+			WillReturnRows(sqlmock.NewRows(urlColumns))
+		items, err = storage.ListByTag(ctx, "missing")
+		require.NoError(t, err)
+		assert.Empty(t, items)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("TopN", func(t *testing.T) {
+		storage, mock := newTestPostgresStorage(t)
+		now := time.Now().UTC()
+
+		mock.ExpectQuery("FROM urls WHERE expires_at IS NULL OR expires_at > \\$1\\s+ORDER BY access_count DESC, created_at, short_url LIMIT \\$2").
+			WithArgs(sqlmock.AnyArg(), 2).
+			WillReturnRows(sqlmock.NewRows(urlColumns).
+				AddRow("a", "https://a.com", now, now, nil, "{}", "", 50, "").
+				AddRow("b", "https://b.com", now, now, nil, "{}", "", 10, ""))
+		items, err := storage.TopN(ctx, 2)
+		require.NoError(t, err)
+		require.Len(t, items, 2)
+		assert.Equal(t, "a", items[0].ShortURL)
+		assert.Equal(t, int64(50), items[0].AccessCount)
+
+		_, err = storage.TopN(ctx, 0)
+		assert.Equal(t, ErrInvalidPagination, err)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("List", func(t *testing.T) {
+		storage, mock := newTestPostgresStorage(t)
+		now := time.Now().UTC()
+
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM urls")).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		mock.ExpectQuery(regexp.QuoteMeta("FROM urls ORDER BY created_at, short_url LIMIT $1 OFFSET $2")).
+			WithArgs(2, 1).
+			WillReturnRows(sqlmock.NewRows(urlColumns).
+				AddRow("b", "https://b.com", now, now, nil, "{}", "", 0, "").
+				AddRow("c", "https://c.com", now, now, nil, "{}", "", 0, ""))
+		page, total, err := storage.List(ctx, 1, 2)
+		require.NoError(t, err)
+		assert.Equal(t, 3, total)
+		require.Len(t, page, 2)
+		assert.Equal(t, "b", page[0].ShortURL)
+
+		_, _, err = storage.List(ctx, -1, 2)
+		assert.Equal(t, ErrInvalidPagination, err)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ForEach", func(t *testing.T) {
+		storage, mock := newTestPostgresStorage(t)
+		now := time.Now().UTC()
+
+		mock.ExpectQuery(regexp.QuoteMeta("FROM urls ORDER BY created_at, short_url")).
+			WillReturnRows(sqlmock.NewRows(urlColumns).
+				AddRow("a", "https://a.com", now, now, nil, "{}", "", 0, "").
+				AddRow("b", "https://b.com", now, now, nil, "{}", "", 0, ""))
+		var visited []string
+		require.NoError(t, storage.ForEach(ctx, func(urlData types.URLData) error {
+			visited = append(visited, urlData.ShortURL)
+			return nil
+		}))
+		assert.Equal(t, []string{"a", "b"}, visited)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		storage, mock := newTestPostgresStorage(t)
+		now := time.Now().UTC()
+
+		mock.ExpectQuery("UPDATE urls SET original_url .* RETURNING").
+			WithArgs("abc123", "https://updated.com", sqlmock.AnyArg(), "", nil, nil).
+			WillReturnRows(sqlmock.NewRows(urlColumns).AddRow("abc123", "https://updated.com", now, now, nil, "{}", "", 4, ""))
+		updated, err := storage.Update(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://updated.com"})
+		assert.NoError(t, err)
+		assert.Equal(t, "https://updated.com", updated.OriginalURL)
+		assert.Equal(t, int64(4), updated.AccessCount)
+
+		mock.ExpectQuery("UPDATE urls SET original_url .* RETURNING").
+			WithArgs("missing", "https://updated.com", sqlmock.AnyArg(), "", nil, nil).
+			WillReturnRows(sqlmock.NewRows(urlColumns))
+		_, err = storage.Update(ctx, types.URLData{ShortURL: "missing", OriginalURL: "https://updated.com"})
+		assert.Equal(t, ErrShortURLNotFound, err)
+
+		expiresAt := now.Add(time.Hour)
+		mock.ExpectQuery("UPDATE urls SET original_url .* RETURNING").
+			WithArgs("abc123", "https://updated.com", sqlmock.AnyArg(), "", expiresAt, nil).
+			WillReturnRows(sqlmock.NewRows(urlColumns).AddRow("abc123", "https://updated.com", now, now, expiresAt, "{}", "", 4, ""))
+		updated, err = storage.Update(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://updated.com", ExpiresAt: expiresAt})
+		assert.NoError(t, err)
+		assert.Equal(t, expiresAt, updated.ExpiresAt)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("CompareAndUpdate", func(t *testing.T) {
+		storage, mock := newTestPostgresStorage(t)
+		now := time.Now().UTC()
+		version := now.Add(-time.Minute)
+
+		mock.ExpectQuery(`UPDATE urls SET original_url .* AND \(\$6::timestamptz IS NULL OR updated_at = \$6\) RETURNING`).
+			WithArgs("abc123", "https://updated.com", sqlmock.AnyArg(), "", nil, version).
+			WillReturnRows(sqlmock.NewRows(urlColumns).AddRow("abc123", "https://updated.com", now, now, nil, "{}", "", 4, ""))
+		updated, err := storage.CompareAndUpdate(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://updated.com"}, version)
+		assert.NoError(t, err)
+		assert.Equal(t, now, updated.UpdatedAt)
+
+		mock.ExpectQuery("UPDATE urls SET original_url .* RETURNING").
+			WithArgs("abc123", "https://stale.com", sqlmock.AnyArg(), "", nil, version).
+			WillReturnRows(sqlmock.NewRows(urlColumns))
+		mock.ExpectQuery("SELECT .* FROM urls WHERE short_url").
+			WithArgs("abc123").
+			WillReturnRows(sqlmock.NewRows(urlColumns).AddRow("abc123", "https://updated.com", now, now, nil, "{}", "", 4, ""))
+		_, err = storage.CompareAndUpdate(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://stale.com"}, version)
+		assert.Equal(t, ErrVersionMismatch, err)
+
+		mock.ExpectQuery("UPDATE urls SET original_url .* RETURNING").
+			WithArgs("missing", "https://updated.com", sqlmock.AnyArg(), "", nil, version).
+			WillReturnRows(sqlmock.NewRows(urlColumns))
+		mock.ExpectQuery("SELECT .* FROM urls WHERE short_url").
+			WithArgs("missing").
+			WillReturnRows(sqlmock.NewRows(urlColumns))
+		_, err = storage.CompareAndUpdate(ctx, types.URLData{ShortURL: "missing", OriginalURL: "https://updated.com"}, version)
+		assert.Equal(t, ErrShortURLNotFound, err)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		storage, mock := newTestPostgresStorage(t)
+		now := time.Now().UTC()
+
+		mock.ExpectQuery("UPDATE urls SET short_url .* RETURNING").
+			WithArgs("abc123", "docs", "https://example.org", sqlmock.AnyArg(), "", nil, now).
+			WillReturnRows(sqlmock.NewRows(urlColumns).AddRow("docs", "https://example.org", now, now, nil, "{}", "", 4, ""))
+		renamed, err := storage.Rename(ctx, "abc123", types.URLData{ShortURL: "docs", OriginalURL: "https://example.org"}, now)
+		assert.NoError(t, err)
+		assert.Equal(t, "docs", renamed.ShortURL)
+		assert.Equal(t, "https://example.org", renamed.OriginalURL)
+		assert.Equal(t, int64(4), renamed.AccessCount)
+
+		stale := now.Add(-time.Second)
+		mock.ExpectQuery("UPDATE urls SET short_url .* RETURNING").
+			WithArgs("abc123", "docs", "https://example.org", sqlmock.AnyArg(), "", nil, stale).
+			WillReturnRows(sqlmock.NewRows(urlColumns))
+		mock.ExpectQuery("SELECT .* FROM urls WHERE short_url").
+			WithArgs("abc123").
+			WillReturnRows(sqlmock.NewRows(urlColumns).AddRow("abc123", "https://example.com", now, now, nil, "{}", "", 4, ""))
+		_, err = storage.Rename(ctx, "abc123", types.URLData{ShortURL: "docs", OriginalURL: "https://example.org"}, stale)
+		assert.Equal(t, ErrVersionMismatch, err)
+
+		mock.ExpectQuery("UPDATE urls SET short_url .* RETURNING").
+			WithArgs("abc123", "taken", "https://example.org", sqlmock.AnyArg(), "", nil, nil).
+			WillReturnError(&pq.Error{Code: pqUniqueViolation})
+		_, err = storage.Rename(ctx, "abc123", types.URLData{ShortURL: "taken", OriginalURL: "https://example.org"}, time.Time{})
+		assert.Equal(t, ErrShortURLExists, err)
+
+		mock.ExpectQuery("UPDATE urls SET short_url .* RETURNING").
+			WithArgs("missing", "docs", "https://example.org", sqlmock.AnyArg(), "", nil, nil).
+			WillReturnRows(sqlmock.NewRows(urlColumns))
+		_, err = storage.Rename(ctx, "missing", types.URLData{ShortURL: "docs", OriginalURL: "https://example.org"}, time.Time{})
+		assert.Equal(t, ErrShortURLNotFound, err)
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		storage, mock := newTestPostgresStorage(t)
+
+		mock.ExpectExec("DELETE FROM urls WHERE short_url").WithArgs("abc123").WillReturnResult(sqlmock.NewResult(0, 1))
+		assert.NoError(t, storage.Delete(ctx, "abc123"))
+
+		mock.ExpectExec("DELETE FROM urls WHERE short_url").WithArgs("missing").WillReturnResult(sqlmock.NewResult(0, 0))
+		assert.Equal(t, ErrShortURLNotFound, storage.Delete(ctx, "missing"))
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("IncrementAccess", func(t *testing.T) {
+		storage, mock := newTestPostgresStorage(t)
+
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE urls SET access_count = access_count + 1")).WithArgs("abc123").WillReturnResult(sqlmock.NewResult(0, 1))
+		assert.NoError(t, storage.IncrementAccess(ctx, "abc123"))
+
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE urls SET access_count = access_count + 1")).WithArgs("missing").WillReturnResult(sqlmock.NewResult(0, 0))
+		assert.Equal(t, ErrShortURLNotFound, storage.IncrementAccess(ctx, "missing"))
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ReplaceAll", func(t *testing.T) {
+		storage, mock := newTestPostgresStorage(t)
+		items := []types.URLData{
+			{ShortURL: "a", OriginalURL: "https://a.com"},
+			{ShortURL: "b", OriginalURL: "https://b.com"},
+		}
+
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM urls").WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec("INSERT INTO urls").WithArgs("a", "https://a.com", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO urls").WithArgs("b", "https://b.com", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		assert.NoError(t, storage.ReplaceAll(ctx, items))
+
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM urls").WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec("INSERT INTO urls").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("INSERT INTO urls").WillReturnError(&pq.Error{Code: pqUniqueViolation})
+		mock.ExpectRollback()
+		assert.Equal(t, ErrShortURLExists, storage.ReplaceAll(ctx, []types.URLData{{ShortURL: "dup"}, {ShortURL: "dup"}}))
+
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Context cancellation", func(t *testing.T) {
+		storage, mock := newTestPostgresStorage(t)
+		cancelCtx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		assert.Equal(t, context.Canceled, storage.Create(cancelCtx, types.URLData{ShortURL: "cancelled"}))
+		_, err := storage.GetURLData(cancelCtx, "cancelled")
+		assert.Equal(t, context.Canceled, err)
+		_, err = storage.GetShortURL(cancelCtx, "https://cancelled.com")
+		assert.Equal(t, context.Canceled, err)
+		_, err = storage.Update(cancelCtx, types.URLData{ShortURL: "cancelled"})
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, context.Canceled, storage.Delete(cancelCtx, "cancelled"))
+		assert.Equal(t, context.Canceled, storage.ReplaceAll(cancelCtx, nil))
+
+		assert.NoError(t, mock.ExpectationsWereMet(), "No queries should have been issued")
+	})
+}
@@ -0,0 +1,905 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go-url-shortening/types"
+	"go.uber.org/zap"
+)
+
+// Redis key layout used by RedisStorage.
+const (
+	redisURLKeyPrefix = "url:"          // Hash per short URL holding its URLData fields
+	redisIndexKey     = "urls:index"    // Hash mapping lookup key (dedup key or original URL) -> short URL
+	redisCodesKey     = "urls:codes"    // Set of all stored short URLs, used for counting and enumeration
+	redisExternalKey  = "urls:external" // Hash mapping external ID -> short URL
+	redisTimeLayout   = time.RFC3339Nano
+	// redisForEachPageSize is the COUNT hint of the SSCAN calls of ForEach, and the number of
+	// hashes it fetches per pipeline
+	redisForEachPageSize = 500
+)
+
+// Sentinel replies returned by the Lua scripts below.
+const (
+	redisReplyExists   = "EXISTS"
+	redisReplyExternal = "EXTERNAL_EXISTS"
+	redisReplyNotFound = "NOT_FOUND"
+	redisReplyFull     = "FULL"
+	redisReplyOK       = "OK"
+	redisReplyVersion  = "VERSION_MISMATCH"
+)
+
+// redisLookupKeyLua defines lookup_key, the Lua counterpart of types.URLData.LookupKey,
+// for hashes stored before the dedup_key field existed as well as current ones.
+const redisLookupKeyLua = `
+local function lookup_key(key)
+  local dedup = redis.call("HGET", key, "dedup_key")
+  if dedup and dedup ~= "" then return dedup end
+  return redis.call("HGET", key, "original_url")
+end
+`
+
+// redisCreateLua defines create, which creates a short URL and indexes it under its lookup key
+// with index_cmd: HSETNX to keep an existing entry, HSET to replace it. It is shared by the create
+// and get-or-create scripts.
+// KEYS: url key, index key, codes key, external key. ARGV: short, original, created_at, updated_at, expires_at, tags, dedup_key, lookup key, capacity, external_id.
+const redisCreateLua = `
+local function create(index_cmd)
+  if redis.call("SCARD", KEYS[3]) >= tonumber(ARGV[9]) then return "FULL" end
+  if redis.call("EXISTS", KEYS[1]) == 1 then return "EXISTS" end
+  if ARGV[10] ~= "" and redis.call("HEXISTS", KEYS[4], ARGV[10]) == 1 then return "EXTERNAL_EXISTS" end
+  redis.call("HSET", KEYS[1], "short_url", ARGV[1], "original_url", ARGV[2], "created_at", ARGV[3], "updated_at", ARGV[4], "expires_at", ARGV[5], "tags", ARGV[6], "dedup_key", ARGV[7], "external_id", ARGV[10])
+  redis.call(index_cmd, KEYS[2], ARGV[8], ARGV[1])
+  if ARGV[10] ~= "" then redis.call("HSET", KEYS[4], ARGV[10], ARGV[1]) end
+  redis.call("SADD", KEYS[3], ARGV[1])
+  return "OK"
+end
+`
+
+// redisTimeKeyLua defines time_key, which turns a redisTimeLayout time in UTC into a string that
+// sorts in time order, padding the fraction of a second that RFC3339Nano trims to nine digits.
+const redisTimeKeyLua = `
+local function time_key(t)
+  local base, frac = string.match(t, "^(%d+%-%d+%-%d+T%d+:%d+:%d+)%.?(%d*)Z$")
+  if not base then return t end
+  return base .. frac .. string.rep("0", 9 - #frac)
+end
+`
+
+// The scripts run atomically on the Redis server, which gives RedisStorage the same
+// check-then-write guarantees that InMemoryStorage gets from its mutex.
+var (
+	// KEYS and ARGV as for redisCreateLua.
+	redisCreateScript = redis.NewScript(redisCreateLua + `return create("HSETNX")`)
+
+	// KEYS and ARGV as for redisCreateLua, plus the url key prefix as ARGV[11] and the current time
+	// as ARGV[12]. The hash of an existing short URL is only known once the index is read, so its
+	// key is built in the script. An expired or deleted short URL is replaced in the index by the
+	// new one.
+	redisGetOrCreateScript = redis.NewScript(redisCreateLua + redisTimeKeyLua + `
+local existing = redis.call("HGET", KEYS[2], ARGV[8])
+if existing then
+  local key = ARGV[11] .. existing
+  local expires_at, deleted_at = unpack(redis.call("HMGET", key, "expires_at", "deleted_at"))
+  local live = redis.call("EXISTS", key) == 1 and (not deleted_at or deleted_at == "") and
+    (not expires_at or expires_at == "" or time_key(expires_at) > time_key(ARGV[12]))
+  if live then return redis.call("HGETALL", key) end
+end
+return create("HSET")`)
+
+	// KEYS: url key, index key. ARGV: short, new original, updated_at, new dedup_key, new lookup key, new expires_at,
+	// expected updated_at or "" to update any version.
+	redisUpdateScript = redis.NewScript(redisLookupKeyLua + `
+if redis.call("EXISTS", KEYS[1]) == 0 then return "NOT_FOUND" end
+if ARGV[7] ~= "" and redis.call("HGET", KEYS[1], "updated_at") ~= ARGV[7] then return "VERSION_MISMATCH" end
+local old = lookup_key(KEYS[1])
+if redis.call("HGET", KEYS[2], old) == ARGV[1] then redis.call("HDEL", KEYS[2], old) end
+if redis.call("HGET", KEYS[1], "original_url") ~= ARGV[2] then redis.call("HDEL", KEYS[1], "last_checked_at", "last_status") end
+redis.call("HSET", KEYS[1], "original_url", ARGV[2], "updated_at", ARGV[3], "dedup_key", ARGV[4], "expires_at", ARGV[6])
+redis.call("HSETNX", KEYS[2], ARGV[5], ARGV[1])
+return redis.call("HGETALL", KEYS[1])`)
+
+	// KEYS: url key, new url key, index key, codes key, external key. ARGV: short, new short, new original,
+	// updated_at, new dedup_key, new lookup key, new expires_at, expected updated_at or "" to rename any version.
+	redisRenameScript = redis.NewScript(redisLookupKeyLua + `
+if redis.call("EXISTS", KEYS[1]) == 0 then return "NOT_FOUND" end
+if ARGV[8] ~= "" and redis.call("HGET", KEYS[1], "updated_at") ~= ARGV[8] then return "VERSION_MISMATCH" end
+if redis.call("EXISTS", KEYS[2]) == 1 then return "EXISTS" end
+local old = lookup_key(KEYS[1])
+if redis.call("HGET", KEYS[3], old) == ARGV[1] then redis.call("HDEL", KEYS[3], old) end
+redis.call("RENAME", KEYS[1], KEYS[2])
+if redis.call("HGET", KEYS[2], "original_url") ~= ARGV[3] then redis.call("HDEL", KEYS[2], "last_checked_at", "last_status") end
+redis.call("HSET", KEYS[2], "short_url", ARGV[2], "original_url", ARGV[3], "updated_at", ARGV[4], "dedup_key", ARGV[5], "expires_at", ARGV[7])
+redis.call("HSETNX", KEYS[3], ARGV[6], ARGV[2])
+local external = redis.call("HGET", KEYS[2], "external_id")
+if external and external ~= "" then redis.call("HSET", KEYS[5], external, ARGV[2]) end
+redis.call("SREM", KEYS[4], ARGV[1])
+redis.call("SADD", KEYS[4], ARGV[2])
+return redis.call("HGETALL", KEYS[2])`)
+
+	// KEYS: url key, index key, codes key, external key. ARGV: short.
+	redisDeleteScript = redis.NewScript(redisLookupKeyLua + `
+if redis.call("EXISTS", KEYS[1]) == 0 then return "NOT_FOUND" end
+local old = lookup_key(KEYS[1])
+if redis.call("HGET", KEYS[2], old) == ARGV[1] then redis.call("HDEL", KEYS[2], old) end
+local external = redis.call("HGET", KEYS[1], "external_id")
+if external and external ~= "" then redis.call("HDEL", KEYS[4], external) end
+redis.call("DEL", KEYS[1])
+redis.call("SREM", KEYS[3], ARGV[1])
+return "OK"`)
+
+	// KEYS: url key. ARGV: none.
+	redisIncrementAccessScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then return "NOT_FOUND" end
+redis.call("HINCRBY", KEYS[1], "access_count", 1)
+return "OK"`)
+
+	// KEYS: url key. ARGV: deleted_at, or "" to clear it.
+	redisMarkDeletedScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then return "NOT_FOUND" end
+if ARGV[1] == "" then redis.call("HDEL", KEYS[1], "deleted_at") else redis.call("HSET", KEYS[1], "deleted_at", ARGV[1]) end
+return redis.call("HGETALL", KEYS[1])`)
+
+	// KEYS: url key. ARGV: original, last_checked_at, last_status.
+	redisRecordCheckScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then return "NOT_FOUND" end
+if redis.call("HGET", KEYS[1], "original_url") ~= ARGV[1] then return "OK" end
+redis.call("HSET", KEYS[1], "last_checked_at", ARGV[2], "last_status", ARGV[3])
+return "OK"`)
+
+	// KEYS: index key, codes key, external key. ARGV: url key prefix, then groups of short, original, created_at, updated_at, expires_at, tags, dedup_key, lookup key, access_count, external_id, deleted_at.
+	redisReplaceAllScript = redis.NewScript(`
+for _, code in ipairs(redis.call("SMEMBERS", KEYS[2])) do redis.call("DEL", ARGV[1] .. code) end
+redis.call("DEL", KEYS[1], KEYS[2], KEYS[3])
+for i = 2, #ARGV, 11 do
+  redis.call("HSET", ARGV[1] .. ARGV[i], "short_url", ARGV[i], "original_url", ARGV[i+1], "created_at", ARGV[i+2], "updated_at", ARGV[i+3], "expires_at", ARGV[i+4], "tags", ARGV[i+5], "dedup_key", ARGV[i+6], "access_count", ARGV[i+8], "external_id", ARGV[i+9])
+  if ARGV[i+10] ~= "" then redis.call("HSET", ARGV[1] .. ARGV[i], "deleted_at", ARGV[i+10]) end
+  redis.call("HSETNX", KEYS[1], ARGV[i+7], ARGV[i])
+  if ARGV[i+9] ~= "" then redis.call("HSET", KEYS[3], ARGV[i+9], ARGV[i]) end
+  redis.call("SADD", KEYS[2], ARGV[i])
+end
+return "OK"`)
+)
+
+// RedisStorage implements the Storage interface on top of a Redis server.
+// Each URLData is stored as a hash keyed by its short URL, with a secondary
+// hash index from original URL to short URL backing GetShortURL. Soft-deleted URLs are kept until
+// they are restored, as nothing purges them, and count toward the capacity meanwhile.
+type RedisStorage struct {
+	client   *redis.Client // Client used for all Redis commands
+	capacity int           // Maximum number of URLs that can be stored
+	logger   *zap.Logger   // Logger for RedisStorage operations
+	pageSize int           // Number of hashes ForEach fetches at a time
+}
+
+// NewRedisStorage creates and returns a new RedisStorage connected to the Redis server at addr.
+// The connection is established lazily on the first command.
+func NewRedisStorage(addr string, capacity int, logger *zap.Logger) *RedisStorage {
+	if capacity <= 0 {
+		capacity = 1000 // Default capacity if an invalid value is provided
+	}
+	if logger == nil {
+		var err error
+		logger, err = zap.NewProduction()
+		if err != nil {
+			panic("Failed to initialize zap logger: " + err.Error())
+		}
+	}
+	return &RedisStorage{
+		client:   redis.NewClient(&redis.Options{Addr: addr}),
+		capacity: capacity,
+		logger:   logger,
+		pageSize: redisForEachPageSize,
+	}
+}
+
+// Ping checks that the Redis server is reachable.
+func (s *RedisStorage) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+// Close releases the underlying Redis connection pool.
+func (s *RedisStorage) Close() error {
+	return s.client.Close()
+}
+
+func redisURLKey(shortURL string) string {
+	return redisURLKeyPrefix + shortURL
+}
+
+// Create adds a new short URL and its corresponding URLData to the storage
+func (s *RedisStorage) Create(ctx context.Context, urlData types.URLData) error {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("Create operation cancelled", zap.String("shortURL", urlData.ShortURL))
+		return ctx.Err()
+	default:
+		urlData.CreatedAt = time.Now().UTC()
+		urlData.UpdatedAt = urlData.CreatedAt
+
+		reply, err := redisCreateScript.Run(ctx, s.client,
+			[]string{redisURLKey(urlData.ShortURL), redisIndexKey, redisCodesKey, redisExternalKey},
+			urlData.ShortURL, urlData.OriginalURL,
+			urlData.CreatedAt.Format(redisTimeLayout), urlData.UpdatedAt.Format(redisTimeLayout),
+			formatRedisExpiry(urlData.ExpiresAt), formatRedisTags(urlData.Tags),
+			urlData.DedupKey, urlData.LookupKey(), s.capacity, urlData.ExternalID,
+		).Text()
+		if err != nil {
+			s.logger.Error("Redis create failed", zap.String("shortURL", urlData.ShortURL), zap.Error(err))
+			return err
+		}
+
+		switch reply {
+		case redisReplyFull:
+			s.logger.Error("Storage capacity reached. Cannot create shortURL", zap.String("shortURL", urlData.ShortURL))
+			return ErrStorageCapacityReached
+		case redisReplyExists:
+			s.logger.Warn("Attempt to create duplicate shortURL", zap.String("shortURL", urlData.ShortURL))
+			return ErrShortURLExists
+		case redisReplyExternal:
+			s.logger.Warn("Attempt to create duplicate external ID", zap.String("externalID", urlData.ExternalID))
+			return ErrExternalIDExists
+		}
+
+		s.logger.Info("Short URL created successfully",
+			zap.String("shortURL", urlData.ShortURL),
+			zap.String("originalURL", urlData.OriginalURL),
+			zap.Time("createdAt", urlData.CreatedAt))
+		return nil
+	}
+}
+
+// GetOrCreate returns the live URLData indexed under the lookup key of urlData, or creates urlData
+// if there is none, re-pointing the index at it, in a single script.
+func (s *RedisStorage) GetOrCreate(ctx context.Context, urlData types.URLData) (types.URLData, bool, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("GetOrCreate operation cancelled", zap.String("shortURL", urlData.ShortURL))
+		return types.URLData{}, false, ctx.Err()
+	default:
+		urlData.CreatedAt = time.Now().UTC()
+		urlData.UpdatedAt = urlData.CreatedAt
+		urlData.AccessCount = 0
+
+		reply, err := redisGetOrCreateScript.Run(ctx, s.client,
+			[]string{redisURLKey(urlData.ShortURL), redisIndexKey, redisCodesKey, redisExternalKey},
+			urlData.ShortURL, urlData.OriginalURL,
+			urlData.CreatedAt.Format(redisTimeLayout), urlData.UpdatedAt.Format(redisTimeLayout),
+			formatRedisExpiry(urlData.ExpiresAt), formatRedisTags(urlData.Tags),
+			urlData.DedupKey, urlData.LookupKey(), s.capacity, urlData.ExternalID, redisURLKeyPrefix,
+			urlData.CreatedAt.Format(redisTimeLayout),
+		).Result()
+		if err != nil {
+			s.logger.Error("Redis get-or-create failed", zap.String("shortURL", urlData.ShortURL), zap.Error(err))
+			return types.URLData{}, false, err
+		}
+
+		switch reply {
+		case redisReplyFull:
+			s.logger.Error("Storage capacity reached. Cannot create shortURL", zap.String("shortURL", urlData.ShortURL))
+			return types.URLData{}, false, ErrStorageCapacityReached
+		case redisReplyExists:
+			s.logger.Warn("Attempt to create duplicate shortURL", zap.String("shortURL", urlData.ShortURL))
+			return types.URLData{}, false, ErrShortURLExists
+		case redisReplyExternal:
+			s.logger.Warn("Attempt to create duplicate external ID", zap.String("externalID", urlData.ExternalID))
+			return types.URLData{}, false, ErrExternalIDExists
+		case redisReplyOK:
+			s.logger.Info("Short URL created successfully",
+				zap.String("shortURL", urlData.ShortURL),
+				zap.String("originalURL", urlData.OriginalURL),
+				zap.Time("createdAt", urlData.CreatedAt))
+			return urlData, true, nil
+		}
+
+		fields, err := redisHashReply(reply)
+		if err != nil {
+			s.logger.Error("Unexpected Redis get-or-create reply", zap.String("shortURL", urlData.ShortURL), zap.Error(err))
+			return types.URLData{}, false, err
+		}
+		existing, err := decodeRedisURLData(fields)
+		if err != nil {
+			s.logger.Error("Corrupt URL data in Redis", zap.String("shortURL", urlData.ShortURL), zap.Error(err))
+			return types.URLData{}, false, err
+		}
+		return existing, false, nil
+	}
+}
+
+// GetURLData retrieves the URLData for a given short URL.
+func (s *RedisStorage) GetURLData(ctx context.Context, shortURL string) (types.URLData, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("Read operation cancelled", zap.String("shortURL", shortURL))
+		return types.URLData{}, ctx.Err()
+	default:
+		fields, err := s.client.HGetAll(ctx, redisURLKey(shortURL)).Result()
+		if err != nil {
+			s.logger.Error("Redis read failed", zap.String("shortURL", shortURL), zap.Error(err))
+			return types.URLData{}, err
+		}
+		if len(fields) == 0 {
+			return types.URLData{}, ErrShortURLNotFound
+		}
+
+		urlData, err := decodeRedisURLData(fields)
+		if err != nil {
+			s.logger.Error("Corrupt URL data in Redis", zap.String("shortURL", shortURL), zap.Error(err))
+			return types.URLData{}, err
+		}
+		s.logger.Info("URL data retrieved successfully",
+			zap.String("shortURL", shortURL),
+			zap.String("originalURL", urlData.OriginalURL))
+		return urlData, nil
+	}
+}
+
+// GetByExternalID retrieves the URLData stored with the given external ID through the external ID index.
+func (s *RedisStorage) GetByExternalID(ctx context.Context, externalID string) (types.URLData, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("GetByExternalID operation cancelled", zap.String("externalID", externalID))
+		return types.URLData{}, ctx.Err()
+	default:
+		shortURL, err := s.client.HGet(ctx, redisExternalKey, externalID).Result()
+		if errors.Is(err, redis.Nil) {
+			return types.URLData{}, ErrShortURLNotFound
+		}
+		if err != nil {
+			s.logger.Error("Redis external ID lookup failed", zap.String("externalID", externalID), zap.Error(err))
+			return types.URLData{}, err
+		}
+		return s.GetURLData(ctx, shortURL)
+	}
+}
+
+// GetShortURL retrieves the short URL for a given original URL.
+func (s *RedisStorage) GetShortURL(ctx context.Context, originalURL string) (string, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("GetShortURL operation cancelled", zap.String("originalURL", originalURL))
+		return "", ctx.Err()
+	default:
+		shortURL, err := s.client.HGet(ctx, redisIndexKey, originalURL).Result()
+		if errors.Is(err, redis.Nil) {
+			return "", ErrShortURLNotFound
+		}
+		if err != nil {
+			s.logger.Error("Redis index lookup failed", zap.String("originalURL", originalURL), zap.Error(err))
+			return "", err
+		}
+		s.logger.Debug("Short URL retrieved successfully",
+			zap.String("shortURL", shortURL),
+			zap.String("originalURL", originalURL))
+		return shortURL, nil
+	}
+}
+
+// Update modifies the URLData for a given short URL and returns it as stored. The hash is read
+// back by the same script that writes it, so no other write can come in between.
+func (s *RedisStorage) Update(ctx context.Context, urlData types.URLData) (types.URLData, error) {
+	return s.CompareAndUpdate(ctx, urlData, time.Time{})
+}
+
+// CompareAndUpdate is Update, provided the stored record was last updated at expectedUpdatedAt.
+// The version is compared by the script that writes the hash.
+func (s *RedisStorage) CompareAndUpdate(ctx context.Context, urlData types.URLData, expectedUpdatedAt time.Time) (types.URLData, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("Update operation cancelled", zap.String("shortURL", urlData.ShortURL))
+		return types.URLData{}, ctx.Err()
+	default:
+		urlData.UpdatedAt = time.Now().UTC()
+		var expected string
+		if !expectedUpdatedAt.IsZero() {
+			expected = expectedUpdatedAt.UTC().Format(redisTimeLayout)
+		}
+
+		reply, err := redisUpdateScript.Run(ctx, s.client,
+			[]string{redisURLKey(urlData.ShortURL), redisIndexKey},
+			urlData.ShortURL, urlData.OriginalURL, urlData.UpdatedAt.Format(redisTimeLayout),
+			urlData.DedupKey, urlData.LookupKey(), formatRedisExpiry(urlData.ExpiresAt), expected,
+		).Result()
+		if err != nil {
+			s.logger.Error("Redis update failed", zap.String("shortURL", urlData.ShortURL), zap.Error(err))
+			return types.URLData{}, err
+		}
+		switch reply {
+		case redisReplyNotFound:
+			s.logger.Warn("Attempt to update non-existent shortURL", zap.String("shortURL", urlData.ShortURL))
+			return types.URLData{}, ErrShortURLNotFound
+		case redisReplyVersion:
+			s.logger.Warn("Attempt to update a stale version of shortURL", zap.String("shortURL", urlData.ShortURL))
+			return types.URLData{}, ErrVersionMismatch
+		}
+		fields, err := redisHashReply(reply)
+		if err != nil {
+			s.logger.Error("Unexpected Redis update reply", zap.String("shortURL", urlData.ShortURL), zap.Error(err))
+			return types.URLData{}, err
+		}
+		updated, err := decodeRedisURLData(fields)
+		if err != nil {
+			s.logger.Error("Corrupt URL data in Redis", zap.String("shortURL", urlData.ShortURL), zap.Error(err))
+			return types.URLData{}, err
+		}
+
+		s.logger.Info("Updated shortURL",
+			zap.String("shortURL", updated.ShortURL),
+			zap.String("newURL", updated.OriginalURL),
+			zap.Time("updatedAt", updated.UpdatedAt))
+		return updated, nil
+	}
+}
+
+// Rename moves the hash of shortURL to urlData.ShortURL, updates it with urlData and repoints the
+// indexes at it, all in one script, which also compares the version.
+func (s *RedisStorage) Rename(ctx context.Context, shortURL string, urlData types.URLData, expectedUpdatedAt time.Time) (types.URLData, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("Rename operation cancelled", zap.String("shortURL", shortURL))
+		return types.URLData{}, ctx.Err()
+	default:
+		newShortURL := urlData.ShortURL
+		var expected string
+		if !expectedUpdatedAt.IsZero() {
+			expected = expectedUpdatedAt.UTC().Format(redisTimeLayout)
+		}
+
+		reply, err := redisRenameScript.Run(ctx, s.client,
+			[]string{redisURLKey(shortURL), redisURLKey(newShortURL), redisIndexKey, redisCodesKey, redisExternalKey},
+			shortURL, newShortURL, urlData.OriginalURL, time.Now().UTC().Format(redisTimeLayout),
+			urlData.DedupKey, urlData.LookupKey(), formatRedisExpiry(urlData.ExpiresAt), expected,
+		).Result()
+		if err != nil {
+			s.logger.Error("Redis rename failed", zap.String("shortURL", shortURL), zap.Error(err))
+			return types.URLData{}, err
+		}
+		switch reply {
+		case redisReplyNotFound:
+			s.logger.Warn("Attempt to rename non-existent shortURL", zap.String("shortURL", shortURL))
+			return types.URLData{}, ErrShortURLNotFound
+		case redisReplyVersion:
+			s.logger.Warn("Attempt to rename a stale version of shortURL", zap.String("shortURL", shortURL))
+			return types.URLData{}, ErrVersionMismatch
+		case redisReplyExists:
+			s.logger.Warn("Attempt to rename to existing shortURL", zap.String("shortURL", newShortURL))
+			return types.URLData{}, ErrShortURLExists
+		}
+		fields, err := redisHashReply(reply)
+		if err != nil {
+			s.logger.Error("Unexpected Redis rename reply", zap.String("shortURL", shortURL), zap.Error(err))
+			return types.URLData{}, err
+		}
+		renamed, err := decodeRedisURLData(fields)
+		if err != nil {
+			s.logger.Error("Corrupt URL data in Redis", zap.String("shortURL", newShortURL), zap.Error(err))
+			return types.URLData{}, err
+		}
+
+		s.logger.Info("Renamed shortURL", zap.String("shortURL", shortURL), zap.String("newShortURL", newShortURL))
+		return renamed, nil
+	}
+}
+
+// Delete removes a short URL and its corresponding original URL from the storage.
+func (s *RedisStorage) Delete(ctx context.Context, shortURL string) error {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("Delete operation cancelled", zap.String("shortURL", shortURL))
+		return ctx.Err()
+	default:
+		reply, err := redisDeleteScript.Run(ctx, s.client,
+			[]string{redisURLKey(shortURL), redisIndexKey, redisCodesKey, redisExternalKey},
+			shortURL,
+		).Text()
+		if err != nil {
+			s.logger.Error("Redis delete failed", zap.String("shortURL", shortURL), zap.Error(err))
+			return err
+		}
+		if reply == redisReplyNotFound {
+			s.logger.Warn("Attempt to delete non-existent shortURL", zap.String("shortURL", shortURL))
+			return ErrShortURLNotFound
+		}
+
+		s.logger.Info("Deleted shortURL", zap.String("shortURL", shortURL))
+		return nil
+	}
+}
+
+// IncrementAccess adds one to the access count of a short URL with HINCRBY.
+func (s *RedisStorage) IncrementAccess(ctx context.Context, shortURL string) error {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("IncrementAccess operation cancelled", zap.String("shortURL", shortURL))
+		return ctx.Err()
+	default:
+		reply, err := redisIncrementAccessScript.Run(ctx, s.client, []string{redisURLKey(shortURL)}).Text()
+		if err != nil {
+			s.logger.Error("Redis access increment failed", zap.String("shortURL", shortURL), zap.Error(err))
+			return err
+		}
+		if reply == redisReplyNotFound {
+			return ErrShortURLNotFound
+		}
+		return nil
+	}
+}
+
+// RecordCheck stores the result of a reachability check in the URL hash.
+func (s *RedisStorage) RecordCheck(ctx context.Context, shortURL, originalURL string, checkedAt time.Time, status int) error {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("RecordCheck operation cancelled", zap.String("shortURL", shortURL))
+		return ctx.Err()
+	default:
+		reply, err := redisRecordCheckScript.Run(ctx, s.client, []string{redisURLKey(shortURL)},
+			originalURL, checkedAt.UTC().Format(redisTimeLayout), status,
+		).Text()
+		if err != nil {
+			s.logger.Error("Redis check recording failed", zap.String("shortURL", shortURL), zap.Error(err))
+			return err
+		}
+		if reply == redisReplyNotFound {
+			return ErrShortURLNotFound
+		}
+		return nil
+	}
+}
+
+// MarkDeleted sets or, when deletedAt is zero, clears the deleted_at field of the URL hash.
+func (s *RedisStorage) MarkDeleted(ctx context.Context, shortURL string, deletedAt time.Time) (types.URLData, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("MarkDeleted operation cancelled", zap.String("shortURL", shortURL))
+		return types.URLData{}, ctx.Err()
+	default:
+		reply, err := redisMarkDeletedScript.Run(ctx, s.client, []string{redisURLKey(shortURL)},
+			formatRedisExpiry(deletedAt),
+		).Result()
+		if err != nil {
+			s.logger.Error("Redis mark deleted failed", zap.String("shortURL", shortURL), zap.Error(err))
+			return types.URLData{}, err
+		}
+		if reply == redisReplyNotFound {
+			s.logger.Warn("Attempt to mark non-existent shortURL as deleted", zap.String("shortURL", shortURL))
+			return types.URLData{}, ErrShortURLNotFound
+		}
+		fields, err := redisHashReply(reply)
+		if err != nil {
+			s.logger.Error("Unexpected Redis mark deleted reply", zap.String("shortURL", shortURL), zap.Error(err))
+			return types.URLData{}, err
+		}
+		urlData, err := decodeRedisURLData(fields)
+		if err != nil {
+			s.logger.Error("Corrupt URL data in Redis", zap.String("shortURL", shortURL), zap.Error(err))
+			return types.URLData{}, err
+		}
+		s.logger.Info("Marked shortURL as deleted",
+			zap.String("shortURL", shortURL),
+			zap.Bool("deleted", urlData.Deleted()))
+		return urlData, nil
+	}
+}
+
+// ReplaceAll atomically swaps the entire dataset for the given items.
+// The items are validated before anything is written, so on error the storage is left untouched.
+func (s *RedisStorage) ReplaceAll(ctx context.Context, items []types.URLData) error {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("ReplaceAll operation cancelled", zap.Int("items", len(items)))
+		return ctx.Err()
+	default:
+		if len(items) > s.capacity {
+			s.logger.Error("Storage capacity reached. Cannot replace dataset",
+				zap.Int("items", len(items)),
+				zap.Int("capacity", s.capacity))
+			return ErrStorageCapacityReached
+		}
+
+		args := make([]interface{}, 0, 1+11*len(items))
+		args = append(args, redisURLKeyPrefix)
+		seen := make(map[string]struct{}, len(items))
+		seenExternal := make(map[string]struct{})
+		now := time.Now().UTC()
+		for _, urlData := range items {
+			if _, exists := seen[urlData.ShortURL]; exists {
+				s.logger.Warn("Duplicate shortURL in replacement dataset", zap.String("shortURL", urlData.ShortURL))
+				return ErrShortURLExists
+			}
+			seen[urlData.ShortURL] = struct{}{}
+			if urlData.ExternalID != "" {
+				if _, exists := seenExternal[urlData.ExternalID]; exists {
+					s.logger.Warn("Duplicate external ID in replacement dataset", zap.String("externalID", urlData.ExternalID))
+					return ErrExternalIDExists
+				}
+				seenExternal[urlData.ExternalID] = struct{}{}
+			}
+			if urlData.CreatedAt.IsZero() {
+				urlData.CreatedAt = now
+			}
+			if urlData.UpdatedAt.IsZero() {
+				urlData.UpdatedAt = urlData.CreatedAt
+			}
+			args = append(args, urlData.ShortURL, urlData.OriginalURL,
+				urlData.CreatedAt.Format(redisTimeLayout), urlData.UpdatedAt.Format(redisTimeLayout),
+				formatRedisExpiry(urlData.ExpiresAt), formatRedisTags(urlData.Tags),
+				urlData.DedupKey, urlData.LookupKey(), urlData.AccessCount, urlData.ExternalID,
+				formatRedisExpiry(urlData.DeletedAt))
+		}
+
+		if err := redisReplaceAllScript.Run(ctx, s.client, []string{redisIndexKey, redisCodesKey, redisExternalKey}, args...).Err(); err != nil {
+			s.logger.Error("Redis replace failed", zap.Error(err))
+			return err
+		}
+		s.logger.Info("Replaced storage dataset", zap.Int("count", len(items)))
+		return nil
+	}
+}
+
+// ListByTag returns every stored URL carrying the given tag, oldest first.
+// Tags are not indexed in Redis, so this fetches every URL and filters them.
+func (s *RedisStorage) ListByTag(ctx context.Context, tag string) ([]types.URLData, error) {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("ListByTag operation cancelled", zap.String("tag", tag))
+		return nil, ctx.Err()
+	default:
+		all, err := s.loadAll(ctx)
+		if err != nil {
+			s.logger.Error("Redis list failed", zap.String("tag", tag), zap.Error(err))
+			return nil, err
+		}
+
+		var items []types.URLData
+		for _, urlData := range all {
+			if hasTag(urlData, tag) {
+				items = append(items, urlData)
+			}
+		}
+		s.logger.Debug("Listed URLs by tag", zap.String("tag", tag), zap.Int("count", len(items)))
+		return items, nil
+	}
+}
+
+// List returns a page of stored URLs ordered by creation time, and the total number of stored URLs.
+// Redis has no ordering by creation time, so every URL is fetched and the page is cut client-side.
+func (s *RedisStorage) List(ctx context.Context, offset, limit int) ([]types.URLData, int, error) {
+	if err := validatePagination(offset, limit); err != nil {
+		return nil, 0, err
+	}
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("List operation cancelled", zap.Int("offset", offset), zap.Int("limit", limit))
+		return nil, 0, ctx.Err()
+	default:
+		all, err := s.loadAll(ctx)
+		if err != nil {
+			s.logger.Error("Redis list failed", zap.Error(err))
+			return nil, 0, err
+		}
+		return paginate(all, offset, limit), len(all), nil
+	}
+}
+
+// ForEach calls fn with every stored URL, in no particular order. The short URLs are walked with
+// SSCAN and their hashes fetched a page at a time, so that no more than a page is ever held. As
+// with any SSCAN, a URL stored or deleted during the walk may or may not be seen, and one may be
+// seen twice if the set is resized meanwhile.
+func (s *RedisStorage) ForEach(ctx context.Context, fn func(types.URLData) error) error {
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("ForEach operation cancelled")
+		return ctx.Err()
+	default:
+		var cursor uint64
+		for {
+			codes, next, err := s.client.SScan(ctx, redisCodesKey, cursor, "", int64(s.pageSize)).Result()
+			if err != nil {
+				s.logger.Error("Redis list failed", zap.Error(err))
+				return err
+			}
+			// COUNT is only a hint, so a reply may still hold more than a page
+			for len(codes) > 0 {
+				n := min(len(codes), s.pageSize)
+				page, err := s.load(ctx, codes[:n])
+				if err != nil {
+					s.logger.Error("Redis list failed", zap.Error(err))
+					return err
+				}
+				for _, urlData := range page {
+					if err := fn(urlData); err != nil {
+						return err
+					}
+				}
+				codes = codes[n:]
+			}
+			if next == 0 {
+				return nil
+			}
+			cursor = next
+		}
+	}
+}
+
+// TopN returns the n most accessed unexpired URLs, most accessed first. Access counts are not
+// indexed in Redis, so this fetches every URL and ranks them.
+func (s *RedisStorage) TopN(ctx context.Context, n int) ([]types.URLData, error) {
+	if n <= 0 {
+		return nil, ErrInvalidPagination
+	}
+	select {
+	case <-ctx.Done():
+		s.logger.Warn("TopN operation cancelled", zap.Int("n", n))
+		return nil, ctx.Err()
+	default:
+		all, err := s.loadAll(ctx)
+		if err != nil {
+			s.logger.Error("Redis list failed", zap.Int("n", n), zap.Error(err))
+			return nil, err
+		}
+
+		now := time.Now()
+		ranking := newAccessRanking(n)
+		for _, urlData := range all {
+			if !urlData.Expired(now) && !urlData.Deleted() {
+				ranking.add(urlData)
+			}
+		}
+		return ranking.sorted(), nil
+	}
+}
+
+// loadAll fetches every stored URL in a single pipeline, ordered by creation time.
+func (s *RedisStorage) loadAll(ctx context.Context) ([]types.URLData, error) {
+	codes, err := s.client.SMembers(ctx, redisCodesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.load(ctx, codes)
+	if err != nil {
+		return nil, err
+	}
+	sortByCreation(items)
+	return items, nil
+}
+
+// load fetches the URLs of the given short URLs in a single pipeline, leaving out those deleted
+// since the short URLs were read.
+func (s *RedisStorage) load(ctx context.Context, codes []string) ([]types.URLData, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(codes))
+	for i, code := range codes {
+		cmds[i] = pipe.HGetAll(ctx, redisURLKey(code))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	items := make([]types.URLData, 0, len(cmds))
+	for _, cmd := range cmds {
+		if len(cmd.Val()) == 0 {
+			continue
+		}
+		urlData, err := decodeRedisURLData(cmd.Val())
+		if err != nil {
+			s.logger.Error("Corrupt URL data in Redis", zap.Error(err))
+			return nil, err
+		}
+		items = append(items, urlData)
+	}
+	return items, nil
+}
+
+// Usage returns the current number of stored URLs and the storage capacity.
+func (s *RedisStorage) Usage(ctx context.Context) (int, int, error) {
+	count, err := s.client.SCard(ctx, redisCodesKey).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(count), s.capacity, nil
+}
+
+// redisHashReply converts the flat field/value array returned by HGETALL inside a script into a map.
+func redisHashReply(reply interface{}) (map[string]string, error) {
+	values, ok := reply.([]interface{})
+	if !ok || len(values)%2 != 0 {
+		return nil, fmt.Errorf("unexpected hash reply %v", reply)
+	}
+	fields := make(map[string]string, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		field, fieldOK := values[i].(string)
+		value, valueOK := values[i+1].(string)
+		if !fieldOK || !valueOK {
+			return nil, fmt.Errorf("unexpected hash reply %v", reply)
+		}
+		fields[field] = value
+	}
+	return fields, nil
+}
+
+// decodeRedisURLData converts the fields of a Redis URL hash back into URLData.
+func decodeRedisURLData(fields map[string]string) (types.URLData, error) {
+	createdAt, err := time.Parse(redisTimeLayout, fields["created_at"])
+	if err != nil {
+		return types.URLData{}, err
+	}
+	updatedAt, err := time.Parse(redisTimeLayout, fields["updated_at"])
+	if err != nil {
+		return types.URLData{}, err
+	}
+	var expiresAt time.Time
+	if fields["expires_at"] != "" {
+		if expiresAt, err = time.Parse(redisTimeLayout, fields["expires_at"]); err != nil {
+			return types.URLData{}, err
+		}
+	}
+	var accessCount int64
+	if fields["access_count"] != "" {
+		if accessCount, err = strconv.ParseInt(fields["access_count"], 10, 64); err != nil {
+			return types.URLData{}, err
+		}
+	}
+	var lastCheckedAt time.Time
+	if fields["last_checked_at"] != "" {
+		if lastCheckedAt, err = time.Parse(redisTimeLayout, fields["last_checked_at"]); err != nil {
+			return types.URLData{}, err
+		}
+	}
+	var lastStatus int
+	if fields["last_status"] != "" {
+		if lastStatus, err = strconv.Atoi(fields["last_status"]); err != nil {
+			return types.URLData{}, err
+		}
+	}
+	var deletedAt time.Time
+	if fields["deleted_at"] != "" {
+		if deletedAt, err = time.Parse(redisTimeLayout, fields["deleted_at"]); err != nil {
+			return types.URLData{}, err
+		}
+	}
+	return types.URLData{
+		ShortURL:      fields["short_url"],
+		OriginalURL:   fields["original_url"],
+		CreatedAt:     createdAt,
+		UpdatedAt:     updatedAt,
+		ExpiresAt:     expiresAt,
+		Tags:          parseRedisTags(fields["tags"]),
+		DedupKey:      fields["dedup_key"],
+		ExternalID:    fields["external_id"],
+		AccessCount:   accessCount,
+		LastCheckedAt: lastCheckedAt,
+		LastStatus:    lastStatus,
+		DeletedAt:     deletedAt,
+	}, nil
+}
+
+// formatRedisTags encodes tags as a comma-separated list. Tags are validated not to contain commas.
+func formatRedisTags(tags []string) string {
+	return strings.Join(tags, ",")
+}
+
+// parseRedisTags decodes a comma-separated tag list, returning nil for an empty list.
+func parseRedisTags(tags string) []string {
+	if tags == "" {
+		return nil
+	}
+	return strings.Split(tags, ",")
+}
+
+// formatRedisExpiry encodes an expiration time for storage, using an empty string for no expiration.
+// It encodes deletion times the same way.
+func formatRedisExpiry(expiresAt time.Time) string {
+	if expiresAt.IsZero() {
+		return ""
+	}
+	return expiresAt.UTC().Format(redisTimeLayout)
+}
@@ -0,0 +1,553 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-url-shortening/types"
+	"go.uber.org/zap"
+)
+
+func newTestRedisStorage(t *testing.T, capacity int) (*RedisStorage, *miniredis.Miniredis) {
+	server := miniredis.RunT(t)
+	storage := NewRedisStorage(server.Addr(), capacity, zap.NewNop())
+	t.Cleanup(func() { storage.Close() })
+	return storage, server
+}
+
+// pipelineSizeHook records the largest pipeline sent through the client it is added to.
+type pipelineSizeHook struct {
+	largest int
+}
+
+func (h *pipelineSizeHook) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (h *pipelineSizeHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook { return next }
+
+func (h *pipelineSizeHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		h.largest = max(h.largest, len(cmds))
+		return next(ctx, cmds)
+	}
+}
+
+func TestRedisStorage(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("NewRedisStorage", func(t *testing.T) {
+		storage := NewRedisStorage("localhost:0", 0, nil)
+		defer storage.Close()
+		assert.Equal(t, 1000, storage.capacity, "Capacity should be set to default 1000 when input is 0")
+		assert.NotNil(t, storage.logger, "Logger should be initialized when input is nil")
+	})
+
+	t.Run("Create and read", func(t *testing.T) {
+		storage, _ := newTestRedisStorage(t, 10)
+
+		err := storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"})
+		require.NoError(t, err)
+
+		urlData, err := storage.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+		assert.Equal(t, "abc123", urlData.ShortURL)
+		assert.Equal(t, "https://example.com", urlData.OriginalURL)
+		assert.False(t, urlData.CreatedAt.IsZero())
+		assert.Equal(t, urlData.CreatedAt, urlData.UpdatedAt)
+		assert.True(t, urlData.ExpiresAt.IsZero(), "URLs without a TTL should not expire")
+
+		shortURL, err := storage.GetShortURL(ctx, "https://example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "abc123", shortURL)
+
+		err = storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://other.com"})
+		assert.Equal(t, ErrShortURLExists, err)
+
+		_, err = storage.GetURLData(ctx, "nonexistent")
+		assert.Equal(t, ErrShortURLNotFound, err)
+
+		_, err = storage.GetShortURL(ctx, "https://nonexistent.com")
+		assert.Equal(t, ErrShortURLNotFound, err)
+	})
+
+	t.Run("Create preserves expiration", func(t *testing.T) {
+		storage, _ := newTestRedisStorage(t, 10)
+		expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 6, time.UTC)
+
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "ttl123", OriginalURL: "https://example.com", ExpiresAt: expiresAt}))
+		urlData, err := storage.GetURLData(ctx, "ttl123")
+		require.NoError(t, err)
+		assert.Equal(t, expiresAt, urlData.ExpiresAt)
+	})
+
+	t.Run("ListByTag", func(t *testing.T) {
+		storage, _ := newTestRedisStorage(t, 10)
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "a", OriginalURL: "https://a.com", Tags: []string{"campaignX", "team"}}))
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "b", OriginalURL: "https://b.com", Tags: []string{"team"}}))
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "c", OriginalURL: "https://c.com"}))
+
+		items, err := storage.ListByTag(ctx, "campaignX")
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		assert.Equal(t, "a", items[0].ShortURL)
+		assert.Equal(t, []string{"campaignX", "team"}, items[0].Tags)
+
+		items, err = storage.ListByTag(ctx, "team")
+		require.NoError(t, err)
+		assert.Len(t, items, 2)
+
+		urlData, err := storage.GetURLData(ctx, "c")
+		require.NoError(t, err)
+		assert.Nil(t, urlData.Tags, "Untagged URLs should have no tags")
+	})
+
+	t.Run("TopN", func(t *testing.T) {
+		storage, _ := newTestRedisStorage(t, 10)
+		base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		require.NoError(t, storage.ReplaceAll(ctx, []types.URLData{
+			{ShortURL: "low", OriginalURL: "https://low.com", CreatedAt: base, AccessCount: 1},
+			{ShortURL: "high", OriginalURL: "https://high.com", CreatedAt: base, AccessCount: 50},
+			{ShortURL: "tie", OriginalURL: "https://tie.com", CreatedAt: base.Add(time.Hour), AccessCount: 10},
+			{ShortURL: "expired", OriginalURL: "https://expired.com", CreatedAt: base, AccessCount: 100, ExpiresAt: time.Now().Add(-time.Minute)},
+		}))
+		for i := 0; i < 11; i++ {
+			require.NoError(t, storage.IncrementAccess(ctx, "low"))
+		}
+
+		items, err := storage.TopN(ctx, 2)
+		require.NoError(t, err)
+		require.Len(t, items, 2)
+		assert.Equal(t, "high", items[0].ShortURL)
+		assert.Equal(t, "low", items[1].ShortURL, "Counted accesses should be ranked")
+		assert.Equal(t, int64(12), items[1].AccessCount)
+
+		items, err = storage.TopN(ctx, 10)
+		require.NoError(t, err)
+		assert.Len(t, items, 3, "Expired URLs should be left out")
+
+		_, err = storage.TopN(ctx, 0)
+		assert.Equal(t, ErrInvalidPagination, err)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		storage, _ := newTestRedisStorage(t, 10)
+		base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		require.NoError(t, storage.ReplaceAll(ctx, []types.URLData{
+			{ShortURL: "c", OriginalURL: "https://c.com", CreatedAt: base.Add(2 * time.Second)},
+			{ShortURL: "a", OriginalURL: "https://a.com", CreatedAt: base},
+			{ShortURL: "b", OriginalURL: "https://b.com", CreatedAt: base.Add(time.Second)},
+		}))
+
+		page, total, err := storage.List(ctx, 1, 5)
+		require.NoError(t, err)
+		assert.Equal(t, 3, total)
+		require.Len(t, page, 2)
+		assert.Equal(t, "b", page[0].ShortURL)
+		assert.Equal(t, "c", page[1].ShortURL)
+
+		_, _, err = storage.List(ctx, 0, 0)
+		assert.Equal(t, ErrInvalidPagination, err)
+	})
+
+	t.Run("ForEach", func(t *testing.T) {
+		storage, _ := newTestRedisStorage(t, 10)
+		base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		require.NoError(t, storage.ReplaceAll(ctx, []types.URLData{
+			{ShortURL: "b", OriginalURL: "https://b.com", CreatedAt: base.Add(time.Second)},
+			{ShortURL: "a", OriginalURL: "https://a.com", CreatedAt: base},
+		}))
+
+		var visited []string
+		require.NoError(t, storage.ForEach(ctx, func(urlData types.URLData) error {
+			visited = append(visited, urlData.ShortURL)
+			return nil
+		}))
+		assert.ElementsMatch(t, []string{"a", "b"}, visited)
+
+		stop := errors.New("stop")
+		assert.Equal(t, stop, storage.ForEach(ctx, func(types.URLData) error { return stop }))
+	})
+
+	t.Run("ForEach reads one page at a time", func(t *testing.T) {
+		storage, _ := newTestRedisStorage(t, 100)
+		storage.pageSize = 4
+		var stored []string
+		for i := 0; i < 10; i++ {
+			shortURL := fmt.Sprintf("code%d", i)
+			require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: shortURL, OriginalURL: "https://" + shortURL + ".com"}))
+			stored = append(stored, shortURL)
+		}
+		hook := &pipelineSizeHook{}
+		storage.client.AddHook(hook)
+
+		var visited []string
+		require.NoError(t, storage.ForEach(ctx, func(urlData types.URLData) error {
+			visited = append(visited, urlData.ShortURL)
+			return nil
+		}))
+		assert.ElementsMatch(t, stored, visited)
+		assert.Equal(t, 4, hook.largest, "No more than a page of hashes should be fetched at once")
+	})
+
+	t.Run("Capacity limit", func(t *testing.T) {
+		storage, _ := newTestRedisStorage(t, 3)
+
+		for i := 0; i < 3; i++ {
+			err := storage.Create(ctx, types.URLData{ShortURL: fmt.Sprintf("test%d", i), OriginalURL: fmt.Sprintf("https://test%d.com", i)})
+			require.NoError(t, err)
+		}
+		err := storage.Create(ctx, types.URLData{ShortURL: "overflow", OriginalURL: "https://overflow.com"})
+		assert.Equal(t, ErrStorageCapacityReached, err)
+	})
+
+	t.Run("GetOrCreate", func(t *testing.T) {
+		storage, _ := newTestRedisStorage(t, 2)
+
+		created, isNew, err := storage.GetOrCreate(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com", Tags: []string{"a"}})
+		require.NoError(t, err)
+		assert.True(t, isNew)
+		stored, err := storage.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+		assert.Equal(t, stored, created)
+
+		require.NoError(t, storage.IncrementAccess(ctx, "abc123"))
+		existing, isNew, err := storage.GetOrCreate(ctx, types.URLData{ShortURL: "def456", OriginalURL: "https://example.com"})
+		require.NoError(t, err)
+		assert.False(t, isNew)
+		assert.Equal(t, "abc123", existing.ShortURL)
+		assert.Equal(t, int64(1), existing.AccessCount)
+		_, err = storage.GetURLData(ctx, "def456")
+		assert.Equal(t, ErrShortURLNotFound, err)
+
+		_, _, err = storage.GetOrCreate(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://other.com"})
+		assert.Equal(t, ErrShortURLExists, err)
+		_, _, err = storage.GetOrCreate(ctx, types.URLData{ShortURL: "ghi789", OriginalURL: "https://other.com"})
+		require.NoError(t, err)
+		_, _, err = storage.GetOrCreate(ctx, types.URLData{ShortURL: "full", OriginalURL: "https://full.com"})
+		assert.Equal(t, ErrStorageCapacityReached, err)
+	})
+
+	t.Run("GetOrCreate replaces expired and deleted records", func(t *testing.T) {
+		storage, _ := newTestRedisStorage(t, 10)
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "expired", OriginalURL: "https://example.com", ExpiresAt: time.Now().Add(-time.Second)}))
+
+		created, isNew, err := storage.GetOrCreate(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"})
+		require.NoError(t, err)
+		assert.True(t, isNew)
+		assert.Equal(t, "abc123", created.ShortURL)
+
+		_, err = storage.MarkDeleted(ctx, "abc123", time.Now())
+		require.NoError(t, err)
+		created, isNew, err = storage.GetOrCreate(ctx, types.URLData{ShortURL: "def456", OriginalURL: "https://example.com"})
+		require.NoError(t, err)
+		assert.True(t, isNew)
+		assert.Equal(t, "def456", created.ShortURL)
+
+		existing, isNew, err := storage.GetOrCreate(ctx, types.URLData{ShortURL: "ghi789", OriginalURL: "https://example.com"})
+		require.NoError(t, err)
+		assert.False(t, isNew, "The index should point at the replacement")
+		assert.Equal(t, "def456", existing.ShortURL)
+	})
+
+	t.Run("Update maintains the index", func(t *testing.T) {
+		storage, _ := newTestRedisStorage(t, 10)
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}))
+		before, err := storage.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+
+		time.Sleep(time.Millisecond)
+		updated, err := storage.Update(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://updated.com"})
+		require.NoError(t, err)
+
+		after, err := storage.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+		assert.Equal(t, after, updated, "Update should return the record as stored")
+		assert.Equal(t, "https://updated.com", after.OriginalURL)
+		assert.Equal(t, before.CreatedAt, after.CreatedAt)
+		assert.True(t, after.UpdatedAt.After(before.UpdatedAt))
+
+		_, err = storage.GetShortURL(ctx, "https://example.com")
+		assert.Equal(t, ErrShortURLNotFound, err)
+		shortURL, err := storage.GetShortURL(ctx, "https://updated.com")
+		require.NoError(t, err)
+		assert.Equal(t, "abc123", shortURL)
+
+		_, err = storage.Update(ctx, types.URLData{ShortURL: "nonexistent", OriginalURL: "https://new.com"})
+		assert.Equal(t, ErrShortURLNotFound, err)
+	})
+
+	t.Run("Update sets the expiration", func(t *testing.T) {
+		storage, _ := newTestRedisStorage(t, 10)
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}))
+
+		expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+		updated, err := storage.Update(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com", ExpiresAt: expiresAt})
+		require.NoError(t, err)
+		assert.True(t, expiresAt.Equal(updated.ExpiresAt))
+
+		updated, err = storage.Update(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"})
+		require.NoError(t, err)
+		assert.True(t, updated.ExpiresAt.IsZero(), "A zero expiration makes the URL permanent again")
+	})
+
+	t.Run("CompareAndUpdate", func(t *testing.T) {
+		storage, _ := newTestRedisStorage(t, 10)
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}))
+		read, err := storage.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+
+		updated, err := storage.CompareAndUpdate(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://first.com"}, read.UpdatedAt)
+		require.NoError(t, err)
+		assert.Equal(t, "https://first.com", updated.OriginalURL)
+
+		_, err = storage.CompareAndUpdate(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://second.com"}, read.UpdatedAt)
+		assert.Equal(t, ErrVersionMismatch, err, "An update of a version read before the first update is stale")
+		stored, err := storage.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+		assert.Equal(t, "https://first.com", stored.OriginalURL)
+
+		_, err = storage.CompareAndUpdate(ctx, types.URLData{ShortURL: "missing", OriginalURL: "https://first.com"}, read.UpdatedAt)
+		assert.Equal(t, ErrShortURLNotFound, err)
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		storage, server := newTestRedisStorage(t, 10)
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com", ExternalID: "order-1"}))
+		require.NoError(t, storage.IncrementAccess(ctx, "abc123"))
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "taken", OriginalURL: "https://other.com"}))
+		before, err := storage.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+
+		_, err = storage.Rename(ctx, "abc123", types.URLData{ShortURL: "docs", OriginalURL: "https://example.org"}, before.UpdatedAt.Add(-time.Second))
+		assert.Equal(t, ErrVersionMismatch, err)
+
+		renamed, err := storage.Rename(ctx, "abc123", types.URLData{ShortURL: "docs", OriginalURL: "https://example.org"}, before.UpdatedAt)
+		require.NoError(t, err)
+		assert.Equal(t, "docs", renamed.ShortURL)
+		assert.Equal(t, "https://example.org", renamed.OriginalURL, "The update should be stored along with the rename")
+		assert.Equal(t, before.CreatedAt, renamed.CreatedAt)
+		assert.Equal(t, int64(1), renamed.AccessCount, "The access count moves with the record")
+		stored, err := storage.GetURLData(ctx, "docs")
+		require.NoError(t, err)
+		assert.Equal(t, stored, renamed, "Rename should return the record as stored")
+
+		_, err = storage.GetURLData(ctx, "abc123")
+		assert.Equal(t, ErrShortURLNotFound, err)
+		_, err = storage.GetShortURL(ctx, "https://example.com")
+		assert.Equal(t, ErrShortURLNotFound, err, "The old destination should no longer be indexed")
+		shortURL, err := storage.GetShortURL(ctx, "https://example.org")
+		require.NoError(t, err)
+		assert.Equal(t, "docs", shortURL)
+		byExternal, err := storage.GetByExternalID(ctx, "order-1")
+		require.NoError(t, err)
+		assert.Equal(t, "docs", byExternal.ShortURL)
+		codes, err := server.SMembers(redisCodesKey)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"docs", "taken"}, codes)
+
+		_, err = storage.Rename(ctx, "docs", types.URLData{ShortURL: "taken", OriginalURL: "https://example.org"}, time.Time{})
+		assert.Equal(t, ErrShortURLExists, err)
+		_, err = storage.Rename(ctx, "missing", types.URLData{ShortURL: "free", OriginalURL: "https://example.org"}, time.Time{})
+		assert.Equal(t, ErrShortURLNotFound, err)
+	})
+
+	t.Run("Dedup key backs the index", func(t *testing.T) {
+		storage, server := newTestRedisStorage(t, 10)
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://Example.com", DedupKey: "https://example.com/"}))
+
+		shortURL, err := storage.GetShortURL(ctx, "https://example.com/")
+		require.NoError(t, err)
+		assert.Equal(t, "abc123", shortURL)
+		urlData, err := storage.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+		assert.Equal(t, "https://Example.com", urlData.OriginalURL)
+		assert.Equal(t, "https://example.com/", urlData.DedupKey)
+
+		_, err = storage.Update(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://other.com"})
+		require.NoError(t, err)
+		_, err = storage.GetShortURL(ctx, "https://example.com/")
+		assert.Equal(t, ErrShortURLNotFound, err)
+		require.NoError(t, storage.Delete(ctx, "abc123"))
+		assert.False(t, server.Exists(redisIndexKey), "Index should be empty after deleting the only entry")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		storage, server := newTestRedisStorage(t, 10)
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}))
+
+		err := storage.Delete(ctx, "abc123")
+		require.NoError(t, err)
+
+		_, err = storage.GetURLData(ctx, "abc123")
+		assert.Equal(t, ErrShortURLNotFound, err)
+		_, err = storage.GetShortURL(ctx, "https://example.com")
+		assert.Equal(t, ErrShortURLNotFound, err)
+		assert.False(t, server.Exists(redisCodesKey), "Codes set should be empty after deleting the only entry")
+
+		err = storage.Delete(ctx, "abc123")
+		assert.Equal(t, ErrShortURLNotFound, err)
+	})
+
+	t.Run("External IDs", func(t *testing.T) {
+		storage, server := newTestRedisStorage(t, 10)
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com", ExternalID: "order-1"}))
+
+		urlData, err := storage.GetByExternalID(ctx, "order-1")
+		require.NoError(t, err)
+		assert.Equal(t, "abc123", urlData.ShortURL)
+		assert.Equal(t, "order-1", urlData.ExternalID)
+
+		err = storage.Create(ctx, types.URLData{ShortURL: "def456", OriginalURL: "https://other.com", ExternalID: "order-1"})
+		assert.Equal(t, ErrExternalIDExists, err)
+		_, _, err = storage.GetOrCreate(ctx, types.URLData{ShortURL: "def456", OriginalURL: "https://other.com", ExternalID: "order-1"})
+		assert.Equal(t, ErrExternalIDExists, err)
+		assert.False(t, server.Exists(redisURLKey("def456")), "A rejected create should store nothing")
+
+		updated, err := storage.Update(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://new.com"})
+		require.NoError(t, err)
+		assert.Equal(t, "order-1", updated.ExternalID)
+
+		require.NoError(t, storage.Delete(ctx, "abc123"))
+		_, err = storage.GetByExternalID(ctx, "order-1")
+		assert.Equal(t, ErrShortURLNotFound, err)
+		assert.False(t, server.Exists(redisExternalKey), "External ID index should be empty after deleting the only entry")
+
+		err = storage.ReplaceAll(ctx, []types.URLData{
+			{ShortURL: "a", OriginalURL: "https://a.com", ExternalID: "order-2"},
+			{ShortURL: "b", OriginalURL: "https://b.com", ExternalID: "order-2"},
+		})
+		assert.Equal(t, ErrExternalIDExists, err)
+		require.NoError(t, storage.ReplaceAll(ctx, []types.URLData{{ShortURL: "a", OriginalURL: "https://a.com", ExternalID: "order-2"}}))
+		urlData, err = storage.GetByExternalID(ctx, "order-2")
+		require.NoError(t, err)
+		assert.Equal(t, "a", urlData.ShortURL)
+	})
+
+	t.Run("ReplaceAll", func(t *testing.T) {
+		storage, _ := newTestRedisStorage(t, 10)
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "old", OriginalURL: "https://old.com"}))
+
+		createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		items := []types.URLData{
+			{ShortURL: "new0", OriginalURL: "https://new0.com", CreatedAt: createdAt, UpdatedAt: createdAt},
+			{ShortURL: "new1", OriginalURL: "https://new1.com", CreatedAt: createdAt, UpdatedAt: createdAt, ExpiresAt: createdAt.Add(time.Hour)},
+			{ShortURL: "new2", OriginalURL: "https://new2.com", CreatedAt: createdAt, UpdatedAt: createdAt, DeletedAt: createdAt.Add(time.Minute)},
+		}
+		require.NoError(t, storage.ReplaceAll(ctx, items))
+
+		_, err := storage.GetURLData(ctx, "old")
+		assert.Equal(t, ErrShortURLNotFound, err)
+		_, err = storage.GetShortURL(ctx, "https://old.com")
+		assert.Equal(t, ErrShortURLNotFound, err)
+		for _, item := range items {
+			urlData, err := storage.GetURLData(ctx, item.ShortURL)
+			require.NoError(t, err)
+			assert.Equal(t, item, urlData)
+		}
+
+		err = storage.ReplaceAll(ctx, []types.URLData{{ShortURL: "dup"}, {ShortURL: "dup"}})
+		assert.Equal(t, ErrShortURLExists, err)
+		_, err = storage.GetURLData(ctx, "new0")
+		assert.NoError(t, err, "Failed replace should leave the dataset untouched")
+	})
+
+	t.Run("IncrementAccess", func(t *testing.T) {
+		storage, _ := newTestRedisStorage(t, 10)
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}))
+
+		require.NoError(t, storage.IncrementAccess(ctx, "abc123"))
+		require.NoError(t, storage.IncrementAccess(ctx, "abc123"))
+		_, err := storage.Update(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.org"})
+		require.NoError(t, err)
+
+		urlData, err := storage.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), urlData.AccessCount, "Update should keep the count")
+
+		assert.Equal(t, ErrShortURLNotFound, storage.IncrementAccess(ctx, "missing"))
+		_, err = storage.GetURLData(ctx, "missing")
+		assert.Equal(t, ErrShortURLNotFound, err, "Incrementing a missing URL should not create it")
+	})
+
+	t.Run("RecordCheck", func(t *testing.T) {
+		storage, _ := newTestRedisStorage(t, 10)
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}))
+		checkedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		require.NoError(t, storage.RecordCheck(ctx, "abc123", "https://example.com", checkedAt, 200))
+		require.NoError(t, storage.RecordCheck(ctx, "abc123", "https://stale.com", checkedAt, 500))
+		urlData, err := storage.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+		assert.Equal(t, checkedAt, urlData.LastCheckedAt)
+		assert.Equal(t, 200, urlData.LastStatus)
+
+		_, err = storage.Update(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.org"})
+		require.NoError(t, err)
+		urlData, err = storage.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+		assert.True(t, urlData.LastCheckedAt.IsZero(), "A new destination clears the previous check")
+		assert.Equal(t, 0, urlData.LastStatus)
+
+		assert.Equal(t, ErrShortURLNotFound, storage.RecordCheck(ctx, "missing", "https://example.com", checkedAt, 200))
+	})
+
+	t.Run("MarkDeleted", func(t *testing.T) {
+		storage, _ := newTestRedisStorage(t, 10)
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}))
+		deletedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		deleted, err := storage.MarkDeleted(ctx, "abc123", deletedAt)
+		require.NoError(t, err)
+		assert.Equal(t, deletedAt, deleted.DeletedAt)
+		assert.Equal(t, deleted.CreatedAt, deleted.UpdatedAt, "Marking a URL deleted should not update it")
+
+		_, err = storage.Update(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.org"})
+		require.NoError(t, err)
+		urlData, err := storage.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+		assert.Equal(t, deletedAt, urlData.DeletedAt, "Updates should keep the deletion mark")
+
+		restored, err := storage.MarkDeleted(ctx, "abc123", time.Time{})
+		require.NoError(t, err)
+		assert.False(t, restored.Deleted())
+		assert.Equal(t, "https://example.org", restored.OriginalURL)
+
+		_, err = storage.MarkDeleted(ctx, "missing", deletedAt)
+		assert.Equal(t, ErrShortURLNotFound, err)
+	})
+
+	t.Run("Context cancellation", func(t *testing.T) {
+		storage, _ := newTestRedisStorage(t, 10)
+		cancelCtx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		assert.Equal(t, context.Canceled, storage.Create(cancelCtx, types.URLData{ShortURL: "cancelled"}))
+		_, err := storage.GetURLData(cancelCtx, "cancelled")
+		assert.Equal(t, context.Canceled, err)
+		_, err = storage.GetShortURL(cancelCtx, "https://cancelled.com")
+		assert.Equal(t, context.Canceled, err)
+		_, err = storage.Update(cancelCtx, types.URLData{ShortURL: "cancelled"})
+		assert.Equal(t, context.Canceled, err)
+		assert.Equal(t, context.Canceled, storage.Delete(cancelCtx, "cancelled"))
+		assert.Equal(t, context.Canceled, storage.ReplaceAll(cancelCtx, nil))
+		assert.Equal(t, context.Canceled, storage.IncrementAccess(cancelCtx, "cancelled"))
+
+		_, err = storage.GetURLData(ctx, "cancelled")
+		assert.Equal(t, ErrShortURLNotFound, err, "ShortURL should not have been added to the storage")
+	})
+
+	t.Run("Server unavailable", func(t *testing.T) {
+		storage, server := newTestRedisStorage(t, 10)
+		server.Close()
+
+		err := storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"})
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrShortURLExists)
+	})
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go-url-shortening/types"
+	"go.uber.org/zap"
+)
+
+// ReplicatedStorage implements the Storage interface on top of a primary and a set of read
+// replicas. Writes go to the primary, while reads are spread round-robin across the replicas and
+// retried on the primary when a replica fails. A replica that has not caught up with a recent
+// write answers ErrShortURLNotFound, so misses are retried on the primary as well.
+type ReplicatedStorage struct {
+	primary  Storage       // Receives every write, and the reads replicas fail
+	replicas []Storage     // Serve reads in turn
+	next     atomic.Uint64 // Index of the replica serving the next read, modulo len(replicas)
+	logger   *zap.Logger   // Logger for replica failures
+}
+
+// NewReplicatedStorage returns a Storage writing to primary and reading from replicas.
+// Without replicas, every read goes to the primary.
+func NewReplicatedStorage(primary Storage, replicas []Storage, logger *zap.Logger) *ReplicatedStorage {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &ReplicatedStorage{primary: primary, replicas: replicas, logger: logger}
+}
+
+// Create adds a new short URL on the primary.
+func (s *ReplicatedStorage) Create(ctx context.Context, urlData types.URLData) error {
+	return s.primary.Create(ctx, urlData)
+}
+
+// GetOrCreate runs on the primary, which alone can make the lookup and the create atomic.
+func (s *ReplicatedStorage) GetOrCreate(ctx context.Context, urlData types.URLData) (types.URLData, bool, error) {
+	return s.primary.GetOrCreate(ctx, urlData)
+}
+
+// GetURLData reads the URLData of a short URL from the next replica.
+func (s *ReplicatedStorage) GetURLData(ctx context.Context, shortURL string) (types.URLData, error) {
+	var urlData types.URLData
+	err := s.read(ctx, "GetURLData", func(store Storage) (err error) {
+		urlData, err = store.GetURLData(ctx, shortURL)
+		return err
+	})
+	return urlData, err
+}
+
+// GetByExternalID reads the URLData stored with an external ID from the next replica.
+func (s *ReplicatedStorage) GetByExternalID(ctx context.Context, externalID string) (types.URLData, error) {
+	var urlData types.URLData
+	err := s.read(ctx, "GetByExternalID", func(store Storage) (err error) {
+		urlData, err = store.GetByExternalID(ctx, externalID)
+		return err
+	})
+	return urlData, err
+}
+
+// GetShortURL looks up a short URL by its lookup key on the next replica.
+func (s *ReplicatedStorage) GetShortURL(ctx context.Context, originalURL string) (string, error) {
+	var shortURL string
+	err := s.read(ctx, "GetShortURL", func(store Storage) (err error) {
+		shortURL, err = store.GetShortURL(ctx, originalURL)
+		return err
+	})
+	return shortURL, err
+}
+
+// Update modifies a short URL on the primary.
+func (s *ReplicatedStorage) Update(ctx context.Context, urlData types.URLData) (types.URLData, error) {
+	return s.primary.Update(ctx, urlData)
+}
+
+// CompareAndUpdate conditionally modifies the URLData for a given short URL on the primary.
+func (s *ReplicatedStorage) CompareAndUpdate(ctx context.Context, urlData types.URLData, expectedUpdatedAt time.Time) (types.URLData, error) {
+	return s.primary.CompareAndUpdate(ctx, urlData, expectedUpdatedAt)
+}
+
+// Delete removes a short URL on the primary.
+func (s *ReplicatedStorage) Delete(ctx context.Context, shortURL string) error {
+	return s.primary.Delete(ctx, shortURL)
+}
+
+// ReplaceAll replaces the dataset of the primary.
+func (s *ReplicatedStorage) ReplaceAll(ctx context.Context, items []types.URLData) error {
+	return s.primary.ReplaceAll(ctx, items)
+}
+
+// ListByTag lists the URLs carrying tag from the next replica.
+func (s *ReplicatedStorage) ListByTag(ctx context.Context, tag string) ([]types.URLData, error) {
+	var items []types.URLData
+	err := s.read(ctx, "ListByTag", func(store Storage) (err error) {
+		items, err = store.ListByTag(ctx, tag)
+		return err
+	})
+	return items, err
+}
+
+// List returns a page of URLs from the next replica.
+func (s *ReplicatedStorage) List(ctx context.Context, offset, limit int) ([]types.URLData, int, error) {
+	var items []types.URLData
+	var total int
+	err := s.read(ctx, "List", func(store Storage) (err error) {
+		items, total, err = store.List(ctx, offset, limit)
+		return err
+	})
+	return items, total, err
+}
+
+// ForEach calls fn with every URL of the next replica. Once fn has been called, a failing replica
+// is not retried on the primary, as fn would see the URLs it was already given a second time.
+func (s *ReplicatedStorage) ForEach(ctx context.Context, fn func(types.URLData) error) error {
+	started := false
+	var startedErr error
+	return s.read(ctx, "ForEach", func(store Storage) error {
+		if started {
+			return startedErr
+		}
+		startedErr = store.ForEach(ctx, func(urlData types.URLData) error {
+			started = true
+			return fn(urlData)
+		})
+		return startedErr
+	})
+}
+
+// TopN returns the most accessed URLs from the next replica.
+func (s *ReplicatedStorage) TopN(ctx context.Context, n int) ([]types.URLData, error) {
+	var items []types.URLData
+	err := s.read(ctx, "TopN", func(store Storage) (err error) {
+		items, err = store.TopN(ctx, n)
+		return err
+	})
+	return items, err
+}
+
+// Rename renames the record on the primary.
+func (s *ReplicatedStorage) Rename(ctx context.Context, shortURL string, urlData types.URLData, expectedUpdatedAt time.Time) (types.URLData, error) {
+	return s.primary.Rename(ctx, shortURL, urlData, expectedUpdatedAt)
+}
+
+// IncrementAccess counts an access on the primary.
+func (s *ReplicatedStorage) IncrementAccess(ctx context.Context, shortURL string) error {
+	return s.primary.IncrementAccess(ctx, shortURL)
+}
+
+// Ping checks that the primary is reachable, as the server cannot take writes without it.
+// Replicas that are down only cost a retry on the primary.
+func (s *ReplicatedStorage) Ping(ctx context.Context) error {
+	return s.primary.Ping(ctx)
+}
+
+// Usage forwards to the primary when it implements UsageReporter.
+func (s *ReplicatedStorage) Usage(ctx context.Context) (count, capacity int, err error) {
+	reporter, ok := s.primary.(UsageReporter)
+	if !ok {
+		return 0, 0, errUsageUnsupported
+	}
+	return reporter.Usage(ctx)
+}
+
+// read runs op against the next replica, and against the primary if there are no replicas or the
+// replica fails while ctx is still live.
+func (s *ReplicatedStorage) read(ctx context.Context, operation string, op func(store Storage) error) error {
+	if len(s.replicas) == 0 {
+		return op(s.primary)
+	}
+	index := (s.next.Add(1) - 1) % uint64(len(s.replicas))
+	err := op(s.replicas[index])
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+	s.logger.Debug("Replica read failed, falling back to the primary",
+		zap.String("operation", operation),
+		zap.Uint64("replica", index),
+		zap.Error(err))
+	return op(s.primary)
+}
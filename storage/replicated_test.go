@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go-url-shortening/storage/mocks"
+	"go-url-shortening/types"
+	"go.uber.org/zap"
+)
+
+func TestReplicatedStorage(t *testing.T) {
+	ctx := context.Background()
+	urlData := types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}
+
+	newReplicated := func(replicas int) (*ReplicatedStorage, *mocks.MockStorage, []*mocks.MockStorage) {
+		primary := new(mocks.MockStorage)
+		mockReplicas := make([]*mocks.MockStorage, replicas)
+		stores := make([]Storage, replicas)
+		for i := range mockReplicas {
+			mockReplicas[i] = new(mocks.MockStorage)
+			stores[i] = mockReplicas[i]
+		}
+		return NewReplicatedStorage(primary, stores, zap.NewNop()), primary, mockReplicas
+	}
+
+	t.Run("Writes go to the primary", func(t *testing.T) {
+		store, primary, replicas := newReplicated(2)
+		primary.On("Create", ctx, urlData).Return(nil).Once()
+		primary.On("GetOrCreate", ctx, urlData).Return(urlData, true, nil).Once()
+		primary.On("Update", ctx, urlData).Return(urlData, nil).Once()
+		primary.On("Delete", ctx, "abc123").Return(nil).Once()
+		primary.On("ReplaceAll", ctx, []types.URLData{urlData}).Return(nil).Once()
+		primary.On("IncrementAccess", ctx, "abc123").Return(nil).Once()
+
+		require.NoError(t, store.Create(ctx, urlData))
+		_, _, err := store.GetOrCreate(ctx, urlData)
+		require.NoError(t, err)
+		_, err = store.Update(ctx, urlData)
+		require.NoError(t, err)
+		require.NoError(t, store.Delete(ctx, "abc123"))
+		require.NoError(t, store.ReplaceAll(ctx, []types.URLData{urlData}))
+		require.NoError(t, store.IncrementAccess(ctx, "abc123"))
+
+		primary.AssertExpectations(t)
+		for _, replica := range replicas {
+			assert.Empty(t, replica.Calls, "Replicas should never be written to")
+		}
+	})
+
+	t.Run("Reads are distributed across replicas", func(t *testing.T) {
+		store, primary, replicas := newReplicated(2)
+		for _, replica := range replicas {
+			replica.On("GetURLData", ctx, "abc123").Return(urlData, nil)
+			replica.On("GetShortURL", ctx, "https://example.com").Return("abc123", nil)
+			replica.On("List", ctx, 0, 10).Return([]types.URLData{urlData}, 1, nil)
+			replica.On("ListByTag", ctx, "tag").Return([]types.URLData{urlData}, nil)
+		}
+
+		for i := 0; i < 4; i++ {
+			got, err := store.GetURLData(ctx, "abc123")
+			require.NoError(t, err)
+			assert.Equal(t, urlData, got)
+		}
+		shortURL, err := store.GetShortURL(ctx, "https://example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "abc123", shortURL)
+		_, err = store.GetShortURL(ctx, "https://example.com")
+		require.NoError(t, err)
+		items, total, err := store.List(ctx, 0, 10)
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+		assert.Len(t, items, 1)
+		_, err = store.ListByTag(ctx, "tag")
+		require.NoError(t, err)
+
+		replicas[0].AssertNumberOfCalls(t, "GetURLData", 2)
+		replicas[1].AssertNumberOfCalls(t, "GetURLData", 2)
+		replicas[0].AssertNumberOfCalls(t, "GetShortURL", 1)
+		replicas[1].AssertNumberOfCalls(t, "GetShortURL", 1)
+		assert.Len(t, replicas[0].Calls, 4)
+		assert.Len(t, replicas[1].Calls, 4)
+		assert.Empty(t, primary.Calls)
+	})
+
+	t.Run("Failed replica reads fall back to the primary", func(t *testing.T) {
+		store, primary, replicas := newReplicated(1)
+		replicas[0].On("GetURLData", ctx, "abc123").Return(types.URLData{}, errors.New("connection refused")).Once()
+		replicas[0].On("GetURLData", ctx, "new").Return(types.URLData{}, ErrShortURLNotFound).Once()
+		primary.On("GetURLData", ctx, "abc123").Return(urlData, nil).Once()
+		primary.On("GetURLData", ctx, "new").Return(types.URLData{ShortURL: "new"}, nil).Once()
+
+		got, err := store.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+		assert.Equal(t, urlData, got)
+		got, err = store.GetURLData(ctx, "new")
+		require.NoError(t, err, "A replica lagging behind a create should not hide it")
+		assert.Equal(t, "new", got.ShortURL)
+
+		primary.AssertExpectations(t)
+		replicas[0].AssertExpectations(t)
+	})
+
+	t.Run("ForEach falls back to the primary only before it has started", func(t *testing.T) {
+		store, primary, replicas := newReplicated(1)
+		failure := errors.New("connection refused")
+		replicas[0].On("ForEach", ctx, mock.Anything).Return(nil, failure).Once()
+		primary.On("ForEach", ctx, mock.Anything).Return([]types.URLData{urlData}, nil).Once()
+
+		var visited []string
+		require.NoError(t, store.ForEach(ctx, func(urlData types.URLData) error {
+			visited = append(visited, urlData.ShortURL)
+			return nil
+		}))
+		assert.Equal(t, []string{"abc123"}, visited)
+
+		replicas[0].On("ForEach", ctx, mock.Anything).Return([]types.URLData{urlData}, failure).Once()
+		visited = nil
+		err := store.ForEach(ctx, func(urlData types.URLData) error {
+			visited = append(visited, urlData.ShortURL)
+			return nil
+		})
+		assert.Equal(t, failure, err)
+		assert.Equal(t, []string{"abc123"}, visited, "URLs already visited should not be repeated")
+		primary.AssertExpectations(t)
+		replicas[0].AssertExpectations(t)
+	})
+
+	t.Run("No fallback once the context is done", func(t *testing.T) {
+		store, primary, replicas := newReplicated(1)
+		cancelCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		replicas[0].On("GetURLData", cancelCtx, "abc123").Return(types.URLData{}, context.Canceled).Once()
+
+		_, err := store.GetURLData(cancelCtx, "abc123")
+		assert.Equal(t, context.Canceled, err)
+		primary.AssertNotCalled(t, "GetURLData", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Without replicas the primary serves reads", func(t *testing.T) {
+		store, primary, _ := newReplicated(0)
+		primary.On("GetURLData", ctx, "abc123").Return(urlData, nil).Once()
+
+		_, err := store.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+		primary.AssertExpectations(t)
+	})
+
+	t.Run("Usage and Ping use the primary", func(t *testing.T) {
+		primary := NewInMemoryStorage(5, zap.NewNop())
+		require.NoError(t, primary.Create(ctx, urlData))
+		store := NewReplicatedStorage(primary, []Storage{NewInMemoryStorage(5, zap.NewNop())}, zap.NewNop())
+
+		count, capacity, err := store.Usage(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+		assert.Equal(t, 5, capacity)
+		assert.NoError(t, store.Ping(ctx))
+	})
+}
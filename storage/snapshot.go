@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"go-url-shortening/types"
+	"go.uber.org/zap"
+)
+
+// snapshotSchemaVersion is the schema version written to new snapshots. Bump it and append
+// a migration to snapshotMigrations whenever a change to types.URLData needs older snapshots upgraded.
+const snapshotSchemaVersion = 2
+
+// snapshotMigrations upgrade the URLs of a snapshot by one schema version:
+// snapshotMigrations[i] turns version i+1 into version i+2.
+var snapshotMigrations = []func(urls []types.URLData){
+	migrateSnapshotV1,
+}
+
+// ErrUnsupportedSnapshotVersion is returned when restoring a snapshot written with a schema
+// version newer than this build understands.
+var ErrUnsupportedSnapshotVersion = errors.New("unsupported snapshot schema version")
+
+// snapshotFile is the on-disk representation of an InMemoryStorage snapshot.
+// Snapshots written before versioning was introduced have no schema_version and are version 1.
+type snapshotFile struct {
+	SchemaVersion int             `json:"schema_version,omitempty"`
+	URLs          []types.URLData `json:"urls"`
+}
+
+// gzipMagic are the leading bytes of every gzip stream, used to tell compressed snapshots apart.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// WithSnapshotCompression makes SaveToFile gzip the snapshot it writes.
+// LoadFromFile reads both compressed and uncompressed snapshots regardless of this option.
+func WithSnapshotCompression(enabled bool) InMemoryOption {
+	return func(s *InMemoryStorage) {
+		s.compressSnapshots = enabled
+	}
+}
+
+// Snapshot writes every stored URLData to w as JSON.
+// The read locks of every shard are held while encoding so the snapshot is a consistent point-in-time view.
+func (s *InMemoryStorage) Snapshot(w io.Writer) error {
+	unlock := s.rlockAll()
+	defer unlock()
+
+	snapshot := snapshotFile{SchemaVersion: snapshotSchemaVersion, URLs: make([]types.URLData, 0, s.count.Load())}
+	for _, shard := range s.shards {
+		for _, urlData := range shard.urls {
+			snapshot.URLs = append(snapshot.URLs, s.export(urlData))
+		}
+	}
+	// Sort for a deterministic output, which keeps snapshots diffable
+	sort.Slice(snapshot.URLs, func(i, j int) bool {
+		return snapshot.URLs[i].ShortURL < snapshot.URLs[j].ShortURL
+	})
+
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		s.logger.Error("Failed to encode snapshot", zap.Error(err))
+		return err
+	}
+	s.logger.Info("Snapshot written", zap.Int("count", len(snapshot.URLs)))
+	return nil
+}
+
+// Restore replaces the stored dataset with the snapshot read from r.
+// Snapshots written with an older schema version are migrated to the current one first,
+// while newer versions are rejected with ErrUnsupportedSnapshotVersion.
+// CreatedAt, UpdatedAt and AccessCount are preserved as recorded in the snapshot.
+func (s *InMemoryStorage) Restore(r io.Reader) error {
+	var snapshot snapshotFile
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		s.logger.Error("Failed to decode snapshot", zap.Error(err))
+		return err
+	}
+	if err := migrateSnapshot(&snapshot); err != nil {
+		s.logger.Error("Failed to migrate snapshot", zap.Int("schemaVersion", snapshot.SchemaVersion), zap.Error(err))
+		return err
+	}
+	return s.ReplaceAll(context.Background(), snapshot.URLs)
+}
+
+// migrateSnapshot upgrades snapshot in place to snapshotSchemaVersion.
+func migrateSnapshot(snapshot *snapshotFile) error {
+	if snapshot.SchemaVersion == 0 {
+		snapshot.SchemaVersion = 1
+	}
+	if snapshot.SchemaVersion < 0 || snapshot.SchemaVersion > snapshotSchemaVersion {
+		return fmt.Errorf("%w: %d, this build reads up to version %d",
+			ErrUnsupportedSnapshotVersion, snapshot.SchemaVersion, snapshotSchemaVersion)
+	}
+	for ; snapshot.SchemaVersion < snapshotSchemaVersion; snapshot.SchemaVersion++ {
+		snapshotMigrations[snapshot.SchemaVersion-1](snapshot.URLs)
+	}
+	return nil
+}
+
+// migrateSnapshotV1 upgrades unversioned snapshots, which may lack UpdatedAt for URLs never updated.
+// It defaults to CreatedAt, while fields added later, such as expiry, tags and access counts, are
+// absent from them and keep their zero values: no expiry, no tags and no recorded clicks.
+func migrateSnapshotV1(urls []types.URLData) {
+	for i := range urls {
+		if urls[i].UpdatedAt.IsZero() {
+			urls[i].UpdatedAt = urls[i].CreatedAt
+		}
+	}
+}
+
+// SaveToFile writes a snapshot to path. The snapshot is first written to a temporary
+// file in the same directory and then renamed, so a crash never leaves a truncated snapshot.
+func (s *InMemoryStorage) SaveToFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once the file has been renamed
+
+	if err := s.writeSnapshotFile(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeSnapshotFile writes the snapshot to f, gzipped when compression is enabled.
+func (s *InMemoryStorage) writeSnapshotFile(f *os.File) error {
+	if !s.compressSnapshots {
+		return s.Snapshot(f)
+	}
+	zw := gzip.NewWriter(f)
+	if err := s.Snapshot(zw); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// LoadFromFile restores the dataset from the snapshot at path, decompressing it first when it
+// starts with the gzip magic bytes. A missing file is not an error, so the first start with a
+// new path begins empty.
+func (s *InMemoryStorage) LoadFromFile(path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		s.logger.Info("No snapshot found, starting empty", zap.String("path", path))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	magic, err := r.Peek(len(gzipMagic))
+	if err != nil || !bytes.Equal(magic, gzipMagic) {
+		// Too short to be gzip or not gzip at all: let Restore decode (or reject) it as is
+		return s.Restore(r)
+	}
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		s.logger.Error("Failed to open compressed snapshot", zap.String("path", path), zap.Error(err))
+		return err
+	}
+	defer zr.Close()
+	return s.Restore(zr)
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go-url-shortening/types"
+	"go.uber.org/zap"
+)
+
+func TestInMemoryStorageSnapshot(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+
+	newPopulatedStorage := func(t *testing.T) *InMemoryStorage {
+		storage := NewInMemoryStorage(10, logger)
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "abc123", OriginalURL: "https://example.com"}))
+		require.NoError(t, storage.Create(ctx, types.URLData{ShortURL: "def456", OriginalURL: "https://example.org"}))
+		_, err := storage.Update(ctx, types.URLData{ShortURL: "def456", OriginalURL: "https://example.org/updated"})
+		require.NoError(t, err)
+		return storage
+	}
+
+	t.Run("Round trip preserves data and timestamps", func(t *testing.T) {
+		source := newPopulatedStorage(t)
+
+		var buf bytes.Buffer
+		require.NoError(t, source.Snapshot(&buf))
+
+		target := NewInMemoryStorage(10, logger)
+		require.NoError(t, target.Create(ctx, types.URLData{ShortURL: "stale", OriginalURL: "https://stale.com"}))
+		require.NoError(t, target.Restore(&buf))
+
+		assert.Equal(t, shardedURLs(source), shardedURLs(target))
+		assert.Equal(t, source.count.Load(), target.count.Load())
+	})
+
+	t.Run("Restore rejects malformed input", func(t *testing.T) {
+		target := NewInMemoryStorage(10, logger)
+		require.NoError(t, target.Create(ctx, types.URLData{ShortURL: "keep", OriginalURL: "https://keep.com"}))
+
+		err := target.Restore(bytes.NewBufferString("not json"))
+		assert.Error(t, err)
+		_, err = target.GetURLData(ctx, "keep")
+		assert.NoError(t, err, "Existing data should survive a failed restore")
+	})
+
+	t.Run("SaveToFile and LoadFromFile", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "snapshot.json")
+		source := newPopulatedStorage(t)
+		require.NoError(t, source.SaveToFile(path))
+
+		entries, err := os.ReadDir(filepath.Dir(path))
+		require.NoError(t, err)
+		assert.Len(t, entries, 1, "Temporary files should be cleaned up")
+
+		target := NewInMemoryStorage(10, logger)
+		require.NoError(t, target.LoadFromFile(path))
+		assert.Equal(t, shardedURLs(source), shardedURLs(target))
+	})
+
+	t.Run("LoadFromFile with missing file starts empty", func(t *testing.T) {
+		target := NewInMemoryStorage(10, logger)
+		err := target.LoadFromFile(filepath.Join(t.TempDir(), "missing.json"))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), target.count.Load())
+	})
+
+	t.Run("Compressed snapshot round trip", func(t *testing.T) {
+		dir := t.TempDir()
+		source := NewInMemoryStorage(1000, logger, WithSnapshotCompression(true))
+		for i := 0; i < 200; i++ {
+			require.NoError(t, source.Create(ctx, types.URLData{
+				ShortURL:    fmt.Sprintf("code%03d", i),
+				OriginalURL: fmt.Sprintf("https://example.com/articles/%d", i),
+			}))
+		}
+		require.NoError(t, source.IncrementAccess(ctx, "code007"))
+
+		compressedPath := filepath.Join(dir, "compressed.json.gz")
+		require.NoError(t, source.SaveToFile(compressedPath))
+		source.compressSnapshots = false
+		plainPath := filepath.Join(dir, "plain.json")
+		require.NoError(t, source.SaveToFile(plainPath))
+
+		compressed, err := os.ReadFile(compressedPath)
+		require.NoError(t, err)
+		plain, err := os.ReadFile(plainPath)
+		require.NoError(t, err)
+		assert.Equal(t, gzipMagic, compressed[:2])
+		assert.Less(t, len(compressed), len(plain), "Compressed snapshot should be smaller")
+
+		for _, path := range []string{compressedPath, plainPath} {
+			target := NewInMemoryStorage(1000, logger, WithSnapshotCompression(true))
+			require.NoError(t, target.LoadFromFile(path))
+			assert.Equal(t, shardedURLs(source), shardedURLs(target))
+			assert.Equal(t, source.count.Load(), target.count.Load())
+			urlData, err := target.GetURLData(ctx, "code007")
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), urlData.AccessCount)
+		}
+	})
+
+	t.Run("LoadFromFile rejects a truncated compressed snapshot", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "truncated.json.gz")
+		require.NoError(t, os.WriteFile(path, gzipMagic, 0o600))
+		target := NewInMemoryStorage(10, logger)
+		assert.Error(t, target.LoadFromFile(path))
+	})
+
+	t.Run("Snapshot records the schema version", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, newPopulatedStorage(t).Snapshot(&buf))
+
+		var snapshot snapshotFile
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &snapshot))
+		assert.Equal(t, snapshotSchemaVersion, snapshot.SchemaVersion)
+	})
+
+	t.Run("Restore migrates an unversioned v1 snapshot", func(t *testing.T) {
+		v1 := `{"urls":[{"ShortURL":"abc123","OriginalURL":"https://example.com","CreatedAt":"2024-01-02T03:04:05Z"}]}`
+		target := NewInMemoryStorage(10, logger)
+		require.NoError(t, target.Restore(bytes.NewBufferString(v1)))
+
+		urlData, err := target.GetURLData(ctx, "abc123")
+		require.NoError(t, err)
+		createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		assert.Equal(t, "https://example.com", urlData.OriginalURL)
+		assert.True(t, createdAt.Equal(urlData.CreatedAt))
+		assert.True(t, createdAt.Equal(urlData.UpdatedAt), "UpdatedAt should default to CreatedAt")
+		assert.True(t, urlData.ExpiresAt.IsZero())
+		assert.Empty(t, urlData.Tags)
+		assert.Equal(t, int64(0), urlData.AccessCount)
+
+		shortURL, err := target.GetShortURL(ctx, "https://example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "abc123", shortURL)
+	})
+
+	t.Run("Restore rejects a snapshot from a newer version", func(t *testing.T) {
+		target := NewInMemoryStorage(10, logger)
+		require.NoError(t, target.Create(ctx, types.URLData{ShortURL: "keep", OriginalURL: "https://keep.com"}))
+
+		future := fmt.Sprintf(`{"schema_version":%d,"urls":[]}`, snapshotSchemaVersion+1)
+		err := target.Restore(bytes.NewBufferString(future))
+		assert.ErrorIs(t, err, ErrUnsupportedSnapshotVersion)
+		_, err = target.GetURLData(ctx, "keep")
+		assert.NoError(t, err, "Existing data should survive a rejected snapshot")
+	})
+}
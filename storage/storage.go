@@ -2,9 +2,12 @@
 package storage
 
 import (
+	"container/heap"
 	"context"
 	"errors"
 	"go-url-shortening/types"
+	"sort"
+	"time"
 )
 
 // Common errors returned by storage operations.
@@ -12,13 +15,182 @@ var (
 	ErrShortURLExists         = errors.New("short URL already exists")
 	ErrShortURLNotFound       = errors.New("short URL not found")
 	ErrStorageCapacityReached = errors.New("storage capacity reached")
+	ErrInvalidPagination      = errors.New("invalid pagination parameters")
+	ErrExternalIDExists       = errors.New("external ID already exists")
+	ErrVersionMismatch        = errors.New("short URL was modified since the expected version")
 )
 
 // Storage interface defines the methods for URL storage operations.
 type Storage interface {
 	Create(ctx context.Context, urlData types.URLData) error
+	// GetOrCreate returns the record indexed under urlData.LookupKey() and false if there is one that
+	// is neither expired nor soft-deleted, or creates urlData as Create does, indexes it under the
+	// lookup key in place of any expired or deleted record, and returns it as stored and true. The
+	// lookup and the create are atomic, so concurrent calls for one lookup key create at most one record.
+	GetOrCreate(ctx context.Context, urlData types.URLData) (types.URLData, bool, error)
 	GetURLData(ctx context.Context, shortURL string) (types.URLData, error)
+	// GetByExternalID returns the URLData stored with the given non-empty external ID. Create and
+	// GetOrCreate fail with ErrExternalIDExists when another short URL already has urlData.ExternalID.
+	GetByExternalID(ctx context.Context, externalID string) (types.URLData, error)
+	// GetShortURL looks up a short URL by the key returned from types.URLData.LookupKey,
+	// which is the original URL unless a separate deduplication key was stored.
 	GetShortURL(ctx context.Context, originalURL string) (string, error)
-	Update(ctx context.Context, urlData types.URLData) error
+	// Update replaces the stored URLData of urlData.ShortURL, keeping its creation time, access
+	// count and external ID, and returns the record as stored. The write and the returned record are atomic, so a
+	// concurrent update can never be returned in place of this one.
+	Update(ctx context.Context, urlData types.URLData) (types.URLData, error)
+	// CompareAndUpdate is Update, provided the stored record's UpdatedAt is still expectedUpdatedAt,
+	// and fails with ErrVersionMismatch otherwise. The comparison and the write are atomic. A zero
+	// expectedUpdatedAt matches any version.
+	CompareAndUpdate(ctx context.Context, urlData types.URLData, expectedUpdatedAt time.Time) (types.URLData, error)
+	// Rename moves the record of shortURL to urlData.ShortURL and updates it with urlData as
+	// CompareAndUpdate does, in one atomic write, returning the record as stored. It fails with
+	// ErrShortURLExists if the new short URL is already taken, and with ErrVersionMismatch unless the
+	// stored record's UpdatedAt is still expectedUpdatedAt. A zero expectedUpdatedAt matches any version.
+	Rename(ctx context.Context, shortURL string, urlData types.URLData, expectedUpdatedAt time.Time) (types.URLData, error)
 	Delete(ctx context.Context, shortURL string) error
+	// ReplaceAll atomically swaps the entire dataset for the given items, leaving it untouched on
+	// error. It backs snapshot restores and the replace mode of the CSV import.
+	ReplaceAll(ctx context.Context, items []types.URLData) error
+	ListByTag(ctx context.Context, tag string) ([]types.URLData, error)
+	// List returns the page of URLs starting at offset, ordered by creation time, along with
+	// the total number of stored URLs. Offset must be non-negative and limit positive.
+	List(ctx context.Context, offset, limit int) ([]types.URLData, int, error)
+	// ForEach calls fn with every stored URL, in an order of the backend's choosing, and stops at the
+	// first error fn returns, returning it. The URLs are read a page at a time, so the dataset is never
+	// held in memory as a whole, and fn is called without any storage lock held, so it may block, e.g.
+	// on a slow client, without holding up writes. URLs written during the walk may or may not be seen.
+	ForEach(ctx context.Context, fn func(types.URLData) error) error
+	// TopN returns the n URLs with the highest access count, most accessed first, breaking ties by
+	// creation time and then short URL. Expired and soft-deleted URLs are left out. N must be positive.
+	TopN(ctx context.Context, n int) ([]types.URLData, error)
+	// IncrementAccess adds one to the access count of a short URL without rewriting its URLData.
+	IncrementAccess(ctx context.Context, shortURL string) error
+	// Ping checks that the storage is usable, e.g. that the server of an external backend is
+	// reachable. Backends without an external dependency always succeed.
+	Ping(ctx context.Context) error
+}
+
+// UsageReporter is implemented by storage backends that enforce a capacity
+// and can report how much of it is in use.
+type UsageReporter interface {
+	Usage(ctx context.Context) (count, capacity int, err error)
+}
+
+// CheckRecorder is implemented by storage backends that can record the reachability of destinations.
+type CheckRecorder interface {
+	// RecordCheck stores the result of checking originalURL, the destination of shortURL, at checkedAt.
+	// It is a no-op if shortURL has since been updated to another destination. Updating a short URL
+	// to a new destination clears its previous check result.
+	RecordCheck(ctx context.Context, shortURL, originalURL string, checkedAt time.Time, status int) error
+}
+
+// SoftDeleter is implemented by storage backends that can mark short URLs as deleted while keeping
+// them, so that they can be restored.
+type SoftDeleter interface {
+	// MarkDeleted sets the DeletedAt of shortURL to deletedAt, or clears it when deletedAt is zero,
+	// and returns the URLData as stored. UpdatedAt is left unchanged.
+	MarkDeleted(ctx context.Context, shortURL string, deletedAt time.Time) (types.URLData, error)
+}
+
+// sortByCreation orders items oldest first, breaking ties by short URL, so that
+// backends without a natural order return listings deterministically.
+func sortByCreation(items []types.URLData) {
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].CreatedAt.Equal(items[j].CreatedAt) {
+			return items[i].CreatedAt.Before(items[j].CreatedAt)
+		}
+		return items[i].ShortURL < items[j].ShortURL
+	})
+}
+
+// rankedAbove reports whether a comes before b in the order of TopN.
+func rankedAbove(a, b types.URLData) bool {
+	if a.AccessCount != b.AccessCount {
+		return a.AccessCount > b.AccessCount
+	}
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ShortURL < b.ShortURL
+}
+
+// accessRanking keeps the n highest ranked of the URLs added to it in a min-heap, so that ranking
+// m URLs takes O(m log n) instead of sorting all of them.
+type accessRanking struct {
+	n     int
+	items []types.URLData // Heap ordered with the lowest ranked URL first
+}
+
+// newAccessRanking returns an empty ranking of the top n URLs.
+func newAccessRanking(n int) *accessRanking {
+	return &accessRanking{n: n}
+}
+
+func (r *accessRanking) Len() int           { return len(r.items) }
+func (r *accessRanking) Less(i, j int) bool { return rankedAbove(r.items[j], r.items[i]) }
+func (r *accessRanking) Swap(i, j int)      { r.items[i], r.items[j] = r.items[j], r.items[i] }
+func (r *accessRanking) Push(x any)         { r.items = append(r.items, x.(types.URLData)) }
+func (r *accessRanking) Pop() any {
+	last := r.items[len(r.items)-1]
+	r.items = r.items[:len(r.items)-1]
+	return last
+}
+
+// add ranks urlData, dropping the lowest ranked URL once there are more than n.
+func (r *accessRanking) add(urlData types.URLData) {
+	if len(r.items) < r.n {
+		heap.Push(r, urlData)
+		return
+	}
+	if r.n > 0 && rankedAbove(urlData, r.items[0]) {
+		r.items[0] = urlData
+		heap.Fix(r, 0)
+	}
+}
+
+// sorted returns the ranked URLs, highest ranked first.
+func (r *accessRanking) sorted() []types.URLData {
+	items := append([]types.URLData{}, r.items...)
+	sort.Slice(items, func(i, j int) bool { return rankedAbove(items[i], items[j]) })
+	return items
+}
+
+// hasTag reports whether tag is one of the URL's tags.
+func hasTag(urlData types.URLData, tag string) bool {
+	for _, t := range urlData.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneURLData returns a copy of urlData that shares no memory with it, so callers
+// can't mutate a backend's internal state through returned values.
+func cloneURLData(urlData types.URLData) types.URLData {
+	if urlData.Tags != nil {
+		urlData.Tags = append([]string(nil), urlData.Tags...)
+	}
+	return urlData
+}
+
+// validatePagination checks the offset and limit passed to List.
+func validatePagination(offset, limit int) error {
+	if offset < 0 || limit <= 0 {
+		return ErrInvalidPagination
+	}
+	return nil
+}
+
+// paginate returns the page of items starting at offset, which may be past the end.
+func paginate(items []types.URLData, offset, limit int) []types.URLData {
+	if offset >= len(items) {
+		return []types.URLData{}
+	}
+	end := offset + limit
+	if end > len(items) || end < offset { // end < offset guards against overflow
+		end = len(items)
+	}
+	return items[offset:end]
 }
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-url-shortening/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the spans created by this package.
+const tracerName = "go-url-shortening/storage"
+
+// errUsageUnsupported is returned by a traced storage whose backend doesn't report usage.
+var errUsageUnsupported = errors.New("storage backend does not report usage")
+
+// errSoftDeleteUnsupported is returned by a traced storage whose backend can't soft-delete.
+var errSoftDeleteUnsupported = errors.New("storage backend does not support soft deletes")
+
+// tracedStorage wraps a Storage, recording a span around each call.
+type tracedStorage struct {
+	next   Storage
+	tracer trace.Tracer
+}
+
+// NewTracedStorage returns a Storage that records a span for every call to next
+// using the global tracer provider. Usage and MarkDeleted are forwarded when next implements them.
+func NewTracedStorage(next Storage) Storage {
+	return &tracedStorage{next: next, tracer: otel.Tracer(tracerName)}
+}
+
+func (s *tracedStorage) Create(ctx context.Context, urlData types.URLData) error {
+	ctx, span := s.tracer.Start(ctx, "Storage.Create", trace.WithAttributes(attribute.String("short_url", urlData.ShortURL)))
+	defer span.End()
+	err := s.next.Create(ctx, urlData)
+	recordError(span, err)
+	return err
+}
+
+func (s *tracedStorage) GetOrCreate(ctx context.Context, urlData types.URLData) (types.URLData, bool, error) {
+	ctx, span := s.tracer.Start(ctx, "Storage.GetOrCreate", trace.WithAttributes(attribute.String("short_url", urlData.ShortURL)))
+	defer span.End()
+	result, created, err := s.next.GetOrCreate(ctx, urlData)
+	recordError(span, err)
+	return result, created, err
+}
+
+func (s *tracedStorage) GetURLData(ctx context.Context, shortURL string) (types.URLData, error) {
+	ctx, span := s.tracer.Start(ctx, "Storage.GetURLData", trace.WithAttributes(attribute.String("short_url", shortURL)))
+	defer span.End()
+	urlData, err := s.next.GetURLData(ctx, shortURL)
+	recordError(span, err)
+	return urlData, err
+}
+
+func (s *tracedStorage) GetByExternalID(ctx context.Context, externalID string) (types.URLData, error) {
+	ctx, span := s.tracer.Start(ctx, "Storage.GetByExternalID")
+	defer span.End()
+	urlData, err := s.next.GetByExternalID(ctx, externalID)
+	recordError(span, err)
+	return urlData, err
+}
+
+func (s *tracedStorage) GetShortURL(ctx context.Context, originalURL string) (string, error) {
+	ctx, span := s.tracer.Start(ctx, "Storage.GetShortURL")
+	defer span.End()
+	shortURL, err := s.next.GetShortURL(ctx, originalURL)
+	recordError(span, err)
+	return shortURL, err
+}
+
+func (s *tracedStorage) Update(ctx context.Context, urlData types.URLData) (types.URLData, error) {
+	ctx, span := s.tracer.Start(ctx, "Storage.Update", trace.WithAttributes(attribute.String("short_url", urlData.ShortURL)))
+	defer span.End()
+	updated, err := s.next.Update(ctx, urlData)
+	recordError(span, err)
+	return updated, err
+}
+
+func (s *tracedStorage) CompareAndUpdate(ctx context.Context, urlData types.URLData, expectedUpdatedAt time.Time) (types.URLData, error) {
+	ctx, span := s.tracer.Start(ctx, "Storage.CompareAndUpdate", trace.WithAttributes(attribute.String("short_url", urlData.ShortURL)))
+	defer span.End()
+	updated, err := s.next.CompareAndUpdate(ctx, urlData, expectedUpdatedAt)
+	recordError(span, err)
+	return updated, err
+}
+
+func (s *tracedStorage) Delete(ctx context.Context, shortURL string) error {
+	ctx, span := s.tracer.Start(ctx, "Storage.Delete", trace.WithAttributes(attribute.String("short_url", shortURL)))
+	defer span.End()
+	err := s.next.Delete(ctx, shortURL)
+	recordError(span, err)
+	return err
+}
+
+// MarkDeleted forwards to the wrapped backend when it implements SoftDeleter.
+func (s *tracedStorage) MarkDeleted(ctx context.Context, shortURL string, deletedAt time.Time) (types.URLData, error) {
+	deleter, ok := s.next.(SoftDeleter)
+	if !ok {
+		return types.URLData{}, errSoftDeleteUnsupported
+	}
+	ctx, span := s.tracer.Start(ctx, "Storage.MarkDeleted", trace.WithAttributes(attribute.String("short_url", shortURL)))
+	defer span.End()
+	urlData, err := deleter.MarkDeleted(ctx, shortURL, deletedAt)
+	recordError(span, err)
+	return urlData, err
+}
+
+func (s *tracedStorage) ReplaceAll(ctx context.Context, items []types.URLData) error {
+	ctx, span := s.tracer.Start(ctx, "Storage.ReplaceAll", trace.WithAttributes(attribute.Int("items", len(items))))
+	defer span.End()
+	err := s.next.ReplaceAll(ctx, items)
+	recordError(span, err)
+	return err
+}
+
+func (s *tracedStorage) ListByTag(ctx context.Context, tag string) ([]types.URLData, error) {
+	ctx, span := s.tracer.Start(ctx, "Storage.ListByTag", trace.WithAttributes(attribute.String("tag", tag)))
+	defer span.End()
+	items, err := s.next.ListByTag(ctx, tag)
+	recordError(span, err)
+	return items, err
+}
+
+func (s *tracedStorage) List(ctx context.Context, offset, limit int) ([]types.URLData, int, error) {
+	ctx, span := s.tracer.Start(ctx, "Storage.List", trace.WithAttributes(attribute.Int("offset", offset), attribute.Int("limit", limit)))
+	defer span.End()
+	items, total, err := s.next.List(ctx, offset, limit)
+	recordError(span, err)
+	return items, total, err
+}
+
+func (s *tracedStorage) ForEach(ctx context.Context, fn func(types.URLData) error) error {
+	ctx, span := s.tracer.Start(ctx, "Storage.ForEach")
+	defer span.End()
+	err := s.next.ForEach(ctx, fn)
+	recordError(span, err)
+	return err
+}
+
+func (s *tracedStorage) TopN(ctx context.Context, n int) ([]types.URLData, error) {
+	ctx, span := s.tracer.Start(ctx, "Storage.TopN", trace.WithAttributes(attribute.Int("n", n)))
+	defer span.End()
+	items, err := s.next.TopN(ctx, n)
+	recordError(span, err)
+	return items, err
+}
+
+func (s *tracedStorage) IncrementAccess(ctx context.Context, shortURL string) error {
+	ctx, span := s.tracer.Start(ctx, "Storage.IncrementAccess", trace.WithAttributes(attribute.String("short_url", shortURL)))
+	defer span.End()
+	err := s.next.IncrementAccess(ctx, shortURL)
+	recordError(span, err)
+	return err
+}
+
+func (s *tracedStorage) Rename(ctx context.Context, shortURL string, urlData types.URLData, expectedUpdatedAt time.Time) (types.URLData, error) {
+	ctx, span := s.tracer.Start(ctx, "Storage.Rename", trace.WithAttributes(
+		attribute.String("short_url", shortURL), attribute.String("new_short_url", urlData.ShortURL)))
+	defer span.End()
+	renamed, err := s.next.Rename(ctx, shortURL, urlData, expectedUpdatedAt)
+	recordError(span, err)
+	return renamed, err
+}
+
+func (s *tracedStorage) Ping(ctx context.Context) error {
+	ctx, span := s.tracer.Start(ctx, "Storage.Ping")
+	defer span.End()
+	err := s.next.Ping(ctx)
+	recordError(span, err)
+	return err
+}
+
+// Usage forwards to the wrapped backend when it implements UsageReporter.
+func (s *tracedStorage) Usage(ctx context.Context) (count, capacity int, err error) {
+	reporter, ok := s.next.(UsageReporter)
+	if !ok {
+		return 0, 0, errUsageUnsupported
+	}
+	return reporter.Usage(ctx)
+}
+
+// recordError marks span as failed when err is non-nil.
+func recordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
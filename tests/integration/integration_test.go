@@ -63,6 +63,8 @@ func sendRequest(t *testing.T, server *httptest.Server, method, path string, bod
 
 func setupTestEnvironment(t *testing.T, storageCapacity ...int) (*httptest.Server, func(), *zap.Logger, *gin.Engine, *config.Config) {
 	cfg := config.DefaultConfig()
+	// Requests carry the client IP in X-Forwarded-For, as if through a proxy on the loopback interface
+	cfg.TrustedProxies = []string{"127.0.0.1", "::1"}
 	capacity := 1000000
 	if len(storageCapacity) > 0 {
 		capacity = storageCapacity[0]
@@ -78,8 +80,9 @@ func setupTestEnvironment(t *testing.T, storageCapacity ...int) (*httptest.Serve
 
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	router.Use(handlers.CORSMiddleware())
-	handlers.RegisterRoutes(router, urlHandler, cfg)
+	require.NoError(t, router.SetTrustedProxies(cfg.TrustedProxies))
+	router.Use(handlers.CORSMiddleware(cfg))
+	handlers.RegisterRoutes(router, urlHandler, cfg, logger)
 
 	server := httptest.NewServer(router)
 
@@ -197,7 +200,7 @@ func TestIntegration(t *testing.T) {
 
 		assert.Equal(t, http.StatusOK, resp.StatusCode)
 		assert.Equal(t, "*", resp.Header.Get("Access-Control-Allow-Origin"))
-		assert.Equal(t, "POST, GET, OPTIONS, PUT, DELETE", resp.Header.Get("Access-Control-Allow-Methods"))
+		assert.Equal(t, "POST, GET, OPTIONS, PUT, PATCH, DELETE", resp.Header.Get("Access-Control-Allow-Methods"))
 		assert.Equal(t, "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization", resp.Header.Get("Access-Control-Allow-Headers"))
 	})
 
@@ -287,8 +290,8 @@ func TestIntegration(t *testing.T) {
 		assert.NoError(t, err)
 
 		testRouter := gin.New()
-		testRouter.Use(handlers.CORSMiddleware())
-		handlers.RegisterRoutes(testRouter, testHandler, cfg)
+		testRouter.Use(handlers.CORSMiddleware(cfg))
+		handlers.RegisterRoutes(testRouter, testHandler, cfg, testLogger)
 
 		testServer := httptest.NewServer(testRouter)
 		defer testServer.Close()
@@ -384,11 +387,15 @@ func TestIntegration(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		resp, err = http.DefaultClient.Do(req)
 		assert.NoError(t, err)
-		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
 		var secondResp types.URLResponse
 		json.NewDecoder(resp.Body).Decode(&secondResp)
 
 		assert.Equal(t, firstResp.ShortURL, secondResp.ShortURL)
+		require.NotNil(t, firstResp.Created)
+		require.NotNil(t, secondResp.Created)
+		assert.True(t, *firstResp.Created)
+		assert.False(t, *secondResp.Created)
 	})
 
 	t.Run("Update Non-existent Short URL", func(t *testing.T) {
@@ -472,8 +479,8 @@ func TestIntegration(t *testing.T) {
 		assert.NoError(t, err)
 
 		testRouter := gin.New()
-		testRouter.Use(handlers.CORSMiddleware())
-		handlers.RegisterRoutes(testRouter, testHandler, cfg)
+		testRouter.Use(handlers.CORSMiddleware(cfg))
+		handlers.RegisterRoutes(testRouter, testHandler, cfg, testLogger)
 
 		testServer := httptest.NewServer(testRouter)
 		defer testServer.Close()
@@ -498,7 +505,7 @@ func TestIntegration(t *testing.T) {
 		}
 		resp, err = client.Do(req)
 		assert.NoError(t, err)
-		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+		assert.Equal(t, http.StatusFound, resp.StatusCode)
 		assert.Equal(t, "https://example.com/redirect", resp.Header.Get("Location"))
 
 		// Test redirection for non-existent short URL
@@ -3,23 +3,222 @@ package types
 
 import "time"
 
+// BatchDeleteRequest represents the request structure for deleting several short URLs at once.
+type BatchDeleteRequest struct {
+	ShortURLs []string `json:"short_urls"`
+}
+
+// BatchDeleteResult represents the outcome of deleting one short URL of a batch. Status is the HTTP
+// status the short URL would have received from a single delete, and Error is set whenever it isn't 204.
+type BatchDeleteResult struct {
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BatchDeleteResponse represents the response structure for a batch delete, with one result per
+// requested short URL, keyed by it.
+type BatchDeleteResponse struct {
+	Results map[string]BatchDeleteResult `json:"results"`
+}
+
+// BatchGetRequest represents the request structure for looking up several short URLs at once.
+type BatchGetRequest struct {
+	ShortURLs []string `json:"short_urls"`
+}
+
+// BatchGetResponse represents the response structure for a batch lookup. URLs holds the data of
+// the short URLs found, and Errors the error message of the others, both keyed by short URL.
+type BatchGetResponse struct {
+	URLs   map[string]URLResponse `json:"urls"`
+	Errors map[string]string      `json:"errors"`
+}
+
+// ImportSummary represents the response structure for a CSV import.
+type ImportSummary struct {
+	Imported int           `json:"imported"`
+	Skipped  int           `json:"skipped"` // Rows whose short URL was already taken
+	Errors   []ImportError `json:"errors"`
+}
+
+// ImportError represents a row of a CSV import that couldn't be imported, by its line in the file.
+type ImportError struct {
+	Line     int    `json:"line"`
+	ShortURL string `json:"short_url,omitempty"`
+	Error    string `json:"error"`
+}
+
+// RedirectTargetResponse represents the destination of a short URL, returned instead of a redirect
+// to clients asking for JSON.
+type RedirectTargetResponse struct {
+	ShortURL    string    `json:"short_url"`
+	OriginalURL string    `json:"original_url"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// URLPatchRequest represents the request structure for partially updating a short URL.
+// Omitted fields are left unchanged.
+type URLPatchRequest struct {
+	URL *string `json:"url,omitempty" validate:"omitempty,url"`
+	TTL *string `json:"ttl,omitempty"` // New lifetime from now as a Go duration string, e.g. "24h"
+	// Alias moves the short URL to a new path
+	Alias *string `json:"alias,omitempty"`
+}
+
 // URLResponse represents the response structure for URL-related operations.
 type URLResponse struct {
+	ShortURL    string     `json:"short_url"`
+	ShortLink   string     `json:"short_link,omitempty"` // Absolute URL of ShortURL, set when a base URL is configured
+	OriginalURL string     `json:"original_url"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	Code        string     `json:"code,omitempty"`
+	ExternalID  string     `json:"external_id,omitempty"`
+	// Created reports on create responses whether this request minted ShortURL, rather than finding
+	// the URL already shortened. It is omitted from every other response.
+	Created *bool `json:"created,omitempty"`
+	// LastCheckedAt and LastStatus report the latest reachability check, omitted until the first one.
+	// A check that could not reach the destination has a LastCheckedAt but no LastStatus.
+	LastCheckedAt *time.Time `json:"last_checked_at,omitempty"`
+	LastStatus    int        `json:"last_status,omitempty"`
+	// DeletedAt is set on soft-deleted URLs, which are only listed until they are purged or restored.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// AccessCount is the number of redirects through ShortURL, only set by the most-visited listing.
+	AccessCount *int64 `json:"access_count,omitempty"`
+	// Timings breaks down where a create spent its time, only set when the server is configured to report it.
+	Timings *CreateTimings `json:"timings,omitempty"`
+}
+
+// CreateTimings reports in milliseconds how long a create spent generating short URLs, deriving
+// the deduplication key and in the storage, which looks the key up and stores the URL in one call.
+type CreateTimings struct {
+	GenerationMS   float64 `json:"generation_ms"`
+	DedupKeyMS     float64 `json:"dedup_key_ms"`
+	StorageWriteMS float64 `json:"storage_write_ms"`
+}
+
+// URLListResponse represents the response structure for endpoints listing several URLs.
+type URLListResponse struct {
+	URLs []URLResponse `json:"urls"`
+}
+
+// URLPageResponse represents the response structure for one page of the paginated URL listing.
+type URLPageResponse struct {
+	Items []URLResponse `json:"items"`
+	Total int           `json:"total"`
+	Page  int           `json:"page"`
+}
+
+// BatchURLRequest represents the request structure for creating several short URLs at once.
+type BatchURLRequest struct {
+	URLs []string `json:"urls"`
+}
+
+// BatchURLResult represents the outcome of one URL of a batch create. Status is the HTTP status
+// the URL would have received from a single create. The URLResponse fields are only present when
+// a short URL was created, with Status 201, or already existed, with Status 200, and Error is set
+// whenever Status is neither.
+type BatchURLResult struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+	*URLResponse
+	Error string `json:"error,omitempty"`
+}
+
+// BatchURLResponse represents the response structure for a batch create, with one result per requested URL.
+type BatchURLResponse struct {
+	Results []BatchURLResult `json:"results"`
+}
+
+// BatchJobResponse represents the response structure for an asynchronous batch create job.
+// Status is "running" or "completed", and Results, in request order, are only present once completed.
+type BatchJobResponse struct {
+	ID          string           `json:"id"`
+	Status      string           `json:"status"`
+	Total       int              `json:"total"`
+	Processed   int              `json:"processed"`
+	CreatedAt   time.Time        `json:"created_at"`
+	CompletedAt *time.Time       `json:"completed_at,omitempty"`
+	Results     []BatchURLResult `json:"results,omitempty"`
+}
+
+// URLStatsResponse represents the response structure for the per-URL statistics endpoint.
+type URLStatsResponse struct {
 	ShortURL    string    `json:"short_url"`
-	OriginalURL string    `json:"original_url"`
+	AccessCount int64     `json:"access_count"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// RuntimeStatsResponse represents the response structure for the admin runtime diagnostics endpoint.
+type RuntimeStatsResponse struct {
+	Goroutines       int    `json:"goroutines"`
+	HeapAllocBytes   uint64 `json:"heap_alloc_bytes"`
+	RateLimitClients int64  `json:"rate_limit_clients"`
+	// Storage is omitted when the storage backend doesn't report its usage
+	Storage *StorageStats `json:"storage,omitempty"`
+}
+
+// StorageStats represents the usage of a storage backend that enforces a capacity.
+type StorageStats struct {
+	Count    int `json:"count"`
+	Capacity int `json:"capacity"`
+}
+
+// StatusCountsResponse represents the response structure for the per-status-class response counters.
+type StatusCountsResponse struct {
+	Status2xx int64 `json:"2xx"`
+	Status3xx int64 `json:"3xx"`
+	Status4xx int64 `json:"4xx"`
+	Status5xx int64 `json:"5xx"`
+}
+
 // URLData represents the internal structure for storing URL data.
 type URLData struct {
 	ShortURL    string
 	OriginalURL string
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+	ExpiresAt   time.Time // Zero value means the URL never expires
+	Tags        []string
+	DedupKey    string // Key used to detect duplicate submissions; empty means OriginalURL
+	ExternalID  string // Unique reference supplied by the client at creation; empty means none
+	AccessCount int64  // Number of successful redirects through the short URL
+	// LastCheckedAt and LastStatus hold the latest reachability check of OriginalURL. LastCheckedAt
+	// is zero if it was never checked, and LastStatus is 0 if the destination could not be reached.
+	LastCheckedAt time.Time
+	LastStatus    int
+	DeletedAt     time.Time // Time the URL was soft-deleted at; zero value means it is not deleted
+}
+
+// LookupKey returns the key under which the URL is indexed for deduplication.
+func (u URLData) LookupKey() string {
+	if u.DedupKey != "" {
+		return u.DedupKey
+	}
+	return u.OriginalURL
+}
+
+// Expired reports whether the URL has expired at the given time.
+// A URL with an ExpiresAt equal to now is already considered expired.
+func (u URLData) Expired(now time.Time) bool {
+	return !u.ExpiresAt.IsZero() && !now.Before(u.ExpiresAt)
+}
+
+// Deleted reports whether the URL was soft-deleted.
+func (u URLData) Deleted() bool {
+	return !u.DeletedAt.IsZero()
 }
 
 // URLRequest represents the request structure for creating or updating a short URL.
 type URLRequest struct {
-	URL string `json:"url" validate:"required,url"`
+	URL  string   `json:"url" validate:"required,url"`
+	TTL  string   `json:"ttl,omitempty"` // Optional lifetime as a Go duration string, e.g. "24h"
+	Tags []string `json:"tags,omitempty" validate:"max=10,dive,required,max=32,excludesall=0x2C"`
+	// Alias, when set, is used as the short URL instead of a generated one
+	Alias string `json:"alias,omitempty"`
+	// ExternalID, when set, is a unique reference of the client's own to look the short URL up by.
+	// It is only accepted at creation, when the server has external IDs enabled.
+	ExternalID string `json:"external_id,omitempty" validate:"max=128"`
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -52,3 +53,24 @@ func TestURLRequestValidationTag(t *testing.T) {
 	tag := field.Tag.Get("validate")
 	require.Equal(t, "required,url", tag, "Unexpected validate tag for URL field")
 }
+
+func TestURLDataExpired(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		expected  bool
+	}{
+		{name: "Zero ExpiresAt never expires", expiresAt: time.Time{}, expected: false},
+		{name: "Expires in the future", expiresAt: now.Add(time.Nanosecond), expected: false},
+		{name: "Expires exactly now", expiresAt: now, expected: true},
+		{name: "Expired in the past", expiresAt: now.Add(-time.Nanosecond), expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, URLData{ExpiresAt: tt.expiresAt}.Expired(now))
+		})
+	}
+}
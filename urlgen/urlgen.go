@@ -3,6 +3,8 @@ package urlgen
 
 import (
 	"crypto/rand"
+	"errors"
+	"math"
 	"math/big"
 	"strings"
 )
@@ -13,19 +15,87 @@ const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 // shortURLLength defines the length of the generated short URLs.
 const shortURLLength = 8
 
+// DefaultCharset and DefaultLength expose the built-in short URL format
+// so callers can fall back to it when no custom format is configured.
+const (
+	DefaultCharset = charset
+	DefaultLength  = shortURLLength
+)
+
+// Generator creates short URL strings of a fixed length from a fixed alphabet.
+type Generator struct {
+	length  int
+	charset string
+}
+
+// defaultGenerator produces short URLs in the built-in format.
+var defaultGenerator = &Generator{length: shortURLLength, charset: charset}
+
+// NewGenerator creates a Generator for short URLs of the given length using the given alphabet.
+// It returns an error if length is not positive or charset is empty.
+func NewGenerator(length int, charset string) (*Generator, error) {
+	if length <= 0 {
+		return nil, errors.New("short URL length must be positive")
+	}
+	if charset == "" {
+		return nil, errors.New("short URL charset cannot be empty")
+	}
+	return &Generator{length: length, charset: charset}, nil
+}
+
 // Generate creates a new short URL string.
+func (g *Generator) Generate() (string, error) {
+	return generate(g.length, g.charset)
+}
+
+// Generate creates a new short URL string in the built-in format.
 func Generate() (string, error) {
+	return defaultGenerator.Generate()
+}
+
+// GenerateWith creates a new short URL string of the given length using the given alphabet.
+func GenerateWith(length int, alphabet string) (string, error) {
+	g, err := NewGenerator(length, alphabet)
+	if err != nil {
+		return "", err
+	}
+	return g.Generate()
+}
+
+// generate creates a random string of length characters drawn uniformly from alphabet.
+func generate(length int, alphabet string) (string, error) {
 	var sb strings.Builder
-	sb.Grow(shortURLLength) // Pre-allocate the required capacity for better performance
+	sb.Grow(length) // Pre-allocate the required capacity for better performance
 
-	charsetLength := big.NewInt(int64(len(charset)))
+	charsetLength := big.NewInt(int64(len(alphabet)))
 
-	for i := 0; i < shortURLLength; i++ {
+	for i := 0; i < length; i++ {
 		randomIndex, err := rand.Int(rand.Reader, charsetLength)
 		if err != nil {
 			return "", err
 		}
-		sb.WriteByte(charset[randomIndex.Int64()])
+		sb.WriteByte(alphabet[randomIndex.Int64()])
 	}
 	return sb.String(), nil
 }
+
+// RecommendLength returns the shortest code length for which generating expectedCount
+// codes from an alphabet of charsetSize characters keeps the probability of any collision
+// at or below collisionProb. It uses the birthday-bound approximation p ≈ n² / (2·charsetSize^length).
+// It returns 0 when charsetSize < 2 or collisionProb is not in (0, 1).
+func RecommendLength(expectedCount int, collisionProb float64, charsetSize int) int {
+	if charsetSize < 2 || collisionProb <= 0 || collisionProb >= 1 {
+		return 0
+	}
+	if expectedCount < 2 {
+		return 1
+	}
+
+	n := float64(expectedCount)
+	requiredSpace := n * n / (2 * collisionProb)
+	length := int(math.Ceil(math.Log(requiredSpace) / math.Log(float64(charsetSize))))
+	if length < 1 {
+		length = 1
+	}
+	return length
+}
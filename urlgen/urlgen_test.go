@@ -70,6 +70,77 @@ func TestGenerateShortURL(t *testing.T) {
 	})
 }
 
+func TestGenerateWith(t *testing.T) {
+	shortURL, err := GenerateWith(12, "ab")
+	require.NoError(t, err)
+	require.Len(t, shortURL, 12)
+	for _, char := range shortURL {
+		assert.Contains(t, "ab", string(char), "Generated short URL should only use the custom alphabet")
+	}
+
+	_, err = GenerateWith(0, "ab")
+	assert.Error(t, err, "Non-positive length should be rejected")
+
+	_, err = GenerateWith(8, "")
+	assert.Error(t, err, "Empty charset should be rejected")
+}
+
+func TestNewGenerator(t *testing.T) {
+	generator, err := NewGenerator(5, "xyz")
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		shortURL, err := generator.Generate()
+		require.NoError(t, err)
+		require.Len(t, shortURL, 5)
+		for _, char := range shortURL {
+			assert.Contains(t, "xyz", string(char), "Generated short URL should only use the generator's alphabet")
+		}
+	}
+
+	_, err = NewGenerator(0, "xyz")
+	assert.Error(t, err, "Non-positive length should be rejected")
+
+	_, err = NewGenerator(-1, "xyz")
+	assert.Error(t, err, "Negative length should be rejected")
+
+	_, err = NewGenerator(8, "")
+	assert.Error(t, err, "Empty charset should be rejected")
+}
+
+func TestRecommendLength(t *testing.T) {
+	t.Run("Increases with expected count", func(t *testing.T) {
+		previous := 0
+		for _, count := range []int{1000, 100000, 10000000, 1000000000} {
+			length := RecommendLength(count, 1e-6, len(charset))
+			assert.GreaterOrEqual(t, length, previous, "Length should not shrink as the expected count grows")
+			previous = length
+		}
+		assert.Greater(t, RecommendLength(1000000000, 1e-6, len(charset)), RecommendLength(1000, 1e-6, len(charset)))
+	})
+
+	t.Run("Decreases with a larger charset", func(t *testing.T) {
+		small := RecommendLength(1000000, 1e-6, 16)
+		large := RecommendLength(1000000, 1e-6, len(charset))
+		assert.Greater(t, small, large)
+	})
+
+	t.Run("Meets the collision target", func(t *testing.T) {
+		length := RecommendLength(1000000, 1e-6, len(charset))
+		space := 1.0
+		for i := 0; i < length; i++ {
+			space *= float64(len(charset))
+		}
+		assert.LessOrEqual(t, 1e12/(2*space), 1e-6)
+	})
+
+	t.Run("Invalid inputs", func(t *testing.T) {
+		assert.Equal(t, 0, RecommendLength(1000, 1e-6, 1))
+		assert.Equal(t, 0, RecommendLength(1000, 0, len(charset)))
+		assert.Equal(t, 0, RecommendLength(1000, 1, len(charset)))
+		assert.Equal(t, 1, RecommendLength(1, 1e-6, len(charset)))
+	})
+}
+
 // BenchmarkGenerateShortURL measures the performance of the Generate function.
 // It's used to quantify the speed of short URL generation and detect performance regressions.
 func BenchmarkGenerateShortURL(b *testing.B) {
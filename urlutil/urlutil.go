@@ -0,0 +1,143 @@
+// Package urlutil provides URL normalization helpers for the URL shortener service.
+package urlutil
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+)
+
+// defaultPorts maps schemes to the port that is implied when none is given.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Canonicalize returns a normalized form of rawURL suitable as a deduplication key.
+// Equivalent URLs map to the same key: the scheme and host are lowercased, IP literals are
+// rewritten in their canonical form (e.g. [0:0:0:0:0:0:0:1] as [::1]), default ports and
+// fragments are dropped, an empty path becomes "/" and query parameters are sorted.
+// The result is only meant for comparisons; the URL a user submitted should be stored verbatim.
+func Canonicalize(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", errors.New("url must be absolute")
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := u.Hostname(), u.Port()
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if addr, ok := HostIP(u); ok {
+		host = addr.String()
+	}
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]" // IPv6 literals keep their brackets
+	} else {
+		u.Host = host
+	}
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.RawPath = ""
+	u.Fragment = ""
+	u.RawFragment = ""
+	// Encode sorts by key; values of repeated keys keep their relative order
+	u.RawQuery = u.Query().Encode()
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+// NormalizeURL prefixes rawURL with defaultScheme when it has no scheme of its own, so that
+// "example.com/path" and the scheme-relative "//example.com/path" both become
+// "https://example.com/path" with defaultScheme "https". A host with a port, as in
+// "example.com:8080", is not mistaken for a scheme. URLs with a scheme are returned unchanged.
+func NormalizeURL(rawURL, defaultScheme string) string {
+	if strings.HasPrefix(rawURL, "//") {
+		return defaultScheme + ":" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err == nil && u.Scheme != "" && !startsWithPort(u.Opaque) {
+		return rawURL
+	}
+	return defaultScheme + "://" + rawURL
+}
+
+// startsWithPort reports whether s, the part of a URL after what parsed as its scheme, starts with
+// a port number ending the host, as in the "8080/path" of "example.com:8080/path".
+func startsWithPort(s string) bool {
+	port, _, _ := strings.Cut(s, "/")
+	if port == "" {
+		return false
+	}
+	for _, r := range port {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// HostIP returns the address of the host of u when it is an IPv4 or IPv6 literal, such as
+// 127.0.0.1 or [::1]. IPv4-mapped IPv6 addresses like [::ffff:127.0.0.1] are returned as the
+// IPv4 address they reach.
+func HostIP(u *url.URL) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(u.Hostname())
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// IsInternalHost reports whether the host of u addresses this machine or a private network: the
+// name localhost or a name under it, or an IP literal that is loopback, private, link-local or
+// unspecified. Such destinations would make the service reach into its own network when
+// fetching them. Names resolving to internal addresses are not detected.
+func IsInternalHost(u *url.URL) bool {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	addr, ok := HostIP(u)
+	return ok && IsInternalAddr(addr)
+}
+
+// IsInternalAddr reports whether addr is loopback (127.0.0.0/8, ::1), private (RFC 1918 and
+// fc00::/7), link-local (169.254.0.0/16, fe80::/10), unspecified or an interface-local multicast
+// address. IPv4-mapped IPv6 addresses are classified as the IPv4 address they reach.
+func IsInternalAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast()
+}
+
+// HasDuplicateQueryKeys reports whether the query string of u repeats a key, once decoded,
+// as in ?a=1&a=2 or ?a=1&%61=2.
+func HasDuplicateQueryKeys(u *url.URL) bool {
+	seen := make(map[string]bool)
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(pair, "=")
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if seen[key] {
+			return true
+		}
+		seen[key] = true
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package urlutil
+
+import (
+	"net/netip"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "Already canonical", input: "https://example.com/path?a=1", expected: "https://example.com/path?a=1"},
+		{name: "Scheme and host are lowercased", input: "HTTPS://Example.COM/Path", expected: "https://example.com/Path"},
+		{name: "Default HTTPS port is dropped", input: "https://example.com:443/", expected: "https://example.com/"},
+		{name: "Default HTTP port is dropped", input: "http://example.com:80/", expected: "http://example.com/"},
+		{name: "Other ports are kept", input: "https://example.com:8443/", expected: "https://example.com:8443/"},
+		{name: "Empty path becomes root", input: "https://example.com", expected: "https://example.com/"},
+		{name: "Fragment is dropped", input: "https://example.com/page#section", expected: "https://example.com/page"},
+		{name: "Query parameters are sorted", input: "https://example.com/?b=2&a=1", expected: "https://example.com/?a=1&b=2"},
+		{name: "Empty query is dropped", input: "https://example.com/?", expected: "https://example.com/"},
+		{name: "Trailing dot in host is dropped", input: "https://example.com./", expected: "https://example.com/"},
+		{name: "IPv6 literal", input: "http://[::1]:80/", expected: "http://[::1]/"},
+		{name: "Expanded IPv6 literal", input: "http://[0:0:0:0:0:0:0:1]/", expected: "http://[::1]/"},
+		{name: "Uppercase IPv6 literal with port", input: "http://[2001:DB8:0::1]:8080/", expected: "http://[2001:db8::1]:8080/"},
+		{name: "IPv4-mapped IPv6 literal", input: "http://[::ffff:127.0.0.1]/", expected: "http://127.0.0.1/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			canonical, err := Canonicalize(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, canonical)
+		})
+	}
+
+	t.Run("Relative URLs are rejected", func(t *testing.T) {
+		_, err := Canonicalize("/just/a/path")
+		assert.Error(t, err)
+	})
+
+	t.Run("Malformed URLs are rejected", func(t *testing.T) {
+		_, err := Canonicalize("http://%zz")
+		assert.Error(t, err)
+	})
+}
+
+func TestIsInternalHost(t *testing.T) {
+	tests := []struct {
+		url      string
+		internal bool
+	}{
+		{url: "http://localhost:8080/", internal: true},
+		{url: "http://api.localhost./", internal: true},
+		{url: "http://127.0.0.1/", internal: true},
+		{url: "http://[::1]/", internal: true},
+		{url: "http://[0:0:0:0:0:0:0:1]/", internal: true},
+		{url: "http://[::ffff:127.0.0.1]/", internal: true},
+		{url: "http://10.1.2.3/", internal: true},
+		{url: "http://[fd00::1]/", internal: true},
+		{url: "http://169.254.169.254/latest/meta-data", internal: true},
+		{url: "http://[fe80::1%25eth0]/", internal: true},
+		{url: "http://0.0.0.0/", internal: true},
+		{url: "http://[::]/", internal: true},
+		{url: "https://93.184.215.14/", internal: false},
+		{url: "https://[2606:4700::1111]/", internal: false},
+		{url: "https://example.com/", internal: false},
+		{url: "https://localhost.example.com/", internal: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			require.NoError(t, err)
+			assert.Equal(t, tt.internal, IsInternalHost(u))
+		})
+	}
+
+	t.Run("Equivalent notations share a host IP", func(t *testing.T) {
+		short, err := url.Parse("http://[::1]/")
+		require.NoError(t, err)
+		expanded, err := url.Parse("http://[0:0:0:0:0:0:0:1]/")
+		require.NoError(t, err)
+
+		shortIP, ok := HostIP(short)
+		require.True(t, ok)
+		expandedIP, ok := HostIP(expanded)
+		require.True(t, ok)
+		assert.Equal(t, shortIP, expandedIP)
+		assert.True(t, shortIP.IsLoopback())
+
+		_, ok = HostIP(&url.URL{Host: "example.com"})
+		assert.False(t, ok)
+	})
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "example.com", expected: "https://example.com"},
+		{input: "example.com/path?q=1", expected: "https://example.com/path?q=1"},
+		{input: "//example.com/path", expected: "https://example.com/path"},
+		{input: "example.com:8080/path", expected: "https://example.com:8080/path"},
+		{input: "localhost:3000", expected: "https://localhost:3000"},
+		{input: "https://example.com", expected: "https://example.com"},
+		{input: "http://example.com", expected: "http://example.com"},
+		{input: "ftp://files.example.com", expected: "ftp://files.example.com"},
+		{input: "mailto:someone@example.com", expected: "mailto:someone@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expected, NormalizeURL(tt.input, "https"))
+		})
+	}
+}
+
+func TestIsInternalAddr(t *testing.T) {
+	tests := []struct {
+		addr     string
+		internal bool
+	}{
+		{addr: "127.0.0.1", internal: true},
+		{addr: "::1", internal: true},
+		{addr: "10.0.0.1", internal: true},
+		{addr: "172.16.5.4", internal: true},
+		{addr: "192.168.1.1", internal: true},
+		{addr: "169.254.169.254", internal: true},
+		{addr: "fc00::1", internal: true},
+		{addr: "fdff:ffff::1", internal: true},
+		{addr: "fe80::1", internal: true},
+		{addr: "::ffff:10.0.0.1", internal: true},
+		{addr: "172.32.0.1", internal: false},
+		{addr: "93.184.215.14", internal: false},
+		{addr: "2606:4700::1111", internal: false},
+		{addr: "fe00::1", internal: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			assert.Equal(t, tt.internal, IsInternalAddr(netip.MustParseAddr(tt.addr)))
+		})
+	}
+}
+
+func TestHasDuplicateQueryKeys(t *testing.T) {
+	tests := []struct {
+		query     string
+		duplicate bool
+	}{
+		{query: "", duplicate: false},
+		{query: "a=1&b=2", duplicate: false},
+		{query: "a=1&a=2", duplicate: true},
+		{query: "a&a", duplicate: true},
+		{query: "a=1&%61=2", duplicate: true},
+		{query: "a+b=1&a%20b=2", duplicate: true},
+		{query: "a=1&&b=2", duplicate: false},
+		{query: "a=1&A=2", duplicate: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			assert.Equal(t, tt.duplicate, HasDuplicateQueryKeys(&url.URL{RawQuery: tt.query}))
+		})
+	}
+}
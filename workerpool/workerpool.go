@@ -0,0 +1,134 @@
+// Package workerpool runs the background tasks of the URL shortener service on a bounded
+// number of goroutines.
+package workerpool
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Task is a unit of background work. Its context is cancelled when the pool is stopped.
+type Task func(ctx context.Context)
+
+// Pool runs tasks on a fixed number of worker goroutines. Tasks wait for a free worker in a queue of
+// fixed size, so a long-running task, such as a full reachability pass, delays the others while it
+// holds a worker, and tasks are rejected once the queue is full.
+type Pool struct {
+	tasks   chan Task // Buffered: the tasks waiting for a free worker
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
+
+	mu      sync.Mutex
+	stopped bool
+	timers  map[*time.Timer]struct{} // Timers that will queue a task once they fire
+	pending sync.WaitGroup           // Timers that fired and are queueing their task
+}
+
+// New starts a pool of size workers, queueing up to queueSize tasks while they are all busy.
+// Non-positive sizes mean 1.
+func New(size, queueSize int) *Pool {
+	if size <= 0 {
+		size = 1
+	}
+	if queueSize <= 0 {
+		queueSize = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		tasks:  make(chan Task, queueSize),
+		ctx:    ctx,
+		cancel: cancel,
+		timers: make(map[*time.Timer]struct{}),
+	}
+	p.workers.Add(size)
+	for i := 0; i < size; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// Go queues task to run once on the pool, without waiting for a worker to be free. It returns
+// false, dropping task, when the queue is full or the pool is stopped.
+func (p *Pool) Go(task Task) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return false
+	}
+	select {
+	case p.tasks <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+// Schedule runs task on the pool right away, then again interval after each run completes, until
+// the pool is stopped. Runs of a task never overlap, and ticks don't pile up behind a slow run: a
+// run finding the queue full is tried again interval later.
+func (p *Pool) Schedule(interval time.Duration, task Task) {
+	var run Task
+	run = func(ctx context.Context) {
+		task(ctx)
+		p.after(interval, interval, run)
+	}
+	p.after(0, interval, run)
+}
+
+// Stop cancels the context of running tasks, drops the queued and scheduled ones, and waits for
+// every goroutine of the pool to exit. It is safe to call more than once.
+func (p *Pool) Stop() {
+	p.mu.Lock()
+	p.stopped = true
+	for timer := range p.timers {
+		if timer.Stop() {
+			p.pending.Done()
+		}
+		delete(p.timers, timer)
+	}
+	p.mu.Unlock()
+
+	p.cancel()
+	p.pending.Wait()
+	p.workers.Wait()
+}
+
+// after queues task once delay has elapsed, unless the pool is stopped by then, trying again every
+// retry while the queue is full.
+func (p *Pool) after(delay, retry time.Duration, task Task) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped {
+		return
+	}
+
+	p.pending.Add(1)
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		defer p.pending.Done()
+		// Also waits for timer to be assigned, as after holds the lock until then
+		p.mu.Lock()
+		delete(p.timers, timer)
+		p.mu.Unlock()
+
+		if !p.Go(task) {
+			p.after(retry, retry, task)
+		}
+	})
+	p.timers[timer] = struct{}{}
+}
+
+// work runs tasks until the pool is stopped.
+func (p *Pool) work() {
+	defer p.workers.Done()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case task := <-p.tasks:
+			task(p.ctx)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package workerpool
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPool(t *testing.T) {
+	t.Run("Tasks run on at most size workers", func(t *testing.T) {
+		pool := New(2, 10)
+		defer pool.Stop()
+
+		var running, maxRunning, done atomic.Int32
+		for i := 0; i < 10; i++ {
+			pool.Go(func(context.Context) {
+				current := running.Add(1)
+				for {
+					max := maxRunning.Load()
+					if current <= max || maxRunning.CompareAndSwap(max, current) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				running.Add(-1)
+				done.Add(1)
+			})
+		}
+
+		require.Eventually(t, func() bool { return done.Load() == 10 }, time.Second, time.Millisecond)
+		assert.Equal(t, int32(2), maxRunning.Load())
+	})
+
+	t.Run("Scheduled tasks run repeatedly without overlapping", func(t *testing.T) {
+		pool := New(4, 10)
+		defer pool.Stop()
+
+		var runs, running atomic.Int32
+		var overlapped atomic.Bool
+		pool.Schedule(time.Millisecond, func(context.Context) {
+			if running.Add(1) > 1 {
+				overlapped.Store(true)
+			}
+			time.Sleep(2 * time.Millisecond)
+			running.Add(-1)
+			runs.Add(1)
+		})
+
+		require.Eventually(t, func() bool { return runs.Load() >= 5 }, time.Second, time.Millisecond)
+		assert.False(t, overlapped.Load())
+	})
+
+	t.Run("Stop cancels running tasks and leaks no goroutines", func(t *testing.T) {
+		baseline := runtime.NumGoroutine()
+		pool := New(3, 10)
+
+		started := make(chan struct{})
+		var cancelled, ranAfterStop atomic.Bool
+		pool.Go(func(ctx context.Context) {
+			close(started)
+			<-ctx.Done()
+			cancelled.Store(true)
+		})
+		pool.Schedule(time.Hour, func(context.Context) {})
+		<-started
+
+		pool.Stop()
+		assert.True(t, cancelled.Load(), "Stop should wait for running tasks")
+
+		assert.False(t, pool.Go(func(context.Context) { ranAfterStop.Store(true) }), "Tasks should be rejected after Stop")
+		pool.Stop()
+		assert.False(t, ranAfterStop.Load(), "Tasks queued after Stop never run")
+
+		// Polled by hand, as assert.Eventually runs the condition on a goroutine of its own
+		deadline := time.Now().Add(time.Second)
+		for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.LessOrEqual(t, runtime.NumGoroutine(), baseline, "Every goroutine of the pool should have exited")
+	})
+
+	t.Run("Tasks are rejected once the queue is full", func(t *testing.T) {
+		pool := New(1, 2)
+		defer pool.Stop()
+
+		started, release := make(chan struct{}), make(chan struct{})
+		require.True(t, pool.Go(func(context.Context) {
+			close(started)
+			<-release
+		}))
+		<-started
+
+		var ran atomic.Int32
+		assert.True(t, pool.Go(func(context.Context) { ran.Add(1) }))
+		assert.True(t, pool.Go(func(context.Context) { ran.Add(1) }))
+		assert.False(t, pool.Go(func(context.Context) { ran.Add(1) }), "The queue holds 2 tasks")
+
+		close(release)
+		require.Eventually(t, func() bool { return ran.Load() == 2 }, time.Second, time.Millisecond)
+		assert.True(t, pool.Go(func(context.Context) { ran.Add(1) }), "Tasks should be accepted again once the queue drains")
+	})
+
+	t.Run("Scheduled runs wait for room in the queue", func(t *testing.T) {
+		pool := New(1, 1)
+		defer pool.Stop()
+
+		started, release := make(chan struct{}), make(chan struct{})
+		require.True(t, pool.Go(func(context.Context) {
+			close(started)
+			<-release
+		}))
+		<-started
+		require.True(t, pool.Go(func(context.Context) {}))
+
+		ran := make(chan struct{}, 1)
+		pool.Schedule(time.Millisecond, func(context.Context) {
+			select {
+			case ran <- struct{}{}:
+			default:
+			}
+		})
+		time.Sleep(10 * time.Millisecond)
+		assert.Empty(t, ran, "The scheduled task should wait while the queue is full")
+
+		close(release)
+		select {
+		case <-ran:
+		case <-time.After(time.Second):
+			t.Fatal("Scheduled task did not run once the queue drained")
+		}
+	})
+
+	t.Run("Non-positive sizes mean one worker and one queued task", func(t *testing.T) {
+		pool := New(0, 0)
+		defer pool.Stop()
+
+		done := make(chan struct{})
+		pool.Go(func(context.Context) { close(done) })
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Task did not run")
+		}
+	})
+}